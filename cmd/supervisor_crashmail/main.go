@@ -0,0 +1,153 @@
+// Command supervisor_crashmail is a Supervisor event listener which sends an email or posts to a
+// webhook when a process exits unexpectedly, backs off or becomes FATAL. It replaces superlance's
+// crashmail:
+//
+//	[eventlistener:crashmail]
+//	command=supervisor_crashmail -smtp localhost:25 -to ops@example.com
+//	events=PROCESS_STATE
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultServerURL string = "http://localhost:9001"
+)
+
+// listFlags collects repeated or comma separated flag values.
+type listFlags []string
+
+func (list *listFlags) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *listFlags) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*list = append(*list, item)
+		}
+	}
+	return nil
+}
+
+// notifyOptions configures how notifications are delivered.
+type notifyOptions struct {
+	smtpAddress  string
+	smtpUser     string
+	smtpPassword string
+	from         string
+	to           listFlags
+	webhook      string
+}
+
+// notifier creates the notifier selected by the options.
+func (opts notifyOptions) notifier() (supervisor.Notifier, error) {
+	var notifiers supervisor.MultiNotifier
+	if opts.smtpAddress != "" {
+		if len(opts.to) == 0 {
+			return nil, errors.New("-smtp requires -to")
+		}
+		mail := supervisor.NewSmtpNotifier(opts.smtpAddress, opts.from, opts.to...)
+		if opts.smtpUser != "" {
+			host, _, err := net.SplitHostPort(opts.smtpAddress)
+			if err != nil {
+				return nil, err
+			}
+			mail.Auth = smtp.PlainAuth("", opts.smtpUser, opts.smtpPassword, host)
+		}
+		notifiers = append(notifiers, mail)
+	}
+	if opts.webhook != "" {
+		notifiers = append(notifiers, supervisor.NewWebhookNotifier(opts.webhook))
+	}
+	if len(notifiers) == 0 {
+		return nil, errors.New("one of -smtp or -webhook is required")
+	}
+	return notifiers, nil
+}
+
+// run executes the command line and returns the exit code.
+func run(args []string) int {
+	var serverURL, username, password, subject, body string
+	var tail int64
+	var processes, states listFlags
+	var limit supervisor.RateLimit
+	var global bool
+	notify := notifyOptions{}
+
+	flags := flag.NewFlagSet("supervisor_crashmail", flag.ContinueOnError)
+	flags.StringVar(&serverURL, "s", defaultServerURL, "URL on which supervisord server is listening")
+	flags.StringVar(&username, "u", "", "username to use for authentication with server")
+	flags.StringVar(&password, "p", "", "password to use for authentication with server")
+	flags.StringVar(&notify.smtpAddress, "smtp", "", "host:port of an SMTP server to send mail through")
+	flags.StringVar(&notify.smtpUser, "smtp.user", "", "username to authenticate with the SMTP server")
+	flags.StringVar(&notify.smtpPassword, "smtp.password", "", "password to authenticate with the SMTP server")
+	flags.StringVar(&notify.from, "from", "supervisor@localhost", "sender of mail")
+	flags.Var(&notify.to, "to", "recipient of mail, may be repeated")
+	flags.StringVar(&notify.webhook, "webhook", "", "URL to post notifications to as JSON")
+	flags.Var(&processes, "program", "group, name or group:name to notify for, may be repeated (default all)")
+	flags.Var(&states, "state", "state to notify for, may be repeated (default EXITED,BACKOFF,FATAL)")
+	flags.Int64Var(&tail, "tail", supervisor.DefaultCrashTail, "bytes of the stderr log to include")
+	flags.StringVar(&subject, "subject", supervisor.DefaultCrashSubject, "template of the notification subject")
+	flags.StringVar(&body, "body", "", "file containing the template of the notification body")
+	flags.IntVar(&limit.Burst, "limit", 0, "notifications sent at once before limiting (default no limit)")
+	flags.DurationVar(&limit.Interval, "limit.interval", 10*time.Minute, "time after which another notification is allowed")
+	flags.BoolVar(&global, "limit.global", false, "limit all notifications together instead of each process")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	notifier, err := notify.notifier()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 2
+	}
+
+	client, err := supervisor.DialClient(serverURL, username, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", serverURL, err)
+		return 1
+	}
+	defer client.Close()
+
+	crashes := supervisor.NewCrashNotifier(client, notifier)
+	if crashes.Subject, err = template.New("subject").Parse(subject); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 2
+	}
+	if body != "" {
+		if crashes.Body, err = template.ParseFiles(body); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return 2
+		}
+	}
+	if len(states) > 0 {
+		crashes.States = states
+	}
+	crashes.Processes = processes
+	crashes.TailBytes = tail
+	crashes.Limit = limit
+	crashes.LimitPerProcess = !global
+	crashes.OnError = func(err error) {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
+
+	if err := crashes.Run(supervisor.NewListener(os.Stdin, os.Stdout)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
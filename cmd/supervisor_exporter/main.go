@@ -0,0 +1,174 @@
+// Command supervisor_exporter exposes Supervisor and process metrics for Prometheus. The metrics
+// can also be pushed to StatsD or a Pushgateway for environments which do not scrape. It polls
+// Supervisor or, with -listen, runs as a Supervisor event listener which also counts events:
+//
+//	[eventlistener:exporter]
+//	command=supervisor_exporter -listen -web.listen-address :9876
+//	events=EVENT
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultServerURL     string = "http://localhost:9001"
+	defaultListenAddress string = ":9876"
+	defaultMetricsPath   string = "/metrics"
+)
+
+// tagFlags collects repeated -tag key=value flags.
+type tagFlags map[string]string
+
+func (tags tagFlags) String() string {
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (tags tagFlags) Set(value string) error {
+	pair := strings.SplitN(value, "=", 2)
+	if len(pair) != 2 || pair[0] == "" {
+		return errors.New(fmt.Sprintf("invalid tag %q, want key=value", value))
+	}
+	tags[pair[0]] = pair[1]
+	return nil
+}
+
+// pushOptions configures pushing metrics.
+type pushOptions struct {
+	statsdAddress string
+	statsdPrefix  string
+	dogstatsd     bool
+	gatewayURL    string
+	gatewayJob    string
+	openMetrics   bool
+	interval      time.Duration
+	tags          tagFlags
+}
+
+// pushers creates the pushers selected by the options.
+func (opts pushOptions) pushers() (pushers []supervisor.Pusher, err error) {
+	if opts.statsdAddress != "" {
+		var statsd supervisor.StatsdPusher
+		if statsd, err = supervisor.NewStatsdPusher(opts.statsdAddress, opts.statsdPrefix, opts.dogstatsd); err != nil {
+			return
+		}
+		for key, value := range opts.tags {
+			statsd.Tags[key] = value
+		}
+		pushers = append(pushers, statsd)
+	}
+	if opts.gatewayURL != "" {
+		url := supervisor.PushgatewayURL(opts.gatewayURL, opts.gatewayJob, nil)
+		gateway := supervisor.NewHttpPusher(url, supervisor.MetricsNamespace)
+		gateway.OpenMetrics = opts.openMetrics
+		for key, value := range opts.tags {
+			gateway.Tags[key] = value
+		}
+		pushers = append(pushers, gateway)
+	}
+	return
+}
+
+// run executes the command line and returns the exit code.
+func run(args []string) int {
+	var serverURL, username, password, address, path string
+	var listen bool
+	config := supervisor.DefaultPollConfig
+
+	flags := flag.NewFlagSet("supervisor_exporter", flag.ContinueOnError)
+	flags.StringVar(&serverURL, "s", defaultServerURL, "URL on which supervisord server is listening")
+	flags.StringVar(&username, "u", "", "username to use for authentication with server")
+	flags.StringVar(&password, "p", "", "password to use for authentication with server")
+	flags.StringVar(&address, "web.listen-address", defaultListenAddress, "address on which to expose metrics")
+	flags.StringVar(&path, "web.telemetry-path", defaultMetricsPath, "path under which to expose metrics")
+	flags.DurationVar(&config.Interval, "interval", config.Interval, "time between polls")
+	flags.BoolVar(&listen, "listen", false, "run as a supervisor event listener on stdin and stdout")
+	push := pushOptions{tags: make(tagFlags)}
+	flags.StringVar(&push.statsdAddress, "statsd.address", "", "host:port of a StatsD server to push metrics to")
+	flags.StringVar(&push.statsdPrefix, "statsd.prefix", supervisor.MetricsNamespace+".", "prefix of StatsD metric names")
+	flags.BoolVar(&push.dogstatsd, "statsd.dogstatsd", false, "send labels as DogStatsD tags")
+	flags.StringVar(&push.gatewayURL, "push.url", "", "base URL of a Pushgateway to push metrics to")
+	flags.StringVar(&push.gatewayJob, "push.job", "supervisor", "job name used when pushing to a Pushgateway")
+	flags.BoolVar(&push.openMetrics, "push.openmetrics", false, "push in the OpenMetrics text format")
+	flags.DurationVar(&push.interval, "push.interval", 10*time.Second, "time between pushes")
+	flags.Var(push.tags, "tag", "key=value tag added to pushed metrics, may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	pushers, err := push.pushers()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 2
+	}
+
+	client, err := supervisor.DialClient(serverURL, username, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", serverURL, err)
+		return 1
+	}
+	defer client.Close()
+
+	events := make(chan interface{})
+	metrics := supervisor.NewMetrics(nil)
+	observed := client.WithObserver(metrics.ObserveRpc)
+	metrics.Client = &observed
+	var mon supervisor.Monitor
+	if listen {
+		mon = supervisor.NewMonitorWithClient(observed, os.Stdin, os.Stdout, events)
+		mon.ForwardEvents = true
+		mon.RefreshOnGap = true
+	} else {
+		mon = supervisor.NewMonitorWithClient(observed, nil, nil, events)
+	}
+	go metrics.Run(events)
+
+	pushErrs := make(chan error)
+	for _, pusher := range pushers {
+		go metrics.PushEvery(pusher, push.interval, nil, pushErrs)
+	}
+	go func() {
+		for err := range pushErrs {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle(path, metrics)
+	server := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 2)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	go func() {
+		if listen {
+			if err := mon.Refresh(); err != nil {
+				events <- supervisor.RefreshErrorEvent{Supervisor: *mon.Supervisor, Error: err, Failures: 1}
+			}
+			errs <- mon.Run()
+		} else {
+			errs <- mon.Poll(config, nil)
+		}
+	}()
+
+	if err := <-errs; err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
@@ -0,0 +1,128 @@
+// Command supervisor_httpok is a Supervisor event listener which restarts processes that fail HTTP
+// or TCP health checks. It replaces superlance's httpok and can serve metrics about the checks:
+//
+//	[eventlistener:httpok]
+//	command=supervisor_httpok -check web:api=http://localhost:8080/health -failures 3
+//	events=TICK_60,PROCESS_STATE
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultServerURL string = "http://localhost:9001"
+)
+
+// checkFlags collects repeated name=URL flags.
+type checkFlags []supervisor.HealthCheck
+
+func (checks *checkFlags) String() string {
+	pairs := make([]string, 0, len(*checks))
+	for _, check := range *checks {
+		pairs = append(pairs, check.Name+"="+check.URL)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (checks *checkFlags) Set(value string) error {
+	pair := strings.SplitN(value, "=", 2)
+	if len(pair) != 2 || pair[1] == "" {
+		return errors.New(fmt.Sprintf("invalid check %q, want name=URL", value))
+	}
+	*checks = append(*checks, supervisor.HealthCheck{Name: pair[0], URL: pair[1]})
+	return nil
+}
+
+// run executes the command line and returns the exit code.
+func run(args []string) int {
+	var serverURL, username, password, body, address string
+	var status, failures int
+	var timeout time.Duration
+	var checks checkFlags
+
+	flags := flag.NewFlagSet("supervisor_httpok", flag.ContinueOnError)
+	flags.StringVar(&serverURL, "s", defaultServerURL, "URL on which supervisord server is listening")
+	flags.StringVar(&username, "u", "", "username to use for authentication with server")
+	flags.StringVar(&password, "p", "", "password to use for authentication with server")
+	flags.Var(&checks, "check", "name=URL of a program or group to check, may be repeated")
+	flags.IntVar(&status, "status", http.StatusOK, "expected HTTP status")
+	flags.StringVar(&body, "body", "", "text the HTTP response body must contain")
+	flags.DurationVar(&timeout, "timeout", supervisor.DefaultHealthTimeout, "time allowed for each check")
+	flags.IntVar(&failures, "failures", 1, "consecutive failed checks before a process is restarted")
+	flags.StringVar(&address, "web.listen-address", "", "address on which to expose metrics (default disabled)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if len(checks) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no checks given\n")
+		return 2
+	}
+	for i := range checks {
+		checks[i].Status = status
+		checks[i].Body = body
+		checks[i].Timeout = timeout
+		checks[i].Failures = failures
+	}
+
+	client, err := supervisor.DialClient(serverURL, username, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", serverURL, err)
+		return 1
+	}
+	defer client.Close()
+
+	events := make(chan interface{})
+	mon := supervisor.NewMonitorWithClient(client, os.Stdin, os.Stdout, events)
+	mon.ForwardEvents = true
+	mon.RefreshOnGap = true
+
+	results := make(chan interface{}, 16)
+	watchdog := supervisor.NewHealthWatchdog(client, checks...)
+	watchdog.Events = results
+	go watchdog.Run(events)
+
+	metrics := supervisor.NewMetrics(nil)
+	go func() {
+		for event := range results {
+			metrics.Observe(event)
+			if event, ok := event.(supervisor.HealthCheckEvent); ok {
+				if !event.Healthy() {
+					fmt.Fprintf(os.Stderr, "%s:%s: %s\n", event.Process.Group, event.Process.Name, event.Error)
+				}
+				if event.RestartError != nil {
+					fmt.Fprintf(os.Stderr, "Error: %s\n", event.RestartError)
+				}
+			}
+		}
+	}()
+	if address != "" {
+		server := &http.Server{Addr: address, Handler: metrics, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.ListenAndServe(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			}
+		}()
+	}
+
+	if err := mon.Refresh(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", serverURL, err)
+		return 1
+	}
+	if err := mon.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
@@ -0,0 +1,102 @@
+// Command supervisor_logship is a Supervisor event listener which ships process output to files,
+// syslog, a JSON lines file descriptor or an HTTP endpoint:
+//
+//	[eventlistener:logship]
+//	command=supervisor_logship -file /var/log/supervisor/all.log -syslog /dev/log
+//	events=PROCESS_LOG
+//
+// Programs must set stdout_events_enabled and stderr_events_enabled for their output to be sent.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"os"
+	"strings"
+)
+
+// run executes the command line and returns the exit code.
+func run(args []string) int {
+	var file, syslog, url, level, programs string
+	var jsonFd int
+	var shipper supervisor.LogShipper
+
+	flags := flag.NewFlagSet("supervisor_logship", flag.ContinueOnError)
+	flags.StringVar(&file, "file", "", "file to append lines to")
+	flags.StringVar(&syslog, "syslog", "", "local syslog socket to send lines to, usually /dev/log")
+	flags.IntVar(&jsonFd, "json-fd", -1, "file descriptor to write JSON lines to, 2 for stderr")
+	flags.StringVar(&url, "http", "", "URL to post batches of JSON lines to")
+	flags.StringVar(&level, "level", "", "least severe level of lines to ship, lines without a level are dropped (default all)")
+	flags.StringVar(&programs, "programs", "", "comma separated groups, names or group:names to ship (default all)")
+	flags.IntVar(&shipper.BatchSize, "batch", supervisor.DefaultLogBatch, "lines to collect before writing")
+	flags.DurationVar(&shipper.FlushInterval, "flush", supervisor.DefaultLogFlush, "longest to hold lines before writing")
+	flags.IntVar(&shipper.MaxLine, "line.max", supervisor.DefaultLogMaxLine, "bytes after which long lines are split")
+	flags.IntVar(&shipper.MaxBuffered, "buffer", supervisor.DefaultLogBuffer, "bytes of lines to hold while a sink fails")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var filter supervisor.LogFilter
+	if level != "" {
+		var ok bool
+		if filter.Level, ok = supervisor.ParseLogLevel(level); !ok {
+			fmt.Fprintf(os.Stderr, "Error: unknown level %s\n", level)
+			return 2
+		}
+	}
+	if programs != "" {
+		filter.Processes = strings.Split(programs, ",")
+	}
+
+	var sinks supervisor.MultiLogSink
+	if file != "" {
+		sink, err := supervisor.NewFileSink(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return 1
+		}
+		sinks = append(sinks, sink)
+	}
+	if syslog != "" {
+		sinks = append(sinks, supervisor.NewSyslogSink(syslog))
+	}
+	if jsonFd >= 0 {
+		sink, err := supervisor.NewJSONSink(os.NewFile(uintptr(jsonFd), fmt.Sprintf("fd%d", jsonFd)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return 2
+		}
+		sinks = append(sinks, sink)
+	}
+	if url != "" {
+		sinks = append(sinks, supervisor.NewHttpSink(url))
+	}
+	if len(sinks) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no sinks given")
+		return 2
+	}
+
+	options := shipper
+	shipper = supervisor.NewLogShipper(sinks)
+	shipper.BatchSize = options.BatchSize
+	shipper.FlushInterval = options.FlushInterval
+	shipper.MaxLine = options.MaxLine
+	shipper.MaxBuffered = options.MaxBuffered
+	if filter.Level != "" || len(filter.Processes) > 0 {
+		shipper.Filter = &filter
+	}
+	shipper.OnError = func(err error) {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
+
+	if err := shipper.Run(supervisor.NewListener(os.Stdin, os.Stdout)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
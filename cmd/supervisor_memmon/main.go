@@ -0,0 +1,121 @@
+// Command supervisor_memmon is a Supervisor event listener which restarts processes using more
+// resident memory than their limit. It replaces superlance's memmon:
+//
+//	[eventlistener:memmon]
+//	command=supervisor_memmon -g web=200MB -g web:worker=100MB -a 1GB -c
+//	events=TICK_60,PROCESS_STATE
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"os"
+	"strings"
+)
+
+const (
+	defaultServerURL string = "http://localhost:9001"
+)
+
+// limitFlags collects repeated name=size flags.
+type limitFlags []supervisor.MemoryLimit
+
+func (limits *limitFlags) String() string {
+	pairs := make([]string, 0, len(*limits))
+	for _, limit := range *limits {
+		pairs = append(pairs, limit.Name+"="+supervisor.FormatByteSize(limit.Bytes))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (limits *limitFlags) Set(value string) error {
+	pair := strings.SplitN(value, "=", 2)
+	if len(pair) != 2 || pair[0] == "" {
+		return errors.New(fmt.Sprintf("invalid limit %q, want name=size", value))
+	}
+	size, err := supervisor.ParseByteSize(pair[1])
+	if err != nil {
+		return err
+	}
+	*limits = append(*limits, supervisor.MemoryLimit{Name: pair[0], Bytes: size})
+	return nil
+}
+
+// run executes the command line and returns the exit code.
+func run(args []string) int {
+	var serverURL, username, password, all, webhook, smtpAddress, from, to string
+	var cumulative bool
+	var limits limitFlags
+
+	flags := flag.NewFlagSet("supervisor_memmon", flag.ContinueOnError)
+	flags.StringVar(&serverURL, "s", defaultServerURL, "URL on which supervisord server is listening")
+	flags.StringVar(&username, "u", "", "username to use for authentication with server")
+	flags.StringVar(&password, "p", "", "password to use for authentication with server")
+	flags.Var(&limits, "g", "name=size limit for a program or group, may be repeated")
+	flags.StringVar(&all, "a", "", "limit for every process without its own limit")
+	flags.BoolVar(&cumulative, "c", false, "include the memory of child processes")
+	flags.StringVar(&webhook, "webhook", "", "URL to post restart notifications to as JSON")
+	flags.StringVar(&smtpAddress, "smtp", "", "host:port of an SMTP server to send restart notifications through")
+	flags.StringVar(&from, "from", "supervisor@localhost", "sender of mail")
+	flags.StringVar(&to, "to", "", "comma separated recipients of mail")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if all != "" {
+		size, err := supervisor.ParseByteSize(all)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return 2
+		}
+		limits = append(limits, supervisor.MemoryLimit{Bytes: size})
+	}
+	if len(limits) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no limits given\n")
+		return 2
+	}
+	var notifiers supervisor.MultiNotifier
+	if smtpAddress != "" {
+		notifiers = append(notifiers, supervisor.NewSmtpNotifier(smtpAddress, from, strings.Split(to, ",")...))
+	}
+	if webhook != "" {
+		notifiers = append(notifiers, supervisor.NewWebhookNotifier(webhook))
+	}
+
+	client, err := supervisor.DialClient(serverURL, username, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", serverURL, err)
+		return 1
+	}
+	defer client.Close()
+
+	events := make(chan interface{})
+	mon := supervisor.NewMonitorWithClient(client, os.Stdin, os.Stdout, events)
+	mon.ForwardEvents = true
+	mon.RefreshOnGap = true
+
+	watchdog := supervisor.NewMemoryWatchdog(client, limits...)
+	watchdog.Cumulative = cumulative
+	if len(notifiers) > 0 {
+		watchdog.Notifier = notifiers
+	}
+	watchdog.OnError = func(err error) {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
+	go watchdog.Run(events)
+
+	if err := mon.Refresh(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", serverURL, err)
+		return 1
+	}
+	if err := mon.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
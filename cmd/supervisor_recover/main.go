@@ -0,0 +1,83 @@
+// Command supervisor_recover is a Supervisor event listener which starts FATAL processes again
+// with exponential backoff, giving up and notifying after a number of attempts:
+//
+//	[eventlistener:recover]
+//	command=supervisor_recover -state /var/lib/supervisor/recover.json -limit 5 -webhook https://hooks.example.com/ops
+//	events=PROCESS_STATE
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"os"
+	"strings"
+)
+
+const (
+	defaultServerURL string = "http://localhost:9001"
+)
+
+// run executes the command line and returns the exit code.
+func run(args []string) int {
+	var serverURL, username, password, path, programs, webhook, smtpAddress, from, to string
+	var recovery supervisor.FatalRecovery
+
+	flags := flag.NewFlagSet("supervisor_recover", flag.ContinueOnError)
+	flags.StringVar(&serverURL, "s", defaultServerURL, "URL on which supervisord server is listening")
+	flags.StringVar(&username, "u", "", "username to use for authentication with server")
+	flags.StringVar(&password, "p", "", "password to use for authentication with server")
+	flags.StringVar(&path, "state", "", "file to keep retry counts in across restarts (default not kept)")
+	flags.StringVar(&programs, "programs", "", "comma separated groups, names or group:names to recover (default all)")
+	flags.DurationVar(&recovery.Backoff, "backoff", supervisor.DefaultRecoveryBackoff, "wait before the first attempt")
+	flags.DurationVar(&recovery.MaxBackoff, "backoff.max", supervisor.DefaultRecoveryMaxBackoff, "longest wait between attempts")
+	flags.IntVar(&recovery.Limit, "limit", supervisor.DefaultRecoveryLimit, "attempts before giving up, 0 for no limit")
+	flags.DurationVar(&recovery.ResetAfter, "reset", supervisor.DefaultRecoveryReset, "time a process must run for its attempts to be forgotten")
+	flags.StringVar(&webhook, "webhook", "", "URL to post notifications to as JSON")
+	flags.StringVar(&smtpAddress, "smtp", "", "host:port of an SMTP server to send notifications through")
+	flags.StringVar(&from, "from", "supervisor@localhost", "sender of mail")
+	flags.StringVar(&to, "to", "", "comma separated recipients of mail")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	var notifiers supervisor.MultiNotifier
+	if smtpAddress != "" {
+		notifiers = append(notifiers, supervisor.NewSmtpNotifier(smtpAddress, from, strings.Split(to, ",")...))
+	}
+	if webhook != "" {
+		notifiers = append(notifiers, supervisor.NewWebhookNotifier(webhook))
+	}
+
+	client, err := supervisor.DialClient(serverURL, username, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", serverURL, err)
+		return 1
+	}
+	defer client.Close()
+
+	options := recovery
+	recovery = supervisor.NewFatalRecovery(client, path)
+	recovery.Backoff = options.Backoff
+	recovery.MaxBackoff = options.MaxBackoff
+	recovery.Limit = options.Limit
+	recovery.ResetAfter = options.ResetAfter
+	if programs != "" {
+		recovery.Processes = strings.Split(programs, ",")
+	}
+	if len(notifiers) > 0 {
+		recovery.Notifier = notifiers
+	}
+	recovery.OnError = func(err error) {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
+
+	if err := recovery.Run(supervisor.NewListener(os.Stdin, os.Stdout)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
@@ -0,0 +1,79 @@
+// Command supervisor_replay replays recorded Supervisor events to an event listener. The listener
+// command is started with its stdin and stdout connected to the replayer, which takes the place of
+// supervisord and prints the result the listener returns for each event. Recordings are written by
+// a Listener with a Recorder attached.
+//
+//	supervisor_replay -speed 10 incident.rec ./mylistener -config test.conf
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"os"
+	"os/exec"
+)
+
+// run executes the command line and returns the exit code.
+func run(args []string) int {
+	var speed float64
+	flags := flag.NewFlagSet("supervisor_replay", flag.ContinueOnError)
+	flags.Float64Var(&speed, "speed", 1, "replay speed relative to the recording, 0 replays without delay")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: supervisor_replay [options] RECORDING COMMAND [ARG...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() < 2 || speed < 0 {
+		flags.Usage()
+		return 2
+	}
+
+	records, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	defer records.Close()
+
+	cmd := exec.Command(flags.Arg(1), flags.Args()[2:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+
+	replayer := supervisor.NewReplayer(stdin, stdout)
+	replayer.Speed = speed
+	results, replayErr := replayer.Replay(records)
+	for i, result := range results {
+		fmt.Printf("%d %s\n", i+1, result)
+	}
+	stdin.Close()
+	waitErr := cmd.Wait()
+	if replayErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", replayErr)
+		return 1
+	}
+	if waitErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", waitErr)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
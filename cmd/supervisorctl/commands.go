@@ -0,0 +1,648 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultTailBytes int64 = 1600
+)
+
+var (
+	// messages used for result codes, matching supervisorctl
+	faultMessages map[string]string = map[string]string{
+		supervisor.FaultBadName:             "no such process",
+		supervisor.FaultBadSignal:           "bad signal name",
+		supervisor.FaultNoFile:              "no such file",
+		supervisor.FaultNotExecutable:       "file is not executable",
+		supervisor.FaultFailed:              "failed",
+		supervisor.FaultAbnormalTermination: "abnormal termination",
+		supervisor.FaultSpawnError:          "spawn error",
+		supervisor.FaultAlreadyStarted:      "already started",
+		supervisor.FaultNotRunning:          "not running",
+		supervisor.FaultShutdownState:       "shutting down",
+	}
+)
+
+// command is a supervisorctl action.
+type command struct {
+	help string
+	run  func(ctl *controller, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"avail":    {"avail\t\t\tDisplay all configured processes", (*controller).avail},
+		"clear":    {"clear <name>|all\tClear process log files", (*controller).clear},
+		"fg":       {"fg <process>\t\tConnect to a process in foreground mode", (*controller).fg},
+		"help":     {"help [<action>]\t\tPrint help for an action", (*controller).help},
+		"maintail": {"maintail [-f|-<bytes>]\tTail the supervisord main log file", (*controller).maintail},
+		"pid":      {"pid [<name>|all]\tGet the PID of supervisord or a process", (*controller).pid},
+		"reread":   {"reread\t\t\tReload the daemon's configuration files without add/remove", (*controller).reread},
+		"restart":  {"restart <name>|<gname>:*|all\tRestart processes", (*controller).restart},
+		"shutdown": {"shutdown\t\tShut the remote supervisord down", (*controller).shutdown},
+		"signal":   {"signal <sig> <name>|<gname>:*|all\tSignal processes", (*controller).signal},
+		"start":    {"start <name>|<gname>:*|all\tStart processes", (*controller).start},
+		"status":   {"status [<name>|<gname>:*|all]\tGet process status info", (*controller).status},
+		"stop":     {"stop <name>|<gname>:*|all\tStop processes", (*controller).stop},
+		"tail":     {"tail [-f|-<bytes>] <name> [stdout|stderr]\tOutput the last part of process logs", (*controller).tail},
+		"update":   {"update [all|<gname>...]\tReload config and add/remove as necessary", (*controller).update},
+	}
+}
+
+// commandNames returns the sorted names of all commands.
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// usageError is returned for invalid command arguments.
+type usageError string
+
+func (err usageError) Error() string {
+	return string(err)
+}
+
+// processName returns the name of a process as displayed by supervisorctl.
+func processName(group string, name string) string {
+	if group == name {
+		return name
+	}
+	return group + ":" + name
+}
+
+// controller runs commands against a Supervisor instance.
+type controller struct {
+	client supervisor.Client
+	in     io.Reader
+	out    io.Writer
+	json   bool
+	exit   int
+	lock   sync.Mutex
+}
+
+func newController(client supervisor.Client, in io.Reader, out io.Writer, json bool) *controller {
+	return &controller{client: client, in: in, out: out, json: json}
+}
+
+// execute runs a command and returns its exit code.
+func (ctl *controller) execute(name string, args []string) int {
+	ctl.exit = exitSuccess
+	cmd, ok := commands[name]
+	if !ok {
+		ctl.fail(errors.New("*** Unknown syntax: " + strings.Join(append([]string{name}, args...), " ")))
+		return exitInvalidArgs
+	}
+	if err := cmd.run(ctl, args); err != nil {
+		ctl.fail(err)
+		if _, ok := err.(usageError); ok {
+			return exitInvalidArgs
+		}
+		if ctl.exit == exitSuccess {
+			ctl.exit = exitGeneric
+		}
+	}
+	return ctl.exit
+}
+
+// output writes a line of text or, in JSON mode, a JSON object.
+func (ctl *controller) output(text string, value interface{}) {
+	ctl.lock.Lock()
+	defer ctl.lock.Unlock()
+	if ctl.json {
+		data, _ := json.Marshal(value)
+		ctl.out.Write(append(data, '\n'))
+	} else {
+		fmt.Fprintln(ctl.out, text)
+	}
+}
+
+// fail writes an error.
+func (ctl *controller) fail(err error) {
+	ctl.output("Error: "+err.Error(), map[string]string{"error": err.Error()})
+}
+
+// setFault updates the exit status from a Supervisor fault in the same way as supervisorctl.
+func (ctl *controller) setFault(fault string, ignored string) {
+	switch fault {
+	case "", supervisor.FaultSuccess, ignored:
+	case supervisor.FaultSpawnError, supervisor.FaultAbnormalTermination, supervisor.FaultNotRunning:
+		ctl.exit = exitNotRunning
+	default:
+		ctl.exit = exitGeneric
+	}
+}
+
+// result reports the outcome of an action on a process.
+func (ctl *controller) result(name string, done string, fault string, err error, ignored string) {
+	if fault == "" && err != nil {
+		fault = supervisor.FaultName(err)
+		if fault == "" {
+			fault = supervisor.FaultFailed
+		}
+	}
+	ctl.setFault(fault, ignored)
+
+	if fault == "" || fault == supervisor.FaultSuccess {
+		ctl.output(name+": "+done, map[string]string{"name": name, "result": done})
+		return
+	}
+	message, ok := faultMessages[fault]
+	if !ok {
+		message = strings.ToLower(strings.Replace(fault, "_", " ", -1))
+	}
+	if err != nil && fault == supervisor.FaultFailed && supervisor.FaultName(err) == "" {
+		message = err.Error()
+	}
+	ctl.output(fmt.Sprintf("%s: ERROR (%s)", name, message), map[string]string{"name": name, "error": message, "fault": fault})
+}
+
+// statuses reports the outcome of an action on many processes.
+func (ctl *controller) statuses(statuses []supervisor.ProcessStatus, done string, ignored string) {
+	for _, status := range statuses {
+		ctl.result(processName(status.Group, status.Name), done, supervisor.FaultCodeName(status.Status), nil, ignored)
+	}
+}
+
+// apply runs an action on every named process. The special names "all" and "<group>:*" apply the
+// action to every process or every process in a group.
+func (ctl *controller) apply(names []string, done string, ignored string,
+	all func() ([]supervisor.ProcessStatus, error),
+	group func(string) ([]supervisor.ProcessStatus, error),
+	process func(string) error) error {
+
+	for _, name := range names {
+		switch {
+		case name == "all":
+			statuses, err := all()
+			if err != nil {
+				return err
+			}
+			ctl.statuses(statuses, done, ignored)
+		case strings.HasSuffix(name, ":*"):
+			gname := strings.TrimSuffix(name, ":*")
+			statuses, err := group(gname)
+			if supervisor.IsFault(err, supervisor.FaultBadName) {
+				ctl.output(fmt.Sprintf("%s: ERROR (no such group)", gname), map[string]string{"name": gname, "error": "no such group", "fault": supervisor.FaultBadName})
+				ctl.exit = exitGeneric
+				continue
+			} else if err != nil {
+				return err
+			}
+			ctl.statuses(statuses, done, ignored)
+		default:
+			ctl.result(name, done, "", process(name), ignored)
+		}
+	}
+	return nil
+}
+
+func (ctl *controller) start(args []string) error {
+	if len(args) == 0 {
+		return usageError("start requires a process name")
+	}
+	return ctl.apply(args, "started", supervisor.FaultAlreadyStarted,
+		func() ([]supervisor.ProcessStatus, error) {
+			return ctl.client.StartAllProcesses(true)
+		},
+		func(name string) ([]supervisor.ProcessStatus, error) {
+			return ctl.client.StartProcessGroup(name, true)
+		},
+		func(name string) error {
+			_, err := ctl.client.StartProcess(name, true)
+			return err
+		})
+}
+
+func (ctl *controller) stop(args []string) error {
+	if len(args) == 0 {
+		return usageError("stop requires a process name")
+	}
+	return ctl.apply(args, "stopped", supervisor.FaultNotRunning,
+		func() ([]supervisor.ProcessStatus, error) {
+			return ctl.client.StopAllProcesses(true)
+		},
+		func(name string) ([]supervisor.ProcessStatus, error) {
+			return ctl.client.StopProcessGroup(name, true)
+		},
+		func(name string) error {
+			_, err := ctl.client.StopProcess(name, true)
+			return err
+		})
+}
+
+func (ctl *controller) restart(args []string) error {
+	if len(args) == 0 {
+		return usageError("restart requires a process name")
+	}
+	if err := ctl.stop(args); err != nil {
+		return err
+	}
+	return ctl.start(args)
+}
+
+func (ctl *controller) signal(args []string) error {
+	if len(args) < 2 {
+		return usageError("signal requires a signal name and a process name")
+	}
+	sig := args[0]
+	return ctl.apply(args[1:], "signalled", "",
+		func() ([]supervisor.ProcessStatus, error) {
+			return ctl.client.SignalAllProcesses(sig)
+		},
+		func(name string) ([]supervisor.ProcessStatus, error) {
+			return ctl.client.SignalProcessGroup(name, sig)
+		},
+		func(name string) error {
+			_, err := ctl.client.SignalProcess(name, sig)
+			return err
+		})
+}
+
+func (ctl *controller) clear(args []string) error {
+	if len(args) == 0 {
+		return usageError("clear requires a process name")
+	}
+	return ctl.apply(args, "cleared", "",
+		func() ([]supervisor.ProcessStatus, error) {
+			return ctl.client.ClearAllProcessLogs()
+		},
+		func(name string) ([]supervisor.ProcessStatus, error) {
+			return nil, usageError("clear does not accept group names")
+		},
+		func(name string) error {
+			_, err := ctl.client.ClearProcessLogs(name)
+			return err
+		})
+}
+
+// statusJSON is the JSON form of a status line.
+type statusJSON struct {
+	Name        string `json:"name"`
+	Group       string `json:"group"`
+	State       string `json:"state"`
+	PID         int64  `json:"pid"`
+	Description string `json:"description"`
+	Start       int64  `json:"start"`
+	Stop        int64  `json:"stop"`
+	ExitStatus  int64  `json:"exitstatus"`
+	SpawnErr    string `json:"spawnerr"`
+}
+
+// matchProcesses returns the processes selected by names. Names may be "all", "<group>:*",
+// "<group>:<name>", or the name of a process. Unknown names are returned separately.
+func matchProcesses(infos []supervisor.ProcessInfo, names []string) (matched []supervisor.ProcessInfo, unknown []string) {
+	if len(names) == 0 || contains(names, "all") {
+		return infos, nil
+	}
+	for _, name := range names {
+		found := false
+		for _, info := range infos {
+			if name == info.Group+":*" || name == info.FullName() || name == processName(info.Group, info.Name) {
+				matched = append(matched, info)
+				found = true
+			}
+		}
+		if !found {
+			unknown = append(unknown, name)
+		}
+	}
+	return
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (ctl *controller) status(args []string) error {
+	infos, err := ctl.client.GetAllProcessInfo()
+	if err != nil {
+		return err
+	}
+	matched, unknown := matchProcesses(infos, args)
+	for _, name := range unknown {
+		ctl.output(name+": ERROR (no such process)", map[string]string{"name": name, "error": "no such process", "fault": supervisor.FaultBadName})
+		ctl.exit = exitStatusUnknown
+	}
+	for _, info := range matched {
+		name := processName(info.Group, info.Name)
+		ctl.output(fmt.Sprintf("%-32s %-10s %s", name, info.StateName, info.Description), statusJSON{
+			name, info.Group, info.StateName, info.PID, info.Description,
+			info.Start, info.Stop, info.ExitStatus, info.SpawnErr,
+		})
+		if info.StateName != supervisor.Running && ctl.exit == exitSuccess {
+			ctl.exit = exitStatusNotRunning
+		}
+	}
+	return nil
+}
+
+func (ctl *controller) pid(args []string) error {
+	if len(args) == 0 {
+		pid, err := ctl.client.GetPID()
+		if err != nil {
+			return err
+		}
+		ctl.output(strconv.FormatInt(pid, 10), map[string]interface{}{"name": "supervisord", "pid": pid})
+		return nil
+	}
+
+	infos, err := ctl.client.GetAllProcessInfo()
+	if err != nil {
+		return err
+	}
+	matched, unknown := matchProcesses(infos, args)
+	for _, name := range unknown {
+		ctl.output("No such process "+name, map[string]string{"name": name, "error": "no such process", "fault": supervisor.FaultBadName})
+		ctl.exit = exitGeneric
+	}
+	for _, info := range matched {
+		name := processName(info.Group, info.Name)
+		if contains(args, "all") {
+			ctl.output(fmt.Sprintf("%s: %d", name, info.PID), map[string]interface{}{"name": name, "pid": info.PID})
+		} else {
+			ctl.output(strconv.FormatInt(info.PID, 10), map[string]interface{}{"name": name, "pid": info.PID})
+		}
+		if info.PID == 0 {
+			ctl.exit = exitNotRunning
+		}
+	}
+	return nil
+}
+
+func (ctl *controller) avail(args []string) error {
+	infos, err := ctl.client.GetAllConfigInfo()
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := processName(info.Group, info.Name)
+		inuse := "avail"
+		if info.InUse {
+			inuse = "in use"
+		}
+		autostart := "manual"
+		if info.Autostart {
+			autostart = "auto"
+		}
+		ctl.output(fmt.Sprintf("%-32s %-9s %-9s %d:%d", name, inuse, autostart, info.ProcessPrio, info.GroupPrio),
+			map[string]interface{}{
+				"name":         name,
+				"group":        info.Group,
+				"inuse":        info.InUse,
+				"autostart":    info.Autostart,
+				"process_prio": info.ProcessPrio,
+				"group_prio":   info.GroupPrio,
+			})
+	}
+	return nil
+}
+
+func (ctl *controller) reread(args []string) error {
+	changes, err := ctl.client.ReloadConfig()
+	if err != nil {
+		if supervisor.IsFault(err, supervisor.FaultCantReread) {
+			ctl.exit = exitGeneric
+		}
+		return err
+	}
+	if len(changes.Added)+len(changes.Changed)+len(changes.Removed) == 0 {
+		ctl.output("No config updates to processes", map[string]string{})
+		return nil
+	}
+	for _, list := range []struct {
+		names  []string
+		change string
+		text   string
+	}{
+		{changes.Added, supervisor.ChangeAdded, "available"},
+		{changes.Changed, supervisor.ChangeChanged, "changed"},
+		{changes.Removed, supervisor.ChangeRemoved, "disappeared"},
+	} {
+		for _, name := range list.names {
+			ctl.output(name+": "+list.text, map[string]string{"name": name, "change": list.change})
+		}
+	}
+	return nil
+}
+
+func (ctl *controller) update(args []string) error {
+	var groups []string
+	if !contains(args, "all") {
+		groups = args
+	}
+	report, err := ctl.client.Update(false, groups...)
+	if err != nil {
+		return err
+	}
+	for _, update := range report.Groups {
+		value := map[string]interface{}{"name": update.Name, "change": update.Change, "steps": update.Steps}
+		if update.Error != nil {
+			value["error"] = update.Error.Error()
+			ctl.exit = exitGeneric
+		}
+		if text := update.String(); text != "" {
+			ctl.output(text, value)
+		}
+	}
+	return nil
+}
+
+func (ctl *controller) shutdown(args []string) error {
+	if _, err := ctl.client.Shutdown(); err != nil {
+		if supervisor.IsFault(err, supervisor.FaultShutdownState) {
+			ctl.output("ERROR: already shutting down", map[string]string{"error": "already shutting down"})
+			ctl.exit = exitGeneric
+			return nil
+		}
+		return err
+	}
+	ctl.output("Shut down", map[string]string{"result": "shut down"})
+	return nil
+}
+
+// parseTailArgs parses the -f and -<bytes> flags of the tail commands.
+func parseTailArgs(args []string) (follow bool, length int64, rest []string, err error) {
+	length = defaultTailBytes
+	for _, arg := range args {
+		switch {
+		case arg == "-f":
+			follow = true
+		case len(arg) > 1 && arg[0] == '-':
+			if length, err = strconv.ParseInt(arg[1:], 10, 64); err != nil || length <= 0 {
+				err = usageError("bad argument " + arg)
+				return
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return
+}
+
+// stream copies a log stream to the output until it ends.
+func (ctl *controller) stream(name string, reader io.ReadCloser) error {
+	defer reader.Close()
+	buf := make([]byte, 4096)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if ctl.json {
+				ctl.output("", map[string]string{"name": name, "log": string(buf[:n])})
+			} else {
+				ctl.lock.Lock()
+				ctl.out.Write(buf[:n])
+				ctl.lock.Unlock()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// write a chunk of log output
+func (ctl *controller) log(name string, log string) {
+	if ctl.json {
+		ctl.output("", map[string]string{"name": name, "log": log})
+	} else {
+		ctl.lock.Lock()
+		io.WriteString(ctl.out, log)
+		ctl.lock.Unlock()
+	}
+}
+
+func (ctl *controller) tail(args []string) error {
+	follow, length, rest, err := parseTailArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 || len(rest) > 2 {
+		return usageError("tail requires a process name")
+	}
+	name := rest[0]
+	stderr := false
+	if len(rest) == 2 {
+		switch rest[1] {
+		case "stdout":
+		case "stderr":
+			stderr = true
+		default:
+			return usageError("bad channel " + rest[1])
+		}
+	}
+
+	if follow {
+		reader, err := ctl.client.TailProcessLog(name, stderr)
+		if err != nil {
+			return err
+		}
+		return ctl.stream(name, reader)
+	}
+
+	var tail *supervisor.ProcessTail
+	if stderr {
+		tail, err = ctl.client.TailProcessStderrLog(name, 0, length)
+	} else {
+		tail, err = ctl.client.TailProcessStdoutLog(name, 0, length)
+	}
+	if err != nil {
+		fault := supervisor.FaultName(err)
+		ctl.result(name, "", fault, err, "")
+		return nil
+	}
+	ctl.log(name, tail.Log)
+	return nil
+}
+
+func (ctl *controller) maintail(args []string) error {
+	follow, length, rest, err := parseTailArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usageError("maintail does not accept a process name")
+	}
+	if follow {
+		reader, err := ctl.client.TailLog()
+		if err != nil {
+			return err
+		}
+		return ctl.stream("supervisord", reader)
+	}
+	log, err := ctl.client.ReadLog(-length, 0)
+	if err != nil {
+		return err
+	}
+	ctl.log("supervisord", log)
+	return nil
+}
+
+func (ctl *controller) fg(args []string) error {
+	if len(args) != 1 {
+		return usageError("fg requires a process name")
+	}
+	name := args[0]
+	info, err := ctl.client.GetProcessInfo(name)
+	if err != nil {
+		ctl.result(name, "", "", err, "")
+		return nil
+	}
+	if info.StateName != supervisor.Running {
+		ctl.exit = exitNotRunning
+		return errors.New("process not running")
+	}
+
+	for _, stderr := range []bool{false, true} {
+		reader, err := ctl.client.TailProcessLog(name, stderr)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		go ctl.stream(name, reader)
+	}
+
+	scanner := bufio.NewScanner(ctl.in)
+	for scanner.Scan() {
+		if _, err := ctl.client.SendProcessStdin(name, scanner.Text()+"\n"); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (ctl *controller) help(args []string) error {
+	if len(args) == 0 {
+		ctl.output("default commands (type help <topic>):\n=====================================\n"+strings.Join(commandNames(), " "),
+			map[string]interface{}{"commands": commandNames()})
+		return nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return usageError("no help on " + args[0])
+	}
+	ctl.output(cmd.help, map[string]string{"command": args[0], "help": cmd.help})
+	return nil
+}
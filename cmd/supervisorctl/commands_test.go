@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestServer starts a fake supervisord which is closed when the test ends.
+func newTestServer(t *testing.T, programs ...supervisortest.Program) *supervisortest.Server {
+	server := supervisortest.NewServer(programs...)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// runCommand runs supervisorctl against the server and returns its output and exit code. An empty
+// configuration file is used so that none is searched for.
+func runCommand(t *testing.T, server *supervisortest.Server, args ...string) (string, int) {
+	config := filepath.Join(t.TempDir(), "supervisord.conf")
+	if err := ioutil.WriteFile(config, []byte("[supervisorctl]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-c", config, "-s", server.URL}, args...)
+	code := run(args, strings.NewReader(""), &stdout, &stderr)
+	return stdout.String() + stderr.String(), code
+}
+
+// statusLine formats a line of status output as supervisorctl does.
+func statusLine(name string, state string, description string) string {
+	return fmt.Sprintf("%-32s %-10s %s\n", name, state, description)
+}
+
+// Test the output and exit codes of the status and pid commands.
+func TestStatus(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "cron")...)
+	server.SetState("web:api", supervisor.Running)
+	server.SetState("cron", supervisor.Fatal)
+	running := fmt.Sprintf("%-32s %-10s pid 100, uptime ", "web:api", supervisor.Running)
+
+	output, code := runCommand(t, server, "status")
+	lines := strings.SplitAfter(output, "\n")
+	if code != exitStatusNotRunning || len(lines) != 3 || lines[0] != statusLine("cron", supervisor.Fatal, "") || !strings.HasPrefix(lines[1], running) {
+		t.Errorf(`supervisorctl status => %q, %d, want cron FATAL and web:api RUNNING, %d`, output, code, exitStatusNotRunning)
+	}
+
+	tests := []struct {
+		args   []string
+		output string
+		code   int
+	}{
+		{[]string{"status", "cron", "missing"}, "missing: ERROR (no such process)\n" + statusLine("cron", supervisor.Fatal, ""), exitStatusUnknown},
+		{[]string{"status", "nope:*"}, "nope:*: ERROR (no such process)\n", exitStatusUnknown},
+		{[]string{"pid", "web:api"}, "100\n", exitSuccess},
+		{[]string{"pid", "cron"}, "0\n", exitNotRunning},
+		{[]string{"pid", "all"}, "cron: 0\nweb:api: 100\n", exitNotRunning},
+		{[]string{"pid", "missing"}, "No such process missing\n", exitGeneric},
+		{[]string{"-json", "status", "cron"}, `{"name":"cron","group":"cron","state":"FATAL","pid":0,"description":"","start":0,"stop":0,"exitstatus":0,"spawnerr":""}` + "\n", exitStatusNotRunning},
+		{[]string{"bogus", "arg"}, "Error: *** Unknown syntax: bogus arg\n", exitInvalidArgs},
+	}
+	for _, test := range tests {
+		if output, code := runCommand(t, server, test.args...); output != test.output || code != test.code {
+			t.Errorf(`supervisorctl %s => %q, %d, want %q, %d`, strings.Join(test.args, " "), output, code, test.output, test.code)
+		}
+	}
+
+	output, code = runCommand(t, server, "status", "web:api")
+	if code != exitSuccess || !strings.HasPrefix(output, running) {
+		t.Errorf(`supervisorctl status web:api => %q, %d, want web:api RUNNING, %d`, output, code, exitSuccess)
+	}
+}
+
+// Test the output and exit codes of the commands which act on processes.
+func TestProcessCommands(t *testing.T) {
+	broken := supervisortest.NewProgram("broken")
+	broken.SpawnError = "can't find command '/bin/broken'"
+	programs := append(supervisortest.Programs("web:api", "web:worker", "cron"), broken)
+	server := newTestServer(t, programs...)
+
+	tests := []struct {
+		args   []string
+		output string
+		code   int
+	}{
+		{[]string{"start", "cron"}, "cron: started\n", exitSuccess},
+		{[]string{"start", "cron"}, "cron: ERROR (already started)\n", exitSuccess},
+		{[]string{"start", "web:*"}, "web:api: started\nweb:worker: started\n", exitSuccess},
+		{[]string{"start", "nope:*"}, "nope: ERROR (no such group)\n", exitGeneric},
+		{[]string{"start", "missing"}, "missing: ERROR (no such process)\n", exitGeneric},
+		{[]string{"start", "broken"}, "broken: ERROR (spawn error)\n", exitNotRunning},
+		{[]string{"start"}, "Error: start requires a process name\n", exitInvalidArgs},
+		{[]string{"stop", "web:api"}, "web:api: stopped\n", exitSuccess},
+		{[]string{"stop", "web:api"}, "web:api: ERROR (not running)\n", exitSuccess},
+		{[]string{"restart", "cron"}, "cron: stopped\ncron: started\n", exitSuccess},
+		{[]string{"signal", "HUP", "cron"}, "cron: signalled\n", exitSuccess},
+		{[]string{"signal", "HUP", "web:api"}, "web:api: ERROR (not running)\n", exitNotRunning},
+		{[]string{"signal", "cron"}, "Error: signal requires a signal name and a process name\n", exitInvalidArgs},
+		{[]string{"stop", "all"}, "web:worker: stopped\ncron: stopped\n", exitSuccess},
+		{[]string{"-json", "start", "cron"}, `{"name":"cron","result":"started"}` + "\n", exitSuccess},
+	}
+	for _, test := range tests {
+		if output, code := runCommand(t, server, test.args...); output != test.output || code != test.code {
+			t.Errorf(`supervisorctl %s => %q, %d, want %q, %d`, strings.Join(test.args, " "), output, code, test.output, test.code)
+		}
+	}
+}
+
+// Test the output of the commands which reload the configuration.
+func TestUpdateCommands(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "cron")...)
+	server.SetState("cron", supervisor.Running)
+
+	if output, code := runCommand(t, server, "reread"); output != "No config updates to processes\n" || code != exitSuccess {
+		t.Errorf(`supervisorctl reread => %q, %d, want no updates, %d`, output, code, exitSuccess)
+	}
+	server.Configure(supervisortest.Programs("web:api", "queue")...)
+	tests := []struct {
+		args   []string
+		output string
+		code   int
+	}{
+		{[]string{"reread"}, "queue: available\ncron: disappeared\n", exitSuccess},
+		{[]string{"update"}, "cron: stopped\ncron: removed process group\nqueue: added process group\n", exitSuccess},
+		{[]string{"update"}, "", exitSuccess},
+	}
+	for _, test := range tests {
+		if output, code := runCommand(t, server, test.args...); output != test.output || code != test.code {
+			t.Errorf(`supervisorctl %s => %q, %d, want %q, %d`, strings.Join(test.args, " "), output, code, test.output, test.code)
+		}
+	}
+	if state := server.State("cron"); state != "" {
+		t.Errorf(`Server.State("cron") => %q after update, want removed`, state)
+	}
+}
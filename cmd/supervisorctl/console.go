@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/internal/term"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultServerName    string        = "default"
+	defaultPrompt        string        = "supervisor"
+	defaultWatchInterval time.Duration = 2 * time.Second
+	maxHistory           int           = 1000
+)
+
+var (
+	// commands handled by the console itself
+	consoleCommands map[string]string = map[string]string{
+		"exit":    "exit\t\t\tExit the supervisor shell",
+		"open":    "open <server>|<url>\tConnect to a named server or a URL",
+		"quit":    "quit\t\t\tExit the supervisor shell",
+		"servers": "servers\t\t\tList the named servers",
+		"watch":   "watch [-<seconds>] [<name>...]\tShow live process status until a key is pressed",
+	}
+
+	// commands whose arguments are process names
+	processCommands []string = []string{"clear", "fg", "pid", "restart", "signal", "start", "status", "stop", "tail", "watch"}
+
+	// signal names offered for completion
+	signalNames []string = []string{"HUP", "INT", "QUIT", "KILL", "USR1", "USR2", "TERM", "CONT", "STOP", "WINCH"}
+)
+
+// consoleCommandNames returns the sorted names of the console commands.
+func consoleCommandNames() []string {
+	names := make([]string, 0, len(consoleCommands))
+	for name := range consoleCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// console is an interactive shell. It runs commands against the current server and adds commands to
+// switch between servers and to watch process status.
+type console struct {
+	opts    options
+	servers map[string]server
+	in      *bufio.Reader
+	out     io.Writer
+	fd      int
+	editor  *lineEditor
+	name    string
+	client  *supervisor.Client
+	ctl     *controller
+}
+
+func newConsole(opts options, stdin io.Reader, stdout io.Writer) *console {
+	con := &console{
+		opts:    opts,
+		servers: make(map[string]server),
+		in:      bufio.NewReader(stdin),
+		out:     stdout,
+		fd:      -1,
+	}
+	for name, srv := range opts.servers {
+		con.servers[name] = srv
+	}
+	if _, ok := con.servers[defaultServerName]; !ok {
+		con.servers[defaultServerName] = server{opts.serverURL, opts.username, opts.password}
+	}
+	if file, ok := stdin.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		con.fd = int(file.Fd())
+	}
+	con.editor = newLineEditor(con.in, stdout, con.fd)
+	con.editor.complete = con.complete
+	return con
+}
+
+// run reads and executes commands until the input ends or the user exits.
+func (con *console) run() int {
+	con.loadHistory()
+	defer con.saveHistory()
+	defer con.close()
+
+	con.open(defaultServerName)
+	for {
+		line, err := con.editor.readLine(con.prompt())
+		if err != nil {
+			return exitSuccess
+		}
+		con.editor.addHistory(line)
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit", "quit":
+			return exitSuccess
+		case "open":
+			if len(args) != 2 {
+				fmt.Fprintln(con.out, consoleCommands["open"])
+				continue
+			}
+			con.open(args[1])
+		case "servers":
+			con.listServers()
+		case "watch":
+			con.watch(args[1:])
+		case "help":
+			con.help(args[1:])
+		default:
+			if con.ctl == nil {
+				fmt.Fprintln(con.out, "Error: not connected, use open <server>")
+				continue
+			}
+			con.ctl.execute(args[0], args[1:])
+		}
+	}
+}
+
+// prompt returns the prompt for the current server.
+func (con *console) prompt() string {
+	prompt := con.opts.prompt
+	if prompt == "" {
+		prompt = defaultPrompt
+	}
+	if con.name != "" && con.name != defaultServerName {
+		prompt += "@" + con.name
+	}
+	return prompt + "> "
+}
+
+// open connects to a named server or URL and prints its status.
+func (con *console) open(target string) {
+	srv, ok := con.servers[target]
+	if !ok {
+		if !strings.Contains(target, "://") {
+			fmt.Fprintf(con.out, "Error: unknown server %s\n", target)
+			return
+		}
+		srv = server{target, con.opts.username, con.opts.password}
+	}
+	client, err := srv.dial()
+	if err != nil {
+		fmt.Fprintf(con.out, "%s: %s\n", srv.url, err)
+		return
+	}
+	con.close()
+	con.name = target
+	con.client = &client
+	con.ctl = newController(client, con.in, con.out, con.opts.json)
+	con.ctl.execute("status", nil)
+}
+
+// close the connection to the current server
+func (con *console) close() {
+	if con.client != nil {
+		con.client.Close()
+		con.client = nil
+		con.ctl = nil
+	}
+}
+
+// listServers prints the named servers, marking the current one.
+func (con *console) listServers() {
+	names := make([]string, 0, len(con.servers))
+	for name := range con.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		mark := " "
+		if name == con.name {
+			mark = "*"
+		}
+		fmt.Fprintf(con.out, "%s %-20s %s\n", mark, name, con.servers[name].url)
+	}
+}
+
+// help prints help for console commands and delegates the rest to the controller.
+func (con *console) help(args []string) {
+	if len(args) > 0 {
+		if text, ok := consoleCommands[args[0]]; ok {
+			fmt.Fprintln(con.out, text)
+			return
+		}
+	}
+	if con.ctl != nil {
+		con.ctl.execute("help", args)
+	}
+	if len(args) == 0 {
+		fmt.Fprintf(con.out, "\nshell commands:\n%s\n", strings.Join(consoleCommandNames(), " "))
+	}
+}
+
+// watch redraws the process status until a key is pressed.
+func (con *console) watch(args []string) {
+	if con.ctl == nil {
+		fmt.Fprintln(con.out, "Error: not connected, use open <server>")
+		return
+	}
+	interval := defaultWatchInterval
+	var names []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			seconds, err := strconv.ParseFloat(arg[1:], 64)
+			if err != nil || seconds <= 0 {
+				fmt.Fprintf(con.out, "Error: bad interval %s\n", arg)
+				return
+			}
+			interval = time.Duration(seconds * float64(time.Second))
+		} else {
+			names = append(names, arg)
+		}
+	}
+
+	if con.fd >= 0 {
+		if restore, err := term.MakeRaw(con.fd); err == nil {
+			defer restore()
+		}
+	}
+	stop := make(chan bool, 1)
+	go func() {
+		con.in.ReadByte()
+		stop <- true
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		fmt.Fprint(con.out, "\x1b[H\x1b[2J")
+		fmt.Fprintf(con.out, "%s  %s  (press any key to stop)\n\n", con.servers[con.name].url, time.Now().Format("15:04:05"))
+		con.ctl.execute("status", names)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// complete returns the completions of the last word of a line.
+func (con *console) complete(line string) []string {
+	return completeLine(line, con.processes, con.serverNames())
+}
+
+// processes returns the processes on the current server for completion.
+func (con *console) processes() []supervisor.ProcessInfo {
+	if con.client == nil {
+		return nil
+	}
+	infos, _ := con.client.GetAllProcessInfo()
+	return infos
+}
+
+// serverNames returns the names of the configured servers.
+func (con *console) serverNames() []string {
+	names := make([]string, 0, len(con.servers))
+	for name := range con.servers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// completeLine returns the completions of the last word of a line. Processes are only fetched when
+// the command takes process or group names.
+func completeLine(line string, processes func() []supervisor.ProcessInfo, servers []string) []string {
+	words := strings.Fields(line)
+	word := ""
+	if len(words) > 0 && !strings.HasSuffix(line, " ") {
+		word = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	var candidates []string
+	switch {
+	case len(words) == 0:
+		candidates = append(commandNames(), consoleCommandNames()...)
+	case words[0] == "help":
+		candidates = append(commandNames(), consoleCommandNames()...)
+	case words[0] == "open":
+		candidates = servers
+	case words[0] == "update":
+		candidates = append(groupNames(processes()), "all")
+	case words[0] == "signal" && len(words) == 1:
+		candidates = signalNames
+	case words[0] == "tail" && len(words) > 1 && !strings.HasPrefix(words[len(words)-1], "-"):
+		candidates = []string{"stdout", "stderr"}
+	case contains(processCommands, words[0]):
+		candidates = append(processNames(processes()), "all")
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) && !contains(matches, candidate) {
+			matches = append(matches, candidate)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// processNames returns the names of the processes and their groups as accepted by commands.
+func processNames(infos []supervisor.ProcessInfo) []string {
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, processName(info.Group, info.Name))
+		if info.Group != info.Name {
+			names = append(names, info.Group+":*")
+		}
+	}
+	return names
+}
+
+// groupNames returns the names of the process groups.
+func groupNames(infos []supervisor.ProcessInfo) []string {
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if !contains(names, info.Group) {
+			names = append(names, info.Group)
+		}
+	}
+	return names
+}
+
+// historyPath returns the path of the history file with ~ expanded.
+func (con *console) historyPath() string {
+	path := con.opts.historyFile
+	if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(os.Getenv("HOME"), path[2:])
+	}
+	return path
+}
+
+// loadHistory reads the history file if one is configured.
+func (con *console) loadHistory() {
+	path := con.historyPath()
+	if path == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		con.editor.addHistory(line)
+	}
+}
+
+// saveHistory writes the most recent history to the history file if one is configured.
+func (con *console) saveHistory() {
+	path := con.historyPath()
+	if path == "" {
+		return
+	}
+	history := con.editor.history
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	if err := ioutil.WriteFile(path, []byte(strings.Join(history, "\n")+"\n"), 0600); err != nil {
+		fmt.Fprintf(con.out, "Error: %s\n", err)
+	}
+}
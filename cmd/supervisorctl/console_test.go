@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"io"
+	"strings"
+	"testing"
+)
+
+func cmpStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Test completion of commands, process names, and server names.
+func TestCompleteLine(t *testing.T) {
+	fetched := 0
+	processes := func() []supervisor.ProcessInfo {
+		fetched++
+		return []supervisor.ProcessInfo{
+			{Name: "web_0", Group: "web"},
+			{Name: "web_1", Group: "web"},
+			{Name: "cron", Group: "cron"},
+		}
+	}
+	servers := []string{"default", "staging"}
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"sta", []string{"start", "status"}},
+		{"start ", []string{"all", "cron", "web:*", "web:web_0", "web:web_1"}},
+		{"stop web:w", []string{"web:web_0", "web:web_1"}},
+		{"open st", []string{"staging"}},
+		{"signal H", []string{"HUP"}},
+		{"tail -f cron s", []string{"stderr", "stdout"}},
+		{"update w", []string{"web"}},
+		{"help ser", []string{"servers"}},
+		{"bogus ", nil},
+	}
+	for _, test := range tests {
+		if got := completeLine(test.line, processes, servers); !cmpStrings(got, test.want) {
+			t.Errorf(`completeLine(%q) => %v, want %v`, test.line, got, test.want)
+		}
+	}
+	if fetched != 3 {
+		t.Errorf(`completeLine() fetched processes %d times, want 3`, fetched)
+	}
+}
+
+// Test line editing, history recall, and tab completion.
+func TestLineEditor(t *testing.T) {
+	input := strings.Join([]string{
+		"staz\x7ftus\r",                       // backspace
+		"sto\t\r",                             // unique completion
+		"\x1b[A\x1b[A\r",                      // recall the first line
+		"wrld\x1b[D\x1b[D\x1b[Do\x01hello \r", // cursor movement
+		"ab\x15cd\r",                          // kill to start of line
+		"\x04",                                // end of input
+	}, "")
+	out := &bytes.Buffer{}
+	ed := &lineEditor{in: bufio.NewReader(strings.NewReader(input)), out: out, fd: -1, raw: true}
+	ed.complete = func(line string) []string {
+		return completeLine(line, nil, nil)
+	}
+
+	want := []string{"status", "stop ", "status", "hello world", "cd"}
+	for _, line := range want {
+		got, err := ed.readLine("> ")
+		if err != nil {
+			t.Fatalf(`lineEditor.readLine() => error{"%v"}, want %q`, err, line)
+		}
+		if got != line {
+			t.Errorf(`lineEditor.readLine() => %q, want %q`, got, line)
+		}
+		ed.addHistory(got)
+	}
+	if _, err := ed.readLine("> "); err != io.EOF {
+		t.Errorf(`lineEditor.readLine() => error{"%v"}, want EOF`, err)
+	}
+	if !cmpStrings(ed.history, []string{"status", "stop ", "status", "hello world", "cd"}) {
+		t.Errorf(`lineEditor.history => %q`, ed.history)
+	}
+}
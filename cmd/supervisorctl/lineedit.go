@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/internal/term"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Control keys understood by the line editor.
+const (
+	keyCtrlA     rune = 1
+	keyCtrlB     rune = 2
+	keyCtrlC     rune = 3
+	keyCtrlD     rune = 4
+	keyCtrlE     rune = 5
+	keyCtrlF     rune = 6
+	keyCtrlH     rune = 8
+	keyTab       rune = 9
+	keyLF        rune = 10
+	keyCtrlK     rune = 11
+	keyCR        rune = 13
+	keyCtrlN     rune = 14
+	keyCtrlP     rune = 16
+	keyCtrlU     rune = 21
+	keyEscape    rune = 27
+	keyBackspace rune = 127
+)
+
+// lineEditor reads lines from a terminal with history and tab completion. When raw is false the
+// input is not a terminal and whole lines are read without editing. The terminal on fd is put into
+// raw mode only while a line is being read.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	fd       int
+	raw      bool
+	history  []string
+	complete func(line string) []string
+
+	buf  []rune
+	pos  int
+	hist int
+}
+
+func newLineEditor(in *bufio.Reader, out io.Writer, fd int) *lineEditor {
+	return &lineEditor{in: in, out: out, fd: fd, raw: fd >= 0 && term.IsTerminal(fd)}
+}
+
+// addHistory appends a line to the history. Blank lines and repeats of the last line are skipped.
+func (ed *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(ed.history) > 0 && ed.history[len(ed.history)-1] == line {
+		return
+	}
+	ed.history = append(ed.history, line)
+}
+
+// readLine prints the prompt and reads a line. io.EOF is returned when the input ends or Ctrl-D is
+// pressed on an empty line.
+func (ed *lineEditor) readLine(prompt string) (line string, err error) {
+	fmt.Fprint(ed.out, prompt)
+	if !ed.raw {
+		line, err = ed.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+		return
+	}
+
+	if ed.fd >= 0 {
+		var restore func()
+		if restore, err = term.MakeRaw(ed.fd); err != nil {
+			return
+		}
+		defer restore()
+	}
+	ed.buf = ed.buf[:0]
+	ed.pos = 0
+	ed.hist = len(ed.history)
+	for {
+		var key rune
+		if key, _, err = ed.in.ReadRune(); err != nil {
+			return
+		}
+		switch key {
+		case keyCR, keyLF:
+			fmt.Fprint(ed.out, "\n")
+			line = string(ed.buf)
+			return
+		case keyCtrlC:
+			fmt.Fprint(ed.out, "^C\n")
+			ed.buf = ed.buf[:0]
+			ed.pos = 0
+		case keyCtrlD:
+			if len(ed.buf) == 0 {
+				fmt.Fprint(ed.out, "\n")
+				err = io.EOF
+				return
+			}
+			ed.delete(ed.pos)
+		case keyBackspace, keyCtrlH:
+			if ed.pos > 0 {
+				ed.pos--
+				ed.delete(ed.pos)
+			}
+		case keyCtrlA:
+			ed.pos = 0
+		case keyCtrlE:
+			ed.pos = len(ed.buf)
+		case keyCtrlB:
+			ed.move(-1)
+		case keyCtrlF:
+			ed.move(1)
+		case keyCtrlK:
+			ed.buf = ed.buf[:ed.pos]
+		case keyCtrlU:
+			ed.buf = append(ed.buf[:0], ed.buf[ed.pos:]...)
+			ed.pos = 0
+		case keyCtrlP:
+			ed.recall(-1)
+		case keyCtrlN:
+			ed.recall(1)
+		case keyTab:
+			ed.completeWord()
+		case keyEscape:
+			ed.escape()
+		default:
+			if key >= ' ' {
+				ed.buf = append(ed.buf, 0)
+				copy(ed.buf[ed.pos+1:], ed.buf[ed.pos:])
+				ed.buf[ed.pos] = key
+				ed.pos++
+			}
+		}
+		ed.render(prompt)
+	}
+}
+
+// handle an escape sequence
+func (ed *lineEditor) escape() {
+	if next, _, err := ed.in.ReadRune(); err != nil || (next != '[' && next != 'O') {
+		return
+	}
+	key, _, err := ed.in.ReadRune()
+	if err != nil {
+		return
+	}
+	switch key {
+	case 'A':
+		ed.recall(-1)
+	case 'B':
+		ed.recall(1)
+	case 'C':
+		ed.move(1)
+	case 'D':
+		ed.move(-1)
+	case 'H':
+		ed.pos = 0
+	case 'F':
+		ed.pos = len(ed.buf)
+	case '3':
+		if next, _, err := ed.in.ReadRune(); err == nil && next == '~' {
+			ed.delete(ed.pos)
+		}
+	}
+}
+
+// move the cursor
+func (ed *lineEditor) move(offset int) {
+	if pos := ed.pos + offset; pos >= 0 && pos <= len(ed.buf) {
+		ed.pos = pos
+	}
+}
+
+// delete the character at a position
+func (ed *lineEditor) delete(pos int) {
+	if pos < len(ed.buf) {
+		ed.buf = append(ed.buf[:pos], ed.buf[pos+1:]...)
+	}
+}
+
+// replace the buffer with a line from history
+func (ed *lineEditor) recall(offset int) {
+	hist := ed.hist + offset
+	if hist < 0 || hist > len(ed.history) {
+		return
+	}
+	ed.hist = hist
+	if hist == len(ed.history) {
+		ed.buf = ed.buf[:0]
+	} else {
+		ed.buf = []rune(ed.history[hist])
+	}
+	ed.pos = len(ed.buf)
+}
+
+// complete the word before the cursor. A single match is inserted in full. Otherwise the longest
+// common prefix is inserted, or the matches are listed if there is nothing to insert.
+func (ed *lineEditor) completeWord() {
+	if ed.complete == nil {
+		return
+	}
+	line := string(ed.buf[:ed.pos])
+	matches := ed.complete(line)
+	if len(matches) == 0 {
+		return
+	}
+	word := line[strings.LastIndexAny(line, " \t")+1:]
+	insert := commonPrefix(matches)
+	if len(matches) == 1 {
+		insert += " "
+	}
+	if len(insert) > len(word) && strings.HasPrefix(insert, word) {
+		rest := []rune(insert[len(word):])
+		ed.buf = append(ed.buf[:ed.pos], append(rest, ed.buf[ed.pos:]...)...)
+		ed.pos += len(rest)
+		return
+	}
+	sort.Strings(matches)
+	fmt.Fprintf(ed.out, "\n%s\n", strings.Join(matches, "  "))
+}
+
+// render redraws the line and positions the cursor.
+func (ed *lineEditor) render(prompt string) {
+	fmt.Fprintf(ed.out, "\r%s%s\x1b[K", prompt, string(ed.buf))
+	if back := len(ed.buf) - ed.pos; back > 0 {
+		fmt.Fprintf(ed.out, "\x1b[%dD", back)
+	}
+}
+
+// commonPrefix returns the longest prefix shared by all of the strings.
+func commonPrefix(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
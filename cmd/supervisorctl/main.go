@@ -0,0 +1,188 @@
+// Command supervisorctl controls a Supervisor instance. It accepts the same commands as the Python
+// supervisorctl, produces the same output and exit codes, and adds a JSON output mode.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes. These match the LSB codes used by supervisorctl.
+const (
+	exitSuccess          int = 0
+	exitGeneric          int = 1
+	exitInvalidArgs      int = 2
+	exitStatusNotRunning int = 3
+	exitStatusUnknown    int = 4
+	exitNotRunning       int = 7
+)
+
+const (
+	defaultServerURL string = "http://localhost:9001"
+)
+
+var (
+	// searched in order when no configuration file is given
+	configPaths []string = []string{
+		"../etc/supervisord.conf",
+		"../supervisord.conf",
+		"./supervisord.conf",
+		"./etc/supervisord.conf",
+		"/etc/supervisord.conf",
+		"/etc/supervisor/supervisord.conf",
+	}
+)
+
+// server holds the connection details of a Supervisor instance.
+type server struct {
+	url      string
+	username string
+	password string
+}
+
+// dial connects to the server.
+func (srv server) dial() (supervisor.Client, error) {
+	return supervisor.DialClient(srv.url, srv.username, srv.password)
+}
+
+// options holds the connection options given on the command line or in the config file. Named
+// servers are read from [supervisorctl:<name>] sections.
+type options struct {
+	configPath  string
+	serverURL   string
+	username    string
+	password    string
+	json        bool
+	interactive bool
+	prompt      string
+	historyFile string
+	servers     map[string]server
+}
+
+// Read the supervisorctl sections of the configuration file into unset options.
+func (opts *options) readConfig() error {
+	path := opts.configPath
+	if path == "" {
+		for _, candidate := range configPaths {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return nil
+		}
+	}
+
+	file, err := supervisor.ReadConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	vars := make(map[string]string)
+	for _, env := range os.Environ() {
+		if pair := strings.SplitN(env, "=", 2); len(pair) == 2 {
+			vars["ENV_"+pair[0]] = pair[1]
+		}
+	}
+	get := func(section *supervisor.ConfigSection, value *string, key string) error {
+		if raw, ok := section.Get(key); ok && *value == "" {
+			expanded, err := supervisor.ExpandConfig(raw, vars)
+			if err != nil {
+				return err
+			}
+			*value = expanded
+		}
+		return nil
+	}
+
+	for _, section := range file.Sections {
+		if section.Type() != "supervisorctl" {
+			continue
+		}
+		if name := section.Suffix(); name != "" {
+			srv := server{}
+			for key, value := range map[string]*string{"serverurl": &srv.url, "username": &srv.username, "password": &srv.password} {
+				if err := get(section, value, key); err != nil {
+					return err
+				}
+			}
+			if opts.servers == nil {
+				opts.servers = make(map[string]server)
+			}
+			opts.servers[name] = srv
+			continue
+		}
+		for key, value := range map[string]*string{
+			"serverurl":    &opts.serverURL,
+			"username":     &opts.username,
+			"password":     &opts.password,
+			"prompt":       &opts.prompt,
+			"history_file": &opts.historyFile,
+		} {
+			if err := get(section, value, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func usage(flags *flag.FlagSet, out io.Writer) {
+	fmt.Fprintf(out, "Usage: supervisorctl [options] [action [arguments]]\n\nOptions:\n")
+	flags.PrintDefaults()
+	fmt.Fprintf(out, "\nActions:\n%s\n", strings.Join(commandNames(), " "))
+}
+
+// run executes the command line and returns the exit code.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	opts := options{}
+	flags := flag.NewFlagSet("supervisorctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.configPath, "c", "", "configuration file path")
+	flags.StringVar(&opts.serverURL, "s", "", "URL on which supervisord server is listening")
+	flags.StringVar(&opts.username, "u", "", "username to use for authentication with server")
+	flags.StringVar(&opts.password, "p", "", "password to use for authentication with server")
+	flags.BoolVar(&opts.json, "json", false, "write output as JSON lines")
+	flags.BoolVar(&opts.interactive, "i", false, "start an interactive shell after executing commands")
+	flags.Usage = func() {
+		usage(flags, stderr)
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitInvalidArgs
+	}
+
+	if err := opts.readConfig(); err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return exitInvalidArgs
+	}
+	if opts.serverURL == "" {
+		opts.serverURL = defaultServerURL
+	}
+
+	if flags.NArg() == 0 {
+		return newConsole(opts, stdin, stdout).run()
+	}
+
+	client, err := server{opts.serverURL, opts.username, opts.password}.dial()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", opts.serverURL, err)
+		return exitNotRunning
+	}
+	ctl := newController(client, stdin, stdout, opts.json)
+	status := ctl.execute(flags.Arg(0), flags.Args()[1:])
+	client.Close()
+
+	if opts.interactive {
+		return newConsole(opts, stdin, stdout).run()
+	}
+	return status
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	tailBytes int64 = 8192
+)
+
+// row is the dashboard state of a single process.
+type row struct {
+	supervisor.Process
+	starts supervisor.ProcessStarts // restarts seen since the dashboard began watching
+}
+
+// uptime returns how long a running process has been up.
+func (r row) uptime(now time.Time) time.Duration {
+	if r.State != supervisor.Running || r.starts.Since.IsZero() {
+		return 0
+	}
+	return now.Sub(r.starts.Since)
+}
+
+// dashboard holds the state shown by supervisortop. It is updated by Monitor events and key presses
+// and rendered to a string for each frame.
+type dashboard struct {
+	client     *supervisor.Client
+	source     string
+	supervisor supervisor.Supervisor
+	rows       map[string]*row
+	names      []string
+	selected   int
+	status     string
+	tail       string
+	tailing    string
+	now        func() time.Time
+}
+
+func newDashboard(client *supervisor.Client, source string) *dashboard {
+	return &dashboard{
+		client:     client,
+		source:     source,
+		supervisor: *supervisor.NewSupervisor(),
+		rows:       make(map[string]*row),
+		now:        time.Now,
+	}
+}
+
+// handle updates the dashboard from a Monitor event.
+func (dash *dashboard) handle(event interface{}) {
+	switch event := event.(type) {
+	case supervisor.SupervisorStateEvent:
+		dash.supervisor = event.Supervisor
+		dash.status = ""
+	case supervisor.ProcessAddEvent:
+		r := &row{Process: event.Process}
+		if r.State == supervisor.Running {
+			r.starts.Since = dash.startTime(r.Process)
+		}
+		dash.rows[event.Process.Name] = r
+		dash.sort()
+		dash.status = ""
+	case supervisor.ProcessRemoveEvent:
+		delete(dash.rows, event.Process.Name)
+		dash.sort()
+		dash.status = ""
+	case supervisor.ProcessStateEvent:
+		r, ok := dash.rows[event.Process.Name]
+		if !ok {
+			r = &row{}
+			dash.rows[event.Process.Name] = r
+			dash.sort()
+		}
+		r.starts.Update(r.Process, event.Process, dash.now())
+		r.Process = event.Process
+		dash.status = ""
+	case supervisor.RefreshErrorEvent:
+		dash.status = fmt.Sprintf("refresh failed: %s (retry in %s)", event.Error, event.Retry)
+	}
+}
+
+// startTime returns when a running process was started. The time is fetched from Supervisor when
+// possible.
+func (dash *dashboard) startTime(proc supervisor.Process) time.Time {
+	if dash.client != nil {
+		if info, err := dash.client.GetProcessInfo(fullName(proc)); err == nil && info.Start > 0 {
+			return dash.now().Add(-time.Duration(info.Now-info.Start) * time.Second)
+		}
+	}
+	return dash.now()
+}
+
+// sort the process names
+func (dash *dashboard) sort() {
+	dash.names = dash.names[:0]
+	for name := range dash.rows {
+		dash.names = append(dash.names, name)
+	}
+	sort.Slice(dash.names, func(i, j int) bool {
+		a, b := dash.rows[dash.names[i]], dash.rows[dash.names[j]]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		return a.Name < b.Name
+	})
+	if dash.selected >= len(dash.names) {
+		dash.selected = len(dash.names) - 1
+	}
+	if dash.selected < 0 {
+		dash.selected = 0
+	}
+}
+
+// fullName returns the group:name of a process as accepted by the RPC interface.
+func fullName(proc supervisor.Process) string {
+	return proc.Group + ":" + proc.Name
+}
+
+// current returns the selected row or nil if there are no processes.
+func (dash *dashboard) current() *row {
+	if len(dash.names) == 0 {
+		return nil
+	}
+	return dash.rows[dash.names[dash.selected]]
+}
+
+// key handles a key press. It returns false when the dashboard should exit.
+func (dash *dashboard) key(key rune) bool {
+	switch key {
+	case 'q', keyCtrlC:
+		return false
+	case 'k', keyUp:
+		if dash.selected > 0 {
+			dash.selected--
+		}
+	case 'j', keyDown:
+		if dash.selected < len(dash.names)-1 {
+			dash.selected++
+		}
+	case 's', 'x', 'r':
+		dash.action(key)
+	case 't':
+		if r := dash.current(); r != nil && dash.tailing == "" {
+			dash.tailing = fullName(r.Process)
+			dash.refreshTail()
+		} else {
+			dash.tailing = ""
+			dash.tail = ""
+		}
+	}
+	return true
+}
+
+// action starts, stops, or restarts the selected process. Calls do not wait for the process so the
+// dashboard stays responsive; the Monitor reports the state changes.
+func (dash *dashboard) action(key rune) {
+	r := dash.current()
+	if r == nil || dash.client == nil {
+		return
+	}
+	name := fullName(r.Process)
+	var err error
+	switch key {
+	case 's':
+		_, err = dash.client.StartProcess(name, false)
+		dash.status = "starting " + name
+	case 'x':
+		_, err = dash.client.StopProcess(name, false)
+		dash.status = "stopping " + name
+	case 'r':
+		if _, err = dash.client.StopProcess(name, true); err == nil || supervisor.IsFault(err, supervisor.FaultNotRunning) {
+			_, err = dash.client.StartProcess(name, false)
+		}
+		dash.status = "restarting " + name
+	}
+	if err != nil {
+		dash.status = fmt.Sprintf("%s: ERROR (%s)", name, err)
+	}
+}
+
+// refreshTail fetches the log of the process being tailed.
+func (dash *dashboard) refreshTail() {
+	if dash.tailing == "" || dash.client == nil {
+		return
+	}
+	tail, err := dash.client.TailProcessStdoutLog(dash.tailing, 0, tailBytes)
+	if err != nil {
+		dash.tail = err.Error()
+		return
+	}
+	dash.tail = tail.Log
+}
+
+// formatDuration formats an uptime as supervisorctl does.
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	seconds := int64(d / time.Second)
+	days := seconds / 86400
+	clock := fmt.Sprintf("%d:%02d:%02d", seconds%86400/3600, seconds%3600/60, seconds%60)
+	if days > 0 {
+		return fmt.Sprintf("%dd %s", days, clock)
+	}
+	return clock
+}
+
+// fit truncates a line to the terminal width.
+func fit(line string, width int) string {
+	if width <= 0 {
+		return line
+	}
+	if len(line) > width {
+		return line[:width]
+	}
+	return line
+}
+
+// render draws a frame of the given size.
+func (dash *dashboard) render(width int, height int) string {
+	now := dash.now()
+	lines := []string{
+		fmt.Sprintf("%s (%s)  %s  %s", dash.supervisor.Name, dash.supervisor.State, dash.source, now.Format("15:04:05")),
+		fmt.Sprintf("  %-32s %-10s %7s %12s %8s", "NAME", "STATE", "PID", "UPTIME", "RESTARTS"),
+	}
+
+	footer := []string{dash.status, "[j/k] select  [s]tart  [x] stop  [r]estart  [t]ail  [q]uit"}
+	var tail []string
+	if dash.tailing != "" {
+		tail = append([]string{"--- " + dash.tailing + " stdout ---"}, strings.Split(strings.TrimRight(dash.tail, "\n"), "\n")...)
+		if max := (height - len(lines) - len(footer)) / 2; len(tail) > max && max > 0 {
+			tail = append(tail[:1], tail[len(tail)-max+1:]...)
+		}
+	}
+
+	// scroll the process list so the selected row is visible
+	rows := height - len(lines) - len(footer) - len(tail)
+	if rows < 1 {
+		rows = len(dash.names)
+	}
+	first := 0
+	if dash.selected >= rows {
+		first = dash.selected - rows + 1
+	}
+	for i := first; i < len(dash.names) && i < first+rows; i++ {
+		r := dash.rows[dash.names[i]]
+		mark := " "
+		if i == dash.selected {
+			mark = ">"
+		}
+		pid := "-"
+		if r.PID > 0 {
+			pid = fmt.Sprint(r.PID)
+		}
+		lines = append(lines, fmt.Sprintf("%s %-32s %-10s %7s %12s %8d", mark, fullName(r.Process), r.State, pid, formatDuration(r.uptime(now)), r.starts.Restarts))
+	}
+	for i := len(dash.names) - first; i < rows; i++ {
+		lines = append(lines, "")
+	}
+	lines = append(lines, tail...)
+	lines = append(lines, footer...)
+
+	for i, line := range lines {
+		lines[i] = fit(line, width)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errTest = errors.New("connection refused")
+
+// Test that Monitor events update the rows, uptime and restart counts.
+func TestDashboardHandle(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	dash := newDashboard(nil, "test")
+	dash.now = func() time.Time {
+		return now
+	}
+	sup := supervisor.Supervisor{Name: "host", State: "RUNNING"}
+	web := supervisor.Process{Name: "web", Group: "web", State: supervisor.Running, PID: 10}
+	cron := supervisor.Process{Name: "cron", Group: "jobs", State: supervisor.Stopped}
+
+	dash.handle(supervisor.SupervisorStateEvent{Supervisor: sup})
+	dash.handle(supervisor.ProcessAddEvent{Supervisor: sup, Process: web})
+	dash.handle(supervisor.ProcessAddEvent{Supervisor: sup, Process: cron})
+	if len(dash.names) != 2 || dash.names[0] != "cron" || dash.names[1] != "web" {
+		t.Fatalf(`dashboard.names => %v, want [cron web]`, dash.names)
+	}
+
+	// a listener sees STARTING then RUNNING
+	now = now.Add(time.Minute)
+	cron.State = supervisor.Starting
+	cron.PID = 20
+	dash.handle(supervisor.ProcessStateEvent{Supervisor: sup, Process: cron, FromState: supervisor.Stopped})
+	cron.State = supervisor.Running
+	dash.handle(supervisor.ProcessStateEvent{Supervisor: sup, Process: cron, FromState: supervisor.Starting})
+
+	// a poll only sees a new pid
+	web.PID = 11
+	dash.handle(supervisor.ProcessStateEvent{Supervisor: sup, Process: web, FromState: supervisor.Running})
+
+	now = now.Add(90 * time.Second)
+	if r := dash.rows["cron"]; r.starts.Restarts != 1 || r.uptime(now) != 90*time.Second {
+		t.Errorf(`dashboard.rows["cron"] => restarts %d uptime %s, want 1 and 1m30s`, r.starts.Restarts, r.uptime(now))
+	}
+	if r := dash.rows["web"]; r.starts.Restarts != 1 || r.PID != 11 {
+		t.Errorf(`dashboard.rows["web"] => restarts %d pid %d, want 1 and 11`, r.starts.Restarts, r.PID)
+	}
+
+	dash.handle(supervisor.RefreshErrorEvent{Supervisor: sup, Error: errTest, Retry: time.Second})
+	if !strings.Contains(dash.status, "refresh failed") {
+		t.Errorf(`dashboard.status => %q, want refresh error`, dash.status)
+	}
+
+	dash.key('j')
+	dash.handle(supervisor.ProcessRemoveEvent{Supervisor: sup, Process: web})
+	if len(dash.names) != 1 || dash.selected != 0 {
+		t.Errorf(`dashboard => names %v selected %d, want [cron] and 0`, dash.names, dash.selected)
+	}
+	if dash.key('q') {
+		t.Errorf(`dashboard.key('q') => true, want false`)
+	}
+}
+
+// Test rendering and scrolling.
+func TestDashboardRender(t *testing.T) {
+	dash := newDashboard(nil, "test")
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		dash.handle(supervisor.ProcessAddEvent{Process: supervisor.Process{Name: name, Group: "g", State: supervisor.Stopped}})
+	}
+	for i := 0; i < 4; i++ {
+		dash.key(keyDown)
+	}
+
+	lines := strings.Split(dash.render(40, 6), "\n")
+	if len(lines) != 6 {
+		t.Fatalf(`dashboard.render() => %d lines, want 6`, len(lines))
+	}
+	if !strings.HasPrefix(lines[2], "  g:d") || !strings.HasPrefix(lines[3], "> g:e") {
+		t.Errorf("dashboard.render() =>\n%s\nwant g:d and selected g:e", strings.Join(lines, "\n"))
+	}
+	for _, line := range lines {
+		if len(line) > 40 {
+			t.Errorf(`dashboard.render() => line %q longer than 40`, line)
+		}
+	}
+
+	for d, want := range map[time.Duration]string{0: "-", 65 * time.Second: "0:01:05", 26 * time.Hour: "1d 2:00:00"} {
+		if got := formatDuration(d); got != want {
+			t.Errorf(`formatDuration(%s) => %q, want %q`, d, got, want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Command supervisortop is a live terminal dashboard of Supervisor processes. It polls Supervisor or
+// runs as a Supervisor event listener and shows the state, pid, uptime and restart count of every
+// process. Processes can be started, stopped, restarted and tailed from the dashboard.
+//
+// To run as an event listener add a section like the following to supervisord.conf and start the
+// listener with the terminal the dashboard should be drawn on:
+//
+//	[eventlistener:top]
+//	command=supervisortop -listen -tty /dev/pts/3
+//	events=PROCESS_STATE,SUPERVISOR_STATE_CHANGE,TICK_5
+//	autostart=false
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/internal/term"
+	"github.com/rynbrd/go-supervisor/supervisor"
+	"io"
+	"os"
+	"time"
+)
+
+// Special keys are mapped to runes outside of the unicode range.
+const (
+	keyCtrlC rune = 3
+	keyUp    rune = 0x110000 + iota
+	keyDown
+)
+
+const (
+	defaultServerURL string = "http://localhost:9001"
+)
+
+// readKeys decodes key presses from a terminal and sends them to the channel until the input ends.
+func readKeys(in io.Reader, keys chan rune) {
+	defer close(keys)
+	reader := bufio.NewReader(in)
+	for {
+		key, _, err := reader.ReadRune()
+		if err != nil {
+			return
+		}
+		if key == 27 && reader.Buffered() >= 2 {
+			if next, _ := reader.ReadByte(); next == '[' || next == 'O' {
+				switch code, _ := reader.ReadByte(); code {
+				case 'A':
+					key = keyUp
+				case 'B':
+					key = keyDown
+				}
+			}
+		}
+		keys <- key
+	}
+}
+
+// run executes the command line and returns the exit code.
+func run(args []string) int {
+	var serverURL, username, password, tty string
+	var listen bool
+	config := supervisor.DefaultPollConfig
+	config.Interval = 2 * time.Second
+	config.Jitter = 0
+
+	flags := flag.NewFlagSet("supervisortop", flag.ContinueOnError)
+	flags.StringVar(&serverURL, "s", defaultServerURL, "URL on which supervisord server is listening")
+	flags.StringVar(&username, "u", "", "username to use for authentication with server")
+	flags.StringVar(&password, "p", "", "password to use for authentication with server")
+	flags.DurationVar(&config.Interval, "interval", config.Interval, "time between polls")
+	flags.BoolVar(&listen, "listen", false, "run as a supervisor event listener on stdin and stdout")
+	flags.StringVar(&tty, "tty", "", "terminal to draw on, required with -listen")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// the terminal to draw on and read keys from
+	display := os.Stdin
+	output := os.Stdout
+	if tty != "" {
+		file, err := os.OpenFile(tty, os.O_RDWR, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return 1
+		}
+		defer file.Close()
+		display, output = file, file
+	} else if listen {
+		fmt.Fprintln(os.Stderr, "Error: -tty is required with -listen")
+		return 2
+	}
+	fd := int(display.Fd())
+	if !term.IsTerminal(fd) {
+		fmt.Fprintln(os.Stderr, "Error: not a terminal")
+		return 1
+	}
+
+	client, err := supervisor.DialClient(serverURL, username, password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", serverURL, err)
+		return 1
+	}
+	defer client.Close()
+
+	events := make(chan interface{})
+	stop := make(chan bool)
+	source := fmt.Sprintf("%s every %s", serverURL, config.Interval)
+	var mon supervisor.Monitor
+	if listen {
+		source = serverURL + " events"
+		mon = supervisor.NewMonitorWithClient(client, os.Stdin, os.Stdout, events)
+		mon.RefreshOnGap = true
+	} else {
+		mon = supervisor.NewMonitorWithClient(client, nil, nil, events)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		if listen {
+			if err := mon.Refresh(); err != nil {
+				events <- supervisor.RefreshErrorEvent{Supervisor: *mon.Supervisor, Error: err, Failures: 1}
+			}
+			done <- mon.Run()
+		} else {
+			done <- mon.Poll(config, stop)
+		}
+	}()
+
+	restore, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	defer restore()
+	fmt.Fprint(output, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(output, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan rune)
+	go readKeys(display, keys)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	dash := newDashboard(&client, source)
+	for {
+		width, height, _ := term.Size(fd)
+		fmt.Fprint(output, "\x1b[H\x1b[2J"+dash.render(width, height))
+
+		select {
+		case event := <-events:
+			dash.handle(event)
+		case key, ok := <-keys:
+			if !ok || !dash.key(key) {
+				close(stop)
+				return 0
+			}
+		case err := <-done:
+			if err != nil {
+				restore()
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				return 1
+			}
+			return 0
+		case <-ticker.C:
+			dash.refreshTail()
+		}
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
@@ -0,0 +1,56 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+// Package term provides the small amount of terminal control needed by the command line tools.
+package term
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// MakeRaw puts a terminal into raw mode and returns a function which restores it. Output
+// processing is left on so newlines are still translated. An error is returned if fd is not a
+// terminal.
+func MakeRaw(fd int) (restore func(), err error) {
+	var old syscall.Termios
+	if err = ioctl(fd, ioctlGetTermios, unsafe.Pointer(&old)); err != nil {
+		return
+	}
+	raw := old
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err = ioctl(fd, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return
+	}
+	restore = func() {
+		ioctl(fd, ioctlSetTermios, unsafe.Pointer(&old))
+	}
+	return
+}
+
+// IsTerminal returns true if fd is a terminal.
+func IsTerminal(fd int) bool {
+	var state syscall.Termios
+	return ioctl(fd, ioctlGetTermios, unsafe.Pointer(&state)) == nil
+}
+
+// Size returns the width and height of a terminal.
+func Size(fd int) (width int, height int, err error) {
+	var size struct {
+		rows, cols, xpixel, ypixel uint16
+	}
+	if err = ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&size)); err != nil {
+		return
+	}
+	return int(size.cols), int(size.rows), nil
+}
+
+func ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+package term
+
+import (
+	"syscall"
+)
+
+const (
+	ioctlGetTermios uintptr = syscall.TIOCGETA
+	ioctlSetTermios uintptr = syscall.TIOCSETA
+)
@@ -0,0 +1,10 @@
+package term
+
+import (
+	"syscall"
+)
+
+const (
+	ioctlGetTermios uintptr = syscall.TCGETS
+	ioctlSetTermios uintptr = syscall.TCSETS
+)
@@ -0,0 +1,25 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+// Package term provides the small amount of terminal control needed by the command line tools.
+package term
+
+import (
+	"errors"
+)
+
+var errUnsupported = errors.New("terminal control is not supported on this platform")
+
+// MakeRaw is not supported on this platform.
+func MakeRaw(fd int) (restore func(), err error) {
+	return nil, errUnsupported
+}
+
+// IsTerminal always returns false on this platform.
+func IsTerminal(fd int) bool {
+	return false
+}
+
+// Size is not supported on this platform.
+func Size(fd int) (width int, height int, err error) {
+	return 0, 0, errUnsupported
+}
@@ -0,0 +1,488 @@
+package supervisor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigError is an error found at a position in a configuration file.
+type ConfigError struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (err ConfigError) Error() string {
+	if err.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", err.Path, err.Line, err.Message)
+	}
+	return fmt.Sprintf("%s: %s", err.Path, err.Message)
+}
+
+// ConfigOption is a key and value in a configuration section. Values which span multiple lines are
+// joined with newlines.
+type ConfigOption struct {
+	Key      string
+	Value    string
+	Line     int
+	Comments []string // comment and blank lines preceding the option, verbatim
+	raw      []string
+	rawKey   string
+	rawValue string
+}
+
+// ConfigSection is a named section of a configuration file.
+type ConfigSection struct {
+	Name     string
+	Path     string
+	Line     int
+	Options  []*ConfigOption
+	Comments []string // comment and blank lines preceding the section header, verbatim
+	raw      string
+	rawName  string
+}
+
+// Type returns the part of the section name before the colon, e.g. "program" for "program:web".
+func (section *ConfigSection) Type() string {
+	return strings.SplitN(section.Name, ":", 2)[0]
+}
+
+// Suffix returns the part of the section name after the colon, e.g. "web" for "program:web".
+func (section *ConfigSection) Suffix() string {
+	parts := strings.SplitN(section.Name, ":", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// Option returns the named option or nil if it is not set. If the option is set more than once the
+// last occurrence is returned.
+func (section *ConfigSection) Option(key string) *ConfigOption {
+	key = strings.ToLower(key)
+	for i := len(section.Options) - 1; i >= 0; i-- {
+		if section.Options[i].Key == key {
+			return section.Options[i]
+		}
+	}
+	return nil
+}
+
+// Get returns the raw value of an option and whether it is set.
+func (section *ConfigSection) Get(key string) (value string, ok bool) {
+	if option := section.Option(key); option != nil {
+		return option.Value, true
+	}
+	return "", false
+}
+
+// Set sets the value of an option. Existing options keep their position and comments. New options
+// are appended to the section.
+func (section *ConfigSection) Set(key string, value string) {
+	if option := section.Option(key); option != nil {
+		option.Value = value
+		return
+	}
+	section.Options = append(section.Options, &ConfigOption{Key: strings.ToLower(key), Value: value})
+}
+
+// Delete removes all occurrences of an option. It returns false if the option was not set.
+func (section *ConfigSection) Delete(key string) bool {
+	key = strings.ToLower(key)
+	options := section.Options[:0]
+	for _, option := range section.Options {
+		if option.Key != key {
+			options = append(options, option)
+		}
+	}
+	deleted := len(options) != len(section.Options)
+	section.Options = options
+	return deleted
+}
+
+// ConfigFile is a parsed configuration file. Comments and formatting are preserved when it is
+// written back out.
+type ConfigFile struct {
+	Path     string
+	Sections []*ConfigSection
+	Trailer  []string // comment and blank lines after the last option, verbatim
+}
+
+// Section returns the named section or nil if it does not exist.
+func (file *ConfigFile) Section(name string) *ConfigSection {
+	for _, section := range file.Sections {
+		if section.Name == name {
+			return section
+		}
+	}
+	return nil
+}
+
+// AddSection appends an empty section to the file and returns it.
+func (file *ConfigFile) AddSection(name string) *ConfigSection {
+	section := &ConfigSection{Name: name, Path: file.Path}
+	if len(file.Sections) > 0 {
+		section.Comments = []string{""}
+	}
+	file.Sections = append(file.Sections, section)
+	return section
+}
+
+// RemoveSection removes the named section from the file. It returns false if the section does not
+// exist.
+func (file *ConfigFile) RemoveSection(name string) bool {
+	for i, section := range file.Sections {
+		if section.Name == name {
+			file.Sections = append(file.Sections[:i], file.Sections[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTo writes the file in supervisord.conf format. Unmodified options and sections are written
+// exactly as they were read.
+func (file *ConfigFile) WriteTo(writer io.Writer) (n int64, err error) {
+	buf := &bytes.Buffer{}
+	writeLines := func(lines []string) {
+		for _, line := range lines {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+
+	for _, section := range file.Sections {
+		writeLines(section.Comments)
+		if section.raw != "" && section.Name == section.rawName {
+			writeLines([]string{section.raw})
+		} else {
+			writeLines([]string{"[" + section.Name + "]"})
+		}
+		for _, option := range section.Options {
+			writeLines(option.Comments)
+			if option.raw != nil && option.Key == option.rawKey && option.Value == option.rawValue {
+				writeLines(option.raw)
+			} else {
+				value := strings.Replace(option.Value, "\n", "\n    ", -1)
+				writeLines([]string{option.Key + "=" + value})
+			}
+		}
+	}
+	writeLines(file.Trailer)
+	return buf.WriteTo(writer)
+}
+
+// Bytes returns the file in supervisord.conf format.
+func (file *ConfigFile) Bytes() []byte {
+	buf := &bytes.Buffer{}
+	file.WriteTo(buf)
+	return buf.Bytes()
+}
+
+// isConfigComment returns true if the trimmed line is blank or a comment.
+func isConfigComment(trimmed string) bool {
+	return trimmed == "" || trimmed[0] == ';' || trimmed[0] == '#'
+}
+
+// stripInlineComment removes a trailing comment from a value. Inline comments start with a ; or #
+// preceded by whitespace.
+func stripInlineComment(value string) string {
+	for i := 1; i < len(value); i++ {
+		if (value[i] == ';' || value[i] == '#') && (value[i-1] == ' ' || value[i-1] == '\t') {
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return value
+}
+
+// ParseConfig parses a single supervisord.conf style file. The path is used to report errors and
+// to resolve includes and is not read. Include sections are not processed.
+func ParseConfig(reader io.Reader, path string) (file *ConfigFile, err error) {
+	file = &ConfigFile{Path: path}
+	scanner := bufio.NewScanner(reader)
+
+	var section *ConfigSection
+	var option *ConfigOption
+	var pending []string
+	lineno := 0
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		lineno++
+
+		switch {
+		case option != nil && len(pending) == 0 && trimmed != "" && (line[0] == ' ' || line[0] == '\t'):
+			// continuation of a multi-line value
+			option.raw = append(option.raw, line)
+			if !isConfigComment(trimmed) {
+				option.Value += "\n" + stripInlineComment(trimmed)
+				option.rawValue = option.Value
+			}
+		case isConfigComment(trimmed):
+			pending = append(pending, line)
+		case trimmed[0] == '[':
+			end := strings.Index(trimmed, "]")
+			if end < 2 {
+				return nil, ConfigError{path, lineno, fmt.Sprintf("invalid section header: %s", trimmed)}
+			}
+			name := strings.TrimSpace(trimmed[1:end])
+			section = &ConfigSection{
+				Name:     name,
+				Path:     path,
+				Line:     lineno,
+				Comments: pending,
+				raw:      line,
+				rawName:  name,
+			}
+			file.Sections = append(file.Sections, section)
+			option = nil
+			pending = nil
+		default:
+			if section == nil {
+				return nil, ConfigError{path, lineno, "option found before first section"}
+			}
+			index := strings.IndexAny(trimmed, "=:")
+			if index <= 0 {
+				return nil, ConfigError{path, lineno, fmt.Sprintf("invalid line: %s", trimmed)}
+			}
+			key := strings.ToLower(strings.TrimSpace(trimmed[:index]))
+			value := stripInlineComment(strings.TrimSpace(trimmed[index+1:]))
+			option = &ConfigOption{
+				Key:      key,
+				Value:    value,
+				Line:     lineno,
+				Comments: pending,
+				raw:      []string{line},
+				rawKey:   key,
+				rawValue: value,
+			}
+			section.Options = append(section.Options, option)
+			pending = nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	file.Trailer = pending
+	return
+}
+
+// ReadConfigFile reads and parses a single configuration file. Include sections are not processed.
+func ReadConfigFile(path string) (*ConfigFile, error) {
+	reader, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ParseConfig(reader, path)
+}
+
+// Write writes the file back to its path.
+func (file *ConfigFile) Write() error {
+	return ioutil.WriteFile(file.Path, file.Bytes(), 0644)
+}
+
+// configVars returns the expansion variables available to every section of a file.
+func configVars(path string) map[string]string {
+	vars := make(map[string]string)
+	for _, env := range os.Environ() {
+		if pair := strings.SplitN(env, "=", 2); len(pair) == 2 {
+			vars["ENV_"+pair[0]] = pair[1]
+		}
+	}
+	if host, err := os.Hostname(); err == nil {
+		vars["host_node_name"] = host
+	}
+	if dir, err := filepath.Abs(filepath.Dir(path)); err == nil {
+		vars["here"] = dir
+	}
+	return vars
+}
+
+// ExpandConfig performs Python style %(name)s expansion on a value. The s and d conversions are
+// supported along with flags and width, e.g. %(process_num)02d. A literal % is written as %%.
+func ExpandConfig(value string, vars map[string]string) (string, error) {
+	if !strings.Contains(value, "%") {
+		return value, nil
+	}
+
+	buf := &bytes.Buffer{}
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			buf.WriteByte(value[i])
+			continue
+		}
+		if i+1 < len(value) && value[i+1] == '%' {
+			buf.WriteByte('%')
+			i++
+			continue
+		}
+		if i+1 >= len(value) || value[i+1] != '(' {
+			return "", errors.New(fmt.Sprintf("invalid expansion at offset %d in %q", i, value))
+		}
+		end := strings.IndexByte(value[i:], ')')
+		if end < 0 {
+			return "", errors.New(fmt.Sprintf("unterminated expansion in %q", value))
+		}
+		name := value[i+2 : i+end]
+		j := i + end + 1
+		for j < len(value) && strings.IndexByte("-+ #0123456789.", value[j]) >= 0 {
+			j++
+		}
+		if j >= len(value) {
+			return "", errors.New(fmt.Sprintf("missing conversion for %%(%s) in %q", name, value))
+		}
+		flags := value[i+end+1 : j]
+
+		str, ok := vars[name]
+		if !ok {
+			return "", errors.New(fmt.Sprintf("unknown expansion %%(%s)%c", name, value[j]))
+		}
+		switch value[j] {
+		case 's', 'r':
+			fmt.Fprintf(buf, "%"+flags+"s", str)
+		case 'd', 'i':
+			num, err := strconv.Atoi(str)
+			if err != nil {
+				return "", errors.New(fmt.Sprintf("expansion %%(%s)d is not a number: %s", name, str))
+			}
+			fmt.Fprintf(buf, "%"+flags+"d", num)
+		default:
+			return "", errors.New(fmt.Sprintf("unsupported conversion %%(%s)%c", name, value[j]))
+		}
+		i = j
+	}
+	return buf.String(), nil
+}
+
+// Config is a supervisord.conf file along with the files it includes.
+type Config struct {
+	Files          []*ConfigFile
+	Programs       []ProgramConfig
+	Groups         []GroupConfig
+	EventListeners []EventListenerConfig
+	FcgiPrograms   []FcgiProgramConfig
+}
+
+// includedFiles returns the sorted paths matched by the include section of a file.
+func includedFiles(file *ConfigFile) (paths []string, err error) {
+	section := file.Section("include")
+	if section == nil {
+		return
+	}
+	option := section.Option("files")
+	if option == nil {
+		return nil, ConfigError{file.Path, section.Line, "include section has no files option"}
+	}
+	value, err := ExpandConfig(option.Value, configVars(file.Path))
+	if err != nil {
+		return nil, ConfigError{file.Path, option.Line, err.Error()}
+	}
+
+	dir := filepath.Dir(file.Path)
+	for _, pattern := range strings.Fields(value) {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		var matches []string
+		if matches, err = filepath.Glob(pattern); err != nil {
+			return nil, ConfigError{file.Path, option.Line, err.Error()}
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	return
+}
+
+// readIncludes reads the files named by the include section of the main file.
+func readIncludes(main *ConfigFile) (files []*ConfigFile, err error) {
+	paths, err := includedFiles(main)
+	if err != nil {
+		return
+	}
+	for _, include := range paths {
+		var file *ConfigFile
+		if file, err = ReadConfigFile(include); err != nil {
+			return
+		}
+		files = append(files, file)
+	}
+	return
+}
+
+// LoadConfig reads a supervisord.conf file and the files named by its include section.
+func LoadConfig(path string) (config *Config, err error) {
+	main, err := ReadConfigFile(path)
+	if err != nil {
+		return
+	}
+	includes, err := readIncludes(main)
+	if err != nil {
+		return
+	}
+	return NewConfig(append([]*ConfigFile{main}, includes...)...)
+}
+
+// NewConfig builds a config from parsed files. The first file is the main configuration file. An
+// error is returned for the first invalid value found.
+func NewConfig(files ...*ConfigFile) (config *Config, err error) {
+	config = &Config{Files: files}
+	sections := config.Sections()
+	groups := programGroups(sections)
+	for _, section := range sections {
+		decoder := newConfigDecoder(section, groups)
+		switch section.Type() {
+		case "program":
+			config.Programs = append(config.Programs, decoder.program())
+		case "group":
+			config.Groups = append(config.Groups, decoder.group())
+		case "eventlistener":
+			config.EventListeners = append(config.EventListeners, decoder.eventListener())
+		case "fcgi-program":
+			config.FcgiPrograms = append(config.FcgiPrograms, decoder.fcgiProgram())
+		}
+		if len(decoder.errors) > 0 {
+			return nil, decoder.errors[0]
+		}
+	}
+	return
+}
+
+// Sections returns the sections of all files in order.
+func (config *Config) Sections() []*ConfigSection {
+	var sections []*ConfigSection
+	for _, file := range config.Files {
+		sections = append(sections, file.Sections...)
+	}
+	return sections
+}
+
+// Section returns the first section with the given name in any file or nil if none exists.
+func (config *Config) Section(name string) *ConfigSection {
+	for _, file := range config.Files {
+		if section := file.Section(name); section != nil {
+			return section
+		}
+	}
+	return nil
+}
+
+// Save writes all files back to their paths.
+func (config *Config) Save() error {
+	for _, file := range config.Files {
+		if err := file.Write(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `; supervisord config
+[supervisord]
+logfile = /var/log/supervisord.log ; main log
+
+[include]
+files = conf.d/*.conf
+
+# the web application
+[program:web]
+command=/usr/bin/web --port=%(process_num)d
+process_name=%(program_name)s_%(process_num)02d
+numprocs=2
+numprocs_start=8000
+autorestart: true
+environment=HOME="/home/web",PATH="/usr/bin:%(ENV_SUPERVISOR_TEST)s", DEBUG=1
+exitcodes=0,2
+stdout_logfile_maxbytes=1MB
+
+[group:apps]
+programs=web,worker
+priority=10
+; trailing comment
+`
+
+const testInclude = `[program:worker]
+command=/usr/bin/worker
+	--queue=default
+autostart=false
+directory=/srv/%(group_name)s
+
+[eventlistener:crashmail]
+command=/usr/bin/crashmail
+events=PROCESS_STATE_EXITED, PROCESS_STATE_FATAL
+directory=/srv/%(group_name)s
+
+[fcgi-program:php]
+command=/usr/bin/php-cgi
+socket=unix:///var/run/%(program_name)s.sock
+`
+
+// Write a file into a directory.
+func writeTestFile(t *testing.T, dir string, name string, data string) string {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Test that parsing and writing a file preserves it exactly.
+func TestConfigRoundTrip(t *testing.T) {
+	file, err := ParseConfig(strings.NewReader(testConfig+testInclude), "supervisord.conf")
+	if err != nil {
+		t.Fatalf(`ParseConfig() => error{"%v"}, want nil`, err)
+	}
+	if out := string(file.Bytes()); out != testConfig+testInclude {
+		t.Errorf("ConfigFile.Bytes() =>\n%s\nwant\n%s", out, testConfig+testInclude)
+	}
+
+	worker := file.Section("program:worker")
+	if value, _ := worker.Get("command"); value != "/usr/bin/worker\n--queue=default" {
+		t.Errorf(`ConfigSection.Get("command") => %q, want multi-line value`, value)
+	}
+	if option := worker.Option("autostart"); option == nil || option.Line != 26 {
+		t.Errorf(`ConfigSection.Option("autostart") => %+v, want line 26`, option)
+	}
+	if value, _ := file.Section("supervisord").Get("logfile"); value != "/var/log/supervisord.log" {
+		t.Errorf(`ConfigSection.Get("logfile") => %q, want inline comment removed`, value)
+	}
+
+	// modify the file and verify the comments are kept
+	file.Section("program:web").Set("numprocs", "4")
+	file.Section("program:web").Delete("exitcodes")
+	file.RemoveSection("fcgi-program:php")
+	file.AddSection("program:cron").Set("command", "/usr/sbin/cron")
+	out := string(file.Bytes())
+	for _, want := range []string{"# the web application\n[program:web]\n", "numprocs=4\n", "logfile = /var/log/supervisord.log ; main log\n", "; trailing comment\n", "\n[program:cron]\ncommand=/usr/sbin/cron\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("ConfigFile.Bytes() =>\n%s\nwant it to contain %q", out, want)
+		}
+	}
+	for _, unwanted := range []string{"exitcodes", "php"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("ConfigFile.Bytes() =>\n%s\nwant no %q", out, unwanted)
+		}
+	}
+
+	if _, err := ParseConfig(strings.NewReader("command=/bin/true\n"), "bad.conf"); err == nil {
+		t.Errorf(`ParseConfig() => nil, want error for option before section`)
+	} else if configErr, ok := err.(ConfigError); !ok || configErr.Line != 1 {
+		t.Errorf(`ParseConfig() => error{"%v"}, want ConfigError at line 1`, err)
+	}
+}
+
+// Test expansion of config values.
+func TestExpandConfig(t *testing.T) {
+	vars := map[string]string{"program_name": "web", "process_num": "7"}
+	verify := func(value string, want string) {
+		if got, err := ExpandConfig(value, vars); err != nil {
+			t.Errorf(`ExpandConfig(%q) => error{"%v"}, want %q`, value, err, want)
+		} else if got != want {
+			t.Errorf(`ExpandConfig(%q) => %q, want %q`, value, got, want)
+		}
+	}
+	verify("%(program_name)s-%(process_num)03d", "web-007")
+	verify("100%%", "100%")
+	verify("plain", "plain")
+
+	for _, value := range []string{"%(missing)s", "%(program_name)", "%(program_name)d", "50%"} {
+		if _, err := ExpandConfig(value, vars); err == nil {
+			t.Errorf(`ExpandConfig(%q) => nil, want error`, value)
+		}
+	}
+}
+
+// Test loading a config with includes into typed sections.
+func TestLoadConfig(t *testing.T) {
+	os.Setenv("SUPERVISOR_TEST", "/opt/bin")
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "supervisord.conf", testConfig)
+	writeTestFile(t, dir, "conf.d/apps.conf", testInclude)
+	writeTestFile(t, dir, "conf.d/ignored.ini", "[program:ignored]\ncommand=/bin/true\n")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf(`LoadConfig() => error{"%v"}, want nil`, err)
+	}
+	if len(config.Files) != 2 {
+		t.Fatalf(`LoadConfig() => %d files, want 2`, len(config.Files))
+	}
+	if len(config.Programs) != 2 || len(config.Groups) != 1 || len(config.EventListeners) != 1 || len(config.FcgiPrograms) != 1 {
+		t.Fatalf(`LoadConfig() => %d programs, %d groups, %d listeners, %d fcgi programs, want 2, 1, 1, 1`,
+			len(config.Programs), len(config.Groups), len(config.EventListeners), len(config.FcgiPrograms))
+	}
+
+	web := config.Programs[0]
+	if web.Command != "/usr/bin/web --port=8000" {
+		t.Errorf(`ProgramConfig.Command => %q, want "/usr/bin/web --port=8000"`, web.Command)
+	}
+	if web.Autorestart != "true" || !web.Autostart || web.StartRetries != 3 || web.StdoutLogfileMaxBytes != 1<<20 {
+		t.Errorf(`ProgramConfig => %+v, want autorestart=true autostart=true startretries=3 maxbytes=1MB`, web)
+	}
+	if len(web.ExitCodes) != 2 || web.ExitCodes[1] != 2 {
+		t.Errorf(`ProgramConfig.ExitCodes => %v, want [0 2]`, web.ExitCodes)
+	}
+	if web.Environment["PATH"] != "/usr/bin:/opt/bin" || web.Environment["HOME"] != "/home/web" || web.Environment["DEBUG"] != "1" {
+		t.Errorf(`ProgramConfig.Environment => %v`, web.Environment)
+	}
+	if names, err := web.ProcessNames(); err != nil || !cmpStrings(names, []string{"web_8000", "web_8001"}) {
+		t.Errorf(`ProgramConfig.ProcessNames() => %v, error{"%v"}, want [web_8000 web_8001]`, names, err)
+	}
+
+	worker := config.Programs[1]
+	if worker.Command != "/usr/bin/worker\n--queue=default" || worker.Autostart {
+		t.Errorf(`ProgramConfig => %+v, want multi-line command and autostart=false`, worker)
+	}
+	// group_name is the group listing a program and the program name otherwise
+	if worker.Directory != "/srv/apps" {
+		t.Errorf(`ProgramConfig.Directory => %q, want "/srv/apps"`, worker.Directory)
+	}
+	if listener := config.EventListeners[0]; listener.Directory != "/srv/crashmail" {
+		t.Errorf(`EventListenerConfig.Directory => %q, want "/srv/crashmail"`, listener.Directory)
+	}
+	if group := config.Groups[0]; group.Name != "apps" || !cmpStrings(group.Programs, []string{"web", "worker"}) || group.Priority != 10 {
+		t.Errorf(`GroupConfig => %+v`, group)
+	}
+	if listener := config.EventListeners[0]; !cmpStrings(listener.Events, []string{"PROCESS_STATE_EXITED", "PROCESS_STATE_FATAL"}) || listener.BufferSize != 10 {
+		t.Errorf(`EventListenerConfig => %+v`, listener)
+	}
+	if php := config.FcgiPrograms[0]; php.Socket != "unix:///var/run/php.sock" {
+		t.Errorf(`FcgiProgramConfig.Socket => %q, want "unix:///var/run/php.sock"`, php.Socket)
+	}
+
+	// invalid values report their position
+	writeTestFile(t, dir, "conf.d/apps.conf", "[program:bad]\ncommand=/bin/true\nautorestart=sometimes\n")
+	if _, err := LoadConfig(path); err == nil {
+		t.Errorf(`LoadConfig() => nil, want error`)
+	} else if configErr, ok := err.(ConfigError); !ok || configErr.Line != 3 || !strings.HasSuffix(configErr.Path, "apps.conf") {
+		t.Errorf(`LoadConfig() => error{"%v"}, want ConfigError at apps.conf:3`, err)
+	}
+}
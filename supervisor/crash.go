@@ -0,0 +1,193 @@
+package supervisor
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"text/template"
+	"time"
+)
+
+const (
+	// DefaultCrashSubject is the template of the subject of crash notifications.
+	DefaultCrashSubject string = `{{.Process}} {{.State}} on {{.Host}}`
+
+	// DefaultCrashBody is the template of the body of crash notifications.
+	DefaultCrashBody string = `Process {{.Process}} on {{.Host}} went from {{.FromState}} to {{.State}} at {{.Time.Format "2006-01-02 15:04:05 MST"}}.
+{{if .PID}}pid: {{.PID}}
+{{end}}{{if .Tries}}tries: {{.Tries}}
+{{end}}{{if .Suppressed}}
+{{.Suppressed}} earlier notifications for this process were suppressed.
+{{end}}{{if .TailError}}
+The stderr log could not be read: {{.TailError}}
+{{else if .Tail}}
+Last stderr output:
+{{.Tail}}
+{{end}}`
+
+	// DefaultCrashTail is the number of bytes of the stderr log included in crash notifications.
+	DefaultCrashTail int64 = 2048
+)
+
+// Crash describes a process which exited unexpectedly, failed to start or gave up starting. It is
+// the data of the crash notification templates.
+type Crash struct {
+	Time       time.Time
+	Host       string
+	Process    string
+	Group      string
+	Name       string
+	State      string
+	FromState  string
+	PID        int
+	Tries      int
+	Tail       string
+	TailError  string
+	Suppressed int
+	Event      Event
+}
+
+// CrashNotifier is an event listener which sends a notification when a process exits unexpectedly,
+// backs off or becomes FATAL, in the manner of superlance's crashmail. The notification is rendered
+// from the Subject and Body templates with a Crash and includes the last TailBytes of the process's
+// stderr log. The listener must be subscribed to PROCESS_STATE events.
+//
+// Processes limits notifications to processes whose group, name or group:name is listed. Limit
+// applies to each process when LimitPerProcess is set and to all notifications otherwise; the
+// number of notifications suppressed by it is reported in the next one sent. Run passes errors
+// sending notifications to OnError.
+type CrashNotifier struct {
+	Client          Client
+	Notifier        Notifier
+	Subject         *template.Template
+	Body            *template.Template
+	States          []string
+	Processes       []string
+	TailBytes       int64
+	Limit           RateLimit
+	LimitPerProcess bool
+	OnError         func(err error)
+	host            string
+	now             func() time.Time
+	limiter         rateLimiter
+}
+
+// NewCrashNotifier creates a crash notifier which reads logs with the client and notifies for
+// unexpected exits and the BACKOFF and FATAL states.
+func NewCrashNotifier(client Client, notifier Notifier) CrashNotifier {
+	host, _ := os.Hostname()
+	return CrashNotifier{
+		Client:          client,
+		Notifier:        notifier,
+		Subject:         template.Must(template.New("subject").Parse(DefaultCrashSubject)),
+		Body:            template.Must(template.New("body").Parse(DefaultCrashBody)),
+		States:          []string{Exited, Backoff, Fatal},
+		TailBytes:       DefaultCrashTail,
+		LimitPerProcess: true,
+		host:            host,
+		now:             time.Now,
+		limiter:         newRateLimiter(),
+	}
+}
+
+// crash returns the crash described by an event. False is returned if the event is not a crash the
+// notifier reports.
+func (crashes CrashNotifier) crash(event Event) (crash Crash, ok bool) {
+	if event.Parent() != "PROCESS_STATE" {
+		return
+	}
+	state := event.State()
+	if state == Exited && event.Meta["expected"] != "0" {
+		return
+	}
+	for _, want := range crashes.States {
+		ok = ok || want == state
+	}
+	group, name := event.Meta["groupname"], event.Meta["processname"]
+	if !ok || !matchProcess(crashes.Processes, group, name) {
+		return crash, false
+	}
+	crash = Crash{
+		Time:      crashes.now(),
+		Host:      crashes.host,
+		Process:   group + ":" + name,
+		Group:     group,
+		Name:      name,
+		State:     state,
+		FromState: event.Meta["from_state"],
+		PID:       event.MetaInt("pid"),
+		Tries:     event.MetaInt("tries"),
+		Event:     event,
+	}
+	return crash, true
+}
+
+// Handle sends a notification if the event reports a crash. It returns true if a notification was
+// sent and false if the event is not a crash or the notification was suppressed by the rate limit.
+// A notification is still sent when the stderr log cannot be read.
+func (crashes CrashNotifier) Handle(event Event) (sent bool, err error) {
+	crash, ok := crashes.crash(event)
+	if !ok {
+		return
+	}
+	key := ""
+	if crashes.LimitPerProcess {
+		key = crash.Process
+	}
+	allowed, suppressed := crashes.limiter.allow(crashes.Limit, key, crash.Time)
+	if !allowed {
+		return
+	}
+	crash.Suppressed = suppressed
+
+	if crashes.TailBytes > 0 {
+		if tail, tailErr := crashes.Client.TailProcessStderrLog(crash.Process, 0, crashes.TailBytes); tailErr != nil {
+			crash.TailError = tailErr.Error()
+		} else {
+			crash.Tail = tail.Log
+		}
+	}
+
+	notification := Notification{
+		Time:    crash.Time,
+		Kind:    "crash",
+		Host:    crash.Host,
+		Process: crash.Process,
+		Group:   crash.Group,
+		Name:    crash.Name,
+		State:   crash.State,
+	}
+	var buf bytes.Buffer
+	if err = crashes.Subject.Execute(&buf, crash); err != nil {
+		return
+	}
+	notification.Subject = buf.String()
+	buf.Reset()
+	if err = crashes.Body.Execute(&buf, crash); err != nil {
+		return
+	}
+	notification.Body = buf.String()
+	if err = crashes.Notifier.Notify(notification); err != nil {
+		return
+	}
+	return true, nil
+}
+
+// Run starts the listener and handles its events until EOF. Every event is acknowledged with OK
+// since a failed notification is not fixed by Supervisor sending the event again.
+func (crashes CrashNotifier) Run(listener Listener) error {
+	listener.Ready()
+	for {
+		event, err := listener.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, err = crashes.Handle(event); err != nil && crashes.OnError != nil {
+			crashes.OnError(err)
+		}
+		listener.Ok()
+		listener.Ready()
+	}
+}
@@ -0,0 +1,203 @@
+package supervisor
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookServer collects the notifications posted to it.
+type webhookServer struct {
+	*httptest.Server
+	lock          *sync.Mutex
+	notifications []Notification
+}
+
+// newWebhookServer starts a webhook server which is closed when the test ends.
+func newWebhookServer(t *testing.T) *webhookServer {
+	hook := &webhookServer{lock: &sync.Mutex{}}
+	hook.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notification := Notification{}
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hook.lock.Lock()
+		defer hook.lock.Unlock()
+		hook.notifications = append(hook.notifications, notification)
+	}))
+	t.Cleanup(hook.Close)
+	return hook
+}
+
+// received returns the notifications posted so far.
+func (hook *webhookServer) received() []Notification {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	return append([]Notification(nil), hook.notifications...)
+}
+
+// Test that a crash notifier reports unexpected exits with the tail of the stderr log.
+func TestCrashNotifier(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "cron")...)
+	server.WriteLog("web:api", true, "starting\npanic: out of cheese\n")
+	hook := newWebhookServer(t)
+
+	crashes := NewCrashNotifier(testClient(t, server), NewWebhookNotifier(hook.URL))
+	crashes.host = "host1"
+	crashes.Processes = []string{"web"}
+	var errs []error
+	crashes.OnError = func(err error) {
+		errs = append(errs, err)
+	}
+
+	pool := supervisortest.NewEventPool("crashmail")
+	done := make(chan error)
+	go func() {
+		done <- crashes.Run(NewListener(pool.Stdin(), pool.Stdout()))
+	}()
+	pool.Emit(
+		supervisortest.TransitionEvent(supervisortest.Transition{Group: "web", Name: "api", From: Running, To: Exited, PID: 10, Expected: true}),
+		supervisortest.TransitionEvent(supervisortest.Transition{Group: "web", Name: "api", From: Running, To: Exited, PID: 11}),
+		supervisortest.TransitionEvent(supervisortest.Transition{Group: "web", Name: "api", From: Starting, To: Running, PID: 12}),
+		supervisortest.TransitionEvent(supervisortest.Transition{Group: "cron", Name: "cron", From: Backoff, To: Fatal}),
+		supervisortest.TickEvent(5, time.Unix(5, 0)),
+		supervisortest.TransitionEvent(supervisortest.Transition{Group: "web", Name: "api", From: Starting, To: Backoff, Tries: 2}),
+	)
+	if _, err := pool.Drain(0); err != nil {
+		t.Fatalf(`EventPool.Drain() => error{"%v"}, want nil`, err)
+	}
+	pool.Close()
+	if err := <-done; err != nil {
+		t.Errorf(`CrashNotifier.Run() => error{"%v"}, want nil`, err)
+	}
+	if len(errs) > 0 {
+		t.Errorf(`CrashNotifier.OnError() called with %v, want no errors`, errs)
+	}
+
+	notifications := hook.received()
+	if len(notifications) != 2 {
+		t.Fatalf(`CrashNotifier.Run() sent %d notifications, want 2`, len(notifications))
+	}
+	exited := notifications[0]
+	if exited.Kind != "crash" || exited.Process != "web:api" || exited.State != Exited || exited.Subject != "web:api EXITED on host1" {
+		t.Errorf(`notification => %+v, want crash of web:api in EXITED`, exited)
+	}
+	if !strings.Contains(exited.Body, "pid: 11\n") || !strings.Contains(exited.Body, "panic: out of cheese") {
+		t.Errorf(`notification body => %q, want pid and stderr tail`, exited.Body)
+	}
+	if backoff := notifications[1]; backoff.State != Backoff || !strings.Contains(backoff.Body, "tries: 2\n") {
+		t.Errorf(`notification => %+v, want BACKOFF after 2 tries`, backoff)
+	}
+}
+
+// Test that a crash notifier limits the rate of notifications. The batch program is unknown to
+// Supervisor so its log cannot be tailed.
+func TestCrashNotifierLimit(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "cron")...)
+	hook := newWebhookServer(t)
+	crashes := NewCrashNotifier(testClient(t, server), NewWebhookNotifier(hook.URL))
+	crashes.Limit = RateLimit{Burst: 2, Interval: time.Minute}
+	now := time.Unix(1000, 0)
+	crashes.now = func() time.Time { return now }
+
+	fatal := func(name string) Event {
+		event := createEvent(1, "PROCESS_STATE_FATAL", name, nil)
+		event.Meta["groupname"] = name
+		return event
+	}
+	steps := []struct {
+		after time.Duration
+		name  string
+		sent  bool
+	}{
+		{0, "batch", true},
+		{0, "batch", true},
+		{0, "batch", false},
+		{0, "web", true},
+		{10 * time.Second, "batch", false},
+		{50 * time.Second, "batch", true},
+	}
+	for i, step := range steps {
+		now = now.Add(step.after)
+		if sent, err := crashes.Handle(fatal(step.name)); sent != step.sent || err != nil {
+			t.Errorf(`%d: CrashNotifier.Handle(%s) => %v, error{"%v"}, want %v, nil`, i, step.name, sent, err, step.sent)
+		}
+	}
+	notifications := hook.received()
+	if last := notifications[len(notifications)-1]; !strings.Contains(last.Body, "2 earlier notifications") {
+		t.Errorf(`notification body => %q, want 2 suppressed notifications`, last.Body)
+	}
+	if !strings.Contains(notifications[0].Body, "The stderr log could not be read") {
+		t.Errorf(`notification body => %q, want tail error`, notifications[0].Body)
+	}
+}
+
+// Test sending a notification through an SMTP server.
+func TestSmtpNotifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(`net.Listen() => error{"%v"}, want nil`, err)
+	}
+	defer listener.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var lines []string
+		data := false
+		conn.Write([]byte("220 localhost ESMTP\r\n"))
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if data {
+				if line == "." {
+					data = false
+					conn.Write([]byte("250 queued\r\n"))
+				} else {
+					lines = append(lines, line)
+				}
+				continue
+			}
+			lines = append(lines, line)
+			switch {
+			case strings.HasPrefix(line, "DATA"):
+				data = true
+				conn.Write([]byte("354 go ahead\r\n"))
+			case strings.HasPrefix(line, "QUIT"):
+				conn.Write([]byte("221 bye\r\n"))
+				received <- lines
+				return
+			default:
+				conn.Write([]byte("250 ok\r\n"))
+			}
+		}
+		received <- lines
+	}()
+
+	notifier := NewSmtpNotifier(listener.Addr().String(), "supervisor@example.com", "ops@example.com")
+	err = notifier.Notify(Notification{Time: time.Unix(0, 0), Subject: "web:api FATAL\non host1", Body: "line 1\nline 2\n"})
+	if err != nil {
+		t.Fatalf(`SmtpNotifier.Notify() => error{"%v"}, want nil`, err)
+	}
+	session := strings.Join(<-received, "\n")
+	for _, want := range []string{"MAIL FROM:<supervisor@example.com>", "RCPT TO:<ops@example.com>", "Subject: web:api FATAL on host1", "\nline 1\nline 2"} {
+		if !strings.Contains(session, want) {
+			t.Errorf(`SmtpNotifier.Notify() sent %q, want %q`, session, want)
+		}
+	}
+}
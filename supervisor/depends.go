@@ -0,0 +1,161 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// how often WaitForState polls the process state
+	waitInterval time.Duration = 100 * time.Millisecond
+)
+
+// DependencyGraph records which processes must be running before others may start. Process names
+// without a group are assumed to be in a group of the same name.
+type DependencyGraph struct {
+	names    *[]string
+	requires map[string][]string
+}
+
+// NewDependencyGraph creates an empty dependency graph.
+func NewDependencyGraph() DependencyGraph {
+	return DependencyGraph{&[]string{}, make(map[string][]string)}
+}
+
+// add a node to the graph if it does not exist
+func (graph DependencyGraph) node(name string) {
+	if _, ok := graph.requires[name]; !ok {
+		graph.requires[name] = nil
+		*graph.names = append(*graph.names, name)
+	}
+}
+
+// Add adds a process to the graph which requires the given processes. Required processes are added
+// to the graph if they are not already present.
+func (graph DependencyGraph) Add(name string, requires ...string) {
+	name = qualifyName(name)
+	graph.node(name)
+	for _, require := range requires {
+		require = qualifyName(require)
+		graph.node(require)
+		graph.requires[name] = append(graph.requires[name], require)
+	}
+}
+
+// Order returns the processes of the graph such that every process follows the processes it
+// requires. Processes keep the order they were added in where possible. An error is returned if the
+// graph contains a cycle.
+func (graph DependencyGraph) Order() (order []string, err error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	marks := make(map[string]int, len(graph.requires))
+	order = make([]string, 0, len(graph.requires))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch marks[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, step := range path {
+				if step == name {
+					path = path[i:]
+					break
+				}
+			}
+			return errors.New(fmt.Sprintf("dependency cycle: %s -> %s", strings.Join(path, " -> "), name))
+		}
+		marks[name] = visiting
+		next := append(append([]string{}, path...), name)
+		for _, require := range graph.requires[name] {
+			if err := visit(require, next); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range *graph.names {
+		if err = visit(name, nil); err != nil {
+			order = nil
+			return
+		}
+	}
+	return
+}
+
+// StepError reports the step of an ordered start or stop which failed.
+type StepError struct {
+	Op   string
+	Name string
+	Step int
+	Err  error
+}
+
+func (err StepError) Error() string {
+	return fmt.Sprintf("step %d: %s %s: %s", err.Step, err.Op, err.Name, err.Err)
+}
+
+// WaitForState polls the named process until it reaches the given state. An error is returned if
+// the timeout expires or the process reaches a state from which it will not recover on its own. A
+// zero timeout waits forever.
+func (client Client) WaitForState(name string, state string, timeout time.Duration) (info ProcessInfo, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if info, err = client.GetProcessInfo(name); err != nil {
+			return
+		}
+		switch {
+		case info.StateName == state:
+			return
+		case info.StateName == Fatal || (state == Running && (info.StateName == Stopped || info.StateName == Exited)):
+			err = errors.New(fmt.Sprintf("process %s entered state %s", name, info.StateName))
+			return
+		case timeout > 0 && time.Now().After(deadline):
+			err = errors.New(fmt.Sprintf("timed out waiting for process %s to reach state %s", name, state))
+			return
+		}
+		time.Sleep(waitInterval)
+	}
+}
+
+// StartGraph starts the processes of the graph in dependency order. Each process must reach the
+// RUNNING state within the timeout before the next is started. Processes which are already running
+// are not restarted. A StepError is returned for the first process which fails to start.
+func (client Client) StartGraph(graph DependencyGraph, timeout time.Duration) error {
+	order, err := graph.Order()
+	if err != nil {
+		return err
+	}
+	for i, name := range order {
+		if _, err = client.StartProcess(name, false); err != nil && !IsFault(err, FaultAlreadyStarted) {
+			return StepError{ActionStart, name, i, err}
+		}
+		if _, err = client.WaitForState(name, Running, timeout); err != nil {
+			return StepError{ActionStart, name, i, err}
+		}
+	}
+	return nil
+}
+
+// StopGraph stops the processes of the graph in reverse dependency order. Processes which are not
+// running are skipped. A StepError is returned for the first process which fails to stop.
+func (client Client) StopGraph(graph DependencyGraph) error {
+	order, err := graph.Order()
+	if err != nil {
+		return err
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		step := len(order) - 1 - i
+		if _, err = client.StopProcess(order[i], true); err != nil && !IsFault(err, FaultNotRunning) {
+			return StepError{ActionStop, order[i], step, err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package supervisor
+
+import (
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test ordering of a dependency graph.
+func TestDependencyGraph(t *testing.T) {
+	graph := NewDependencyGraph()
+	graph.Add("web:api", "db-proxy", "cache")
+	graph.Add("cache", "db-proxy")
+
+	order, err := graph.Order()
+	if err != nil {
+		t.Fatalf(`DependencyGraph.Order() => error{"%v"}, want nil`, err)
+	}
+	if want := []string{"db-proxy:db-proxy", "cache:cache", "web:api"}; !cmpStrings(order, want) {
+		t.Errorf(`DependencyGraph.Order() => %v, want %v`, order, want)
+	}
+
+	graph.Add("db-proxy", "web:api")
+	if _, err := graph.Order(); err == nil {
+		t.Errorf(`DependencyGraph.Order() => nil, want cycle error`)
+	} else if want := "dependency cycle: web:api -> db-proxy:db-proxy -> web:api"; err.Error() != want {
+		t.Errorf(`DependencyGraph.Order() => error{"%v"}, want error{"%s"}`, err, want)
+	}
+}
+
+// Test starting and stopping a dependency graph.
+func TestStartStopGraph(t *testing.T) {
+	waitInterval = 5 * time.Millisecond
+	programs := supervisortest.Programs("web:api", "db-proxy", "cache")
+	for i := range programs {
+		programs[i].StartSecs = 20 * time.Millisecond
+	}
+	server := newTestServer(t, programs...)
+	server.SetState("cache", Running)
+	client := testClient(t, server)
+
+	graph := NewDependencyGraph()
+	graph.Add("web:api", "db-proxy", "cache")
+	graph.Add("cache", "db-proxy")
+
+	if err := client.StartGraph(graph, time.Second); err != nil {
+		t.Fatalf(`Client.StartGraph() => error{"%v"}, want nil`, err)
+	}
+	want := []string{"start db-proxy:db-proxy", "start cache:cache", "start web:api"}
+	if actions := actions(server); !cmpStrings(actions, want) {
+		t.Errorf(`Client.StartGraph() called %v, want %v`, actions, want)
+	}
+	for _, name := range []string{"web:api", "db-proxy", "cache"} {
+		if state := server.State(name); state != Running {
+			t.Errorf(`state of %s => "%s", want "RUNNING"`, name, state)
+		}
+	}
+
+	server.ResetCalls()
+	if err := client.StopGraph(graph); err != nil {
+		t.Fatalf(`Client.StopGraph() => error{"%v"}, want nil`, err)
+	}
+	want = []string{"stop web:api", "stop cache:cache", "stop db-proxy:db-proxy"}
+	if actions := actions(server); !cmpStrings(actions, want) {
+		t.Errorf(`Client.StopGraph() called %v, want %v`, actions, want)
+	}
+}
+
+// Test that a failed start reports the failed step.
+func TestStartGraphFailure(t *testing.T) {
+	waitInterval = 5 * time.Millisecond
+	programs := supervisortest.Programs("web:api", "db-proxy")
+	programs[1].SpawnError = "can't find command '/bin/db-proxy'"
+	server := newTestServer(t, programs...)
+	client := testClient(t, server)
+
+	graph := NewDependencyGraph()
+	graph.Add("web:api", "db-proxy")
+
+	err := client.StartGraph(graph, time.Second)
+	if stepErr, ok := err.(StepError); !ok {
+		t.Fatalf(`Client.StartGraph() => error{"%v"}, want StepError`, err)
+	} else if stepErr.Step != 0 || stepErr.Name != "db-proxy:db-proxy" || !IsFault(stepErr.Err, FaultSpawnError) {
+		t.Errorf(`Client.StartGraph() => %v, want SPAWN_ERROR at step 0 for db-proxy:db-proxy`, stepErr)
+	}
+	if state := server.State("web:api"); state != Stopped {
+		t.Errorf(`state of web:api => "%s", want "STOPPED"`, state)
+	}
+
+	graph.Add("db-proxy", "web:api")
+	if err := client.StartGraph(graph, time.Second); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf(`Client.StartGraph() => error{"%v"}, want cycle error`, err)
+	}
+}
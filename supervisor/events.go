@@ -83,7 +83,7 @@ func ReadEvent(reader io.Reader) (event Event, err error) {
 	}
 
 	rawPayload := make([]byte, length)
-	_, err = buf.Read(rawPayload)
+	_, err = io.ReadFull(buf, rawPayload)
 	if err != nil {
 		return
 	}
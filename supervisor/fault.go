@@ -0,0 +1,81 @@
+package supervisor
+
+import (
+	"errors"
+	"github.com/kolo/xmlrpc"
+)
+
+// Supervisor RPC fault names.
+const (
+	FaultUnknownMethod        string = "UNKNOWN_METHOD"
+	FaultIncorrectParameters  string = "INCORRECT_PARAMETERS"
+	FaultBadArguments         string = "BAD_ARGUMENTS"
+	FaultSignatureUnsupported string = "SIGNATURE_UNSUPPORTED"
+	FaultShutdownState        string = "SHUTDOWN_STATE"
+	FaultBadName              string = "BAD_NAME"
+	FaultBadSignal            string = "BAD_SIGNAL"
+	FaultNoFile               string = "NO_FILE"
+	FaultNotExecutable        string = "NOT_EXECUTABLE"
+	FaultFailed               string = "FAILED"
+	FaultAbnormalTermination  string = "ABNORMAL_TERMINATION"
+	FaultSpawnError           string = "SPAWN_ERROR"
+	FaultAlreadyStarted       string = "ALREADY_STARTED"
+	FaultNotRunning           string = "NOT_RUNNING"
+	FaultSuccess              string = "SUCCESS"
+	FaultAlreadyAdded         string = "ALREADY_ADDED"
+	FaultStillRunning         string = "STILL_RUNNING"
+	FaultCantReread           string = "CANT_REREAD"
+)
+
+var (
+	faultCodes map[string]int64 = map[string]int64{
+		FaultUnknownMethod:        1,
+		FaultIncorrectParameters:  2,
+		FaultBadArguments:         3,
+		FaultSignatureUnsupported: 4,
+		FaultShutdownState:        6,
+		FaultBadName:              10,
+		FaultBadSignal:            11,
+		FaultNoFile:               20,
+		FaultNotExecutable:        21,
+		FaultFailed:               30,
+		FaultAbnormalTermination:  40,
+		FaultSpawnError:           50,
+		FaultAlreadyStarted:       60,
+		FaultNotRunning:           70,
+		FaultSuccess:              80,
+		FaultAlreadyAdded:         90,
+		FaultStillRunning:         91,
+		FaultCantReread:           92,
+	}
+)
+
+// FaultCodeName returns the name of a Supervisor fault or status code or an empty string if the code
+// is unknown.
+func FaultCodeName(code int64) string {
+	for name, value := range faultCodes {
+		if value == code {
+			return name
+		}
+	}
+	return ""
+}
+
+// FaultName returns the name of the Supervisor fault contained in the error or an empty string if
+// the error is not a Supervisor fault.
+func FaultName(err error) string {
+	var fault xmlrpc.FaultError
+	if errors.As(err, &fault) {
+		return FaultCodeName(int64(fault.Code))
+	}
+	var faultPtr *xmlrpc.FaultError
+	if errors.As(err, &faultPtr) && faultPtr != nil {
+		return FaultCodeName(int64(faultPtr.Code))
+	}
+	return ""
+}
+
+// IsFault returns true if the error is the named Supervisor fault.
+func IsFault(err error, name string) bool {
+	return FaultName(err) == name
+}
@@ -0,0 +1,30 @@
+package supervisor
+
+import (
+	"errors"
+	"github.com/kolo/xmlrpc"
+	"testing"
+)
+
+// Test finding the Supervisor fault in an error.
+func TestFaultName(t *testing.T) {
+	tests := []struct {
+		err  error
+		name string
+	}{
+		{nil, ""},
+		{xmlrpc.FaultError{Code: 60, String: "ALREADY_STARTED: web:api"}, FaultAlreadyStarted},
+		{&xmlrpc.FaultError{Code: 10, String: "BAD_NAME: missing"}, FaultBadName},
+		{xmlrpc.FaultError{Code: 999, String: "FAILED"}, ""},
+		{errors.New("FAILED to connect to WEB_API"), ""},
+		{errors.New("Fault(70): NOT_RUNNING"), ""},
+	}
+	for _, test := range tests {
+		if name := FaultName(test.err); name != test.name {
+			t.Errorf(`FaultName(%v) => %q, want %q`, test.err, name, test.name)
+		}
+	}
+	if !IsFault(xmlrpc.FaultError{Code: 70}, FaultNotRunning) {
+		t.Errorf(`IsFault(Fault(70), NOT_RUNNING) => false, want true`)
+	}
+}
@@ -0,0 +1,258 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFleetTimeout is the time allowed to connect to a fleet instance and for it to answer
+	// an RPC call.
+	DefaultFleetTimeout time.Duration = 10 * time.Second
+)
+
+// InstanceEvent wraps an event emitted for one instance of a fleet.
+type InstanceEvent struct {
+	Instance string
+	URL      string
+	Event    interface{}
+}
+
+// InstanceUpEvent is emitted when a fleet instance has been connected.
+type InstanceUpEvent struct{}
+
+// InstanceDownEvent is emitted when a fleet instance can not be reached. The connection will be
+// retried after the Retry duration.
+type InstanceDownEvent struct {
+	Error    error
+	Failures int
+	Retry    time.Duration
+}
+
+// InstanceState is a point in time copy of the state of a fleet instance.
+type InstanceState struct {
+	Name       string
+	URL        string
+	Connected  bool
+	Error      error
+	Updated    time.Time
+	Supervisor Supervisor
+	Processes  map[string]Process
+}
+
+type fleetInstance struct {
+	name  string
+	url   string
+	stop  chan bool
+	lock  sync.Mutex
+	state InstanceState
+}
+
+// update the instance state from the monitor
+func (inst *fleetInstance) update(mon Monitor, connected bool, err error) {
+	processes := make(map[string]Process, len(mon.Processes))
+	for name, proc := range mon.Processes {
+		processes[name] = *proc
+	}
+
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+	inst.state.Connected = connected
+	inst.state.Error = err
+	inst.state.Updated = time.Now()
+	inst.state.Supervisor = *mon.Supervisor
+	inst.state.Processes = processes
+}
+
+// snapshot returns a copy of the instance state
+func (inst *fleetInstance) snapshot() InstanceState {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+	return inst.state
+}
+
+// FleetMonitor polls many Supervisor instances and emits their events over a single channel. Each
+// event is wrapped in an InstanceEvent identifying the instance it came from. An instance which
+// does not connect or answer an RPC call within Timeout is reported as down so that one hung host
+// does not hold up Remove or Close.
+type FleetMonitor struct {
+	Config    PollConfig
+	Timeout   time.Duration
+	events    chan interface{}
+	lock      *sync.Mutex
+	wait      *sync.WaitGroup
+	instances map[string]*fleetInstance
+}
+
+// NewFleetMonitor creates a fleet monitor which sends events to the provided channel. Instances
+// are polled using the given config.
+func NewFleetMonitor(config PollConfig, events chan interface{}) FleetMonitor {
+	return FleetMonitor{
+		config,
+		DefaultFleetTimeout,
+		events,
+		&sync.Mutex{},
+		&sync.WaitGroup{},
+		make(map[string]*fleetInstance),
+	}
+}
+
+// Add starts monitoring the Supervisor instance at url under the given name. An error is returned
+// if the name is already in use or if Config would poll without waiting.
+func (fleet FleetMonitor) Add(name string, url string) error {
+	if err := fleet.Config.validate(); err != nil {
+		return err
+	}
+	fleet.lock.Lock()
+	defer fleet.lock.Unlock()
+
+	if _, ok := fleet.instances[name]; ok {
+		return errors.New(fmt.Sprintf("instance %s already exists", name))
+	}
+
+	inst := &fleetInstance{name: name, url: url, stop: make(chan bool)}
+	inst.state = InstanceState{Name: name, URL: url, Supervisor: *NewSupervisor()}
+	fleet.instances[name] = inst
+
+	fleet.wait.Add(1)
+	go fleet.run(inst)
+	return nil
+}
+
+// Remove stops monitoring the named instance. No events are emitted for the processes of a removed
+// instance. An error is returned if the instance does not exist.
+func (fleet FleetMonitor) Remove(name string) error {
+	fleet.lock.Lock()
+	inst, ok := fleet.instances[name]
+	delete(fleet.instances, name)
+	fleet.lock.Unlock()
+
+	if !ok {
+		return errors.New(fmt.Sprintf("instance %s does not exist", name))
+	}
+	close(inst.stop)
+	return nil
+}
+
+// Instances returns the sorted names of all monitored instances.
+func (fleet FleetMonitor) Instances() []string {
+	fleet.lock.Lock()
+	defer fleet.lock.Unlock()
+
+	names := make([]string, 0, len(fleet.instances))
+	for name := range fleet.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Snapshot returns the last known state of every instance keyed by instance name.
+func (fleet FleetMonitor) Snapshot() map[string]InstanceState {
+	fleet.lock.Lock()
+	defer fleet.lock.Unlock()
+
+	states := make(map[string]InstanceState, len(fleet.instances))
+	for name, inst := range fleet.instances {
+		states[name] = inst.snapshot()
+	}
+	return states
+}
+
+// Close stops monitoring all instances and waits for them to finish. The events channel must be
+// drained until Close returns.
+func (fleet FleetMonitor) Close() {
+	fleet.lock.Lock()
+	for name, inst := range fleet.instances {
+		close(inst.stop)
+		delete(fleet.instances, name)
+	}
+	fleet.lock.Unlock()
+	fleet.wait.Wait()
+}
+
+// dial connects to an instance with a transport which gives up on connections and responses after
+// Timeout.
+func (fleet FleetMonitor) dial(url string) (Client, error) {
+	timeout := fleet.Timeout
+	if timeout <= 0 {
+		timeout = DefaultFleetTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	return NewClientTransport(url, &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	})
+}
+
+// Connect to and poll a single instance until it is stopped.
+func (fleet FleetMonitor) run(inst *fleetInstance) {
+	defer fleet.wait.Done()
+
+	done := make(chan bool)
+	events := make(chan interface{})
+	defer func() {
+		close(events)
+		<-done
+	}()
+
+	go func() {
+		for event := range events {
+			if fleet.events != nil {
+				fleet.events <- InstanceEvent{inst.name, inst.url, event}
+			}
+		}
+		done <- true
+	}()
+
+	mon := Monitor{
+		Supervisor: NewSupervisor(),
+		Processes:  make(map[string]*Process),
+		events:     events,
+	}
+
+	connected := false
+	failures := 0
+	for {
+		var err error
+		if !connected {
+			if mon.Client, err = fleet.dial(inst.url); err == nil {
+				connected = true
+				events <- InstanceUpEvent{}
+			}
+		}
+		if connected {
+			if err = mon.Refresh(); err != nil {
+				mon.Client.Close()
+				connected = false
+			}
+		}
+
+		var delay time.Duration
+		if err != nil {
+			failures++
+			delay = fleet.Config.Delay(failures)
+			events <- InstanceDownEvent{err, failures, delay}
+		} else {
+			failures = 0
+			delay = fleet.Config.Delay(0)
+		}
+		inst.update(mon, connected, err)
+
+		select {
+		case <-inst.stop:
+			if connected {
+				mon.Client.Close()
+			}
+			return
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package supervisor
+
+import (
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that an unreachable fleet instance is reported as down.
+func TestFleetMonitorDown(t *testing.T) {
+	events := make(chan interface{})
+	fleet := NewFleetMonitor(PollConfig{Interval: time.Hour}, events)
+
+	if err := fleet.Add("down", "http://127.0.0.1:1/RPC2"); err != nil {
+		t.Fatalf(`FleetMonitor.Add("down") => error{"%v"}, want nil`, err)
+	}
+	if err := fleet.Add("down", "http://127.0.0.1:1/RPC2"); err == nil {
+		t.Errorf(`FleetMonitor.Add("down") => nil, want error`)
+	}
+
+	select {
+	case event := <-events:
+		instEvent, ok := event.(InstanceEvent)
+		if !ok {
+			t.Fatalf(`<-events => %T, want InstanceEvent`, event)
+		}
+		if instEvent.Instance != "down" {
+			t.Errorf(`InstanceEvent.Instance => "%s", want "down"`, instEvent.Instance)
+		}
+		if downEvent, ok := instEvent.Event.(InstanceDownEvent); !ok {
+			t.Errorf(`InstanceEvent.Event => %T, want InstanceDownEvent`, instEvent.Event)
+		} else if downEvent.Failures != 1 {
+			t.Errorf(`InstanceDownEvent.Failures => %d, want 1`, downEvent.Failures)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(`<-events => timeout, want InstanceDownEvent`)
+	}
+
+	// the snapshot is updated after the event is sent
+	var state InstanceState
+	for i := 0; i < 100; i++ {
+		if state = fleet.Snapshot()["down"]; state.Error != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if state.Connected || state.Error == nil {
+		t.Errorf(`FleetMonitor.Snapshot()["down"] => connected=%v error=%v, want disconnected with error`, state.Connected, state.Error)
+	}
+
+	if err := NewFleetMonitor(PollConfig{}, events).Add("busy", "http://127.0.0.1:1/RPC2"); err == nil {
+		t.Errorf(`FleetMonitor.Add("busy") with a zero interval => nil, want error`)
+	}
+
+	if names := fleet.Instances(); len(names) != 1 || names[0] != "down" {
+		t.Errorf(`FleetMonitor.Instances() => %v, want [down]`, names)
+	}
+	if err := fleet.Remove("missing"); err == nil {
+		t.Errorf(`FleetMonitor.Remove("missing") => nil, want error`)
+	}
+	fleet.Close()
+	if names := fleet.Instances(); len(names) != 0 {
+		t.Errorf(`FleetMonitor.Instances() => %v, want []`, names)
+	}
+}
+
+// Test monitoring a live instance which goes away and comes back.
+func TestFleetMonitor(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "cron")...)
+	server.SetState("web:api", Running)
+	var down int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.LoadInt32(&down) != 0 {
+			http.Error(writer, "gone away", http.StatusServiceUnavailable)
+			return
+		}
+		server.ServeHTTP(writer, request)
+	}))
+	defer proxy.Close()
+
+	events := make(chan interface{}, 100)
+	fleet := NewFleetMonitor(PollConfig{Interval: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}, events)
+	defer fleet.Close()
+	url := proxy.URL + "/RPC2"
+	if err := fleet.Add("one", url); err != nil {
+		t.Fatalf(`FleetMonitor.Add("one") => error{"%v"}, want nil`, err)
+	}
+
+	// wait returns when match returns true for the event of an InstanceEvent.
+	wait := func(what string, match func(event interface{}) bool) {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case event := <-events:
+				instEvent, ok := event.(InstanceEvent)
+				if !ok || instEvent.Instance != "one" || instEvent.URL != url {
+					t.Fatalf(`<-events => %+v, want InstanceEvent for one`, event)
+				}
+				if match(instEvent.Event) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf(`FleetMonitor did not emit %s`, what)
+			}
+		}
+	}
+	isUp := func(event interface{}) bool {
+		_, ok := event.(InstanceUpEvent)
+		return ok
+	}
+
+	wait("InstanceUpEvent", isUp)
+	wait("ProcessAddEvent for api", func(event interface{}) bool {
+		add, ok := event.(ProcessAddEvent)
+		return ok && add.Process.Name == "api" && add.Process.State == Running
+	})
+
+	var state InstanceState
+	for i := 0; i < 100; i++ {
+		if state = fleet.Snapshot()["one"]; len(state.Processes) == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !state.Connected || state.Error != nil || state.Supervisor.State != Running || state.Processes["api"].State != Running || state.Processes["cron"].State != Stopped {
+		t.Errorf(`FleetMonitor.Snapshot()["one"] => %+v, want connected with api RUNNING and cron STOPPED`, state)
+	}
+
+	atomic.StoreInt32(&down, 1)
+	wait("InstanceDownEvent", func(event interface{}) bool {
+		_, ok := event.(InstanceDownEvent)
+		return ok
+	})
+	if state := fleet.Snapshot()["one"]; state.Connected {
+		t.Errorf(`FleetMonitor.Snapshot()["one"] => connected after the instance went away, want disconnected`)
+	}
+
+	atomic.StoreInt32(&down, 0)
+	server.SetState("cron", Running)
+	wait("InstanceUpEvent after reconnecting", isUp)
+	wait("ProcessStateEvent for cron", func(event interface{}) bool {
+		change, ok := event.(ProcessStateEvent)
+		return ok && change.Process.Name == "cron" && change.Process.State == Running
+	})
+}
+
+// Test that an instance which does not answer times out.
+func TestFleetMonitorTimeout(t *testing.T) {
+	hung := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-hung
+	}))
+	defer server.Close()
+	defer close(hung)
+
+	events := make(chan interface{}, 10)
+	fleet := NewFleetMonitor(PollConfig{Interval: time.Hour}, events)
+	fleet.Timeout = 50 * time.Millisecond
+	fleet.Add("hung", server.URL+"/RPC2")
+
+	select {
+	case event := <-events:
+		if _, ok := event.(InstanceEvent).Event.(InstanceDownEvent); !ok {
+			t.Errorf(`<-events => %+v, want InstanceDownEvent`, event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`<-events => timeout, want InstanceDownEvent`)
+	}
+
+	closed := make(chan bool)
+	go func() {
+		fleet.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Errorf(`FleetMonitor.Close() did not return`)
+	}
+}
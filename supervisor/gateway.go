@@ -0,0 +1,466 @@
+package supervisor
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultLogBytes int64 = 1600
+)
+
+var (
+	// HTTP status codes returned by the gateway for Supervisor faults
+	faultStatus map[string]int = map[string]int{
+		FaultUnknownMethod:        http.StatusNotImplemented,
+		FaultSignatureUnsupported: http.StatusNotImplemented,
+		FaultIncorrectParameters:  http.StatusBadRequest,
+		FaultBadArguments:         http.StatusBadRequest,
+		FaultBadSignal:            http.StatusBadRequest,
+		FaultBadName:              http.StatusNotFound,
+		FaultAlreadyStarted:       http.StatusConflict,
+		FaultNotRunning:           http.StatusConflict,
+		FaultAlreadyAdded:         http.StatusConflict,
+		FaultStillRunning:         http.StatusConflict,
+		FaultShutdownState:        http.StatusServiceUnavailable,
+	}
+)
+
+// FaultStatus returns the HTTP status code for an error returned by Client. Faults which reflect
+// on the request map to 4xx codes, failures of Supervisor or the process to 500, and errors which
+// are not faults, such as connection failures, to 502.
+func FaultStatus(err error) int {
+	fault := FaultName(err)
+	if fault == "" {
+		return http.StatusBadGateway
+	}
+	if status, ok := faultStatus[fault]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// ProcessResource is the JSON representation of a process served by Gateway.
+type ProcessResource struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Group         string `json:"group"`
+	State         string `json:"state"`
+	Description   string `json:"description"`
+	PID           int64  `json:"pid"`
+	Start         int64  `json:"start"`
+	Stop          int64  `json:"stop"`
+	Now           int64  `json:"now"`
+	ExitStatus    int64  `json:"exit_status"`
+	SpawnErr      string `json:"spawn_err"`
+	StdoutLogfile string `json:"stdout_logfile"`
+	StderrLogfile string `json:"stderr_logfile"`
+}
+
+func newProcessResource(info ProcessInfo) ProcessResource {
+	return ProcessResource{
+		info.FullName(), info.Name, info.Group, info.StateName, info.Description, info.PID,
+		info.Start, info.Stop, info.Now, info.ExitStatus, info.SpawnErr, info.StdoutLogfile,
+		info.StderrLogfile,
+	}
+}
+
+// errorResource is the JSON body of an error response.
+type errorResource struct {
+	Error string `json:"error"`
+	Fault string `json:"fault,omitempty"`
+}
+
+// Gateway is an http.Handler which exposes a Client as a JSON REST API:
+//
+//	GET  /processes                        list all processes
+//	GET  /processes/{id}                   get a process, the id is group:name or name
+//	POST /processes/{id}/start             start a process, ?wait=false to return immediately
+//	POST /processes/{id}/stop              stop a process, ?wait=false to return immediately
+//	POST /processes/{id}/restart           stop and start a process
+//	POST /processes/{id}/signal?signal=HUP send a signal, the signal may also be in a JSON body
+//	GET  /processes/{id}/log               tail a log, ?stream=stderr, ?bytes=N, ?follow=1
+//	                                       ?format=json for parsed records, ?level=ERROR to filter
+//	POST /reload                           reread the configuration and apply it, ?dry_run=1
+//
+// Errors are returned as JSON objects with the error message and fault name. Prefix is removed from
+// request paths before routing and paths outside of it are not found.
+type Gateway struct {
+	Client Client
+	Prefix string
+}
+
+// NewGateway creates a gateway for the client.
+func NewGateway(client Client) Gateway {
+	return Gateway{Client: client}
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
+
+// writeError writes an error response. Client errors are mapped with FaultStatus.
+func writeError(writer http.ResponseWriter, status int, err error) {
+	if status == 0 {
+		status = FaultStatus(err)
+	}
+	writeJSON(writer, status, errorResource{err.Error(), FaultName(err)})
+}
+
+// queryBool returns true if a query parameter is set to a true value.
+func queryBool(request *http.Request, key string, def bool) bool {
+	value := request.URL.Query().Get(key)
+	if value == "" {
+		return def
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return def
+	}
+	return result
+}
+
+func (gw Gateway) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	path := request.URL.Path
+	if prefix := strings.TrimSuffix(gw.Prefix, "/"); prefix != "" {
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			writeError(writer, http.StatusNotFound, errors.New("not found: "+request.URL.Path))
+			return
+		}
+		path = path[len(prefix):]
+	}
+	path = strings.Trim(path, "/")
+	parts := strings.Split(path, "/")
+
+	route := ""
+	switch {
+	case path == "processes":
+		route = "GET"
+	case len(parts) == 2 && parts[0] == "processes":
+		route = "GET"
+	case len(parts) == 3 && parts[0] == "processes" && parts[2] == "log":
+		route = "GET"
+	case len(parts) == 3 && parts[0] == "processes":
+		route = "POST"
+	case path == "reload":
+		route = "POST"
+	default:
+		writeError(writer, http.StatusNotFound, errors.New("not found: "+request.URL.Path))
+		return
+	}
+	if request.Method != route {
+		writer.Header().Set("Allow", route)
+		writeError(writer, http.StatusMethodNotAllowed, errors.New(fmt.Sprintf("method %s not allowed", request.Method)))
+		return
+	}
+
+	switch {
+	case path == "processes":
+		gw.list(writer)
+	case path == "reload":
+		gw.reload(writer, request)
+	case len(parts) == 2:
+		gw.get(writer, parts[1])
+	case parts[2] == "log":
+		gw.log(writer, request, parts[1])
+	default:
+		gw.action(writer, request, parts[1], parts[2])
+	}
+}
+
+func (gw Gateway) list(writer http.ResponseWriter) {
+	infos, err := gw.Client.GetAllProcessInfo()
+	if err != nil {
+		writeError(writer, 0, err)
+		return
+	}
+	resources := make([]ProcessResource, len(infos))
+	for i, info := range infos {
+		resources[i] = newProcessResource(info)
+	}
+	writeJSON(writer, http.StatusOK, resources)
+}
+
+func (gw Gateway) get(writer http.ResponseWriter, id string) {
+	info, err := gw.Client.GetProcessInfo(id)
+	if err != nil {
+		writeError(writer, 0, err)
+		return
+	}
+	writeJSON(writer, http.StatusOK, newProcessResource(info))
+}
+
+func (gw Gateway) action(writer http.ResponseWriter, request *http.Request, id string, action string) {
+	wait := queryBool(request, "wait", true)
+	var err error
+	switch action {
+	case "start":
+		_, err = gw.Client.StartProcess(id, wait)
+	case "stop":
+		_, err = gw.Client.StopProcess(id, wait)
+	case "restart":
+		if _, err = gw.Client.StopProcess(id, true); IsFault(err, FaultNotRunning) {
+			err = nil
+		}
+		if err == nil {
+			_, err = gw.Client.StartProcess(id, wait)
+		}
+	case "signal":
+		signal := request.URL.Query().Get("signal")
+		if signal == "" && request.Body != nil {
+			var body struct {
+				Signal string `json:"signal"`
+			}
+			if decodeErr := json.NewDecoder(request.Body).Decode(&body); decodeErr != nil && decodeErr != io.EOF {
+				writeError(writer, http.StatusBadRequest, decodeErr)
+				return
+			}
+			signal = body.Signal
+		}
+		if signal == "" {
+			writeError(writer, http.StatusBadRequest, errors.New("signal is required"))
+			return
+		}
+		_, err = gw.Client.SignalProcess(id, signal)
+	default:
+		writeError(writer, http.StatusNotFound, errors.New("unknown action "+action))
+		return
+	}
+	if err != nil {
+		writeError(writer, 0, err)
+		return
+	}
+	gw.get(writer, id)
+}
+
+// logWriter writes the lines of a process log to a response, parsing them into records when they
+// are filtered or written as JSON.
+type logWriter struct {
+	writer  http.ResponseWriter
+	process string
+	channel string
+	json    bool
+	filter  *LogFilter
+}
+
+// header writes the response header for the format.
+func (log logWriter) header() {
+	if log.json {
+		log.writer.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		log.writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	log.writer.WriteHeader(http.StatusOK)
+}
+
+// write writes a line which ends with a newline unless it is the last of the log.
+func (log logWriter) write(line string) (err error) {
+	if !log.json && log.filter == nil {
+		_, err = io.WriteString(log.writer, line)
+		return
+	}
+	return log.writeRecord(ParseLogRecord(line), line)
+}
+
+// writeRecord writes a parsed record, or its line as given when the format is text, unless it is
+// filtered out.
+func (log logWriter) writeRecord(record LogRecord, line string) (err error) {
+	record.Process = log.process
+	record.Channel = log.channel
+	if log.filter != nil && !log.filter.Match(record) {
+		return nil
+	}
+	if log.json {
+		return json.NewEncoder(log.writer).Encode(record)
+	}
+	_, err = io.WriteString(log.writer, line)
+	return
+}
+
+func (gw Gateway) log(writer http.ResponseWriter, request *http.Request, id string) {
+	query := request.URL.Query()
+	log := logWriter{writer: writer, process: id, channel: "stdout"}
+	switch stream := query.Get("stream"); stream {
+	case "", "stdout":
+	case "stderr":
+		log.channel = "stderr"
+	default:
+		writeError(writer, http.StatusBadRequest, errors.New("unknown stream "+stream))
+		return
+	}
+	switch format := query.Get("format"); format {
+	case "", LogFormatText:
+	case LogFormatJSON:
+		log.json = true
+	default:
+		writeError(writer, http.StatusBadRequest, errors.New("unknown format "+format))
+		return
+	}
+	if value := query.Get("level"); value != "" {
+		level, ok := ParseLogLevel(value)
+		if !ok {
+			writeError(writer, http.StatusBadRequest, errors.New("unknown level "+value))
+			return
+		}
+		log.filter = &LogFilter{Level: level}
+	}
+	stderr := log.channel == "stderr"
+
+	if queryBool(request, "follow", false) {
+		reader, err := gw.Client.TailProcessLog(id, stderr)
+		if err != nil {
+			writeError(writer, 0, err)
+			return
+		}
+		defer reader.Close()
+		go func() {
+			// unblock the read when the client goes away
+			<-request.Context().Done()
+			reader.Close()
+		}()
+		log.header()
+		flusher, _ := writer.(http.Flusher)
+		if log.json || log.filter != nil {
+			// records are written a line at a time
+			lines := bufio.NewReader(reader)
+			for {
+				line, err := lines.ReadString('\n')
+				if line != "" {
+					if log.write(line) != nil {
+						return
+					}
+					if flusher != nil {
+						flusher.Flush()
+					}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}
+		buf := make([]byte, 4096)
+		for {
+			n, err := reader.Read(buf)
+			if n > 0 {
+				if _, err := writer.Write(buf[:n]); err != nil {
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	length := defaultLogBytes
+	if value := query.Get("bytes"); value != "" {
+		var err error
+		if length, err = strconv.ParseInt(value, 10, 64); err != nil || length <= 0 {
+			writeError(writer, http.StatusBadRequest, errors.New("invalid bytes "+value))
+			return
+		}
+	}
+	var tail *ProcessTail
+	var err error
+	if stderr {
+		tail, err = gw.Client.TailProcessStderrLog(id, 0, length)
+	} else {
+		tail, err = gw.Client.TailProcessStdoutLog(id, 0, length)
+	}
+	if err != nil {
+		writeError(writer, 0, err)
+		return
+	}
+	log.header()
+	if !log.json && log.filter == nil {
+		io.WriteString(writer, tail.Log)
+		return
+	}
+	records := ParseLogRecords(tail.Log, tail.Overflow)
+	terminated := strings.HasSuffix(tail.Log, "\n")
+	for i, record := range records {
+		line := record.Line
+		if i < len(records)-1 || terminated {
+			line += "\n"
+		}
+		log.writeRecord(record, line)
+	}
+}
+
+// groupUpdateResource is the JSON representation of a GroupUpdate.
+type groupUpdateResource struct {
+	Name   string   `json:"name"`
+	Change string   `json:"change"`
+	Steps  []string `json:"steps"`
+	Error  string   `json:"error,omitempty"`
+}
+
+func (gw Gateway) reload(writer http.ResponseWriter, request *http.Request) {
+	report, err := gw.Client.Update(queryBool(request, "dry_run", false))
+	if err != nil {
+		writeError(writer, 0, err)
+		return
+	}
+	groups := make([]groupUpdateResource, len(report.Groups))
+	status := http.StatusOK
+	for i, update := range report.Groups {
+		groups[i] = groupUpdateResource{update.Name, update.Change, update.Steps, ""}
+		if update.Error != nil {
+			groups[i].Error = update.Error.Error()
+			status = http.StatusInternalServerError
+		}
+	}
+	writeJSON(writer, status, map[string]interface{}{
+		"added":   report.Added,
+		"changed": report.Changed,
+		"removed": report.Removed,
+		"dry_run": report.DryRun,
+		"groups":  groups,
+	})
+}
+
+// BasicAuth wraps a handler so that requests must carry the given basic auth credentials.
+func BasicAuth(handler http.Handler, username string, password string) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		user, pass, ok := request.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="supervisor"`)
+			writeError(writer, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// TokenAuth wraps a handler so that requests must carry one of the tokens as a bearer token in the
+// Authorization header.
+func TokenAuth(handler http.Handler, tokens ...string) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		header := request.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Bearer ") {
+			given := []byte(strings.TrimPrefix(header, "Bearer "))
+			for _, token := range tokens {
+				if subtle.ConstantTimeCompare(given, []byte(token)) == 1 {
+					handler.ServeHTTP(writer, request)
+					return
+				}
+			}
+		}
+		writer.Header().Set("WWW-Authenticate", `Bearer realm="supervisor"`)
+		writeError(writer, http.StatusUnauthorized, errors.New("unauthorized"))
+	})
+}
@@ -0,0 +1,161 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/kolo/xmlrpc"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Make a request to a handler and decode the JSON response.
+func gatewayRequest(t *testing.T, handler http.Handler, method string, path string, value interface{}) int {
+	request := httptest.NewRequest(method, path, nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if value != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), value); err != nil {
+			t.Fatalf(`%s %s => %q, error{"%v"}, want JSON`, method, path, recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code
+}
+
+// Test the REST endpoints and fault mapping.
+func TestGateway(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "cron")...)
+	server.SetState("cron", Running)
+	gateway := NewGateway(testClient(t, server))
+
+	var list []ProcessResource
+	if code := gatewayRequest(t, gateway, "GET", "/processes", &list); code != http.StatusOK || len(list) != 2 {
+		t.Fatalf(`GET /processes => %d %+v, want 200 and 2 processes`, code, list)
+	}
+	if list[0].ID != "cron:cron" || list[0].State != Running || list[1].ID != "web:api" {
+		t.Errorf(`GET /processes => %+v, want cron:cron RUNNING and web:api`, list)
+	}
+
+	var proc ProcessResource
+	if code := gatewayRequest(t, gateway, "POST", "/processes/web:api/start", &proc); code != http.StatusOK || proc.State != Running {
+		t.Errorf(`POST /processes/web:api/start => %d %+v, want 200 RUNNING`, code, proc)
+	}
+
+	var fault errorResource
+	tests := []struct {
+		method string
+		path   string
+		status int
+		fault  string
+	}{
+		{"POST", "/processes/web:api/start", http.StatusConflict, FaultAlreadyStarted},
+		{"GET", "/processes/web:missing", http.StatusNotFound, FaultBadName},
+		{"POST", "/processes/web:api/explode", http.StatusNotFound, ""},
+		{"POST", "/processes/web:api/signal", http.StatusBadRequest, ""},
+		{"DELETE", "/processes", http.StatusMethodNotAllowed, ""},
+		{"GET", "/reload", http.StatusMethodNotAllowed, ""},
+		{"GET", "/nowhere", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		fault = errorResource{}
+		if code := gatewayRequest(t, gateway, test.method, test.path, &fault); code != test.status || fault.Fault != test.fault || fault.Error == "" {
+			t.Errorf(`%s %s => %d %+v, want %d %s`, test.method, test.path, code, fault, test.status, test.fault)
+		}
+	}
+
+	if code := gatewayRequest(t, gateway, "POST", "/processes/cron/restart", &proc); code != http.StatusOK || proc.State != Running {
+		t.Errorf(`POST /processes/cron/restart => %d %+v, want 200 RUNNING`, code, proc)
+	}
+	if actions := actions(server); !cmpStrings(actions, []string{"start web:api", "start web:api", "stop cron:cron", "start cron:cron"}) {
+		t.Errorf(`gateway called %v`, actions)
+	}
+
+	server.Configure(supervisortest.Programs("cron")...)
+	var reload map[string]interface{}
+	if code := gatewayRequest(t, gateway, "POST", "/reload?dry_run=1", &reload); code != http.StatusOK || reload["dry_run"] != true {
+		t.Errorf(`POST /reload?dry_run=1 => %d %v, want 200 dry run`, code, reload)
+	}
+
+	// only paths under the prefix are routed
+	gateway.Prefix = "/api"
+	for path, want := range map[string]int{"/api/processes": http.StatusOK, "/api/processes/": http.StatusOK, "/apifoo/processes": http.StatusNotFound, "/processes": http.StatusNotFound} {
+		if code := gatewayRequest(t, gateway, "GET", path, nil); code != want {
+			t.Errorf(`GET %s with prefix /api => %d, want %d`, path, code, want)
+		}
+	}
+}
+
+// Test the auth middleware.
+func TestGatewayAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	basic := BasicAuth(ok, "admin", "secret")
+	token := TokenAuth(ok, "abc", "def")
+
+	verify := func(handler http.Handler, setup func(*http.Request), want int) {
+		request := httptest.NewRequest("GET", "/processes", nil)
+		setup(request)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != want {
+			t.Errorf(`GET /processes with %v => %d, want %d`, request.Header, recorder.Code, want)
+		}
+	}
+	verify(basic, func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusNoContent)
+	verify(basic, func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }, http.StatusUnauthorized)
+	verify(basic, func(r *http.Request) {}, http.StatusUnauthorized)
+	verify(token, func(r *http.Request) { r.Header.Set("Authorization", "Bearer def") }, http.StatusNoContent)
+	verify(token, func(r *http.Request) { r.Header.Set("Authorization", "Bearer xyz") }, http.StatusUnauthorized)
+
+	if status := FaultStatus(errors.New("dial tcp: connection refused")); status != http.StatusBadGateway {
+		t.Errorf(`FaultStatus(connection error) => %d, want 502`, status)
+	}
+	if status := FaultStatus(xmlrpc.FaultError{Code: 50, String: "SPAWN_ERROR: web"}); status != http.StatusInternalServerError {
+		t.Errorf(`FaultStatus(SPAWN_ERROR) => %d, want 500`, status)
+	}
+}
+
+// Test parsing and filtering logs served by the gateway.
+func TestGatewayLogFormat(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "cron")...)
+	server.WriteLog("web:api", false, "INFO ready\nlevel=error msg=\"request failed\" path=/\n")
+	server.WriteLog("cron", false, "WARN slow\nERROR no newline")
+	gateway := NewGateway(testClient(t, server))
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/processes/web:api/log?level=warn", http.StatusOK, "level=error msg=\"request failed\" path=/\n"},
+		{"/processes/web:api/log?format=json&level=error", http.StatusOK,
+			`{"time":"0001-01-01T00:00:00Z","process":"web:api","channel":"stdout","format":"logfmt","level":"ERROR","message":"request failed","fields":{"path":"/"},"line":"level=error msg=\"request failed\" path=/"}` + "\n"},
+		{"/processes/cron/log?level=warn", http.StatusOK, "WARN slow\nERROR no newline"},
+		{"/processes/web:api/log?level=loud", http.StatusBadRequest, ""},
+		{"/processes/web:api/log?format=xml", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		gateway.ServeHTTP(recorder, httptest.NewRequest("GET", test.path, nil))
+		if recorder.Code != test.status || (test.body != "" && recorder.Body.String() != test.body) {
+			t.Errorf(`GET %s => %d %q, want %d %q`, test.path, recorder.Code, recorder.Body.String(), test.status, test.body)
+		}
+	}
+
+	// followed logs are parsed a line at a time
+	web := httptest.NewServer(gateway)
+	defer web.Close()
+	resp, err := web.Client().Get(web.URL + "/processes/web:api/log?follow=1&format=json&level=error")
+	if err != nil {
+		t.Fatalf(`GET /processes/web:api/log?follow=1 => error{"%v"}, want nil`, err)
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, 4096)
+	n, _ := resp.Body.Read(buf)
+	if body := string(buf[:n]); resp.Header.Get("Content-Type") != "application/x-ndjson" || !strings.Contains(body, `"message":"request failed"`) || strings.Contains(body, "ready") {
+		t.Errorf(`GET /processes/web:api/log?follow=1 => %q, want the error record`, body)
+	}
+}
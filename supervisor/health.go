@@ -0,0 +1,245 @@
+package supervisor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHealthTimeout is the time allowed for a health check which does not set a timeout.
+	DefaultHealthTimeout time.Duration = 10 * time.Second
+
+	// most of a response body read when looking for the expected body
+	healthBodyLimit int64 = 1 << 20
+)
+
+// HealthCheck checks that a process answers requests. URL is an http or https URL which must
+// respond with Status, or 200 if Status is zero, and a body containing Body, or a tcp://host:port
+// URL which must accept a connection. The process is restarted after Failures consecutive failed
+// checks, or after the first if Failures is zero. Name selects the processes checked as for
+// MemoryLimit.
+type HealthCheck struct {
+	Name     string
+	URL      string
+	Status   int
+	Body     string
+	Timeout  time.Duration
+	Failures int
+}
+
+// run performs the check and returns an error if it fails.
+func (check HealthCheck) run(client *http.Client) error {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
+	}
+	url, err := neturl.Parse(check.URL)
+	if err != nil {
+		return err
+	}
+	switch url.Scheme {
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", url.Host, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "http", "https":
+	default:
+		return errors.New(fmt.Sprintf("unsupported health check URL %q", check.URL))
+	}
+
+	checkClient := *client
+	checkClient.Timeout = timeout
+	response, err := checkClient.Get(check.URL)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	status := check.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if response.StatusCode != status {
+		return errors.New(fmt.Sprintf("%s returned %s, want %d", check.URL, response.Status, status))
+	}
+	if check.Body != "" {
+		body, err := ioutil.ReadAll(io.LimitReader(response.Body, healthBodyLimit))
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(body, []byte(check.Body)) {
+			return errors.New(fmt.Sprintf("%s response does not contain %q", check.URL, check.Body))
+		}
+	}
+	return nil
+}
+
+// HealthCheckEvent is emitted by a HealthWatchdog for every check it performs. Failures is the
+// number of consecutive failed checks of the process. Restarted is set when the check caused the
+// process to be restarted and RestartError when that restart failed.
+type HealthCheckEvent struct {
+	Time         time.Time
+	Process      Process
+	URL          string
+	Duration     time.Duration
+	Error        error
+	Failures     int
+	Restarted    bool
+	RestartError error
+}
+
+// Healthy returns true if the check passed.
+func (event HealthCheckEvent) Healthy() bool {
+	return event.Error == nil
+}
+
+// healthState is the mutable state shared by copies of HealthWatchdog.
+type healthState struct {
+	processes map[string]Process
+	failures  map[string]int
+}
+
+// HealthWatchdog restarts processes which fail health checks, in the manner of superlance's httpok.
+// Like MemoryWatchdog it follows the processes known to a Monitor through the Monitor's events and
+// checks them on every TICK the Monitor forwards, or when Check is called. Only RUNNING processes
+// are checked and the count of failures starts over when a process leaves RUNNING or changes pid.
+//
+// A HealthCheckEvent is sent to Events for each check if it is not nil. Events must not be the
+// channel the watchdog reads Monitor events from. Metrics counts the checks from these events.
+type HealthWatchdog struct {
+	Client     Client
+	Checks     []HealthCheck
+	Events     chan interface{}
+	HttpClient *http.Client
+	now        func() time.Time
+	lock       *sync.Mutex
+	state      *healthState
+}
+
+// NewHealthWatchdog creates a watchdog which restarts processes with the client.
+func NewHealthWatchdog(client Client, checks ...HealthCheck) HealthWatchdog {
+	return HealthWatchdog{
+		Client:     client,
+		Checks:     checks,
+		HttpClient: &http.Client{},
+		now:        time.Now,
+		lock:       &sync.Mutex{},
+		state:      &healthState{make(map[string]Process), make(map[string]int)},
+	}
+}
+
+// check returns the health check of a process. The check with the most specific name is used.
+func (watchdog HealthWatchdog) check(proc Process) (check HealthCheck, ok bool) {
+	best := 0
+	for _, candidate := range watchdog.Checks {
+		if rank := matchRank(proc, candidate.Name); rank > best {
+			best, check, ok = rank, candidate, true
+		}
+	}
+	return
+}
+
+// Observe updates the known processes from a Monitor event and checks them when the event is a
+// forwarded TICK.
+func (watchdog HealthWatchdog) Observe(event interface{}) {
+	watchdog.lock.Lock()
+	state := watchdog.state
+	switch event := event.(type) {
+	case ProcessAddEvent:
+		state.processes[processKey(event.Process)] = event.Process
+	case ProcessStateEvent:
+		key := processKey(event.Process)
+		if event.Process.State != Running || event.Process.PID != state.processes[key].PID {
+			delete(state.failures, key)
+		}
+		state.processes[key] = event.Process
+	case ProcessRemoveEvent:
+		delete(state.processes, processKey(event.Process))
+		delete(state.failures, processKey(event.Process))
+	}
+	watchdog.lock.Unlock()
+
+	if event, ok := event.(ListenerEvent); ok && event.Event.Parent() == "TICK" {
+		watchdog.Check()
+	}
+}
+
+// Run updates the watchdog from the events channel of a Monitor until it is closed.
+func (watchdog HealthWatchdog) Run(events chan interface{}) {
+	for event := range events {
+		watchdog.Observe(event)
+	}
+}
+
+// Check runs the health check of every RUNNING process at once and restarts the processes which
+// have failed too many times in order of group:name. The results are returned.
+func (watchdog HealthWatchdog) Check() []HealthCheckEvent {
+	type target struct {
+		proc  Process
+		check HealthCheck
+	}
+	watchdog.lock.Lock()
+	var targets []target
+	for _, proc := range watchdog.state.processes {
+		if check, ok := watchdog.check(proc); ok && proc.State == Running {
+			targets = append(targets, target{proc, check})
+		}
+	}
+	watchdog.lock.Unlock()
+	sort.Slice(targets, func(i, j int) bool {
+		return processKey(targets[i].proc) < processKey(targets[j].proc)
+	})
+
+	results := make([]HealthCheckEvent, len(targets))
+	wg := sync.WaitGroup{}
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, proc Process, check HealthCheck) {
+			defer wg.Done()
+			start := watchdog.now()
+			err := check.run(watchdog.HttpClient)
+			results[i] = HealthCheckEvent{Time: start, Process: proc, URL: check.URL, Duration: watchdog.now().Sub(start), Error: err}
+		}(i, target.proc, target.check)
+	}
+	wg.Wait()
+
+	for i := range results {
+		result := &results[i]
+		key := processKey(result.Process)
+		watchdog.lock.Lock()
+		if result.Error == nil {
+			delete(watchdog.state.failures, key)
+		} else {
+			watchdog.state.failures[key]++
+			result.Failures = watchdog.state.failures[key]
+		}
+		limit := targets[i].check.Failures
+		if limit <= 0 {
+			limit = 1
+		}
+		restart := result.Failures >= limit
+		if restart {
+			delete(watchdog.state.failures, key)
+		}
+		watchdog.lock.Unlock()
+
+		if restart {
+			result.Restarted = true
+			result.RestartError = restartProcess(watchdog.Client, key)
+		}
+		if watchdog.Events != nil {
+			watchdog.Events <- *result
+		}
+	}
+	return results
+}
@@ -0,0 +1,99 @@
+package supervisor
+
+import (
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// Test that the health watchdog restarts processes after consecutive failed checks.
+func TestHealthWatchdog(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "web:worker", "cron")...)
+	client := testClient(t, server)
+	for _, name := range []string{"web:api", "web:worker"} {
+		if _, err := client.StartProcess(name, true); err != nil {
+			t.Fatalf(`Client.StartProcess("%s") => error{"%v"}, want nil`, name, err)
+		}
+	}
+	server.ResetCalls()
+
+	var status int32 = http.StatusOK
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		fmt.Fprint(w, `{"status": "ok"}`)
+	}))
+	defer api.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(`net.Listen() => error{"%v"}, want nil`, err)
+	}
+	worker := "tcp://" + listener.Addr().String()
+	defer listener.Close()
+
+	events := make(chan interface{}, 100)
+	watchdog := NewHealthWatchdog(client,
+		HealthCheck{Name: "web", URL: worker},
+		HealthCheck{Name: "web:api", URL: api.URL + "/health", Body: `"ok"`, Failures: 2})
+	watchdog.Events = events
+	watchdog.Observe(ProcessAddEvent{Process: Process{Name: "api", Group: "web", State: Running, PID: 100}})
+	watchdog.Observe(ProcessAddEvent{Process: Process{Name: "worker", Group: "web", State: Running, PID: 200}})
+	watchdog.Observe(ProcessAddEvent{Process: Process{Name: "cron", Group: "cron", State: Running, PID: 300}})
+
+	tests := []struct {
+		status   int32
+		listen   bool
+		healthy  string
+		failures string
+		actions  string
+	}{
+		{http.StatusOK, true, "[true true]", "[0 0]", "[]"},
+		{http.StatusServiceUnavailable, true, "[false true]", "[1 0]", "[]"},
+		{http.StatusServiceUnavailable, false, "[false false]", "[2 1]", "[stop web:api start web:api stop web:worker start web:worker]"},
+		{http.StatusServiceUnavailable, false, "[false false]", "[1 1]", "[stop web:worker start web:worker]"},
+	}
+	for i, test := range tests {
+		atomic.StoreInt32(&status, test.status)
+		if !test.listen {
+			listener.Close()
+		}
+		server.ResetCalls()
+		var healthy, failures []interface{}
+		for _, result := range watchdog.Check() {
+			healthy = append(healthy, result.Healthy())
+			failures = append(failures, result.Failures)
+		}
+		if fmt.Sprint(healthy) != test.healthy || fmt.Sprint(failures) != test.failures {
+			t.Errorf(`%d: HealthWatchdog.Check() => healthy %v failures %v, want %s %s`, i, healthy, failures, test.healthy, test.failures)
+		}
+		if got := fmt.Sprint(actions(server)); got != test.actions {
+			t.Errorf(`%d: HealthWatchdog.Check() => %s, want %s`, i, got, test.actions)
+		}
+	}
+
+	// a new pid starts the count over and stopped processes are not checked
+	watchdog.Observe(ProcessStateEvent{Process: Process{Name: "api", Group: "web", State: Running, PID: 101}})
+	watchdog.Observe(ProcessStateEvent{Process: Process{Name: "worker", Group: "web", State: Stopped}})
+	if results := watchdog.Check(); len(results) != 1 || results[0].Failures != 1 || results[0].Restarted {
+		t.Errorf(`HealthWatchdog.Check() => %+v, want one failure of api`, results)
+	}
+
+	close(events)
+	metrics := NewMetrics(nil)
+	metrics.Run(events)
+	want := map[string]float64{
+		"health_check_up":             0,
+		"health_check_failures_total": 4,
+		"health_check_restarts_total": 1,
+	}
+	for _, family := range metrics.Gather() {
+		for _, sample := range family.Samples {
+			if value, ok := want[sample.Name]; ok && sample.Label("name") == "api" && sample.Value != value {
+				t.Errorf(`metric %s{name="api"} => %v, want %v`, sample.Name, sample.Value, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package supervisor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Diagnostic severities.
+const (
+	SeverityError   string = "error"
+	SeverityWarning string = "warning"
+)
+
+var (
+	programKeys []string = []string{
+		"command", "process_name", "numprocs", "numprocs_start", "priority", "autostart",
+		"autorestart", "startsecs", "startretries", "exitcodes", "stopsignal", "stopwaitsecs",
+		"stopasgroup", "killasgroup", "user", "redirect_stderr", "stdout_logfile",
+		"stdout_logfile_maxbytes", "stdout_logfile_backups", "stdout_capture_maxbytes",
+		"stdout_events_enabled", "stdout_syslog", "stderr_logfile", "stderr_logfile_maxbytes",
+		"stderr_logfile_backups", "stderr_capture_maxbytes", "stderr_events_enabled",
+		"stderr_syslog", "environment", "directory", "umask", "serverurl",
+	}
+
+	sectionKeys map[string][]string = map[string][]string{
+		"program":       programKeys,
+		"eventlistener": append([]string{"buffer_size", "events", "result_handler"}, programKeys...),
+		"fcgi-program":  append([]string{"socket", "socket_backlog", "socket_owner", "socket_mode"}, programKeys...),
+		"group":         []string{"programs", "priority"},
+		"include":       []string{"files"},
+		"supervisord": []string{
+			"logfile", "logfile_maxbytes", "logfile_backups", "loglevel", "pidfile", "umask",
+			"nodaemon", "silent", "minfds", "minprocs", "nocleanup", "childlogdir", "user",
+			"directory", "strip_ansi", "environment", "identifier",
+		},
+		"supervisorctl":    []string{"serverurl", "username", "password", "prompt", "history_file"},
+		"unix_http_server": []string{"file", "chmod", "chown", "username", "password"},
+		"inet_http_server": []string{"port", "username", "password"},
+		"rpcinterface":     nil,
+		"ctlplugin":        nil,
+	}
+
+	eventTypes []string = []string{
+		"EVENT", "PROCESS_STATE", "PROCESS_STATE_STARTING", "PROCESS_STATE_RUNNING",
+		"PROCESS_STATE_BACKOFF", "PROCESS_STATE_STOPPING", "PROCESS_STATE_EXITED",
+		"PROCESS_STATE_STOPPED", "PROCESS_STATE_FATAL", "PROCESS_STATE_UNKNOWN",
+		"REMOTE_COMMUNICATION", "PROCESS_LOG", "PROCESS_LOG_STDOUT", "PROCESS_LOG_STDERR",
+		"PROCESS_COMMUNICATION", "PROCESS_COMMUNICATION_STDOUT", "PROCESS_COMMUNICATION_STDERR",
+		"SUPERVISOR_STATE_CHANGE", "SUPERVISOR_STATE_CHANGE_RUNNING",
+		"SUPERVISOR_STATE_CHANGE_STOPPING", "TICK", "TICK_5", "TICK_60", "TICK_3600",
+		"PROCESS_GROUP", "PROCESS_GROUP_ADDED", "PROCESS_GROUP_REMOVED",
+	}
+)
+
+// contains returns true if the list contains the value.
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Diagnostic is a problem found in a configuration file.
+type Diagnostic struct {
+	Severity string
+	Path     string
+	Line     int
+	Section  string
+	Message  string
+}
+
+func (diag Diagnostic) String() string {
+	if diag.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", diag.Path, diag.Severity, diag.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", diag.Path, diag.Line, diag.Severity, diag.Message)
+}
+
+// HasErrors returns true if any of the diagnostics is an error.
+func HasErrors(diags []Diagnostic) bool {
+	for _, diag := range diags {
+		if diag.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// sortDiagnostics sorts diagnostics by path and line.
+func sortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].Path != diags[j].Path {
+			return diags[i].Path < diags[j].Path
+		}
+		return diags[i].Line < diags[j].Line
+	})
+}
+
+// linter collects diagnostics for a set of files.
+type linter struct {
+	diags []Diagnostic
+}
+
+func (l *linter) report(severity string, section *ConfigSection, line int, format string, args ...interface{}) {
+	if line == 0 {
+		line = section.Line
+	}
+	l.diags = append(l.diags, Diagnostic{severity, section.Path, line, section.Name, fmt.Sprintf(format, args...)})
+}
+
+// check the keys of a section
+func (l *linter) keys(section *ConfigSection) {
+	known, ok := sectionKeys[section.Type()]
+	if !ok {
+		l.report(SeverityWarning, section, 0, "unknown section type %s", section.Type())
+		return
+	}
+	seen := make(map[string]bool)
+	for _, option := range section.Options {
+		if known != nil && !contains(known, option.Key) {
+			l.report(SeverityWarning, section, option.Line, "unknown key %s in section %s", option.Key, section.Name)
+		}
+		if seen[option.Key] {
+			l.report(SeverityWarning, section, option.Line, "key %s is set more than once in section %s", option.Key, section.Name)
+		}
+		seen[option.Key] = true
+	}
+}
+
+// check a program, event listener, or fcgi program
+func (l *linter) program(program ProgramConfig) {
+	section := program.Section
+	if program.NumProcs > 1 {
+		option := section.Option("process_name")
+		if option == nil || !strings.Contains(option.Value, "%(process_num)") {
+			line := 0
+			if option != nil {
+				line = option.Line
+			}
+			l.report(SeverityError, section, line, "%s has numprocs > 1 but process_name does not contain %%(process_num)", section.Name)
+		}
+	}
+	if program.RedirectStderr {
+		if option := section.Option("stderr_logfile"); option != nil {
+			l.report(SeverityWarning, section, option.Line, "stderr_logfile is ignored when redirect_stderr is true")
+		}
+	}
+}
+
+// check the event names of a listener
+func (l *linter) eventListener(listener EventListenerConfig) {
+	section := listener.Section
+	option := section.Option("events")
+	if option == nil || len(listener.Events) == 0 {
+		l.report(SeverityError, section, 0, "%s has no events", section.Name)
+		return
+	}
+	for _, event := range listener.Events {
+		if !contains(eventTypes, event) {
+			l.report(SeverityWarning, section, option.Line, "unknown event type %s", event)
+		}
+	}
+	for _, key := range []string{"stdout_capture_maxbytes", "stdout_events_enabled"} {
+		if option := section.Option(key); option != nil {
+			l.report(SeverityError, section, option.Line, "%s is not allowed for event listeners", key)
+		}
+	}
+}
+
+// check for log files written by more than one process
+func (l *linter) logfiles(programs []ProgramConfig) {
+	type owner struct {
+		section *ConfigSection
+		line    int
+	}
+	owners := make(map[string]owner)
+
+	for _, program := range programs {
+		for _, key := range []string{"stdout_logfile", "stderr_logfile"} {
+			option := program.Section.Option(key)
+			if option == nil {
+				continue
+			}
+			path := program.StdoutLogfile
+			if key == "stderr_logfile" {
+				path = program.StderrLogfile
+			}
+			switch strings.ToUpper(path) {
+			case "", "AUTO", "NONE", "SYSLOG":
+				continue
+			}
+			if strings.HasPrefix(path, "/dev/") {
+				continue
+			}
+			if program.NumProcs > 1 && !strings.Contains(option.Value, "%(process_num)") {
+				l.report(SeverityWarning, program.Section, option.Line, "%s %s is shared by all %d processes of %s", key, path, program.NumProcs, program.Section.Name)
+			}
+			if prev, ok := owners[path]; ok {
+				l.report(SeverityWarning, program.Section, option.Line, "%s %s is also used by %s at %s:%d", key, path, prev.section.Name, prev.section.Path, prev.line)
+			} else {
+				owners[path] = owner{program.Section, option.Line}
+			}
+		}
+	}
+}
+
+// LintFiles checks parsed configuration files for errors and likely mistakes. The first file is the
+// main configuration file. The diagnostics are sorted by position.
+func LintFiles(files ...*ConfigFile) []Diagnostic {
+	l := &linter{}
+	sections := make(map[string]*ConfigSection)
+	processGroups := make(map[string]*ConfigSection)
+	var programs []ProgramConfig
+	var groups []GroupConfig
+	var all []*ConfigSection
+	for _, file := range files {
+		all = append(all, file.Sections...)
+	}
+	programGroup := programGroups(all)
+
+	for _, file := range files {
+		for _, section := range file.Sections {
+			if prev, ok := sections[section.Name]; ok {
+				l.report(SeverityError, section, 0, "duplicate section %s, first defined at %s:%d", section.Name, prev.Path, prev.Line)
+				continue
+			}
+			sections[section.Name] = section
+			l.keys(section)
+
+			decoder := newConfigDecoder(section, programGroup)
+			switch section.Type() {
+			case "program", "eventlistener", "fcgi-program":
+				var program ProgramConfig
+				switch section.Type() {
+				case "program":
+					program = decoder.program()
+				case "eventlistener":
+					listener := decoder.eventListener()
+					l.eventListener(listener)
+					program = listener.ProgramConfig
+				case "fcgi-program":
+					program = decoder.fcgiProgram().ProgramConfig
+				}
+				if prev, ok := processGroups[program.Name]; ok {
+					l.report(SeverityError, section, 0, "duplicate process name %s, first defined in %s at %s:%d", program.Name, prev.Name, prev.Path, prev.Line)
+				} else {
+					processGroups[program.Name] = section
+				}
+				l.program(program)
+				programs = append(programs, program)
+			case "group":
+				groups = append(groups, decoder.group())
+			}
+			for _, err := range decoder.errors {
+				l.diags = append(l.diags, Diagnostic{SeverityError, err.Path, err.Line, section.Name, err.Message})
+			}
+		}
+	}
+
+	for _, group := range groups {
+		option := group.Section.Option("programs")
+		for _, name := range group.Programs {
+			if section, ok := processGroups[name]; !ok || (section.Type() != "program" && section.Type() != "fcgi-program") {
+				l.report(SeverityError, group.Section, option.Line, "%s references unknown program %s", group.Section.Name, name)
+			}
+		}
+		if prev, ok := processGroups[group.Name]; ok && !contains(group.Programs, group.Name) {
+			l.report(SeverityError, group.Section, 0, "group name %s conflicts with %s at %s:%d", group.Name, prev.Name, prev.Path, prev.Line)
+		}
+	}
+	l.logfiles(programs)
+
+	if len(files) > 0 {
+		main := files[0]
+		if main.Section("supervisord") == nil {
+			l.diags = append(l.diags, Diagnostic{SeverityError, main.Path, 0, "", "supervisord section not found"})
+		}
+		if main.Section("rpcinterface:supervisor") == nil {
+			l.diags = append(l.diags, Diagnostic{SeverityWarning, main.Path, 0, "", "rpcinterface:supervisor section not found, the RPC interface will be unavailable"})
+		}
+	}
+
+	sortDiagnostics(l.diags)
+	return l.diags
+}
+
+// LintConfig reads a supervisord.conf file and the files it includes and checks them for errors and
+// likely mistakes. Syntax errors are reported as diagnostics. An error is returned if the main file
+// can not be read.
+func LintConfig(path string) (diags []Diagnostic, err error) {
+	main, err := ReadConfigFile(path)
+	if configErr, ok := err.(ConfigError); ok {
+		return []Diagnostic{{SeverityError, configErr.Path, configErr.Line, "", configErr.Message}}, nil
+	} else if err != nil {
+		return
+	}
+
+	includes, err := readIncludes(main)
+	if configErr, ok := err.(ConfigError); ok {
+		section := ""
+		if configErr.Path == main.Path {
+			section = "include"
+		}
+		diags = append(diags, Diagnostic{SeverityError, configErr.Path, configErr.Line, section, configErr.Message})
+		err = nil
+	} else if err != nil {
+		diags = append(diags, Diagnostic{SeverityError, main.Path, 0, "include", err.Error()})
+		err = nil
+	}
+	files := append([]*ConfigFile{main}, includes...)
+	diags = append(diags, LintFiles(files...)...)
+	sortDiagnostics(diags)
+	return
+}
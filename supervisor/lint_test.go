@@ -0,0 +1,98 @@
+package supervisor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const lintMain = `[supervisord]
+logfile=/var/log/supervisord.log
+
+[rpcinterface:supervisor]
+supervisor.rpcinterface_factory = supervisor.rpcinterface:make_main_rpcinterface
+
+[include]
+files=conf.d/*.conf
+
+[program:web]
+command=/usr/bin/web
+numprocs=2
+autorestart=sometimes
+stdout_logfile=/var/log/app.log
+colour=blue
+
+[eventlistener:mail]
+command=/usr/bin/mail
+`
+
+const lintInclude = `[program:web]
+command=/usr/bin/other
+
+[program:worker]
+command=/usr/bin/worker
+stdout_logfile=/var/log/app.log
+redirect_stderr=true
+stderr_logfile=/var/log/worker.err
+
+[fcgi-program:fcgi]
+command=/usr/bin/fcgi
+socket=unix:///var/run/fcgi.sock
+
+[group:apps]
+programs=worker,fcgi,missing
+`
+
+// Test that the linter reports the expected diagnostics.
+func TestLintConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "supervisord.conf", lintMain)
+	writeTestFile(t, dir, "conf.d/apps.conf", lintInclude)
+
+	diags, err := LintConfig(path)
+	if err != nil {
+		t.Fatalf(`LintConfig() => error{"%v"}, want nil`, err)
+	}
+	if !HasErrors(diags) {
+		t.Errorf(`HasErrors() => false, want true`)
+	}
+
+	want := []string{
+		"apps.conf:1: error: duplicate section program:web",
+		"apps.conf:6: warning: stdout_logfile /var/log/app.log is also used by program:web",
+		"apps.conf:8: warning: stderr_logfile is ignored when redirect_stderr is true",
+		"apps.conf:15: error: group:apps references unknown program missing",
+		"supervisord.conf:10: error: program:web has numprocs > 1 but process_name does not contain %(process_num)",
+		"supervisord.conf:13: error: autorestart: invalid value",
+		"supervisord.conf:14: warning: stdout_logfile /var/log/app.log is shared by all 2 processes of program:web",
+		"supervisord.conf:15: warning: unknown key colour in section program:web",
+		"supervisord.conf:17: error: eventlistener:mail has no events",
+	}
+	got := make([]string, len(diags))
+	for i, diag := range diags {
+		diag.Path = filepath.Base(diag.Path)
+		got[i] = diag.String()
+	}
+	if len(got) != len(want) {
+		t.Fatalf("LintConfig() =>\n%s\nwant %d diagnostics", strings.Join(got, "\n"), len(want))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf(`LintConfig()[%d] => %q, want prefix %q`, i, got[i], want[i])
+		}
+	}
+}
+
+// Test that syntax errors are reported as diagnostics.
+func TestLintConfigSyntax(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "supervisord.conf", "[supervisord]\nnot an option\n")
+
+	diags, err := LintConfig(path)
+	if err != nil {
+		t.Fatalf(`LintConfig() => error{"%v"}, want nil`, err)
+	}
+	if len(diags) != 1 || diags[0].Line != 2 || diags[0].Severity != SeverityError {
+		t.Errorf(`LintConfig() => %v, want one error at line 2`, diags)
+	}
+}
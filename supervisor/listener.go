@@ -3,23 +3,112 @@ package supervisor
 import (
 	"fmt"
 	"io"
+	"sync"
 )
 
+// SerialObserver is called by a Listener tracking serials when it reads an event which is a
+// duplicate of one already read or which follows lost events.
+type SerialObserver func(event Event, duplicate bool, lost []Gap)
+
+// SerialCounts are the counts kept by a Listener tracking serials.
+type SerialCounts struct {
+	Events     int
+	Duplicates int
+	Lost       int
+}
+
+// serialTracker tracks the pool serials of the events read by a listener.
+type serialTracker struct {
+	lock     *sync.Mutex
+	state    SerialState
+	counts   SerialCounts
+	observer SerialObserver
+}
+
+// observe records the pool serial of an event and calls the observer if it is a duplicate or
+// follows lost events.
+func (tracker *serialTracker) observe(event Event) {
+	if _, ok := event.Header["poolserial"]; !ok {
+		return
+	}
+	tracker.lock.Lock()
+	duplicate, lost := tracker.state.Observe(event.PoolSerial(), 0)
+	tracker.counts.Events++
+	if duplicate {
+		tracker.counts.Duplicates++
+	}
+	for _, gap := range lost {
+		tracker.counts.Lost += gap.Count()
+	}
+	observer := tracker.observer
+	tracker.lock.Unlock()
+	if (duplicate || len(lost) > 0) && observer != nil {
+		observer(event, duplicate, lost)
+	}
+}
+
+// swap replaces the observer and returns the previous one.
+func (tracker *serialTracker) swap(observer SerialObserver) SerialObserver {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	previous := tracker.observer
+	tracker.observer = observer
+	return previous
+}
+
 type Listener struct {
-	in  io.Reader
-	out io.Writer
+	in       io.Reader
+	out      io.Writer
+	recorder *Recorder
+	serials  *serialTracker
 }
 
 // NewListener creates a new event listener with the given in and out streams. The listener will
 // never close the streams.
 func NewListener(in io.Reader, out io.Writer) Listener {
-	return Listener{in, out}
+	return Listener{in: in, out: out}
+}
+
+// WithRecorder returns a copy of the listener which records every event it reads.
+func (l Listener) WithRecorder(recorder Recorder) Listener {
+	l.recorder = &recorder
+	return l
+}
+
+// WithSerialObserver returns a copy of the listener which tracks the pool serials of the events it
+// reads. The observer is called for an event Supervisor sends again after a FAIL result and for an
+// event which follows events the pool discarded because its buffer overflowed. The observer may be
+// nil to only keep counts. The processes of a pool with numprocs greater than one each see only some
+// of the pool serials and should track them together with a PoolMux.
+func (l Listener) WithSerialObserver(observer SerialObserver) Listener {
+	l.serials = &serialTracker{lock: &sync.Mutex{}, observer: observer}
+	return l
+}
+
+// SerialCounts returns the number of events, duplicates and lost events seen by a listener tracking
+// serials.
+func (l Listener) SerialCounts() SerialCounts {
+	if l.serials == nil {
+		return SerialCounts{}
+	}
+	l.serials.lock.Lock()
+	defer l.serials.lock.Unlock()
+	return l.serials.counts
 }
 
 // Read waits for and returns an event from supervisor. An error is returned if the read fails. If
 // EOF is encountered the error will be io.EOF.
 func (l Listener) Read() (event Event, err error) {
-	return ReadEvent(l.in)
+	if event, err = ReadEvent(l.in); err != nil {
+		return
+	}
+	if l.recorder != nil {
+		l.recorder.Record(event)
+	}
+	if l.serials != nil {
+		l.serials.observe(event)
+	}
+	return
 }
 
 // Ready puts the listener into the READY state.
@@ -2,9 +2,12 @@ package supervisor
 
 import (
 	"bufio"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
 	"io"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Test the Listen function.
@@ -63,3 +66,129 @@ func TestListen(t *testing.T) {
 	sendAndVerifyEvent("PROCESS_STATE_RUNNING", []byte{})
 	sendAndVerifyEvent("PROCESS_LOG_STDERR", []byte("some pretend log data"))
 }
+
+// Test the Listen function against a pool playing supervisord.
+func TestListenPool(t *testing.T) {
+	pool := supervisortest.NewEventPool("listener")
+	ch := make(chan Event, 1)
+	listener := NewListener(pool.Stdin(), pool.Stdout())
+
+	done := make(chan error)
+	go func() {
+		done <- listener.Run(ch)
+	}()
+
+	sendAndVerifyEvent := func(sent supervisortest.PoolEvent) {
+		delivery, err := pool.Send(sent)
+		if err != nil {
+			t.Fatalf(`EventPool.Send(%s) => error{"%v"}, want nil`, sent.Name, err)
+		} else if !delivery.Ok() {
+			t.Errorf(`EventPool.Send(%s) => result "%s", want "OK"`, sent.Name, delivery.Result)
+		}
+
+		event := <-ch
+		if event.Name() != sent.Name || event.Serial() != delivery.Event.Serial || event.PoolSerial() != delivery.Event.PoolSerial {
+			t.Errorf(`(event := <-ch) => %s, want %s`, event, delivery.Event)
+		} else if event.Pool() != "listener" || event.Version() != "3.0" {
+			t.Errorf(`(event := <-ch) => header %v, want pool "listener" and version "3.0"`, event.Header)
+		}
+	}
+
+	sendAndVerifyEvent(supervisortest.TransitionEvent(supervisortest.Transition{
+		Group: "test", Name: "test", From: Starting, To: Running, PID: 42,
+	}))
+	event := supervisortest.LogEvent("test", 42, true, "some pretend log data")
+	sendAndVerifyEvent(event)
+
+	pool.Close()
+	if err := <-done; err != nil {
+		t.Errorf(`Listener.Run() => error{"%v"}, want nil`, err)
+	}
+	if violations := pool.Violations(); len(violations) != 0 {
+		t.Errorf(`EventPool.Violations() => %v, want none`, violations)
+	}
+}
+
+// Test that a failed event is sent again with the same serials.
+func TestListenerFail(t *testing.T) {
+	pool := supervisortest.NewEventPool("listener")
+	defer pool.Close()
+	listener := NewListener(pool.Stdin(), pool.Stdout())
+
+	serials := make(chan [2]int, 3)
+	go func() {
+		listener.Ready()
+		for i := 0; i < 3; i++ {
+			event, err := listener.Read()
+			if err != nil {
+				return
+			}
+			serials <- [2]int{event.Serial(), event.PoolSerial()}
+			if i == 0 {
+				listener.Fail()
+			} else {
+				listener.Ok()
+			}
+			listener.Ready()
+		}
+	}()
+
+	pool.Skip(4)
+	pool.Emit(supervisortest.TickEvent(5, time.Unix(1000, 0)), supervisortest.SupervisorStateEvent(Running))
+	deliveries, err := pool.Drain(0)
+	if err != nil || len(deliveries) != 3 {
+		t.Fatalf(`EventPool.Drain() => %v, error{"%v"}, want 3 deliveries`, deliveries, err)
+	}
+	if deliveries[0].Ok() || !deliveries[1].Ok() || deliveries[1].Attempt != 2 {
+		t.Errorf(`EventPool.Drain() => %v, want the first event failed and then accepted`, deliveries)
+	}
+	for i, want := range [][2]int{{4, 0}, {4, 0}, {5, 1}} {
+		if got := <-serials; got != want {
+			t.Errorf(`event %d serials => %v, want %v`, i, got, want)
+		}
+	}
+}
+
+// Test tracking serials for duplicates and lost events.
+func TestListenerSerials(t *testing.T) {
+	pool := supervisortest.NewEventPool("listener")
+	defer pool.Close()
+	pool.BufferSize = 2
+
+	var observed []string
+	listener := NewListener(pool.Stdin(), pool.Stdout()).WithSerialObserver(func(event Event, duplicate bool, lost []Gap) {
+		observed = append(observed, fmt.Sprintf("%d %v %v", event.PoolSerial(), duplicate, lost))
+	})
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		listener.Ready()
+		for i := 0; i < 4; i++ {
+			if _, err := listener.Read(); err != nil {
+				return
+			}
+			if i == 0 {
+				listener.Fail()
+			} else {
+				listener.Ok()
+			}
+			listener.Ready()
+		}
+	}()
+
+	tick := supervisortest.TickEvent(5, time.Unix(5, 0))
+	pool.Emit(tick)
+	pool.Drain(2)
+	pool.Emit(tick, tick, tick)
+	if _, err := pool.Drain(0); err != nil {
+		t.Fatalf(`EventPool.Drain() => error{"%v"}, want nil`, err)
+	}
+	<-done
+
+	if want := []string{"0 true []", "2 false [1]"}; !cmpStrings(observed, want) {
+		t.Errorf(`SerialObserver called with %q, want %q`, observed, want)
+	}
+	if counts := listener.SerialCounts(); counts != (SerialCounts{4, 1, 1}) {
+		t.Errorf(`Listener.SerialCounts() => %+v, want 4 events, 1 duplicate and 1 lost`, counts)
+	}
+}
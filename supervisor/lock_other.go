@@ -0,0 +1,20 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package supervisor
+
+import (
+	"errors"
+	"os"
+)
+
+var errLockUnsupported = errors.New("file locking is not supported on this platform")
+
+// lockFile is not supported on this platform.
+func lockFile(file *os.File) error {
+	return errLockUnsupported
+}
+
+// unlockFile is not supported on this platform.
+func unlockFile(file *os.File) error {
+	return errLockUnsupported
+}
@@ -0,0 +1,348 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Log levels of LogRecord in order of severity.
+const (
+	LevelTrace string = "TRACE"
+	LevelDebug string = "DEBUG"
+	LevelInfo  string = "INFO"
+	LevelWarn  string = "WARN"
+	LevelError string = "ERROR"
+	LevelFatal string = "FATAL"
+)
+
+// Formats of LogRecord.
+const (
+	LogFormatText   string = "text"
+	LogFormatJSON   string = "json"
+	LogFormatLogfmt string = "logfmt"
+)
+
+var (
+	// levels in order of severity
+	logLevels []string = []string{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelFatal}
+
+	// level names as they appear in logs mapped to the levels
+	logLevelNames map[string]string = map[string]string{
+		"trace":       LevelTrace,
+		"debug":       LevelDebug,
+		"info":        LevelInfo,
+		"information": LevelInfo,
+		"notice":      LevelInfo,
+		"warn":        LevelWarn,
+		"warning":     LevelWarn,
+		"error":       LevelError,
+		"err":         LevelError,
+		"fatal":       LevelFatal,
+		"critical":    LevelFatal,
+		"crit":        LevelFatal,
+		"panic":       LevelFatal,
+		"alert":       LevelFatal,
+		"emerg":       LevelFatal,
+	}
+
+	// keys of structured logs which hold the time, level and message
+	logTimeKeys    []string = []string{"time", "ts", "timestamp", "@timestamp"}
+	logLevelKeys   []string = []string{"level", "lvl", "severity", "levelname", "log.level"}
+	logMessageKeys []string = []string{"msg", "message", "@message"}
+
+	// timestamp prefixes of text lines: ISO 8601, Go's log package and syslog
+	logTimePrefixes []*regexp.Regexp = []*regexp.Regexp{
+		regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?)\]?(?:\s+|$)`),
+		regexp.MustCompile(`^\[?(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:[.,]\d+)?)\]?(?:\s+|$)`),
+		regexp.MustCompile(`^\[?([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2})\]?(?:\s+|$)`),
+	}
+
+	// level prefix of text lines, either upper case or in brackets
+	logLevelPrefix *regexp.Regexp = regexp.MustCompile(`^(?:\[([A-Za-z]+)\]|([A-Z]+)\b)(?:\s*:)?\s*`)
+
+	// layouts of normalised timestamps
+	logTimeLayouts []string = []string{"2006-01-02T15:04:05Z07:00", "2006-01-02T15:04:05Z0700"}
+)
+
+// LogRecord is a line of process output parsed by ParseLogRecord. Format is the format the line
+// was detected as. Time and Level are zero when the line does not have them, and Message is the
+// line without its timestamp and level when it is not structured. Fields holds the remaining keys
+// of structured lines. Line is the line as it was written.
+type LogRecord struct {
+	Time    time.Time              `json:"time,omitempty"`
+	Process string                 `json:"process,omitempty"`
+	Group   string                 `json:"group,omitempty"`
+	Name    string                 `json:"name,omitempty"`
+	PID     int                    `json:"pid,omitempty"`
+	Channel string                 `json:"channel,omitempty"`
+	Format  string                 `json:"format"`
+	Level   string                 `json:"level,omitempty"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	Line    string                 `json:"line"`
+}
+
+// ParseLogLevel returns the level for a level name as it appears in logs, such as "warning" or
+// "err". False is returned if the name is not known.
+func ParseLogLevel(name string) (level string, ok bool) {
+	level, ok = logLevelNames[strings.ToLower(name)]
+	return
+}
+
+// logLevelRank returns the severity of a level starting from 1, or 0 if it is not known.
+func logLevelRank(level string) int {
+	for i, known := range logLevels {
+		if known == level {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// parseLogTime parses a timestamp in one of the formats of logTimePrefixes. Timestamps without a
+// zone are in local time and syslog timestamps are in the current year.
+func parseLogTime(value string) (when time.Time, ok bool) {
+	if len(value) > 3 && value[0] >= 'A' && value[0] <= 'Z' {
+		parsed, err := time.ParseInLocation("Jan _2 15:04:05", value, time.Local)
+		if err != nil {
+			return
+		}
+		return parsed.AddDate(time.Now().Year(), 0, 0), true
+	}
+	if len(value) < 19 {
+		return
+	}
+	normal := []byte(strings.Replace(value, ",", ".", 1))
+	normal[4], normal[7], normal[10] = '-', '-', 'T'
+	for _, layout := range logTimeLayouts {
+		if parsed, err := time.Parse(layout, string(normal)); err == nil {
+			return parsed, true
+		}
+	}
+	if parsed, err := time.ParseInLocation("2006-01-02T15:04:05", string(normal), time.Local); err == nil {
+		return parsed, true
+	}
+	return
+}
+
+// parseLogfmt parses a line of key=value pairs with optionally quoted values. False is returned
+// unless every word of the line is a pair and there are at least two.
+func parseLogfmt(text string) (fields map[string]interface{}, ok bool) {
+	fields = make(map[string]interface{})
+	for text = strings.TrimLeft(text, " \t"); text != ""; text = strings.TrimLeft(text, " \t") {
+		eq := strings.IndexByte(text, '=')
+		if eq <= 0 || strings.ContainsAny(text[:eq], " \t\"") {
+			return nil, false
+		}
+		key := text[:eq]
+		text = text[eq+1:]
+		value := ""
+		if strings.HasPrefix(text, `"`) {
+			end := 1
+			for end < len(text) && text[end] != '"' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				return nil, false
+			}
+			var err error
+			if value, err = strconv.Unquote(text[:end+1]); err != nil {
+				return nil, false
+			}
+			text = text[end+1:]
+			if text != "" && text[0] != ' ' && text[0] != '\t' {
+				return nil, false
+			}
+		} else {
+			end := strings.IndexAny(text, " \t")
+			if end < 0 {
+				end = len(text)
+			}
+			value, text = text[:end], text[end:]
+		}
+		fields[key] = value
+	}
+	return fields, len(fields) >= 2
+}
+
+// takeField removes the first of the keys found in the fields and returns its value.
+func takeField(fields map[string]interface{}, keys []string) (value interface{}, ok bool) {
+	for _, key := range keys {
+		if value, ok = fields[key]; ok {
+			delete(fields, key)
+			return
+		}
+	}
+	return
+}
+
+// structured fills the time, level and message of a record from the fields of a JSON or logfmt
+// line. Values which cannot be understood are left in the fields.
+func (record *LogRecord) structured(fields map[string]interface{}) {
+	if value, ok := takeField(fields, logTimeKeys); ok {
+		switch value := value.(type) {
+		case string:
+			if when, ok := parseLogTime(value); ok {
+				record.Time = when
+			} else if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				record.Time = unixTime(seconds)
+			} else {
+				fields["time"] = value
+			}
+		case json.Number:
+			seconds, _ := value.Float64()
+			record.Time = unixTime(seconds)
+		default:
+			fields["time"] = value
+		}
+	}
+	if value, ok := takeField(fields, logLevelKeys); ok {
+		switch value := value.(type) {
+		case string:
+			if record.Level, ok = ParseLogLevel(value); !ok {
+				fields["level"] = value
+			}
+		case json.Number:
+			// numeric levels as used by bunyan and pino
+			if number, err := value.Int64(); err == nil && number >= 10 {
+				index := int(number/10) - 1
+				if index >= len(logLevels) {
+					index = len(logLevels) - 1
+				}
+				record.Level = logLevels[index]
+			} else {
+				fields["level"] = value
+			}
+		default:
+			fields["level"] = value
+		}
+	}
+	if value, ok := takeField(fields, logMessageKeys); ok {
+		if message, ok := value.(string); ok {
+			record.Message = message
+		} else {
+			fields["msg"] = value
+		}
+	}
+	if len(fields) > 0 {
+		record.Fields = fields
+	}
+}
+
+// unixTime converts a unix timestamp to a time. Timestamps too large to be in seconds are taken as
+// milliseconds.
+func unixTime(seconds float64) time.Time {
+	if seconds > 1e11 {
+		seconds /= 1000
+	}
+	whole := int64(seconds)
+	return time.Unix(whole, int64((seconds-float64(whole))*1e9)).Round(time.Microsecond)
+}
+
+// ParseLogRecord parses a line of process output. JSON objects and logfmt lines are detected and
+// their time, level and message taken from the usual keys. Other lines are text, from which a
+// leading ISO 8601, Go log or syslog timestamp and a level such as INFO or [warn] are taken.
+func ParseLogRecord(line string) LogRecord {
+	line = strings.TrimRight(line, "\r\n")
+	record := LogRecord{Format: LogFormatText, Line: line}
+	text := strings.TrimSpace(line)
+
+	if strings.HasPrefix(text, "{") {
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		fields := make(map[string]interface{})
+		if err := decoder.Decode(&fields); err == nil && !decoder.More() {
+			record.Format = LogFormatJSON
+			record.structured(fields)
+			return record
+		}
+	}
+
+	for _, prefix := range logTimePrefixes {
+		if match := prefix.FindStringSubmatch(text); match != nil {
+			if when, ok := parseLogTime(match[1]); ok {
+				record.Time = when
+				text = text[len(match[0]):]
+			}
+			break
+		}
+	}
+	if fields, ok := parseLogfmt(text); ok {
+		record.Format = LogFormatLogfmt
+		record.structured(fields)
+		return record
+	}
+	if match := logLevelPrefix.FindStringSubmatch(text); match != nil {
+		name := match[1] + match[2]
+		if level, ok := ParseLogLevel(name); ok && (match[1] != "" || name == strings.ToUpper(name)) {
+			record.Level = level
+			text = text[len(match[0]):]
+		}
+	}
+	record.Message = text
+	return record
+}
+
+// ParseLogRecords parses each line of a log as returned by TailProcessStdoutLog. When overflow is
+// true the log is the end of a longer one and its first line, which is likely cut short, is
+// skipped.
+func ParseLogRecords(log string, overflow bool) []LogRecord {
+	if overflow {
+		if i := strings.IndexByte(log, '\n'); i >= 0 {
+			log = log[i+1:]
+		} else {
+			log = ""
+		}
+	}
+	log = strings.TrimSuffix(log, "\n")
+	if log == "" {
+		return nil
+	}
+	lines := strings.Split(log, "\n")
+	records := make([]LogRecord, len(lines))
+	for i, line := range lines {
+		records[i] = ParseLogRecord(line)
+	}
+	return records
+}
+
+// Record parses the line and labels the record with the line's process, channel and time if the
+// line does not have one.
+func (line LogLine) Record() LogRecord {
+	record := ParseLogRecord(line.Line)
+	record.Process = line.Process
+	record.Group = line.Group
+	record.Name = line.Name
+	record.PID = line.PID
+	record.Channel = line.Channel
+	if record.Time.IsZero() {
+		record.Time = line.Time
+	}
+	return record
+}
+
+// LogFilter selects log records. Level is the least severe level to select, and records without a
+// level are not selected when it is set. Processes are the groups, names or group:names to select
+// and Channel is stdout or stderr. Empty fields select every record.
+type LogFilter struct {
+	Level     string
+	Processes []string
+	Channel   string
+}
+
+// Match returns true if the filter selects the record.
+func (filter LogFilter) Match(record LogRecord) bool {
+	if filter.Level != "" && logLevelRank(record.Level) < logLevelRank(filter.Level) {
+		return false
+	}
+	if filter.Channel != "" && filter.Channel != record.Channel {
+		return false
+	}
+	return matchProcess(filter.Processes, record.Group, record.Name)
+}
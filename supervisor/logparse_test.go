@@ -0,0 +1,89 @@
+package supervisor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Test detecting the format, time, level and message of lines.
+func TestParseLogRecord(t *testing.T) {
+	local := func(year int, month time.Month, day, hour, min, sec, msec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, msec*1e6, time.Local)
+	}
+	tests := []struct {
+		line    string
+		format  string
+		time    time.Time
+		level   string
+		message string
+		fields  string
+	}{
+		{`{"time":"2024-03-01T12:00:00.5Z","level":"error","msg":"disk full","disk":"/dev/sda","free":0}`,
+			LogFormatJSON, time.Date(2024, 3, 1, 12, 0, 0, 5e8, time.UTC), LevelError, "disk full", "map[disk:/dev/sda free:0]"},
+		{`{"time":1709294400123,"level":50,"message":"boom"}`,
+			LogFormatJSON, time.Unix(1709294400, 123e6), LevelError, "boom", "map[]"},
+		{`{"severity":"chatty","msg":{"nested":true}}`,
+			LogFormatJSON, time.Time{}, "", "", "map[level:chatty msg:map[nested:true]]"},
+		{`ts=2024-03-01T12:00:00Z lvl=warn msg="slow query" duration=2.5s`,
+			LogFormatLogfmt, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), LevelWarn, "slow query", "map[duration:2.5s]"},
+		{`2024-03-01 12:00:00,250 INFO supervisord started with pid 1`,
+			LogFormatText, local(2024, 3, 1, 12, 0, 0, 250), LevelInfo, "supervisord started with pid 1", "map[]"},
+		{`2024/03/01 12:00:00 [warn] retrying in 5s`,
+			LogFormatText, local(2024, 3, 1, 12, 0, 0, 0), LevelWarn, "retrying in 5s", "map[]"},
+		{`[2024-03-01T12:00:00+01:00] CRITICAL: out of memory`,
+			LogFormatText, time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC), LevelFatal, "out of memory", "map[]"},
+		{`Mar  1 12:00:00 ERROR something broke`,
+			LogFormatText, local(time.Now().Year(), 3, 1, 12, 0, 0, 0), LevelError, "something broke", "map[]"},
+		{`Error handling is hard`, LogFormatText, time.Time{}, "", "Error handling is hard", "map[]"},
+		{`connected to db=main`, LogFormatText, time.Time{}, "", "connected to db=main", "map[]"},
+		{`{not json`, LogFormatText, time.Time{}, "", "{not json", "map[]"},
+	}
+	for _, test := range tests {
+		record := ParseLogRecord(test.line + "\r\n")
+		fields := fmt.Sprint(record.Fields)
+		if record.Format != test.format || !record.Time.Equal(test.time) || record.Level != test.level ||
+			record.Message != test.message || fields != test.fields || record.Line != test.line {
+			t.Errorf(`ParseLogRecord(%q) => %s %v %q %q %s, want %s %v %q %q %s`, test.line,
+				record.Format, record.Time, record.Level, record.Message, fields,
+				test.format, test.time, test.level, test.message, test.fields)
+		}
+	}
+}
+
+// Test parsing a tail and filtering the records.
+func TestLogFilter(t *testing.T) {
+	log := "ut line\nINFO started\nERROR failed\n{\"level\":\"fatal\",\"msg\":\"gone\"}\n"
+	if records := ParseLogRecords(log, true); len(records) != 3 || records[0].Message != "started" {
+		t.Errorf(`ParseLogRecords(overflow) => %+v, want 3 records from "started"`, records)
+	}
+	records := ParseLogRecords(log, false)
+	if len(records) != 4 {
+		t.Fatalf(`ParseLogRecords() => %d records, want 4`, len(records))
+	}
+
+	line := LogLine{Time: time.Unix(10, 0), Process: "workers:w1", Group: "workers", Name: "w1", PID: 3, Channel: "stderr", Line: "ERROR failed"}
+	record := line.Record()
+	if record.Process != "workers:w1" || record.PID != 3 || !record.Time.Equal(line.Time) || record.Level != LevelError {
+		t.Errorf(`LogLine.Record() => %+v, want labelled ERROR record`, record)
+	}
+
+	tests := []struct {
+		filter LogFilter
+		want   bool
+	}{
+		{LogFilter{}, true},
+		{LogFilter{Level: LevelError, Processes: []string{"workers"}}, true},
+		{LogFilter{Level: LevelFatal}, false},
+		{LogFilter{Processes: []string{"web"}}, false},
+		{LogFilter{Channel: "stdout"}, false},
+	}
+	for _, test := range tests {
+		if got := test.filter.Match(record); got != test.want {
+			t.Errorf(`LogFilter%+v.Match() => %v, want %v`, test.filter, got, test.want)
+		}
+	}
+	if (LogFilter{Level: LevelWarn}).Match(records[0]) {
+		t.Errorf(`LogFilter{Level: WARN}.Match() => true for a record without a level, want false`)
+	}
+}
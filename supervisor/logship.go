@@ -0,0 +1,536 @@
+package supervisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLogBatch is the number of lines a LogShipper collects before writing them to its sink.
+	DefaultLogBatch int = 100
+
+	// DefaultLogFlush is the longest a LogShipper holds lines before writing them to its sink.
+	DefaultLogFlush time.Duration = time.Second
+
+	// DefaultLogMaxLine is the longest line a LogShipper reassembles. Longer lines are split.
+	DefaultLogMaxLine int = 64 * 1024
+
+	// DefaultLogBuffer is the most bytes of lines a LogShipper holds while its sink fails.
+	DefaultLogBuffer int = 4 * 1024 * 1024
+)
+
+// Syslog facilities for SyslogSink.
+const (
+	SyslogUser   int = 1
+	SyslogDaemon int = 3
+	SyslogLocal0 int = 16
+)
+
+// LogLine is a line of process output. Partial is set when the line was split because it was too
+// long or had no newline when the process exited or went quiet.
+type LogLine struct {
+	Time    time.Time `json:"time"`
+	Process string    `json:"process"`
+	Group   string    `json:"group"`
+	Name    string    `json:"name"`
+	PID     int       `json:"pid"`
+	Channel string    `json:"channel"`
+	Line    string    `json:"line"`
+	Partial bool      `json:"partial,omitempty"`
+}
+
+// String formats the line as written by FileSink.
+func (line LogLine) String() string {
+	return fmt.Sprintf("%s %s[%d] %s: %s", line.Time.UTC().Format(time.RFC3339Nano), line.Process, line.PID, line.Channel, line.Line)
+}
+
+// LogSink receives batches of log lines.
+type LogSink interface {
+	Write(lines []LogLine) error
+	Close() error
+}
+
+// MultiLogSink writes lines to each of its sinks. Every sink is written and the first error is
+// returned. A LogShipper writes a failed batch again to every sink, so delivery is at least once:
+// the sinks which succeeded receive the lines again when another sink fails.
+type MultiLogSink []LogSink
+
+// Write writes the lines to every sink.
+func (sinks MultiLogSink) Write(lines []LogLine) (err error) {
+	for _, sink := range sinks {
+		if writeErr := sink.Write(lines); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+	return
+}
+
+// Close closes every sink.
+func (sinks MultiLogSink) Close() (err error) {
+	for _, sink := range sinks {
+		if closeErr := sink.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return
+}
+
+// FileSink appends lines to a file in the form "time group:name[pid] channel: line".
+type FileSink struct {
+	file *os.File
+}
+
+// NewFileSink opens the file at the path for appending, creating it if needed.
+func NewFileSink(path string) (sink FileSink, err error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+	return FileSink{file}, nil
+}
+
+// Write appends the lines to the file.
+func (sink FileSink) Write(lines []LogLine) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line.String())
+		buf.WriteByte('\n')
+	}
+	_, err := sink.file.Write(buf.Bytes())
+	return err
+}
+
+// Close closes the file.
+func (sink FileSink) Close() error {
+	return sink.file.Close()
+}
+
+// JSONSink writes lines as JSON, one object per line. A listener's stdout carries the event
+// listener protocol, so the writer must not be os.Stdout; use os.Stderr or another file
+// descriptor.
+type JSONSink struct {
+	writer io.Writer
+	lock   *sync.Mutex
+}
+
+// NewJSONSink creates a sink which writes to the writer. Writing to os.Stdout is refused.
+func NewJSONSink(writer io.Writer) (sink JSONSink, err error) {
+	if file, ok := writer.(*os.File); ok && file.Fd() == os.Stdout.Fd() {
+		return sink, errors.New("stdout is used by the event listener protocol")
+	}
+	return JSONSink{writer, &sync.Mutex{}}, nil
+}
+
+// Write writes each line as a JSON object.
+func (sink JSONSink) Write(lines []LogLine) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, line := range lines {
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	_, err := sink.writer.Write(buf.Bytes())
+	return err
+}
+
+// Close closes the writer if it is an io.Closer.
+func (sink JSONSink) Close() error {
+	if closer, ok := sink.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// syslogConn is the connection of a SyslogSink.
+type syslogConn struct {
+	lock   *sync.Mutex
+	conn   net.Conn
+	stream bool
+}
+
+// SyslogSink sends lines to the local syslog daemon over a unix socket in the BSD syslog format.
+// Each line is tagged with the process name and pid and sent with the Facility and a severity of
+// info for stdout and err for stderr.
+type SyslogSink struct {
+	Path     string
+	Facility int
+	Hostname string
+	conn     *syslogConn
+}
+
+// NewSyslogSink creates a sink which sends to the socket at the path, usually /dev/log.
+func NewSyslogSink(path string) SyslogSink {
+	host, _ := os.Hostname()
+	return SyslogSink{Path: path, Facility: SyslogUser, Hostname: host, conn: &syslogConn{lock: &sync.Mutex{}}}
+}
+
+// dial connects to the socket, which syslog daemons serve as a datagram or a stream socket.
+func (sink SyslogSink) dial() (err error) {
+	sink.conn.stream = false
+	if sink.conn.conn, err = net.Dial("unixgram", sink.Path); err != nil {
+		sink.conn.stream = true
+		sink.conn.conn, err = net.Dial("unix", sink.Path)
+	}
+	return
+}
+
+// Write sends each line as a syslog message, reconnecting once if the socket fails.
+func (sink SyslogSink) Write(lines []LogLine) error {
+	sink.conn.lock.Lock()
+	defer sink.conn.lock.Unlock()
+	for _, line := range lines {
+		severity := 6
+		if line.Channel == "stderr" {
+			severity = 3
+		}
+		message := fmt.Sprintf("<%d>%s %s %s[%d]: %s", sink.Facility*8+severity, line.Time.Format(time.Stamp), sink.Hostname, line.Name, line.PID, line.Line)
+		var err error
+		for attempt := 0; attempt < 2; attempt++ {
+			if sink.conn.conn == nil {
+				if err = sink.dial(); err != nil {
+					return err
+				}
+			}
+			if sink.conn.stream {
+				// messages on a stream socket are separated by newlines
+				_, err = io.WriteString(sink.conn.conn, message+"\n")
+			} else {
+				_, err = io.WriteString(sink.conn.conn, message)
+			}
+			if err == nil {
+				break
+			}
+			sink.conn.conn.Close()
+			sink.conn.conn = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection to the socket.
+func (sink SyslogSink) Close() error {
+	sink.conn.lock.Lock()
+	defer sink.conn.lock.Unlock()
+	if sink.conn.conn == nil {
+		return nil
+	}
+	err := sink.conn.conn.Close()
+	sink.conn.conn = nil
+	return err
+}
+
+// HttpSink posts each batch of lines to a URL as newline delimited JSON.
+type HttpSink struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// NewHttpSink creates a sink which posts to the URL.
+func NewHttpSink(url string) HttpSink {
+	return HttpSink{
+		URL:     url,
+		Headers: make(map[string]string),
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Write posts the lines. A response other than 2xx is an error.
+func (sink HttpSink) Write(lines []LogLine) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, line := range lines {
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	request, err := http.NewRequest(http.MethodPost, sink.URL, &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	for key, value := range sink.Headers {
+		request.Header.Set(key, value)
+	}
+	client := sink.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return errors.New(fmt.Sprintf("log sink returned %s", response.Status))
+	}
+	return nil
+}
+
+// Close does nothing.
+func (sink HttpSink) Close() error {
+	return nil
+}
+
+// logStream is the unfinished line of one channel of a process.
+type logStream struct {
+	line    LogLine
+	data    []byte
+	updated time.Time
+}
+
+// logShipperState is the mutable state shared by copies of LogShipper.
+type logShipperState struct {
+	streams map[string]*logStream
+	batch   []LogLine
+	bytes   int
+	dropped int
+	retry   time.Time
+}
+
+// LogShipper ships process output from PROCESS_LOG_STDOUT and PROCESS_LOG_STDERR events to a sink.
+// Supervisor sends output in chunks which may end part way through a line, so the shipper joins
+// the chunks of each process and channel into lines and labels them with the process, group and
+// pid from the event. A line with no newline is shipped as partial once it reaches MaxLine bytes,
+// when the process's pid changes or when nothing has been added to it for FlushInterval.
+//
+// Lines are written to the sink in batches of BatchSize or every FlushInterval. While the sink
+// fails lines are kept up to MaxBuffered bytes, after which the oldest are dropped and counted. A
+// failed batch is written again in full, so a sink may receive lines more than once. After a
+// failure Handle does not report a full batch until FlushInterval has passed, so a sink which is
+// down is not written on every event.
+// Only the lines selected by Filter are shipped when it is not nil. Errors are passed to OnError.
+type LogShipper struct {
+	Sink          LogSink
+	Filter        *LogFilter
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxLine       int
+	MaxBuffered   int
+	OnError       func(err error)
+	now           func() time.Time
+	lock          *sync.Mutex
+	state         *logShipperState
+}
+
+// NewLogShipper creates a shipper which writes to the sink.
+func NewLogShipper(sink LogSink) LogShipper {
+	return LogShipper{
+		Sink:          sink,
+		BatchSize:     DefaultLogBatch,
+		FlushInterval: DefaultLogFlush,
+		MaxLine:       DefaultLogMaxLine,
+		MaxBuffered:   DefaultLogBuffer,
+		now:           time.Now,
+		lock:          &sync.Mutex{},
+		state:         &logShipperState{streams: make(map[string]*logStream)},
+	}
+}
+
+// error passes an error to OnError.
+func (shipper LogShipper) error(err error) {
+	if shipper.OnError != nil {
+		shipper.OnError(err)
+	}
+}
+
+// Dropped returns the number of lines dropped because the sink could not keep up.
+func (shipper LogShipper) Dropped() int {
+	shipper.lock.Lock()
+	defer shipper.lock.Unlock()
+	return shipper.state.dropped
+}
+
+// add appends a line to the batch if it passes the filter, dropping the oldest lines to stay under
+// MaxBuffered. The lock must be held.
+func (shipper LogShipper) add(line LogLine) {
+	if shipper.Filter != nil && !shipper.Filter.Match(line.Record()) {
+		return
+	}
+	state := shipper.state
+	state.batch = append(state.batch, line)
+	state.bytes += len(line.Line)
+	drop := 0
+	for shipper.MaxBuffered > 0 && state.bytes > shipper.MaxBuffered && drop < len(state.batch) {
+		state.bytes -= len(state.batch[drop].Line)
+		drop++
+	}
+	if drop > 0 {
+		state.dropped += drop
+		state.batch = append(state.batch[:0], state.batch[drop:]...)
+	}
+}
+
+// emit adds the unfinished line of a stream to the batch as partial. The lock must be held.
+func (shipper LogShipper) emit(stream *logStream) {
+	if len(stream.data) == 0 {
+		return
+	}
+	line := stream.line
+	line.Line = string(stream.data)
+	line.Partial = true
+	shipper.add(line)
+	stream.data = stream.data[:0]
+}
+
+// Handle joins the output carried by a PROCESS_LOG event to the output of the process and channel
+// and batches the complete lines. It returns true when a batch is ready to be flushed and the last
+// flush did not fail within FlushInterval.
+func (shipper LogShipper) Handle(event Event) bool {
+	if event.Parent() != "PROCESS_LOG" {
+		return false
+	}
+	channel := event.Meta["channel"]
+	if channel == "" {
+		channel = strings.ToLower(strings.TrimPrefix(event.Name(), "PROCESS_LOG_"))
+	}
+	group, name, pid := event.Meta["groupname"], event.Meta["processname"], event.MetaInt("pid")
+	key := group + ":" + name + " " + channel
+	now := shipper.now()
+
+	shipper.lock.Lock()
+	defer shipper.lock.Unlock()
+	stream, ok := shipper.state.streams[key]
+	if !ok {
+		stream = &logStream{}
+		shipper.state.streams[key] = stream
+	} else if stream.line.PID != pid {
+		shipper.emit(stream)
+	}
+	stream.line = LogLine{Time: now, Process: group + ":" + name, Group: group, Name: name, PID: pid, Channel: channel}
+	stream.updated = now
+
+	data := event.Payload
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n')
+		chunk := data
+		if end >= 0 {
+			chunk = data[:end]
+		}
+		if shipper.MaxLine > 0 && len(stream.data)+len(chunk) > shipper.MaxLine {
+			// split the line, leaving the remainder to be joined as usual
+			take := shipper.MaxLine - len(stream.data)
+			stream.data = append(stream.data, chunk[:take]...)
+			shipper.emit(stream)
+			data = data[take:]
+			continue
+		}
+		stream.data = append(stream.data, chunk...)
+		if end < 0 {
+			break
+		}
+		line := stream.line
+		line.Line = strings.TrimSuffix(string(stream.data), "\r")
+		shipper.add(line)
+		stream.data = stream.data[:0]
+		data = data[end+1:]
+	}
+	return len(shipper.state.batch) >= shipper.BatchSize && !now.Before(shipper.state.retry)
+}
+
+// Flush ships the unfinished lines which have not grown for FlushInterval along with the batched
+// lines. The lines stay batched if the sink fails.
+func (shipper LogShipper) Flush() error {
+	return shipper.flush(false)
+}
+
+// flush writes the batch to the sink, first adding every unfinished line if all is true.
+func (shipper LogShipper) flush(all bool) error {
+	shipper.lock.Lock()
+	now := shipper.now()
+	for key, stream := range shipper.state.streams {
+		if all || now.Sub(stream.updated) >= shipper.FlushInterval {
+			shipper.emit(stream)
+			delete(shipper.state.streams, key)
+		}
+	}
+	batch := shipper.state.batch
+	shipper.state.batch, shipper.state.bytes = nil, 0
+	shipper.lock.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := shipper.Sink.Write(batch)
+	shipper.lock.Lock()
+	defer shipper.lock.Unlock()
+	if err != nil {
+		// put the batch back ahead of lines added while it was written
+		added := shipper.state.batch
+		shipper.state.batch, shipper.state.bytes = nil, 0
+		for _, line := range append(batch, added...) {
+			shipper.add(line)
+		}
+		shipper.state.retry = shipper.now().Add(shipper.interval())
+	} else {
+		shipper.state.retry = time.Time{}
+	}
+	return err
+}
+
+// interval returns FlushInterval or the default when it is not set.
+func (shipper LogShipper) interval() time.Duration {
+	if shipper.FlushInterval <= 0 {
+		return DefaultLogFlush
+	}
+	return shipper.FlushInterval
+}
+
+// Close ships every unfinished and batched line and closes the sink.
+func (shipper LogShipper) Close() error {
+	err := shipper.flush(true)
+	if closeErr := shipper.Sink.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Run starts the listener and ships the output in its events until EOF, then closes the shipper.
+// Every event is acknowledged with OK since lines are dropped rather than refused when the sink
+// cannot keep up.
+func (shipper LogShipper) Run(listener Listener) error {
+	events := make(chan Event)
+	done := make(chan error, 1)
+	go func() {
+		done <- listener.Run(events)
+	}()
+
+	ticker := time.NewTicker(shipper.interval())
+	defer ticker.Stop()
+	for {
+		flush := false
+		select {
+		case event := <-events:
+			flush = shipper.Handle(event)
+		case <-ticker.C:
+			flush = true
+		case err := <-done:
+			if closeErr := shipper.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}
+		if flush {
+			if err := shipper.Flush(); err != nil {
+				shipper.error(err)
+			}
+		}
+	}
+}
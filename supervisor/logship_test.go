@@ -0,0 +1,350 @@
+package supervisor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink collects the lines written to it and fails while err is set.
+type memorySink struct {
+	lock   *sync.Mutex
+	lines  []LogLine
+	writes int
+	err    error
+	closed bool
+}
+
+func newMemorySink() *memorySink {
+	return &memorySink{lock: &sync.Mutex{}}
+}
+
+func (sink *memorySink) Write(lines []LogLine) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.writes++
+	if sink.err != nil {
+		return sink.err
+	}
+	sink.lines = append(sink.lines, lines...)
+	return nil
+}
+
+func (sink *memorySink) Close() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.closed = true
+	return nil
+}
+
+// text returns the lines written as "process[pid] channel: line" with a trailing + for partial
+// lines.
+func (sink *memorySink) text() []string {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	var text []string
+	for _, line := range sink.lines {
+		entry := fmt.Sprintf("%s[%d] %s: %s", line.Process, line.PID, line.Channel, line.Line)
+		if line.Partial {
+			entry += "+"
+		}
+		text = append(text, entry)
+	}
+	return text
+}
+
+// logEvent creates a PROCESS_LOG event.
+func logEvent(name string, pid int, stderr bool, data string) Event {
+	pool := supervisortest.LogEvent(name, pid, stderr, data)
+	event := createEvent(1, pool.Name, "", nil)
+	event.Meta, event.Payload = parsePayload([]byte(pool.Body))
+	return event
+}
+
+// Test reassembling lines across events.
+func TestLogShipperLines(t *testing.T) {
+	sink := newMemorySink()
+	shipper := NewLogShipper(sink)
+	shipper.MaxLine = 10
+	now := time.Unix(1000, 0)
+	shipper.now = func() time.Time { return now }
+
+	events := []Event{
+		logEvent("web:api", 10, false, "hel"),
+		logEvent("web:api", 10, true, "err: "),
+		logEvent("web:api", 10, false, "lo\nwor"),
+		logEvent("web:api", 10, true, "boom\r\n"),
+		logEvent("web:api", 10, false, "ld\n\n0123456789abc\n"),
+		logEvent("web:api", 10, false, "prompt> "),
+		logEvent("web:api", 11, false, "restarted\n"),
+		logEvent("cron", 20, false, "tick"),
+		createEvent(2, "TICK_5", "", nil),
+	}
+	for _, event := range events {
+		shipper.Handle(event)
+	}
+	if err := shipper.Flush(); err != nil {
+		t.Errorf(`LogShipper.Flush() => error{"%v"}, want nil`, err)
+	}
+	want := []string{
+		"web:api[10] stdout: hello",
+		"web:api[10] stderr: err: boom",
+		"web:api[10] stdout: world",
+		"web:api[10] stdout: ",
+		"web:api[10] stdout: 0123456789+",
+		"web:api[10] stdout: abc",
+		"web:api[10] stdout: prompt> +",
+		"web:api[11] stdout: restarted",
+	}
+	if text := sink.text(); !cmpStrings(text, want) {
+		t.Errorf(`LogShipper.Flush() => %q, want %q`, text, want)
+	}
+
+	// a quiet unfinished line is shipped after the flush interval
+	now = now.Add(shipper.FlushInterval)
+	shipper.Flush()
+	if text := sink.text(); text[len(text)-1] != "cron:cron[20] stdout: tick+" {
+		t.Errorf(`LogShipper.Flush() => %q, want the quiet cron line`, text[len(text)-1])
+	}
+}
+
+// Test that a failing sink keeps bounded lines until it recovers.
+func TestLogShipperBuffer(t *testing.T) {
+	sink := newMemorySink()
+	sink.err = errors.New("unavailable")
+	shipper := NewLogShipper(sink)
+	shipper.MaxBuffered = 20
+
+	for i := 0; i < 10; i++ {
+		shipper.Handle(logEvent("web:api", 10, false, fmt.Sprintf("line %d\n", i)))
+	}
+	if err := shipper.Flush(); err == nil {
+		t.Errorf(`LogShipper.Flush() => nil, want error`)
+	}
+	if dropped := shipper.Dropped(); dropped != 7 {
+		t.Errorf(`LogShipper.Dropped() => %d, want 7`, dropped)
+	}
+
+	sink.lock.Lock()
+	sink.err = nil
+	sink.lock.Unlock()
+	shipper.Handle(logEvent("web:api", 10, false, "last"))
+	if err := shipper.Close(); err != nil {
+		t.Errorf(`LogShipper.Close() => error{"%v"}, want nil`, err)
+	}
+	want := []string{"web:api[10] stdout: line 8", "web:api[10] stdout: line 9", "web:api[10] stdout: last+"}
+	if text := sink.text(); !cmpStrings(text, want) {
+		t.Errorf(`LogShipper.Close() => %q, want %q`, text, want)
+	}
+	if !sink.closed {
+		t.Errorf(`LogShipper.Close() did not close the sink`)
+	}
+}
+
+// Test that full batches are not flushed on every event while the sink fails.
+func TestLogShipperBackoff(t *testing.T) {
+	sink := newMemorySink()
+	sink.err = errors.New("unavailable")
+	shipper := NewLogShipper(sink)
+	shipper.BatchSize = 1
+	shipper.FlushInterval = time.Second
+	now := time.Unix(1000, 0)
+	shipper.now = func() time.Time { return now }
+
+	// handle flushes as Run does
+	handle := func(data string) {
+		if shipper.Handle(logEvent("web:api", 10, false, data)) {
+			shipper.Flush()
+		}
+	}
+	writes := func() int {
+		sink.lock.Lock()
+		defer sink.lock.Unlock()
+		return sink.writes
+	}
+
+	for i := 0; i < 5; i++ {
+		handle(fmt.Sprintf("line %d\n", i))
+	}
+	if n := writes(); n != 1 {
+		t.Errorf(`LogShipper wrote %d times to a failing sink, want 1`, n)
+	}
+	now = now.Add(time.Second)
+	handle("line 5\n")
+	if n := writes(); n != 2 {
+		t.Errorf(`LogShipper wrote %d times after FlushInterval, want 2`, n)
+	}
+
+	sink.lock.Lock()
+	sink.err = nil
+	sink.lock.Unlock()
+	now = now.Add(time.Second)
+	handle("line 6\n")
+	handle("line 7\n")
+	if n, text := writes(), sink.text(); n != 4 || len(text) != 8 {
+		t.Errorf(`LogShipper wrote %d times and %d lines after the sink recovered, want 4 and 8`, n, len(text))
+	}
+}
+
+// Test that a batch which fails on one sink of a MultiLogSink is written again to every sink.
+func TestLogShipperMultiSink(t *testing.T) {
+	good := newMemorySink()
+	bad := newMemorySink()
+	bad.err = errors.New("unavailable")
+	shipper := NewLogShipper(MultiLogSink{good, bad})
+
+	shipper.Handle(logEvent("web:api", 10, false, "first\n"))
+	if err := shipper.Flush(); err == nil || err.Error() != "unavailable" {
+		t.Errorf(`LogShipper.Flush() => error{"%v"}, want error{"unavailable"}`, err)
+	}
+	want := []string{"web:api[10] stdout: first"}
+	if text := good.text(); !cmpStrings(text, want) {
+		t.Errorf(`LogShipper.Flush() => %q on the working sink, want %q`, text, want)
+	}
+
+	bad.lock.Lock()
+	bad.err = nil
+	bad.lock.Unlock()
+	shipper.Handle(logEvent("web:api", 10, false, "second\n"))
+	if err := shipper.Close(); err != nil {
+		t.Errorf(`LogShipper.Close() => error{"%v"}, want nil`, err)
+	}
+	want = []string{"web:api[10] stdout: first", "web:api[10] stdout: second"}
+	if text := bad.text(); !cmpStrings(text, want) {
+		t.Errorf(`LogShipper.Close() => %q on the failed sink, want %q`, text, want)
+	}
+	want = []string{"web:api[10] stdout: first", "web:api[10] stdout: first", "web:api[10] stdout: second"}
+	if text := good.text(); !cmpStrings(text, want) {
+		t.Errorf(`LogShipper.Close() => %q on the working sink, want %q`, text, want)
+	}
+	if !good.closed || !bad.closed {
+		t.Errorf(`LogShipper.Close() did not close every sink`)
+	}
+}
+
+// Test writing lines to each kind of sink.
+func TestLogSinks(t *testing.T) {
+	dir := t.TempDir()
+	lines := []LogLine{
+		{Time: time.Unix(0, 0), Process: "web:api", Group: "web", Name: "api", PID: 10, Channel: "stdout", Line: "hello"},
+		{Time: time.Unix(1, 0), Process: "web:api", Group: "web", Name: "api", PID: 10, Channel: "stderr", Line: "oops"},
+	}
+
+	path := filepath.Join(dir, "out.log")
+	file, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf(`NewFileSink() => error{"%v"}, want nil`, err)
+	}
+	file.Write(lines)
+	file.Close()
+	data, _ := ioutil.ReadFile(path)
+	if want := "1970-01-01T00:00:00Z web:api[10] stdout: hello\n1970-01-01T00:00:01Z web:api[10] stderr: oops\n"; string(data) != want {
+		t.Errorf(`FileSink.Write() => %q, want %q`, data, want)
+	}
+
+	if _, err := NewJSONSink(os.Stdout); err == nil {
+		t.Errorf(`NewJSONSink(os.Stdout) => nil, want error`)
+	}
+	var buf bytes.Buffer
+	jsonSink, _ := NewJSONSink(&buf)
+	jsonSink.Write(lines)
+	decoded := LogLine{}
+	if err := json.NewDecoder(&buf).Decode(&decoded); err != nil || decoded.Line != "hello" || decoded.PID != 10 {
+		t.Errorf(`JSONSink.Write() => %+v, error{"%v"}, want hello from pid 10`, decoded, err)
+	}
+
+	socket := filepath.Join(dir, "log.sock")
+	conn, err := net.ListenPacket("unixgram", socket)
+	if err != nil {
+		t.Fatalf(`net.ListenPacket() => error{"%v"}, want nil`, err)
+	}
+	defer conn.Close()
+	syslog := NewSyslogSink(socket)
+	syslog.Hostname = "host1"
+	if err := syslog.Write(lines); err != nil {
+		t.Errorf(`SyslogSink.Write() => error{"%v"}, want nil`, err)
+	}
+	syslog.Close()
+	packet := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for _, want := range []string{"<14>", "<11>"} {
+		n, _, err := conn.ReadFrom(packet)
+		message := string(packet[:n])
+		if err != nil || !strings.HasPrefix(message, want) || !strings.Contains(message, " host1 api[10]: ") {
+			t.Errorf(`SyslogSink.Write() sent %q, error{"%v"}, want %s... host1 api[10]: ...`, message, err, want)
+		}
+	}
+
+	var received []string
+	lock := &sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			received = append(received, r.Header.Get("Content-Type")+" "+scanner.Text())
+		}
+	}))
+	defer server.Close()
+	if err := NewHttpSink(server.URL).Write(lines); err != nil {
+		t.Errorf(`HttpSink.Write() => error{"%v"}, want nil`, err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(received) != 2 || !strings.HasPrefix(received[0], `application/x-ndjson {"time":`) {
+		t.Errorf(`HttpSink.Write() sent %q, want 2 JSON lines`, received)
+	}
+}
+
+// Test running the log shipper as a listener.
+func TestLogShipperRun(t *testing.T) {
+	sink := newMemorySink()
+	shipper := NewLogShipper(sink)
+	pool := supervisortest.NewEventPool("logship")
+	done := make(chan error)
+	go func() {
+		done <- shipper.Run(NewListener(pool.Stdin(), pool.Stdout()))
+	}()
+	pool.Emit(
+		supervisortest.LogEvent("web:api", 10, false, "one\ntw"),
+		supervisortest.LogEvent("web:api", 10, false, "o\nthree"),
+	)
+	if _, err := pool.Drain(0); err != nil {
+		t.Fatalf(`EventPool.Drain() => error{"%v"}, want nil`, err)
+	}
+	pool.Close()
+	if err := <-done; err != nil {
+		t.Errorf(`LogShipper.Run() => error{"%v"}, want nil`, err)
+	}
+	want := []string{"web:api[10] stdout: one", "web:api[10] stdout: two", "web:api[10] stdout: three+"}
+	if text := sink.text(); !cmpStrings(text, want) {
+		t.Errorf(`LogShipper.Run() => %q, want %q`, text, want)
+	}
+}
+
+// Test shipping only the lines selected by a filter.
+func TestLogShipperFilter(t *testing.T) {
+	sink := newMemorySink()
+	shipper := NewLogShipper(sink)
+	shipper.Filter = &LogFilter{Level: LevelError, Processes: []string{"workers"}}
+	shipper.Handle(logEvent("workers:w1", 10, false, "INFO ok\nERROR bad\n"))
+	shipper.Handle(logEvent("web:api", 11, false, "ERROR elsewhere\n"))
+	shipper.Close()
+	want := []string{"workers:w1[10] stdout: ERROR bad"}
+	if text := sink.text(); !cmpStrings(text, want) {
+		t.Errorf(`LogShipper.Close() => %q, want %q`, text, want)
+	}
+}
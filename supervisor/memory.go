@@ -0,0 +1,309 @@
+package supervisor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	byteUnits = []struct {
+		suffix string
+		size   int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"G", 1 << 30},
+		{"M", 1 << 20},
+		{"K", 1 << 10},
+		{"B", 1},
+	}
+)
+
+// ParseByteSize parses a size such as 512, 200KB, 200MB or 1GB. Units are powers of 1024 and the
+// trailing B may be left off.
+func ParseByteSize(size string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper, multiplier = strings.TrimSpace(upper[:len(upper)-len(unit.suffix)]), unit.size
+			break
+		}
+	}
+	value, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || value < 0 {
+		return 0, errors.New(fmt.Sprintf("invalid size %q", size))
+	}
+	return value * multiplier, nil
+}
+
+// FormatByteSize formats a size with the largest unit which keeps it above one.
+func FormatByteSize(size int64) string {
+	for _, unit := range byteUnits[:3] {
+		if size >= unit.size {
+			return strconv.FormatFloat(float64(size)/float64(unit.size), 'f', 1, 64) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(size, 10) + "B"
+}
+
+// MemoryLimit is the most resident memory a process may use. Name is a group, a program name or a
+// group:name. An empty name applies to every process.
+type MemoryLimit struct {
+	Name  string
+	Bytes int64
+}
+
+// MemoryRestart is a process the memory watchdog restarted, or failed to restart when Error is set.
+type MemoryRestart struct {
+	Time    time.Time
+	Process Process
+	RSS     int64
+	Limit   int64
+	Error   error
+}
+
+func (restart MemoryRestart) String() string {
+	return fmt.Sprintf("%s using %s over limit %s", processKey(restart.Process), FormatByteSize(restart.RSS), FormatByteSize(restart.Limit))
+}
+
+// MemoryWatchdog restarts processes using more resident memory than their limit, in the manner of
+// superlance's memmon. It follows the processes known to a Monitor through the Monitor's events and
+// checks them on every TICK event forwarded by a Monitor running as an event listener with
+// ForwardEvents set. Check may also be called directly, as with a polling Monitor.
+//
+// Memory is read from /proc, found at ProcRoot, so processes are only checked on Linux. When
+// Cumulative is set the memory of a process includes that of its descendants. Processes which are
+// not RUNNING are left alone. Restarts are sent to Notifier if it is not nil and errors reading
+// memory, restarting or notifying are passed to OnError.
+type MemoryWatchdog struct {
+	Client     Client
+	Limits     []MemoryLimit
+	Cumulative bool
+	Notifier   Notifier
+	ProcRoot   string
+	OnError    func(err error)
+	host       string
+	now        func() time.Time
+	lock       *sync.Mutex
+	processes  map[string]Process
+}
+
+// NewMemoryWatchdog creates a watchdog which restarts processes with the client.
+func NewMemoryWatchdog(client Client, limits ...MemoryLimit) MemoryWatchdog {
+	host, _ := os.Hostname()
+	return MemoryWatchdog{
+		Client:    client,
+		Limits:    limits,
+		ProcRoot:  "/proc",
+		host:      host,
+		now:       time.Now,
+		lock:      &sync.Mutex{},
+		processes: make(map[string]Process),
+	}
+}
+
+// limit returns the limit of a process. A limit for the group:name is preferred over one for the
+// name, then the group and then every process. Zero is returned if there is no limit.
+func (watchdog MemoryWatchdog) limit(proc Process) int64 {
+	best, limit := 0, int64(0)
+	for _, candidate := range watchdog.Limits {
+		if rank := matchRank(proc, candidate.Name); rank > best {
+			best, limit = rank, candidate.Bytes
+		}
+	}
+	return limit
+}
+
+// Observe updates the known processes from a Monitor event and checks them when the event is a
+// forwarded TICK.
+func (watchdog MemoryWatchdog) Observe(event interface{}) {
+	watchdog.lock.Lock()
+	switch event := event.(type) {
+	case ProcessAddEvent:
+		watchdog.processes[processKey(event.Process)] = event.Process
+	case ProcessStateEvent:
+		watchdog.processes[processKey(event.Process)] = event.Process
+	case ProcessRemoveEvent:
+		delete(watchdog.processes, processKey(event.Process))
+	}
+	watchdog.lock.Unlock()
+
+	if event, ok := event.(ListenerEvent); ok && event.Event.Parent() == "TICK" {
+		watchdog.Check()
+	}
+}
+
+// Run updates the watchdog from the events channel of a Monitor until it is closed.
+func (watchdog MemoryWatchdog) Run(events chan interface{}) {
+	for event := range events {
+		watchdog.Observe(event)
+	}
+}
+
+// Check reads the memory used by each RUNNING process with a limit and restarts those over it in
+// order of group:name. The restarts attempted are returned.
+func (watchdog MemoryWatchdog) Check() (restarts []MemoryRestart) {
+	watchdog.lock.Lock()
+	var procs []Process
+	for _, proc := range watchdog.processes {
+		if proc.State == Running && proc.PID > 0 {
+			procs = append(procs, proc)
+		}
+	}
+	watchdog.lock.Unlock()
+	sort.Slice(procs, func(i, j int) bool {
+		return processKey(procs[i]) < processKey(procs[j])
+	})
+	if len(procs) == 0 {
+		return
+	}
+
+	var children map[int][]int
+	if watchdog.Cumulative {
+		var err error
+		if children, err = readProcessTree(watchdog.ProcRoot); err != nil {
+			watchdog.error(err)
+			return
+		}
+	}
+	for _, proc := range procs {
+		limit := watchdog.limit(proc)
+		if limit <= 0 {
+			continue
+		}
+		rss, err := readTreeRSS(watchdog.ProcRoot, proc.PID, children)
+		if err != nil {
+			watchdog.error(err)
+			continue
+		}
+		if rss > limit {
+			restart := watchdog.restart(MemoryRestart{Time: watchdog.now(), Process: proc, RSS: rss, Limit: limit})
+			restarts = append(restarts, restart)
+		}
+	}
+	return
+}
+
+// restart restarts a process and sends a notification.
+func (watchdog MemoryWatchdog) restart(restart MemoryRestart) MemoryRestart {
+	name := processKey(restart.Process)
+	restart.Error = restartProcess(watchdog.Client, name)
+
+	subject := fmt.Sprintf("%s restarted on %s", name, watchdog.host)
+	body := fmt.Sprintf("Process %s (pid %d) on %s was using %s, over its limit of %s, and was restarted.\n",
+		name, restart.Process.PID, watchdog.host, FormatByteSize(restart.RSS), FormatByteSize(restart.Limit))
+	if restart.Error != nil {
+		watchdog.error(restart.Error)
+		subject = fmt.Sprintf("%s failed to restart on %s", name, watchdog.host)
+		body = fmt.Sprintf("Process %s (pid %d) on %s is using %s, over its limit of %s, and could not be restarted: %s\n",
+			name, restart.Process.PID, watchdog.host, FormatByteSize(restart.RSS), FormatByteSize(restart.Limit), restart.Error)
+	}
+	if watchdog.Notifier != nil {
+		err := watchdog.Notifier.Notify(Notification{
+			Time:    restart.Time,
+			Kind:    "memory",
+			Host:    watchdog.host,
+			Process: name,
+			Group:   restart.Process.Group,
+			Name:    restart.Process.Name,
+			State:   restart.Process.State,
+			Subject: subject,
+			Body:    body,
+		})
+		if err != nil {
+			watchdog.error(err)
+		}
+	}
+	return restart
+}
+
+// error passes an error to OnError.
+func (watchdog MemoryWatchdog) error(err error) {
+	if watchdog.OnError != nil {
+		watchdog.OnError(err)
+	}
+}
+
+// readRSS reads the resident memory of a process in bytes from /proc/<pid>/statm.
+func readRSS(root string, pid int) (int64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(root, strconv.Itoa(pid), "statm"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, errors.New(fmt.Sprintf("invalid statm for pid %d", pid))
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
+
+// readTreeRSS reads the resident memory of a process and, if children is not nil, its descendants.
+// Descendants which exit while they are read are skipped.
+func readTreeRSS(root string, pid int, children map[int][]int) (int64, error) {
+	rss, err := readRSS(root, pid)
+	if err != nil {
+		return 0, err
+	}
+	pending := append([]int(nil), children[pid]...)
+	seen := map[int]bool{pid: true}
+	for len(pending) > 0 {
+		child := pending[0]
+		pending = pending[1:]
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		if size, err := readRSS(root, child); err == nil {
+			rss += size
+		}
+		pending = append(pending, children[child]...)
+	}
+	return rss, nil
+}
+
+// readProcessTree maps the pid of each process in /proc to the pids of its children.
+func readProcessTree(root string) (map[int][]int, error) {
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(root, entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// the command name in parentheses may contain spaces and parentheses
+		end := bytes.LastIndexByte(data, ')')
+		if end < 0 {
+			continue
+		}
+		fields := strings.Fields(string(data[end+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		if ppid, err := strconv.Atoi(fields[1]); err == nil {
+			children[ppid] = append(children[ppid], pid)
+		}
+	}
+	return children, nil
+}
@@ -0,0 +1,116 @@
+package supervisor
+
+import (
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// writeProc writes the stat and statm files of a fake /proc entry.
+func writeProc(t *testing.T, root string, pid int, ppid int, rss int64) {
+	dir := filepath.Join(root, strconv.Itoa(pid))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	stat := fmt.Sprintf("%d (my (odd) cmd) S %d %d %d 0", pid, ppid, pid, pid)
+	statm := fmt.Sprintf("1000 %d 10 1 0 100 0\n", rss/int64(os.Getpagesize()))
+	if err := ioutil.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "statm"), []byte(statm), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test parsing and formatting sizes.
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		size  string
+		bytes int64
+		valid bool
+	}{
+		{"512", 512, true},
+		{"200KB", 200 << 10, true},
+		{"200mb", 200 << 20, true},
+		{"1G", 1 << 30, true},
+		{"10 MB", 10 << 20, true},
+		{"MB", 0, false},
+		{"-1", 0, false},
+	}
+	for _, test := range tests {
+		bytes, err := ParseByteSize(test.size)
+		if bytes != test.bytes || (err == nil) != test.valid {
+			t.Errorf(`ParseByteSize("%s") => %d, error{"%v"}, want %d`, test.size, bytes, err, test.bytes)
+		}
+	}
+	if size := FormatByteSize(300 << 20); size != "300.0MB" {
+		t.Errorf(`FormatByteSize(300MB) => %s, want 300.0MB`, size)
+	}
+}
+
+// Test that the memory watchdog restarts processes over their limits.
+func TestMemoryWatchdog(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "web:worker", "cron")...)
+	client := testClient(t, server)
+	for _, name := range []string{"web:api", "web:worker", "cron:cron"} {
+		if _, err := client.StartProcess(name, true); err != nil {
+			t.Fatalf(`Client.StartProcess("%s") => error{"%v"}, want nil`, name, err)
+		}
+	}
+	server.ResetCalls()
+
+	root := t.TempDir()
+	writeProc(t, root, 100, 1, 150<<20)
+	writeProc(t, root, 101, 100, 100<<20)
+	writeProc(t, root, 200, 1, 150<<20)
+	writeProc(t, root, 300, 1, 600<<20)
+
+	hook := newWebhookServer(t)
+	watchdog := NewMemoryWatchdog(client, MemoryLimit{"web", 200 << 20}, MemoryLimit{"worker", 100 << 20}, MemoryLimit{"", 1 << 30})
+	watchdog.ProcRoot = root
+	watchdog.Notifier = NewWebhookNotifier(hook.URL)
+	var errs []error
+	watchdog.OnError = func(err error) {
+		errs = append(errs, err)
+	}
+
+	events := make(chan interface{}, 10)
+	events <- ProcessAddEvent{Process: Process{Name: "api", Group: "web", State: Running, PID: 100}}
+	events <- ProcessAddEvent{Process: Process{Name: "worker", Group: "web", State: Starting}}
+	events <- ProcessStateEvent{Process: Process{Name: "worker", Group: "web", State: Running, PID: 200}}
+	events <- ProcessAddEvent{Process: Process{Name: "cron", Group: "cron", State: Running, PID: 300}}
+	events <- ListenerEvent{Event: createEvent(1, "TICK_5", "", nil)}
+	close(events)
+	watchdog.Run(events)
+	if got := actions(server); fmt.Sprint(got) != "[stop web:worker start web:worker]" {
+		t.Errorf(`MemoryWatchdog.Run() => %v, want worker restarted`, got)
+	}
+
+	server.ResetCalls()
+	watchdog.Cumulative = true
+	restarts := watchdog.Check()
+	if got := actions(server); fmt.Sprint(got) != "[stop web:api start web:api stop web:worker start web:worker]" {
+		t.Errorf(`MemoryWatchdog.Check() => %v, want api and worker restarted`, got)
+	}
+	for _, restart := range restarts {
+		if restart.Process.Name == "api" && (restart.RSS != 250<<20 || restart.Limit != 200<<20) {
+			t.Errorf(`MemoryWatchdog.Check() => %v, want api using 250MB over 200MB`, restart)
+		}
+	}
+
+	watchdog.Observe(ProcessRemoveEvent{Process: Process{Name: "worker", Group: "web"}})
+	watchdog.Observe(ProcessStateEvent{Process: Process{Name: "api", Group: "web", State: Stopping, PID: 100}})
+	if restarts := watchdog.Check(); len(restarts) != 0 {
+		t.Errorf(`MemoryWatchdog.Check() => %v, want no restarts`, restarts)
+	}
+	if len(errs) > 0 {
+		t.Errorf(`MemoryWatchdog.OnError() called with %v, want no errors`, errs)
+	}
+	if notifications := hook.received(); len(notifications) != 3 || notifications[0].Kind != "memory" {
+		t.Errorf(`MemoryWatchdog sent %+v, want 3 memory notifications`, notifications)
+	}
+}
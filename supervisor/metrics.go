@@ -0,0 +1,426 @@
+package supervisor
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric types.
+const (
+	MetricCounter   string = "counter"
+	MetricGauge     string = "gauge"
+	MetricHistogram string = "histogram"
+)
+
+const (
+	// MetricsNamespace prefixes the metric names served by Metrics.
+	MetricsNamespace string = "supervisor"
+)
+
+var (
+	// DefaultRpcBuckets are the upper bounds in seconds of the RPC latency histogram buckets.
+	DefaultRpcBuckets []float64 = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+	processStates    []string = []string{Stopped, Starting, Running, Backoff, Stopping, Exited, Fatal, Unknown}
+	supervisorStates []string = []string{"FATAL", "RUNNING", "RESTARTING", "SHUTDOWN"}
+)
+
+// Label is a metric label.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a metric family. Histogram samples are named with a _bucket, _sum or
+// _count suffix.
+type Sample struct {
+	Name   string
+	Labels []Label
+	Value  float64
+}
+
+// Label returns the value of a label or an empty string if the sample does not have it.
+func (sample Sample) Label(name string) string {
+	for _, label := range sample.Labels {
+		if label.Name == name {
+			return label.Value
+		}
+	}
+	return ""
+}
+
+// MetricFamily is a set of samples which share a name, help text and type. Names do not include
+// the namespace.
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// processMetrics holds the metrics of a single process.
+type processMetrics struct {
+	process    Process
+	starts     ProcessStarts
+	exitStatus int64
+	tries      int64
+}
+
+// healthMetrics holds the health check metrics of a single process.
+type healthMetrics struct {
+	process  Process
+	up       bool
+	duration time.Duration
+	failures int64
+	restarts int64
+}
+
+// histogram counts observations in buckets.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// metricsState is the mutable state shared by copies of Metrics.
+type metricsState struct {
+	supervisor    Supervisor
+	up            bool
+	refreshErrors int64
+	lostEvents    int64
+	duplicates    int64
+	processes     map[string]*processMetrics
+	health        map[string]*healthMetrics
+	events        map[string]int64
+	rpc           map[string]*histogram
+	rpcErrors     map[string]int64
+}
+
+// Metrics collects Supervisor and process metrics from Monitor events and Client RPC calls. It is
+// safe for concurrent use and serves the collected metrics in the Prometheus text format.
+type Metrics struct {
+	Client  *Client
+	Buckets []float64
+	lock    *sync.Mutex
+	state   *metricsState
+	now     func() time.Time
+}
+
+// NewMetrics creates an empty set of metrics. The client is optional. When given it is used to
+// look up the start time and exit status of processes, which are not carried by Monitor events.
+func NewMetrics(client *Client) Metrics {
+	return Metrics{
+		Client:  client,
+		Buckets: DefaultRpcBuckets,
+		lock:    &sync.Mutex{},
+		state: &metricsState{
+			supervisor: *NewSupervisor(),
+			processes:  make(map[string]*processMetrics),
+			health:     make(map[string]*healthMetrics),
+			events:     make(map[string]int64),
+			rpc:        make(map[string]*histogram),
+			rpcErrors:  make(map[string]int64),
+		},
+		now: time.Now,
+	}
+}
+
+// lookup fetches the process info used for the start time and exit status.
+func (metrics Metrics) lookup(proc Process) (info ProcessInfo, ok bool) {
+	if metrics.Client == nil {
+		return
+	}
+	info, err := metrics.Client.GetProcessInfo(proc.Group + ":" + proc.Name)
+	return info, err == nil
+}
+
+// Observe updates the metrics from a Monitor event. Unknown events are ignored.
+func (metrics Metrics) Observe(event interface{}) {
+	// look up process info before taking the lock as the client may report to ObserveRpc
+	var info ProcessInfo
+	var found bool
+	switch event := event.(type) {
+	case ProcessAddEvent:
+		info, found = metrics.lookup(event.Process)
+	case ProcessStateEvent:
+		if event.Process.State != Starting {
+			info, found = metrics.lookup(event.Process)
+		}
+	}
+
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	state := metrics.state
+	now := metrics.now()
+
+	switch event := event.(type) {
+	case SupervisorStateEvent:
+		state.supervisor = event.Supervisor
+		state.up = true
+	case ProcessAddEvent:
+		state.up = true
+		proc := &processMetrics{process: event.Process}
+		if found {
+			proc.exitStatus = info.ExitStatus
+			if info.Start > 0 && event.Process.State == Running {
+				proc.starts.Since = now.Add(-time.Duration(info.Now-info.Start) * time.Second)
+			}
+		} else if event.Process.State == Running {
+			proc.starts.Since = now
+		}
+		state.processes[processKey(event.Process)] = proc
+	case ProcessRemoveEvent:
+		delete(state.processes, processKey(event.Process))
+		delete(state.health, processKey(event.Process))
+	case ProcessStateEvent:
+		state.up = true
+		key := processKey(event.Process)
+		proc, ok := state.processes[key]
+		if !ok {
+			proc = &processMetrics{}
+			state.processes[key] = proc
+		}
+		proc.starts.Update(proc.process, event.Process, now)
+		if found {
+			proc.exitStatus = info.ExitStatus
+		}
+		proc.tries = int64(event.Tries)
+		proc.process = event.Process
+	case ListenerEvent:
+		state.events[event.Event.Name()]++
+	case RefreshErrorEvent:
+		state.refreshErrors++
+		state.up = false
+	case SerialGapEvent:
+		for _, gap := range event.Lost {
+			state.lostEvents += int64(gap.Count())
+		}
+	case SerialDuplicateEvent:
+		state.duplicates++
+	case HealthCheckEvent:
+		key := processKey(event.Process)
+		health, ok := state.health[key]
+		if !ok {
+			health = &healthMetrics{}
+			state.health[key] = health
+		}
+		health.process = event.Process
+		health.up = event.Healthy()
+		health.duration = event.Duration
+		if !event.Healthy() {
+			health.failures++
+		}
+		if event.Restarted {
+			health.restarts++
+		}
+	}
+}
+
+// ObserveRpc records the latency of an RPC call. It can be used as the RpcObserver of a Client.
+func (metrics Metrics) ObserveRpc(method string, duration time.Duration, err error) {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	hist, ok := metrics.state.rpc[method]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(metrics.Buckets))}
+		metrics.state.rpc[method] = hist
+	}
+	seconds := duration.Seconds()
+	for i, bound := range metrics.Buckets {
+		if seconds <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += seconds
+
+	if err != nil {
+		metrics.state.rpcErrors[method]++
+	} else {
+		metrics.state.up = true
+	}
+}
+
+// Run updates the metrics from the events channel of a Monitor until it is closed.
+func (metrics Metrics) Run(events chan interface{}) {
+	for event := range events {
+		metrics.Observe(event)
+	}
+}
+
+// processKey returns the group:name key of a process.
+func processKey(proc Process) string {
+	return proc.Group + ":" + proc.Name
+}
+
+// boolValue converts a bool to a sample value.
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// Gather returns a snapshot of the metrics sorted by name.
+func (metrics Metrics) Gather() []MetricFamily {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	state := metrics.state
+	now := metrics.now()
+
+	up := MetricFamily{"up", "Whether the last refresh of Supervisor succeeded.", MetricGauge,
+		[]Sample{{"up", nil, boolValue(state.up)}}}
+	supState := MetricFamily{"state", "The state of supervisord.", MetricGauge, nil}
+	for _, name := range supervisorStates {
+		supState.Samples = append(supState.Samples, Sample{"state", []Label{{"state", name}}, boolValue(state.supervisor.State == name)})
+	}
+	refreshErrors := MetricFamily{"refresh_errors_total", "Number of failed refreshes.", MetricCounter,
+		[]Sample{{"refresh_errors_total", nil, float64(state.refreshErrors)}}}
+
+	events := MetricFamily{"events_total", "Number of events received by type.", MetricCounter, nil}
+	for name, count := range state.events {
+		events.Samples = append(events.Samples, Sample{"events_total", []Label{{"event", name}}, float64(count)})
+	}
+
+	lostEvents := MetricFamily{"lost_events_total", "Number of events discarded by Supervisor before reaching the listener.", MetricCounter,
+		[]Sample{{"lost_events_total", nil, float64(state.lostEvents)}}}
+	duplicates := MetricFamily{"duplicate_events_total", "Number of events Supervisor sent to the listener again.", MetricCounter,
+		[]Sample{{"duplicate_events_total", nil, float64(state.duplicates)}}}
+
+	procState := MetricFamily{"process_state", "The state of a process.", MetricGauge, nil}
+	uptime := MetricFamily{"process_uptime_seconds", "Seconds since a running process was started.", MetricGauge, nil}
+	exitStatus := MetricFamily{"process_exit_status", "The exit status of the last run of a process.", MetricGauge, nil}
+	restarts := MetricFamily{"process_restarts_total", "Number of times a process has been started.", MetricCounter, nil}
+	tries := MetricFamily{"process_start_retries", "Number of failed start attempts of a process.", MetricGauge, nil}
+	for _, proc := range state.processes {
+		labels := []Label{{"group", proc.process.Group}, {"name", proc.process.Name}}
+		for _, name := range processStates {
+			stateLabels := append(append([]Label{}, labels...), Label{"state", name})
+			procState.Samples = append(procState.Samples, Sample{"process_state", stateLabels, boolValue(proc.process.State == name)})
+		}
+		seconds := 0.0
+		if proc.process.State == Running && !proc.starts.Since.IsZero() {
+			seconds = math.Floor(now.Sub(proc.starts.Since).Seconds())
+		}
+		uptime.Samples = append(uptime.Samples, Sample{"process_uptime_seconds", labels, seconds})
+		exitStatus.Samples = append(exitStatus.Samples, Sample{"process_exit_status", labels, float64(proc.exitStatus)})
+		restarts.Samples = append(restarts.Samples, Sample{"process_restarts_total", labels, float64(proc.starts.Restarts)})
+		tries.Samples = append(tries.Samples, Sample{"process_start_retries", labels, float64(proc.tries)})
+	}
+
+	healthUp := MetricFamily{"health_check_up", "Whether the last health check of a process passed.", MetricGauge, nil}
+	healthDuration := MetricFamily{"health_check_duration_seconds", "Duration of the last health check of a process.", MetricGauge, nil}
+	healthFailures := MetricFamily{"health_check_failures_total", "Number of failed health checks of a process.", MetricCounter, nil}
+	healthRestarts := MetricFamily{"health_check_restarts_total", "Number of restarts of a process after failed health checks.", MetricCounter, nil}
+	for _, health := range state.health {
+		labels := []Label{{"group", health.process.Group}, {"name", health.process.Name}}
+		healthUp.Samples = append(healthUp.Samples, Sample{"health_check_up", labels, boolValue(health.up)})
+		healthDuration.Samples = append(healthDuration.Samples, Sample{"health_check_duration_seconds", labels, health.duration.Seconds()})
+		healthFailures.Samples = append(healthFailures.Samples, Sample{"health_check_failures_total", labels, float64(health.failures)})
+		healthRestarts.Samples = append(healthRestarts.Samples, Sample{"health_check_restarts_total", labels, float64(health.restarts)})
+	}
+
+	rpc := MetricFamily{"rpc_duration_seconds", "Latency of RPC calls by method.", MetricHistogram, nil}
+	for method, hist := range state.rpc {
+		for i, bound := range metrics.Buckets {
+			labels := []Label{{"method", method}, {"le", formatValue(bound)}}
+			rpc.Samples = append(rpc.Samples, Sample{"rpc_duration_seconds_bucket", labels, float64(hist.counts[i])})
+		}
+		labels := []Label{{"method", method}}
+		rpc.Samples = append(rpc.Samples,
+			Sample{"rpc_duration_seconds_bucket", []Label{{"method", method}, {"le", "+Inf"}}, float64(hist.count)},
+			Sample{"rpc_duration_seconds_sum", labels, hist.sum},
+			Sample{"rpc_duration_seconds_count", labels, float64(hist.count)})
+	}
+	rpcErrors := MetricFamily{"rpc_errors_total", "Number of failed RPC calls by method.", MetricCounter, nil}
+	for method, count := range state.rpcErrors {
+		rpcErrors.Samples = append(rpcErrors.Samples, Sample{"rpc_errors_total", []Label{{"method", method}}, float64(count)})
+	}
+
+	families := []MetricFamily{up, supState, refreshErrors, events, lostEvents, duplicates, procState, uptime, exitStatus, restarts, tries,
+		healthUp, healthDuration, healthFailures, healthRestarts, rpc, rpcErrors}
+	for _, family := range families {
+		sortSamples(family.Samples)
+	}
+	sort.SliceStable(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+	return families
+}
+
+// sortSamples orders samples by their labels so output is stable. Histogram buckets keep their
+// order within a method.
+func sortSamples(samples []Sample) {
+	key := func(sample Sample) string {
+		parts := make([]string, 0, len(sample.Labels))
+		for _, label := range sample.Labels {
+			if label.Name != "le" && label.Name != "state" {
+				parts = append(parts, label.Value)
+			}
+		}
+		return strings.Join(parts, "\x00")
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return key(samples[i]) < key(samples[j])
+	})
+}
+
+// formatValue formats a sample value as Prometheus expects.
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value for the Prometheus text format.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// WriteMetrics writes metric families in the Prometheus text format. Names are prefixed with the
+// namespace if it is not empty.
+func WriteMetrics(writer io.Writer, namespace string, families []MetricFamily) error {
+	prefix := ""
+	if namespace != "" {
+		prefix = namespace + "_"
+	}
+	for _, family := range families {
+		if _, err := fmt.Fprintf(writer, "# HELP %s%s %s\n# TYPE %s%s %s\n", prefix, family.Name, family.Help, prefix, family.Name, family.Type); err != nil {
+			return err
+		}
+		for _, sample := range family.Samples {
+			labels := ""
+			if len(sample.Labels) > 0 {
+				pairs := make([]string, len(sample.Labels))
+				for i, label := range sample.Labels {
+					pairs[i] = fmt.Sprintf(`%s="%s"`, label.Name, escapeLabel(label.Value))
+				}
+				labels = "{" + strings.Join(pairs, ",") + "}"
+			}
+			if _, err := fmt.Fprintf(writer, "%s%s%s %s\n", prefix, sample.Name, labels, formatValue(sample.Value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (metrics Metrics) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	WriteMetrics(writer, MetricsNamespace, metrics.Gather())
+}
@@ -0,0 +1,102 @@
+package supervisor
+
+import (
+	"errors"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test collecting metrics from a polling monitor and scraping them over HTTP.
+func TestMetrics(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "cron")...)
+	server.SetState("web:api", Running)
+
+	events := make(chan interface{}, 100)
+	mon, err := NewPollingMonitor(server.URL, events)
+	if err != nil {
+		t.Fatalf(`NewPollingMonitor() => error{"%v"}, want nil`, err)
+	}
+	client := mon.Client
+	metrics := NewMetrics(&client)
+	mon.Client = client.WithObserver(metrics.ObserveRpc)
+
+	if err := mon.Refresh(); err != nil {
+		t.Fatalf(`Monitor.Refresh() => error{"%v"}, want nil`, err)
+	}
+	server.SetState("cron", Running)
+	if err := mon.Refresh(); err != nil {
+		t.Fatalf(`Monitor.Refresh() => error{"%v"}, want nil`, err)
+	}
+	events <- ProcessStateEvent{Process: Process{Name: "cron", Group: "cron", State: Starting}, Tries: 2}
+	events <- ListenerEvent{Event: Event{Header: map[string]string{"eventname": "TICK_5"}}}
+	events <- ListenerEvent{Event: Event{Header: map[string]string{"eventname": "TICK_5"}}}
+	events <- RefreshErrorEvent{Error: errors.New("connection refused"), Failures: 1, Retry: time.Second}
+	close(events)
+	metrics.Run(events)
+	metrics.ObserveRpc("supervisor.getState", 30*time.Millisecond, errors.New("timeout"))
+
+	exporter := httptest.NewServer(metrics)
+	defer exporter.Close()
+	resp, err := exporter.Client().Get(exporter.URL)
+	if err != nil {
+		t.Fatalf(`GET /metrics => error{"%v"}, want nil`, err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf(`GET /metrics => Content-Type %q, want text/plain; version=0.0.4`, contentType)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	text := string(body)
+
+	for _, want := range []string{
+		"# TYPE supervisor_process_state gauge\n",
+		`supervisor_process_state{group="web",name="api",state="RUNNING"} 1` + "\n",
+		`supervisor_process_state{group="web",name="api",state="STOPPED"} 0` + "\n",
+		`supervisor_process_state{group="cron",name="cron",state="STARTING"} 1` + "\n",
+		`supervisor_process_restarts_total{group="cron",name="cron"} 2` + "\n",
+		`supervisor_process_start_retries{group="cron",name="cron"} 2` + "\n",
+		`supervisor_process_exit_status{group="web",name="api"} 0` + "\n",
+		`supervisor_events_total{event="TICK_5"} 2` + "\n",
+		`supervisor_state{state="RUNNING"} 1` + "\n",
+		"supervisor_refresh_errors_total 1\n",
+		"# TYPE supervisor_rpc_duration_seconds histogram\n",
+		`supervisor_rpc_duration_seconds_count{method="supervisor.getAllProcessInfo"} 2` + "\n",
+		`supervisor_rpc_duration_seconds_bucket{method="supervisor.getState",le="0.025"} 2` + "\n",
+		`supervisor_rpc_duration_seconds_bucket{method="supervisor.getState",le="0.05"} 3` + "\n",
+		`supervisor_rpc_duration_seconds_bucket{method="supervisor.getState",le="+Inf"} 3` + "\n",
+		`supervisor_rpc_errors_total{method="supervisor.getState"} 1` + "\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("GET /metrics =>\n%s\nwant it to contain %q", text, want)
+		}
+	}
+	if !strings.Contains(text, "supervisor_up 0\n") {
+		t.Errorf(`GET /metrics => want supervisor_up 0 after a failed refresh`)
+	}
+
+	if _, err := mon.Client.GetIdentification(); err != nil {
+		t.Fatalf(`Client.GetIdentification() => error{"%v"}, want nil`, err)
+	}
+	for _, family := range metrics.Gather() {
+		if family.Name == "up" && family.Samples[0].Value != 1 {
+			t.Errorf(`Metrics.Gather() => up %v, want 1 after a successful RPC call`, family.Samples[0].Value)
+		}
+	}
+}
+
+// Test label escaping and value formatting of the text format.
+func TestWriteMetrics(t *testing.T) {
+	families := []MetricFamily{{"info", "Help.", MetricGauge, []Sample{{"info", []Label{{"path", "a\"b\\c\nd"}}, 0.5}}}}
+	buf := &strings.Builder{}
+	if err := WriteMetrics(buf, "", families); err != nil {
+		t.Fatalf(`WriteMetrics() => error{"%v"}, want nil`, err)
+	}
+	want := "# HELP info Help.\n# TYPE info gauge\ninfo{path=\"a\\\"b\\\\c\\nd\"} 0.5\n"
+	if buf.String() != want {
+		t.Errorf("WriteMetrics() =>\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -57,12 +57,43 @@ type ProcessStateEvent struct {
 	Tries      int
 }
 
+// ListenerEvent is emitted for every event received by a monitor running as an event listener when
+// ForwardEvents is set.
+type ListenerEvent struct {
+	Supervisor Supervisor
+	Event      Event
+}
+
+// SerialGapEvent is emitted by a monitor running as an event listener when an event follows events
+// which Supervisor discarded because the listener's buffer overflowed.
+type SerialGapEvent struct {
+	Supervisor Supervisor
+	Event      Event
+	Lost       []Gap
+}
+
+// SerialDuplicateEvent is emitted by a monitor running as an event listener when Supervisor sends an
+// event again.
+type SerialDuplicateEvent struct {
+	Supervisor Supervisor
+	Event      Event
+}
+
+// serialNote is a duplicate or gap reported by the listener of a running monitor.
+type serialNote struct {
+	event     Event
+	duplicate bool
+	lost      []Gap
+}
+
 type Monitor struct {
-	Client     Client
-	Listener   Listener
-	Supervisor *Supervisor
-	Processes  map[string]*Process
-	events     chan interface{}
+	Client        Client
+	Listener      Listener
+	Supervisor    *Supervisor
+	Processes     map[string]*Process
+	ForwardEvents bool
+	RefreshOnGap  bool
+	events        chan interface{}
 }
 
 // NewMonitor creates a new Supervisor monitor.
@@ -71,17 +102,21 @@ func NewMonitor(url string, in io.Reader, out io.Writer, events chan interface{}
 	if err != nil {
 		return
 	}
+	return NewMonitorWithClient(client, in, out, events), nil
+}
 
-	listener := NewListener(in, out)
-
-	mon = Monitor{
+// NewMonitorWithClient creates a Supervisor monitor which calls Supervisor with an existing client.
+// The in and out streams are nil for a monitor driven by Poll.
+func NewMonitorWithClient(client Client, in io.Reader, out io.Writer, events chan interface{}) Monitor {
+	return Monitor{
 		client,
-		listener,
+		NewListener(in, out).WithSerialObserver(nil),
 		NewSupervisor(),
 		make(map[string]*Process),
+		false,
+		false,
 		events,
 	}
-	return
 }
 
 // Close the monitor.
@@ -195,10 +230,33 @@ func (mon Monitor) Refresh() (err error) {
 	return
 }
 
-// Run monitors the status of the Supervisor instance and sends events to the provided channel.
+// Run monitors the status of the Supervisor instance and sends events to the provided channel. The
+// pool serials of events are tracked and a SerialGapEvent or SerialDuplicateEvent is sent when an
+// event follows lost events or is sent again. When RefreshOnGap is set the monitor refreshes after
+// lost events since it may have missed state changes. Serials are tracked by the listener, so its
+// SerialCounts include the events read by Run. An error is returned if the monitor has no listener
+// streams, as when it was created with NewPollingMonitor.
 func (mon Monitor) Run() error {
+	if mon.Listener.in == nil || mon.Listener.out == nil {
+		return errors.New("monitor has no event listener, use Poll")
+	}
 	done := make(chan bool)
 	events := make(chan Event)
+	notes := make(chan serialNote, 16)
+
+	// chain the observer onto the listener's own tracker so that its counts and observer are kept
+	listener := mon.Listener
+	if listener.serials == nil {
+		listener = listener.WithSerialObserver(nil)
+	}
+	var previous SerialObserver
+	previous = listener.serials.swap(func(event Event, duplicate bool, lost []Gap) {
+		if previous != nil {
+			previous(event, duplicate, lost)
+		}
+		notes <- serialNote{event, duplicate, lost}
+	})
+	defer listener.serials.swap(previous)
 
 	defer func() {
 		close(events)
@@ -207,6 +265,10 @@ func (mon Monitor) Run() error {
 
 	go func() {
 		for event := range events {
+			mon.handleSerials(notes)
+			if mon.ForwardEvents && mon.events != nil {
+				mon.events <- ListenerEvent{*mon.Supervisor, event}
+			}
 			parent := event.Parent()
 			switch parent {
 			case "PROCESS_STATE":
@@ -221,5 +283,29 @@ func (mon Monitor) Run() error {
 		done <- true
 	}()
 
-	return mon.Listener.Run(events)
+	return listener.Run(events)
+}
+
+// handleSerials emits the duplicates and gaps reported by the listener and refreshes after a gap
+// when RefreshOnGap is set.
+func (mon Monitor) handleSerials(notes chan serialNote) {
+	refresh := false
+	for {
+		select {
+		case note := <-notes:
+			if mon.events != nil {
+				if note.duplicate {
+					mon.events <- SerialDuplicateEvent{*mon.Supervisor, note.event}
+				} else {
+					mon.events <- SerialGapEvent{*mon.Supervisor, note.event, note.lost}
+				}
+			}
+			refresh = refresh || len(note.lost) > 0
+		default:
+			if refresh && mon.RefreshOnGap {
+				mon.Refresh()
+			}
+			return
+		}
+	}
 }
@@ -0,0 +1,73 @@
+package supervisor
+
+import (
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"testing"
+	"time"
+)
+
+// Test that a monitor reports lost events and refreshes after them.
+func TestMonitorSerials(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api")...)
+	pool := supervisortest.NewEventPool("monitor")
+	pool.BufferSize = 1
+
+	events := make(chan interface{}, 100)
+	mon, err := NewMonitor(server.URL, pool.Stdin(), pool.Stdout(), events)
+	if err != nil {
+		t.Fatalf(`NewMonitor() => error{"%v"}, want nil`, err)
+	}
+	mon.RefreshOnGap = true
+	observed := 0
+	mon.Listener = mon.Listener.WithSerialObserver(func(event Event, duplicate bool, lost []Gap) {
+		observed++
+	})
+	done := make(chan error)
+	go func() {
+		done <- mon.Run()
+	}()
+
+	state := supervisortest.SupervisorStateEvent(Running)
+	if _, err := pool.Send(state); err != nil {
+		t.Fatalf(`EventPool.Send() => error{"%v"}, want nil`, err)
+	}
+	pool.Emit(state, state)
+	if _, err := pool.Drain(0); err != nil {
+		t.Fatalf(`EventPool.Drain() => error{"%v"}, want nil`, err)
+	}
+	pool.Close()
+	if err := <-done; err != nil {
+		t.Errorf(`Monitor.Run() => error{"%v"}, want nil`, err)
+	}
+	close(events)
+
+	var gaps []SerialGapEvent
+	added := false
+	for event := range events {
+		switch event := event.(type) {
+		case SerialGapEvent:
+			gaps = append(gaps, event)
+		case ProcessAddEvent:
+			added = event.Process.Name == "api"
+		}
+	}
+	if len(gaps) != 1 || gaps[0].Event.PoolSerial() != 2 || len(gaps[0].Lost) != 1 || gaps[0].Lost[0] != (Gap{1, 1}) {
+		t.Errorf(`Monitor.Run() emitted %+v, want one gap of serial 1 before serial 2`, gaps)
+	}
+	if !added {
+		t.Errorf(`Monitor.Run() did not refresh after the gap`)
+	}
+	if counts := mon.Listener.SerialCounts(); counts != (SerialCounts{Events: 2, Lost: 1}) || observed != 1 {
+		t.Errorf(`Monitor.Listener.SerialCounts() => %+v with %d observed, want 2 events and 1 lost observed`, counts, observed)
+	}
+
+	metrics := NewMetrics(nil)
+	metrics.now = func() time.Time { return time.Unix(0, 0) }
+	metrics.Observe(gaps[0])
+	metrics.Observe(SerialDuplicateEvent{})
+	for _, family := range metrics.Gather() {
+		if (family.Name == "lost_events_total" || family.Name == "duplicate_events_total") && family.Samples[0].Value != 1 {
+			t.Errorf(`metric %s => %v, want 1`, family.Name, family.Samples[0].Value)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package supervisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification is a message sent by a listener about a process.
+type Notification struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Host    string    `json:"host,omitempty"`
+	Process string    `json:"process,omitempty"`
+	Group   string    `json:"group,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	State   string    `json:"state,omitempty"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+}
+
+// Notifier delivers notifications.
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+// SmtpNotifier sends notifications as plain text email through an SMTP server.
+type SmtpNotifier struct {
+	Address string
+	From    string
+	To      []string
+	Auth    smtp.Auth
+}
+
+// NewSmtpNotifier creates a notifier which sends mail through the SMTP server at the given
+// host:port.
+func NewSmtpNotifier(address string, from string, to ...string) SmtpNotifier {
+	return SmtpNotifier{Address: address, From: from, To: to}
+}
+
+// Notify sends the notification as an email.
+func (notifier SmtpNotifier) Notify(notification Notification) error {
+	if len(notifier.To) == 0 {
+		return errors.New("no recipients")
+	}
+	headers := []string{
+		"From: " + notifier.From,
+		"To: " + strings.Join(notifier.To, ", "),
+		"Subject: " + strings.NewReplacer("\r", " ", "\n", " ").Replace(notification.Subject),
+		"Date: " + notification.Time.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	body := strings.ReplaceAll(strings.ReplaceAll(notification.Body, "\r\n", "\n"), "\n", "\r\n")
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + body
+	return smtp.SendMail(notifier.Address, notifier.Auth, notifier.From, notifier.To, []byte(message))
+}
+
+// WebhookNotifier posts notifications to a URL as JSON.
+type WebhookNotifier struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// NewWebhookNotifier creates a notifier which posts to the given URL.
+func NewWebhookNotifier(url string) WebhookNotifier {
+	return WebhookNotifier{
+		URL:     url,
+		Headers: make(map[string]string),
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify posts the notification. A response other than 2xx is an error.
+func (notifier WebhookNotifier) Notify(notification Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, notifier.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range notifier.Headers {
+		request.Header.Set(key, value)
+	}
+	client := notifier.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return errors.New(fmt.Sprintf("webhook returned %s", response.Status))
+	}
+	return nil
+}
+
+// MultiNotifier delivers notifications with each of its notifiers. Every notifier is tried and the
+// first error is returned.
+type MultiNotifier []Notifier
+
+// Notify sends the notification with every notifier.
+func (notifiers MultiNotifier) Notify(notification Notification) (err error) {
+	for _, notifier := range notifiers {
+		if notifyErr := notifier.Notify(notification); notifyErr != nil && err == nil {
+			err = notifyErr
+		}
+	}
+	return
+}
+
+// RateLimit allows Burst notifications at once and one more each Interval after that. A zero Burst
+// is no limit.
+type RateLimit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// bucket is the state of a rate limit for one key.
+type bucket struct {
+	tokens     float64
+	last       time.Time
+	suppressed int
+}
+
+// rateLimiter applies rate limits to each of a set of keys.
+type rateLimiter struct {
+	lock    *sync.Mutex
+	buckets map[string]*bucket
+}
+
+// newRateLimiter creates a limiter with no keys.
+func newRateLimiter() rateLimiter {
+	return rateLimiter{&sync.Mutex{}, make(map[string]*bucket)}
+}
+
+// allow takes a token for the key. It returns false if there are none left, otherwise it returns
+// the number of times allow returned false for the key since it last returned true.
+func (limiter rateLimiter) allow(limit RateLimit, key string, now time.Time) (allowed bool, suppressed int) {
+	if limit.Burst <= 0 {
+		return true, 0
+	}
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	b, ok := limiter.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		limiter.buckets[key] = b
+	}
+	if limit.Interval > 0 && now.After(b.last) {
+		b.tokens += float64(now.Sub(b.last)) / float64(limit.Interval)
+		if b.tokens > float64(limit.Burst) {
+			b.tokens = float64(limit.Burst)
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		b.suppressed++
+		return false, 0
+	}
+	b.tokens--
+	suppressed, b.suppressed = b.suppressed, 0
+	return true, suppressed
+}
+
+// matchProcess returns true if the names are empty or contain the group, the group:name or the
+// name of the process.
+func matchProcess(names []string, group string, name string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, match := range names {
+		if match == group || match == name || match == group+":"+name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package supervisor
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// PollConfig controls how often a polling monitor refreshes its state.
+type PollConfig struct {
+	Interval   time.Duration // time between successful refreshes
+	Jitter     time.Duration // maximum random delay added to every wait
+	MaxBackoff time.Duration // upper bound of the wait after failed refreshes
+}
+
+// DefaultPollConfig refreshes every five seconds and backs off to one minute on errors.
+var DefaultPollConfig = PollConfig{
+	Interval:   5 * time.Second,
+	Jitter:     time.Second,
+	MaxBackoff: time.Minute,
+}
+
+// Delay returns the time to wait before the next refresh given the number of consecutive failed
+// refreshes. The interval is doubled for every failure up to MaxBackoff. A zero MaxBackoff
+// disables backoff. A random jitter of up to Jitter is then added.
+func (config PollConfig) Delay(failures int) time.Duration {
+	delay := config.Interval
+	if config.MaxBackoff > 0 {
+		for i := 0; i < failures && delay < config.MaxBackoff; i++ {
+			delay *= 2
+		}
+		if failures > 0 && delay > config.MaxBackoff {
+			delay = config.MaxBackoff
+		}
+	}
+	if config.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(config.Jitter)))
+	}
+	return delay
+}
+
+// validate returns an error if the config would poll without waiting.
+func (config PollConfig) validate() error {
+	if config.Interval < 0 || (config.Interval == 0 && config.Jitter <= 0) {
+		return errors.New("poll interval must be positive")
+	}
+	return nil
+}
+
+// RefreshErrorEvent is emitted when a polling monitor fails to refresh.
+type RefreshErrorEvent struct {
+	Supervisor Supervisor
+	Error      error
+	Failures   int
+	Retry      time.Duration
+}
+
+// NewPollingMonitor creates a Supervisor monitor which is driven by Poll instead of an event
+// listener. Calling Run on the returned monitor returns an error.
+func NewPollingMonitor(url string, events chan interface{}) (Monitor, error) {
+	return NewMonitor(url, nil, nil, events)
+}
+
+// Poll refreshes the monitor on the interval given by the config until the stop channel is closed
+// or receives a value. The same add, remove, and state events are emitted as when running as an
+// event listener. A RefreshErrorEvent is emitted for every failed refresh after which polling
+// continues with an increasing delay. An error is returned if the config would poll without
+// waiting.
+func (mon Monitor) Poll(config PollConfig, stop chan bool) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	failures := 0
+	for {
+		var delay time.Duration
+		if err := mon.Refresh(); err != nil {
+			failures++
+			delay = config.Delay(failures)
+			if mon.events != nil {
+				mon.events <- RefreshErrorEvent{*mon.Supervisor, err, failures, delay}
+			}
+		} else {
+			failures = 0
+			delay = config.Delay(0)
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
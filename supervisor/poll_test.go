@@ -0,0 +1,112 @@
+package supervisor
+
+import (
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"testing"
+	"time"
+)
+
+// Test the PollConfig.Delay backoff calculation.
+func TestPollDelay(t *testing.T) {
+	config := PollConfig{Interval: time.Second, MaxBackoff: 10 * time.Second}
+
+	verify := func(failures int, want time.Duration) {
+		if delay := config.Delay(failures); delay != want {
+			t.Errorf(`PollConfig.Delay(%d) => %v, want %v`, failures, delay, want)
+		}
+	}
+
+	verify(0, time.Second)
+	verify(1, 2*time.Second)
+	verify(3, 8*time.Second)
+	verify(4, 10*time.Second)
+	verify(100, 10*time.Second)
+
+	config.MaxBackoff = 0
+	verify(5, time.Second)
+
+	config.Jitter = time.Second
+	for i := 0; i < 100; i++ {
+		if delay := config.Delay(0); delay < time.Second || delay >= 2*time.Second {
+			t.Errorf(`PollConfig.Delay(0) => %v, want [1s, 2s)`, delay)
+		}
+	}
+}
+
+// Test polling a fake Supervisor for changes.
+func TestPoll(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "cron")...)
+	events := make(chan interface{}, 100)
+	mon, err := NewPollingMonitor(server.URL, events)
+	if err != nil {
+		t.Fatalf(`NewPollingMonitor() => error{"%v"}, want nil`, err)
+	}
+	if err := mon.Run(); err == nil {
+		t.Errorf(`Monitor.Run() => nil for a polling monitor, want error`)
+	}
+	stop := make(chan bool)
+	if err := mon.Poll(PollConfig{}, stop); err == nil {
+		t.Errorf(`Monitor.Poll(PollConfig{}) => nil, want error`)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- mon.Poll(PollConfig{Interval: 10 * time.Millisecond, MaxBackoff: time.Second}, stop)
+	}()
+
+	// wait returns the first event for which match returns true.
+	wait := func(what string, match func(event interface{}) bool) {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case event := <-events:
+				if match(event) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf(`Monitor.Poll() did not emit %s`, what)
+			}
+		}
+	}
+
+	added := map[string]bool{}
+	wait("ProcessAddEvent for api and cron", func(event interface{}) bool {
+		if event, ok := event.(ProcessAddEvent); ok {
+			added[event.Process.Name] = true
+		}
+		return added["api"] && added["cron"]
+	})
+
+	server.SetState("web:api", Running)
+	wait("ProcessStateEvent for api", func(event interface{}) bool {
+		state, ok := event.(ProcessStateEvent)
+		return ok && state.Process.Name == "api" && state.Process.State == Running && state.FromState == Stopped
+	})
+
+	server.SetFault("supervisor.getState", FaultFailed, 1)
+	wait("RefreshErrorEvent", func(event interface{}) bool {
+		refresh, ok := event.(RefreshErrorEvent)
+		if ok && (refresh.Failures != 1 || refresh.Retry != 20*time.Millisecond || FaultName(refresh.Error) != FaultFailed) {
+			t.Errorf(`Monitor.Poll() emitted %+v, want 1 failure retried in 20ms`, refresh)
+		}
+		return ok
+	})
+
+	if _, err := testClient(t, server).RemoveProcessGroup("cron"); err != nil {
+		t.Fatalf(`Client.RemoveProcessGroup() => error{"%v"}, want nil`, err)
+	}
+	wait("ProcessRemoveEvent for cron", func(event interface{}) bool {
+		remove, ok := event.(ProcessRemoveEvent)
+		return ok && remove.Process.Name == "cron"
+	})
+
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf(`Monitor.Poll() => error{"%v"}, want nil`, err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf(`Monitor.Poll() did not return after stop was closed`)
+	}
+}
@@ -0,0 +1,176 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultPoolReorder is how far out of order the processes of a pool may record serials before a
+// missing serial is considered lost.
+const DefaultPoolReorder int = 16
+
+// Coordinator shares the serial state of event pools between the processes of a pool.
+type Coordinator interface {
+	// Update calls the function with the state of the pool locked against other processes. The
+	// state is stored when the function returns nil and discarded otherwise.
+	Update(pool string, update func(state *SerialState) error) error
+}
+
+// MemoryCoordinator keeps pool state in memory. It coordinates listeners running in the same
+// process and serves the state for a SocketCoordinator.
+type MemoryCoordinator struct {
+	lock  *sync.Mutex
+	pools map[string]SerialState
+}
+
+// NewMemoryCoordinator creates an empty in memory coordinator.
+func NewMemoryCoordinator() MemoryCoordinator {
+	return MemoryCoordinator{&sync.Mutex{}, make(map[string]SerialState)}
+}
+
+// Update calls the function with the state of the pool.
+func (coordinator MemoryCoordinator) Update(pool string, update func(state *SerialState) error) error {
+	coordinator.lock.Lock()
+	defer coordinator.lock.Unlock()
+	state := coordinator.pools[pool].clone()
+	if err := update(&state); err != nil {
+		return err
+	}
+	coordinator.pools[pool] = state
+	return nil
+}
+
+// FileCoordinator keeps the state of each pool in a JSON file in a directory and locks the file
+// while it is updated. The state survives the listener processes.
+type FileCoordinator struct {
+	Dir string
+}
+
+// NewFileCoordinator creates a coordinator which keeps state in the given directory.
+func NewFileCoordinator(dir string) FileCoordinator {
+	return FileCoordinator{dir}
+}
+
+// Update calls the function with the state of the pool read from its file.
+func (coordinator FileCoordinator) Update(pool string, update func(state *SerialState) error) error {
+	path := filepath.Join(coordinator.Dir, url.PathEscape(pool)+".json")
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = lockFile(file); err != nil {
+		return err
+	}
+	defer unlockFile(file)
+
+	state := SerialState{}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &state); err != nil {
+			return err
+		}
+	}
+	if err = update(&state); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(state); err != nil {
+		return err
+	}
+	if err = file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt(data, 0)
+	return err
+}
+
+// PoolMux coordinates the processes of an event listener pool with numprocs greater than one.
+// Supervisor sends each event to one READY process in the pool, so each process sees only some of
+// the pool serials, and sends an event again when the process handling it fails or exits. PoolMux
+// records the pool serial of every event in state shared through a Coordinator so that an event is
+// handled by one process and events the pool lost are reported once.
+type PoolMux struct {
+	Coordinator Coordinator
+	Reorder     int
+	OnLost      func(pool string, lost []Gap)
+}
+
+// NewPoolMux creates a pool multiplexer which shares state through the coordinator.
+func NewPoolMux(coordinator Coordinator) PoolMux {
+	return PoolMux{coordinator, DefaultPoolReorder, nil}
+}
+
+// Accept records an event in the shared state. It returns false if a process in the pool has
+// already accepted the event. Serials the pool has lost are returned.
+func (mux PoolMux) Accept(event Event) (accepted bool, lost []Gap, err error) {
+	err = mux.Coordinator.Update(event.Pool(), func(state *SerialState) error {
+		var duplicate bool
+		duplicate, lost = state.Observe(event.PoolSerial(), mux.Reorder)
+		accepted = !duplicate
+		return nil
+	})
+	return
+}
+
+// Release forgets an accepted event so that it is accepted again when Supervisor resends it. It
+// should be called before returning a FAIL result for an event.
+func (mux PoolMux) Release(event Event) error {
+	return mux.Coordinator.Update(event.Pool(), func(state *SerialState) error {
+		state.Forget(event.PoolSerial())
+		return nil
+	})
+}
+
+// Values calls the function with the values shared by the pool. The values are stored if the
+// function returns nil.
+func (mux PoolMux) Values(pool string, update func(values map[string]string) error) error {
+	return mux.Coordinator.Update(pool, func(state *SerialState) error {
+		if state.Values == nil {
+			state.Values = make(map[string]string)
+		}
+		return update(state.Values)
+	})
+}
+
+// Run starts the listener and calls the handler with the events accepted by the pool. An event is
+// acknowledged with OK once the handler returns nil. When the handler returns an error the event is
+// released and answered with FAIL so that Supervisor sends it again, possibly to another process.
+// Events already accepted by another process are acknowledged without being handled and lost
+// serials are passed to OnLost. Run exits with an error if the coordinator fails, without sending a
+// result for the event, so Supervisor restarts the listener and sends the event again.
+func (mux PoolMux) Run(listener Listener, handle func(event Event) error) error {
+	listener.Ready()
+	for {
+		event, err := listener.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		accepted, lost, err := mux.Accept(event)
+		if err != nil {
+			return err
+		}
+		if len(lost) > 0 && mux.OnLost != nil {
+			mux.OnLost(event.Pool(), lost)
+		}
+		if accepted && handle(event) != nil {
+			if err = mux.Release(event); err != nil {
+				return err
+			}
+			listener.Fail()
+		} else {
+			listener.Ok()
+		}
+		listener.Ready()
+	}
+}
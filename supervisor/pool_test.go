@@ -0,0 +1,260 @@
+package supervisor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test tracking serials with out of order arrivals, duplicates, gaps and restarts.
+func TestSerialState(t *testing.T) {
+	state := SerialState{}
+	tests := []struct {
+		serial    int
+		duplicate bool
+		lost      string
+	}{
+		{10, false, "[]"},
+		{11, false, "[]"},
+		{11, true, "[]"},
+		{13, false, "[]"},
+		{12, false, "[]"},
+		{16, false, "[]"},
+		{15, false, "[]"},
+		{17, false, "[14]"},
+		{20, false, "[]"},
+		{21, false, "[18]"},
+		{22, false, "[19]"},
+		{21, true, "[]"},
+		{0, false, "[]"},
+		{0, true, "[]"},
+	}
+	for _, test := range tests {
+		duplicate, lost := state.Observe(test.serial, 2)
+		if duplicate != test.duplicate || fmt.Sprint(lost) != test.lost {
+			t.Errorf(`SerialState.Observe(%d, 2) => %v, %v, want %v, %s`, test.serial, duplicate, lost, test.duplicate, test.lost)
+		}
+	}
+	if state.Next != 1 || len(state.Pending) != 0 {
+		t.Errorf(`SerialState after restart => %+v, want next 1 and nothing pending`, state)
+	}
+
+	state = SerialState{}
+	state.Observe(5, 0)
+	state.Observe(6, 0)
+	state.Forget(6)
+	if duplicate, _ := state.Observe(6, 0); duplicate {
+		t.Errorf(`SerialState.Observe(6, 0) after Forget(6) => duplicate, want accepted`)
+	}
+	if _, lost := state.Observe(100, 0); fmt.Sprint(lost) != "[7-99]" || lost[0].Count() != 93 {
+		t.Errorf(`SerialState.Observe(100, 0) => lost %v, want [7-99]`, lost)
+	}
+}
+
+// Test that coordinators serialize updates from several processes.
+func TestCoordinators(t *testing.T) {
+	dir := t.TempDir()
+	memory := NewMemoryCoordinator()
+	sockets := []SocketCoordinator{
+		NewSocketCoordinator(filepath.Join(dir, "pool.sock")),
+		NewSocketCoordinator(filepath.Join(dir, "pool.sock")),
+	}
+	// the first socket coordinator to connect serves the state
+	if err := sockets[0].Update("workers", func(state *SerialState) error { return nil }); err != nil {
+		t.Fatalf(`SocketCoordinator.Update() => error{"%v"}, want nil`, err)
+	}
+	tests := []struct {
+		name         string
+		coordinators []Coordinator
+	}{
+		{"memory", []Coordinator{memory, memory}},
+		{"file", []Coordinator{NewFileCoordinator(dir), NewFileCoordinator(dir)}},
+		{"socket", []Coordinator{sockets[0], sockets[1]}},
+	}
+	for _, test := range tests {
+		wg := sync.WaitGroup{}
+		for _, coordinator := range test.coordinators {
+			mux := NewPoolMux(coordinator)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					err := mux.Values("workers", func(values map[string]string) error {
+						count, _ := strconv.Atoi(values["count"])
+						values["count"] = strconv.Itoa(count + 1)
+						return nil
+					})
+					if err != nil {
+						t.Errorf(`%s: PoolMux.Values() => error{"%v"}, want nil`, test.name, err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		mux := NewPoolMux(test.coordinators[1])
+		mux.Values("workers", func(values map[string]string) error {
+			if values["count"] != "100" {
+				t.Errorf(`%s: count => %s, want 100`, test.name, values["count"])
+			}
+			return errors.New("aborted")
+		})
+	}
+
+	// the second socket coordinator takes over when the first closes
+	sockets[0].Close()
+	err := sockets[1].Update("workers", func(state *SerialState) error {
+		if state.Values["count"] != "" {
+			t.Errorf(`count after takeover => %s, want empty state`, state.Values["count"])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf(`SocketCoordinator.Update() after takeover => error{"%v"}, want nil`, err)
+	}
+	sockets[1].Close()
+}
+
+// Test that a socket coordinator aborts and disconnects when it is sent a state it can not read.
+func TestSocketCoordinatorBadState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	replies := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			replies <- nil
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			lines = append(lines, line)
+			if strings.HasPrefix(line, "LOCK ") {
+				io.WriteString(conn, "not json\n")
+			}
+		}
+		replies <- lines
+	}()
+
+	coordinator := NewSocketCoordinator(path)
+	called := false
+	err = coordinator.Update("workers", func(state *SerialState) error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Errorf(`SocketCoordinator.Update() => error{"%v"}, called %v, want error without calling update`, err, called)
+	}
+	if lines := <-replies; fmt.Sprint(lines) != fmt.Sprint([]string{"LOCK workers\n", "ABORT\n"}) {
+		t.Errorf(`SocketCoordinator sent %q, want LOCK then ABORT before disconnecting`, lines)
+	}
+	coordinator.Close()
+}
+
+// Test that processes in a pool accept each event once.
+func TestPoolMuxAccept(t *testing.T) {
+	coordinator := NewFileCoordinator(t.TempDir())
+	first, second := NewPoolMux(coordinator), NewPoolMux(coordinator)
+	first.Reorder = 1
+	second.Reorder = 1
+
+	steps := []struct {
+		mux      PoolMux
+		serial   int
+		accepted bool
+		lost     string
+	}{
+		{first, 0, true, "[]"},
+		{second, 1, true, "[]"},
+		{first, 3, true, "[]"},
+		{second, 2, true, "[]"},
+		{second, 3, false, "[]"}, // the first process exited while handling 3
+		{first, 6, true, "[4]"},
+		{second, 7, true, "[5]"},
+	}
+	for _, step := range steps {
+		event := createEvent(step.serial, "TICK_5", "", nil)
+		accepted, lost, err := step.mux.Accept(event)
+		if err != nil || accepted != step.accepted || fmt.Sprint(lost) != step.lost {
+			t.Errorf(`PoolMux.Accept(%d) => %v, %v, error{"%v"}, want %v, %s`, step.serial, accepted, lost, err, step.accepted, step.lost)
+		}
+	}
+
+	event := createEvent(7, "TICK_5", "", nil)
+	if err := second.Release(event); err != nil {
+		t.Errorf(`PoolMux.Release(7) => error{"%v"}, want nil`, err)
+	}
+	if accepted, _, _ := first.Accept(event); !accepted {
+		t.Errorf(`PoolMux.Accept(7) after Release(7) => false, want true`)
+	}
+}
+
+// Test running a listener with a pool multiplexer.
+func TestPoolMuxRun(t *testing.T) {
+	pool := supervisortest.NewEventPool("workers")
+	pool.BufferSize = 2
+	listener := NewListener(pool.Stdin(), pool.Stdout())
+	mux := NewPoolMux(NewMemoryCoordinator())
+	mux.Reorder = 0
+	var lost []Gap
+	mux.OnLost = func(name string, gaps []Gap) {
+		lost = append(lost, gaps...)
+	}
+
+	// the first attempt to handle each tick fails
+	var handled []int
+	failed := make(map[int]bool)
+	done := make(chan error)
+	go func() {
+		done <- mux.Run(listener, func(event Event) error {
+			serial := event.PoolSerial()
+			if event.Name() == "TICK_5" && !failed[serial] {
+				failed[serial] = true
+				return errors.New("handler failed")
+			}
+			handled = append(handled, serial)
+			return nil
+		})
+	}()
+
+	pool.Send(supervisortest.SupervisorStateEvent(Running))
+	pool.Emit(supervisortest.TickEvent(5, time.Unix(5, 0)), supervisortest.TickEvent(5, time.Unix(5, 0)), supervisortest.TickEvent(5, time.Unix(5, 0)))
+	deliveries, err := pool.Drain(0)
+	if err != nil {
+		t.Fatalf(`EventPool.Drain() => error{"%v"}, want nil`, err)
+	}
+	pool.Close()
+	if err := <-done; err != nil {
+		t.Errorf(`PoolMux.Run() => error{"%v"}, want nil`, err)
+	}
+	var results []string
+	for _, delivery := range deliveries {
+		results = append(results, delivery.Result)
+	}
+	if want := "[FAIL OK FAIL OK]"; fmt.Sprint(results) != want {
+		t.Errorf(`EventPool.Drain() => %v, want %s`, results, want)
+	}
+	if fmt.Sprint(handled) != "[0 2 3]" || fmt.Sprint(lost) != "[1]" {
+		t.Errorf(`PoolMux.Run() handled %v and lost %v, want [0 2 3] and [1]`, handled, lost)
+	}
+}
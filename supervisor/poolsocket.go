@@ -0,0 +1,243 @@
+package supervisor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// time allowed for each exchange with the coordinator socket
+	coordinatorTimeout time.Duration = 5 * time.Second
+
+	errAborted = errors.New("update aborted")
+)
+
+// coordinatorServer serves the state of a memory coordinator over a socket.
+type coordinatorServer struct {
+	listener net.Listener
+	memory   MemoryCoordinator
+	lock     *sync.Mutex
+	conns    map[net.Conn]bool
+}
+
+// serve accepts connections until the listener is closed.
+func (server coordinatorServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.lock.Lock()
+		server.conns[conn] = true
+		server.lock.Unlock()
+		go server.handle(conn)
+	}
+}
+
+// handle answers the requests of a client. A client sends "LOCK pool" and is sent the state of the
+// pool as a line of JSON. The pool stays locked until the client replies with the new state, which
+// is acknowledged with "OK", or with "ABORT".
+func (server coordinatorServer) handle(conn net.Conn) {
+	defer func() {
+		server.lock.Lock()
+		delete(server.conns, conn)
+		server.lock.Unlock()
+		conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Time{})
+		line, err := reader.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "LOCK ") {
+			return
+		}
+		pool, err := url.PathUnescape(strings.TrimSpace(line[5:]))
+		if err != nil {
+			return
+		}
+		err = server.memory.Update(pool, func(state *SerialState) error {
+			data, err := json.Marshal(state)
+			if err != nil {
+				return err
+			}
+			conn.SetDeadline(time.Now().Add(coordinatorTimeout))
+			if _, err = conn.Write(append(data, '\n')); err != nil {
+				return err
+			}
+			reply, err := reader.ReadString('\n')
+			if err != nil {
+				return err
+			} else if reply == "ABORT\n" {
+				return errAborted
+			}
+			*state = SerialState{}
+			return json.Unmarshal([]byte(reply), state)
+		})
+		if err == nil {
+			_, err = io.WriteString(conn, "OK\n")
+		}
+		if err != nil && err != errAborted {
+			return
+		}
+	}
+}
+
+// close stops the server and disconnects its clients.
+func (server coordinatorServer) close() {
+	server.listener.Close()
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	for conn := range server.conns {
+		conn.Close()
+	}
+}
+
+// socketState is the connection of a SocketCoordinator.
+type socketState struct {
+	lock   *sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	server *coordinatorServer
+}
+
+// SocketCoordinator shares pool state between processes through a unix socket. The first process to
+// connect serves the state from memory to the others. If that process exits another takes over and
+// the state starts empty.
+type SocketCoordinator struct {
+	Path  string
+	state *socketState
+}
+
+// NewSocketCoordinator creates a coordinator which connects to the socket at the given path.
+func NewSocketCoordinator(path string) SocketCoordinator {
+	return SocketCoordinator{path, &socketState{lock: &sync.Mutex{}}}
+}
+
+// connect connects to the socket, serving it first if no process does. A lock file next to the
+// socket keeps processes from serving it at the same time.
+func (coordinator SocketCoordinator) connect() error {
+	lock, err := os.OpenFile(coordinator.Path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err = lockFile(lock); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	conn, err := net.Dial("unix", coordinator.Path)
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			// the socket was left behind by a process which exited
+			os.Remove(coordinator.Path)
+		}
+		listener, err := net.Listen("unix", coordinator.Path)
+		if err != nil {
+			return err
+		}
+		server := coordinatorServer{listener, NewMemoryCoordinator(), &sync.Mutex{}, make(map[net.Conn]bool)}
+		go server.serve()
+		coordinator.state.server = &server
+		if conn, err = net.Dial("unix", coordinator.Path); err != nil {
+			return err
+		}
+	}
+	coordinator.state.conn = conn
+	coordinator.state.reader = bufio.NewReader(conn)
+	return nil
+}
+
+// disconnect closes the connection to the socket.
+func (coordinator SocketCoordinator) disconnect() {
+	if coordinator.state.conn != nil {
+		coordinator.state.conn.Close()
+		coordinator.state.conn = nil
+	}
+}
+
+// update makes one update over the connection. Retry is true if the exchange failed before the
+// update function was called.
+func (coordinator SocketCoordinator) update(pool string, update func(state *SerialState) error) (retry bool, err error) {
+	conn, reader := coordinator.state.conn, coordinator.state.reader
+	conn.SetDeadline(time.Now().Add(coordinatorTimeout))
+	if _, err = fmt.Fprintf(conn, "LOCK %s\n", url.PathEscape(pool)); err != nil {
+		return true, err
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return true, err
+	}
+	state := SerialState{}
+	if err = json.Unmarshal([]byte(line), &state); err != nil {
+		// release the pool and drop the connection since its replies can not be trusted
+		io.WriteString(conn, "ABORT\n")
+		coordinator.disconnect()
+		return
+	}
+
+	if err = update(&state); err != nil {
+		if _, abortErr := io.WriteString(conn, "ABORT\n"); abortErr != nil {
+			coordinator.disconnect()
+		}
+		return
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		io.WriteString(conn, "ABORT\n")
+		return
+	}
+	conn.SetDeadline(time.Now().Add(coordinatorTimeout))
+	if _, err = conn.Write(append(data, '\n')); err != nil {
+		coordinator.disconnect()
+		return
+	}
+	if line, err = reader.ReadString('\n'); err != nil {
+		coordinator.disconnect()
+	} else if line != "OK\n" {
+		coordinator.disconnect()
+		err = errors.New(fmt.Sprintf("coordinator replied %q", line))
+	}
+	return
+}
+
+// Update calls the function with the state of the pool held by the process serving the socket.
+func (coordinator SocketCoordinator) Update(pool string, update func(state *SerialState) error) (err error) {
+	coordinator.state.lock.Lock()
+	defer coordinator.state.lock.Unlock()
+	for attempt := 0; attempt < 2; attempt++ {
+		if coordinator.state.conn == nil {
+			if err = coordinator.connect(); err != nil {
+				return
+			}
+		}
+		var retry bool
+		if retry, err = coordinator.update(pool, update); !retry {
+			return
+		}
+		coordinator.disconnect()
+	}
+	return
+}
+
+// Close disconnects from the socket and stops serving it if this process serves it.
+func (coordinator SocketCoordinator) Close() error {
+	coordinator.state.lock.Lock()
+	defer coordinator.state.lock.Unlock()
+	coordinator.disconnect()
+	if coordinator.state.server != nil {
+		coordinator.state.server.close()
+		coordinator.state.server = nil
+	}
+	return nil
+}
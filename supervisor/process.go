@@ -3,6 +3,7 @@ package supervisor
 import (
 	"errors"
 	"strconv"
+	"time"
 )
 
 type Process struct {
@@ -65,3 +66,54 @@ func (proc *Process) update(data interface{}) error {
 	}
 	return nil
 }
+
+// matchRank returns how specifically a name selects a process: 4 for its group:name, 3 for its
+// name, 2 for its group, 1 for an empty name, which selects every process, and 0 for any other.
+func matchRank(proc Process, name string) int {
+	switch name {
+	case proc.Group + ":" + proc.Name:
+		return 4
+	case proc.Name:
+		return 3
+	case proc.Group:
+		return 2
+	case "":
+		return 1
+	}
+	return 0
+}
+
+// ProcessStarts counts the restarts of a process seen in its state changes and records when it
+// last started running. Since is zero while the process is not running or its start is unknown.
+type ProcessStarts struct {
+	Restarts int
+	Since    time.Time
+}
+
+// Update counts a restart and sets the start time when the process changes from prev to next at
+// the given time.
+func (starts *ProcessStarts) Update(prev Process, next Process, now time.Time) {
+	switch next.State {
+	case Starting:
+		starts.Restarts++
+		starts.Since = time.Time{}
+	case Running:
+		// a poll may miss the STARTING state, a new pid means the process was restarted
+		restarted := prev.State != Starting && (prev.State != Running || next.PID != prev.PID)
+		if restarted {
+			starts.Restarts++
+		}
+		if restarted || starts.Since.IsZero() || prev.State != Running {
+			starts.Since = now
+		}
+	}
+}
+
+// restartProcess stops a process and starts it again, waiting for each to finish.
+func restartProcess(client Client, name string) error {
+	if _, err := client.StopProcess(name, true); err != nil {
+		return err
+	}
+	_, err := client.StartProcess(name, true)
+	return err
+}
@@ -0,0 +1,373 @@
+package supervisor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ProgramConfig is a [program:x] section.
+type ProgramConfig struct {
+	Name                  string
+	Command               string
+	ProcessName           string
+	NumProcs              int
+	NumProcsStart         int
+	Priority              int
+	Autostart             bool
+	Autorestart           string // true, false, or unexpected
+	StartSecs             int
+	StartRetries          int
+	ExitCodes             []int
+	StopSignal            string
+	StopWaitSecs          int
+	StopAsGroup           bool
+	KillAsGroup           bool
+	User                  string
+	RedirectStderr        bool
+	StdoutLogfile         string
+	StdoutLogfileMaxBytes int64
+	StdoutLogfileBackups  int
+	StdoutCaptureMaxBytes int64
+	StdoutEventsEnabled   bool
+	StdoutSyslog          bool
+	StderrLogfile         string
+	StderrLogfileMaxBytes int64
+	StderrLogfileBackups  int
+	StderrCaptureMaxBytes int64
+	StderrEventsEnabled   bool
+	StderrSyslog          bool
+	Environment           map[string]string
+	Directory             string
+	Umask                 string
+	ServerURL             string
+	Section               *ConfigSection
+	vars                  map[string]string
+}
+
+// ProcessNames returns the name of every process started for the program. Each name is expanded
+// with its process number.
+func (program ProgramConfig) ProcessNames() (names []string, err error) {
+	vars := make(map[string]string, len(program.vars)+1)
+	for k, v := range program.vars {
+		vars[k] = v
+	}
+
+	raw := "%(program_name)s"
+	if program.Section != nil {
+		if value, ok := program.Section.Get("process_name"); ok {
+			raw = value
+		}
+	}
+
+	for i := 0; i < program.NumProcs; i++ {
+		vars["process_num"] = strconv.Itoa(program.NumProcsStart + i)
+		var name string
+		if name, err = ExpandConfig(raw, vars); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return
+}
+
+// GroupConfig is a [group:x] section.
+type GroupConfig struct {
+	Name     string
+	Programs []string
+	Priority int
+	Section  *ConfigSection
+}
+
+// EventListenerConfig is an [eventlistener:x] section.
+type EventListenerConfig struct {
+	ProgramConfig
+	Events        []string
+	BufferSize    int
+	ResultHandler string
+}
+
+// FcgiProgramConfig is an [fcgi-program:x] section.
+type FcgiProgramConfig struct {
+	ProgramConfig
+	Socket        string
+	SocketBacklog int
+	SocketOwner   string
+	SocketMode    string
+}
+
+// configDecoder converts section options to typed values. Errors are collected rather than
+// returned so that every problem in a section can be reported.
+type configDecoder struct {
+	section *ConfigSection
+	vars    map[string]string
+	errors  []ConfigError
+}
+
+// newConfigDecoder creates a decoder for a section. Groups maps the programs listed by group
+// sections to their group, whose name supervisord uses for %(group_name)s in those programs.
+func newConfigDecoder(section *ConfigSection, groups map[string]string) *configDecoder {
+	vars := configVars(section.Path)
+	if group, ok := groups[section.Suffix()]; ok && (section.Type() == "program" || section.Type() == "fcgi-program") {
+		vars["group_name"] = group
+	}
+	return &configDecoder{section, vars, nil}
+}
+
+// programGroups returns the group of each program listed by a group section.
+func programGroups(sections []*ConfigSection) map[string]string {
+	groups := make(map[string]string)
+	for _, section := range sections {
+		if section.Type() == "group" {
+			group := newConfigDecoder(section, nil).group()
+			for _, program := range group.Programs {
+				groups[program] = group.Name
+			}
+		}
+	}
+	return groups
+}
+
+// record an error for an option
+func (d *configDecoder) fail(option *ConfigOption, format string, args ...interface{}) {
+	line := d.section.Line
+	if option != nil {
+		line = option.Line
+	}
+	d.errors = append(d.errors, ConfigError{d.section.Path, line, fmt.Sprintf(format, args...)})
+}
+
+// get the expanded value of an option
+func (d *configDecoder) value(key string, def string) (value string, option *ConfigOption) {
+	value = def
+	if option = d.section.Option(key); option != nil {
+		value = option.Value
+	}
+	expanded, err := ExpandConfig(value, d.vars)
+	if err != nil {
+		d.fail(option, "%s: %s", key, err)
+		return value, option
+	}
+	return expanded, option
+}
+
+func (d *configDecoder) string(key string, def string) string {
+	value, _ := d.value(key, def)
+	return value
+}
+
+func (d *configDecoder) bool(key string, def string) bool {
+	value, option := d.value(key, def)
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true
+	case "false", "no", "off", "0":
+		return false
+	}
+	d.fail(option, "%s: invalid boolean value %q", key, value)
+	return false
+}
+
+func (d *configDecoder) int(key string, def string) int {
+	value, option := d.value(key, def)
+	num, err := strconv.Atoi(value)
+	if err != nil {
+		d.fail(option, "%s: invalid integer value %q", key, value)
+	}
+	return num
+}
+
+func (d *configDecoder) bytes(key string, def string) int64 {
+	value, option := d.value(key, def)
+	multiplier := int64(1)
+	upper := strings.ToUpper(value)
+	for suffix, mult := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(upper, suffix) {
+			multiplier = mult
+			value = value[:len(value)-len(suffix)]
+			break
+		}
+	}
+	num, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		d.fail(option, "%s: invalid byte size %q", key, value)
+	}
+	return num * multiplier
+}
+
+func (d *configDecoder) list(key string, def string) []string {
+	value, _ := d.value(key, def)
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (d *configDecoder) ints(key string, def string) []int {
+	value, option := d.value(key, def)
+	var nums []int
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		num, err := strconv.Atoi(item)
+		if err != nil {
+			d.fail(option, "%s: invalid integer value %q", key, item)
+		}
+		nums = append(nums, num)
+	}
+	return nums
+}
+
+func (d *configDecoder) choice(key string, def string, choices ...string) string {
+	value, option := d.value(key, def)
+	for _, choice := range choices {
+		if strings.ToLower(value) == choice {
+			return choice
+		}
+	}
+	d.fail(option, "%s: invalid value %q, want one of %s", key, value, strings.Join(choices, ", "))
+	return value
+}
+
+// parse a KEY=value,KEY2="value 2" list
+func (d *configDecoder) environment(key string) map[string]string {
+	value, option := d.value(key, "")
+	env := make(map[string]string)
+	var pair []string
+	var token []rune
+	var quote rune
+
+	flush := func() {
+		pair = append(pair, string(token))
+		token = nil
+	}
+	for _, r := range value {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				token = append(token, r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '=' && len(pair) == 0:
+			flush()
+		case r == ',':
+			flush()
+			if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+				d.fail(option, "%s: invalid key/value pair %q", key, strings.Join(pair, "="))
+			} else {
+				env[strings.TrimSpace(pair[0])] = pair[1]
+			}
+			pair = nil
+		case unicode.IsSpace(r) && len(token) == 0:
+		default:
+			token = append(token, r)
+		}
+	}
+	if quote != 0 {
+		d.fail(option, "%s: unterminated quote", key)
+	}
+	if len(token) > 0 || len(pair) > 0 {
+		flush()
+		if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+			d.fail(option, "%s: invalid key/value pair %q", key, strings.Join(pair, "="))
+		} else {
+			env[strings.TrimSpace(pair[0])] = pair[1]
+		}
+	}
+	return env
+}
+
+// decode the options shared by programs, event listeners, and fcgi programs
+func (d *configDecoder) program() (program ProgramConfig) {
+	program.Name = d.section.Suffix()
+	program.Section = d.section
+
+	d.vars["program_name"] = program.Name
+	if _, ok := d.vars["group_name"]; !ok {
+		d.vars["group_name"] = program.Name
+	}
+	program.NumProcs = d.int("numprocs", "1")
+	program.NumProcsStart = d.int("numprocs_start", "0")
+	d.vars["numprocs"] = strconv.Itoa(program.NumProcs)
+	d.vars["process_num"] = strconv.Itoa(program.NumProcsStart)
+
+	program.Command = d.string("command", "")
+	program.ProcessName = d.string("process_name", "%(program_name)s")
+	program.Priority = d.int("priority", "999")
+	program.Autostart = d.bool("autostart", "true")
+	program.Autorestart = d.choice("autorestart", "unexpected", "true", "false", "unexpected")
+	program.StartSecs = d.int("startsecs", "1")
+	program.StartRetries = d.int("startretries", "3")
+	program.ExitCodes = d.ints("exitcodes", "0")
+	program.StopSignal = strings.ToUpper(d.string("stopsignal", "TERM"))
+	program.StopWaitSecs = d.int("stopwaitsecs", "10")
+	program.StopAsGroup = d.bool("stopasgroup", "false")
+	program.KillAsGroup = d.bool("killasgroup", strconv.FormatBool(program.StopAsGroup))
+	program.User = d.string("user", "")
+	program.RedirectStderr = d.bool("redirect_stderr", "false")
+	program.StdoutLogfile = d.string("stdout_logfile", "AUTO")
+	program.StdoutLogfileMaxBytes = d.bytes("stdout_logfile_maxbytes", "50MB")
+	program.StdoutLogfileBackups = d.int("stdout_logfile_backups", "10")
+	program.StdoutCaptureMaxBytes = d.bytes("stdout_capture_maxbytes", "0")
+	program.StdoutEventsEnabled = d.bool("stdout_events_enabled", "false")
+	program.StdoutSyslog = d.bool("stdout_syslog", "false")
+	program.StderrLogfile = d.string("stderr_logfile", "AUTO")
+	program.StderrLogfileMaxBytes = d.bytes("stderr_logfile_maxbytes", "50MB")
+	program.StderrLogfileBackups = d.int("stderr_logfile_backups", "10")
+	program.StderrCaptureMaxBytes = d.bytes("stderr_capture_maxbytes", "0")
+	program.StderrEventsEnabled = d.bool("stderr_events_enabled", "false")
+	program.StderrSyslog = d.bool("stderr_syslog", "false")
+	program.Environment = d.environment("environment")
+	program.Directory = d.string("directory", "")
+	program.Umask = d.string("umask", "")
+	program.ServerURL = d.string("serverurl", "AUTO")
+
+	if program.Command == "" {
+		d.fail(nil, "%s: command is required", d.section.Name)
+	}
+
+	program.vars = make(map[string]string, len(d.vars))
+	for k, v := range d.vars {
+		program.vars[k] = v
+	}
+	return
+}
+
+func (d *configDecoder) group() (group GroupConfig) {
+	group.Name = d.section.Suffix()
+	group.Programs = d.list("programs", "")
+	group.Priority = d.int("priority", "999")
+	group.Section = d.section
+	if len(group.Programs) == 0 {
+		d.fail(nil, "%s: programs is required", d.section.Name)
+	}
+	return
+}
+
+func (d *configDecoder) eventListener() (listener EventListenerConfig) {
+	listener.ProgramConfig = d.program()
+	listener.Events = d.list("events", "")
+	listener.BufferSize = d.int("buffer_size", "10")
+	listener.ResultHandler = d.string("result_handler", "supervisor.dispatchers:default_handler")
+	return
+}
+
+func (d *configDecoder) fcgiProgram() (program FcgiProgramConfig) {
+	program.ProgramConfig = d.program()
+	program.Socket = d.string("socket", "")
+	program.SocketBacklog = d.int("socket_backlog", "0")
+	program.SocketOwner = d.string("socket_owner", "")
+	program.SocketMode = d.string("socket_mode", "0700")
+	if program.Socket == "" {
+		d.fail(nil, "%s: socket is required", d.section.Name)
+	}
+	return
+}
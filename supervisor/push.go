@@ -0,0 +1,315 @@
+package supervisor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maximum size of a StatsD packet, small enough to avoid fragmentation on most networks
+	statsdPacketSize int = 1432
+)
+
+var (
+	statsdUnsafe *regexp.Regexp = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+)
+
+// Pusher sends metrics to a collector.
+type Pusher interface {
+	Push(families []MetricFamily) error
+}
+
+// PushEvery pushes the metrics with the pusher on every interval until the stop channel is closed
+// or receives a value. The metrics are pushed a final time before returning. Push errors are sent to
+// the errs channel if it is not nil and do not stop pushing.
+func (metrics Metrics) PushEvery(pusher Pusher, interval time.Duration, stop chan bool, errs chan error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		stopped := false
+		select {
+		case <-stop:
+			stopped = true
+		case <-ticker.C:
+		}
+		if err := pusher.Push(metrics.Gather()); err != nil && errs != nil {
+			errs <- err
+		}
+		if stopped {
+			return
+		}
+	}
+}
+
+// StatsdPusher sends metrics to a StatsD server over UDP. Gauges are sent as gauges, counters as
+// the increase since the previous push, and histograms as a count and a timer of the mean duration
+// in milliseconds since the previous push. Metric names are prefixed with Prefix. When DogStatsd is
+// true labels and Tags are sent as DogStatsD tags, otherwise label values are appended to the
+// metric name and Tags are not sent.
+type StatsdPusher struct {
+	Prefix    string
+	Tags      map[string]string
+	DogStatsd bool
+	conn      net.Conn
+	lock      *sync.Mutex
+	last      map[string]float64
+}
+
+// NewStatsdPusher creates a pusher which sends to the StatsD server at the given host:port.
+func NewStatsdPusher(address string, prefix string, dogstatsd bool) (pusher StatsdPusher, err error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return
+	}
+	pusher = StatsdPusher{
+		Prefix:    prefix,
+		Tags:      make(map[string]string),
+		DogStatsd: dogstatsd,
+		conn:      conn,
+		lock:      &sync.Mutex{},
+		last:      make(map[string]float64),
+	}
+	return
+}
+
+// Close the connection to the StatsD server.
+func (pusher StatsdPusher) Close() error {
+	return pusher.conn.Close()
+}
+
+// name returns the StatsD name and tag suffix of a sample.
+func (pusher StatsdPusher) name(name string, labels []Label) (string, string) {
+	name = pusher.Prefix + name
+	var tags []string
+	for _, label := range labels {
+		if pusher.DogStatsd {
+			tags = append(tags, label.Name+":"+label.Value)
+		} else {
+			name += "." + statsdUnsafe.ReplaceAllString(label.Value, "_")
+		}
+	}
+	if !pusher.DogStatsd {
+		return name, ""
+	}
+	for key, value := range pusher.Tags {
+		tags = append(tags, key+":"+value)
+	}
+	if len(tags) == 0 {
+		return name, ""
+	}
+	sort.Strings(tags[len(labels):])
+	return name, "|#" + strings.Join(tags, ",")
+}
+
+// delta returns the increase of a counter since the previous push.
+func (pusher StatsdPusher) delta(key string, value float64) float64 {
+	last, ok := pusher.last[key]
+	pusher.last[key] = value
+	if !ok || value < last {
+		// first push or the counter was reset
+		return value
+	}
+	return value - last
+}
+
+// lines converts metric families to StatsD lines.
+func (pusher StatsdPusher) lines(families []MetricFamily) []string {
+	var lines []string
+	add := func(name string, labels []Label, value float64, kind string) {
+		name, tags := pusher.name(name, labels)
+		if kind == "g" && value < 0 {
+			// a leading sign would make the gauge relative
+			lines = append(lines, name+":0|g"+tags)
+		}
+		lines = append(lines, fmt.Sprintf("%s:%s|%s%s", name, formatValue(value), kind, tags))
+	}
+
+	for _, family := range families {
+		switch family.Type {
+		case MetricGauge:
+			for _, sample := range family.Samples {
+				add(sample.Name, sample.Labels, sample.Value, "g")
+			}
+		case MetricCounter:
+			for _, sample := range family.Samples {
+				key := sample.Name + fmt.Sprint(sample.Labels)
+				if delta := pusher.delta(key, sample.Value); delta > 0 {
+					add(sample.Name, sample.Labels, delta, "c")
+				}
+			}
+		case MetricHistogram:
+			// pair the sum and count of each label set
+			sums := make(map[string]float64)
+			for _, sample := range family.Samples {
+				if strings.HasSuffix(sample.Name, "_sum") {
+					sums[fmt.Sprint(sample.Labels)] = sample.Value
+				}
+			}
+			for _, sample := range family.Samples {
+				if !strings.HasSuffix(sample.Name, "_count") {
+					continue
+				}
+				key := fmt.Sprint(sample.Labels)
+				count := pusher.delta(family.Name+"_count"+key, sample.Value)
+				sum := pusher.delta(family.Name+"_sum"+key, sums[key])
+				if count > 0 {
+					add(family.Name+"_count", sample.Labels, count, "c")
+					add(family.Name, sample.Labels, sum/count*1000, "ms")
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// Push sends the metrics to the StatsD server. Lines are batched into packets.
+func (pusher StatsdPusher) Push(families []MetricFamily) error {
+	pusher.lock.Lock()
+	defer pusher.lock.Unlock()
+
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := pusher.conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	for _, line := range pusher.lines(families) {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
+
+// HttpPusher pushes metrics to a Prometheus Pushgateway compatible endpoint. The metrics replace all
+// metrics previously pushed to the URL. Labels in Tags are added to every sample. When OpenMetrics is
+// true the body is sent in the OpenMetrics text format.
+type HttpPusher struct {
+	URL         string
+	Namespace   string
+	Tags        map[string]string
+	OpenMetrics bool
+	Client      *http.Client
+}
+
+// NewHttpPusher creates a pusher which sends metrics to a URL such as one returned by
+// PushgatewayURL.
+func NewHttpPusher(url string, namespace string) HttpPusher {
+	return HttpPusher{
+		URL:       url,
+		Namespace: namespace,
+		Tags:      make(map[string]string),
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// PushgatewayURL returns the Pushgateway URL for a job and grouping labels.
+func PushgatewayURL(base string, job string, grouping map[string]string) string {
+	url := strings.TrimSuffix(base, "/") + "/metrics/job/" + neturl.PathEscape(job)
+	keys := make([]string, 0, len(grouping))
+	for key := range grouping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		url += "/" + neturl.PathEscape(key) + "/" + neturl.PathEscape(grouping[key])
+	}
+	return url
+}
+
+// tagged returns copies of the families with the pusher tags added to every sample.
+func (pusher HttpPusher) tagged(families []MetricFamily) []MetricFamily {
+	if len(pusher.Tags) == 0 {
+		return families
+	}
+	keys := make([]string, 0, len(pusher.Tags))
+	for key := range pusher.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tagged := make([]MetricFamily, len(families))
+	for i, family := range families {
+		tagged[i] = family
+		tagged[i].Samples = make([]Sample, len(family.Samples))
+		for j, sample := range family.Samples {
+			labels := make([]Label, 0, len(keys)+len(sample.Labels))
+			for _, key := range keys {
+				labels = append(labels, Label{key, pusher.Tags[key]})
+			}
+			sample.Labels = append(labels, sample.Labels...)
+			tagged[i].Samples[j] = sample
+		}
+	}
+	return tagged
+}
+
+// Push sends the metrics to the endpoint.
+func (pusher HttpPusher) Push(families []MetricFamily) error {
+	var body bytes.Buffer
+	contentType := "text/plain; version=0.0.4; charset=utf-8"
+	families = pusher.tagged(families)
+	if pusher.OpenMetrics {
+		contentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+		WriteOpenMetrics(&body, pusher.Namespace, families)
+	} else {
+		WriteMetrics(&body, pusher.Namespace, families)
+	}
+
+	request, err := http.NewRequest(http.MethodPut, pusher.URL, &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	client := pusher.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		return errors.New(fmt.Sprintf("push to %s failed: %s: %s", pusher.URL, response.Status, strings.TrimSpace(string(message))))
+	}
+	return nil
+}
+
+// WriteOpenMetrics writes metric families in the OpenMetrics text format. Counter families are
+// named without their _total suffix as the format requires.
+func WriteOpenMetrics(writer io.Writer, namespace string, families []MetricFamily) error {
+	renamed := make([]MetricFamily, len(families))
+	for i, family := range families {
+		renamed[i] = family
+		if family.Type == MetricCounter {
+			renamed[i].Name = strings.TrimSuffix(family.Name, "_total")
+		}
+	}
+	if err := WriteMetrics(writer, namespace, renamed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(writer, "# EOF\n")
+	return err
+}
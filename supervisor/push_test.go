@@ -0,0 +1,121 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var pushFamilies []MetricFamily = []MetricFamily{
+	{"process_state", "", MetricGauge, []Sample{
+		{"process_state", []Label{{"group", "web"}, {"name", "api"}, {"state", "RUNNING"}}, 1},
+	}},
+	{"process_restarts_total", "", MetricCounter, []Sample{
+		{"process_restarts_total", []Label{{"group", "web"}, {"name", "api"}}, 3},
+	}},
+	{"rpc_duration_seconds", "", MetricHistogram, []Sample{
+		{"rpc_duration_seconds_bucket", []Label{{"method", "supervisor.getState"}, {"le", "+Inf"}}, 2},
+		{"rpc_duration_seconds_sum", []Label{{"method", "supervisor.getState"}}, 0.05},
+		{"rpc_duration_seconds_count", []Label{{"method", "supervisor.getState"}}, 2},
+	}},
+}
+
+// Read a StatsD packet from a UDP socket.
+func readPacket(t *testing.T, conn net.PacketConn) []string {
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf(`ReadFrom() => error{"%v"}, want packet`, err)
+	}
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+// Test pushing metrics to a StatsD server.
+func TestStatsdPusher(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pusher, err := NewStatsdPusher(conn.LocalAddr().String(), "supervisor.", true)
+	if err != nil {
+		t.Fatalf(`NewStatsdPusher() => error{"%v"}, want nil`, err)
+	}
+	defer pusher.Close()
+	pusher.Tags["env"] = "prod"
+
+	if err := pusher.Push(pushFamilies); err != nil {
+		t.Fatalf(`StatsdPusher.Push() => error{"%v"}, want nil`, err)
+	}
+	want := []string{
+		"supervisor.process_state:1|g|#group:web,name:api,state:RUNNING,env:prod",
+		"supervisor.process_restarts_total:3|c|#group:web,name:api,env:prod",
+		"supervisor.rpc_duration_seconds_count:2|c|#method:supervisor.getState,env:prod",
+		"supervisor.rpc_duration_seconds:25|ms|#method:supervisor.getState,env:prod",
+	}
+	if lines := readPacket(t, conn); !cmpStrings(lines, want) {
+		t.Errorf("StatsdPusher.Push() sent\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+
+	// counters are sent as deltas and unchanged counters are skipped
+	pusher.DogStatsd = false
+	pushFamilies[1].Samples[0].Value = 5
+	if err := pusher.Push(pushFamilies); err != nil {
+		t.Fatalf(`StatsdPusher.Push() => error{"%v"}, want nil`, err)
+	}
+	want = []string{
+		"supervisor.process_state.web.api.RUNNING:1|g",
+		"supervisor.process_restarts_total.web.api:2|c",
+	}
+	if lines := readPacket(t, conn); !cmpStrings(lines, want) {
+		t.Errorf("StatsdPusher.Push() sent\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	pushFamilies[1].Samples[0].Value = 3
+}
+
+// Test pushing metrics to a Pushgateway.
+func TestHttpPusher(t *testing.T) {
+	var method, path, contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		method, path, contentType, body = r.Method, r.URL.Path, r.Header.Get("Content-Type"), string(data)
+	}))
+	defer server.Close()
+
+	url := PushgatewayURL(server.URL, "supervisor", map[string]string{"instance": "web-1"})
+	pusher := NewHttpPusher(url, "supervisor")
+	pusher.Tags["env"] = "prod"
+	pusher.OpenMetrics = true
+	if err := pusher.Push(pushFamilies); err != nil {
+		t.Fatalf(`HttpPusher.Push() => error{"%v"}, want nil`, err)
+	}
+	if method != "PUT" || path != "/metrics/job/supervisor/instance/web-1" {
+		t.Errorf(`HttpPusher.Push() => %s %s, want PUT /metrics/job/supervisor/instance/web-1`, method, path)
+	}
+	if !strings.HasPrefix(contentType, "application/openmetrics-text") {
+		t.Errorf(`HttpPusher.Push() => Content-Type %q, want application/openmetrics-text`, contentType)
+	}
+	for _, want := range []string{
+		"# TYPE supervisor_process_restarts counter\n",
+		`supervisor_process_restarts_total{env="prod",group="web",name="api"} 3` + "\n",
+		"# EOF\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("HttpPusher.Push() body =>\n%s\nwant it to contain %q", body, want)
+		}
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	if err := NewHttpPusher(failing.URL, "").Push(pushFamilies); err == nil || !strings.Contains(err.Error(), "bad metrics") {
+		t.Errorf(`HttpPusher.Push() => error{"%v"}, want 400 error`, err)
+	}
+}
@@ -0,0 +1,281 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reconciler action operations.
+const (
+	ActionAddGroup    string = "add"
+	ActionRemoveGroup string = "remove"
+	ActionStart       string = "start"
+	ActionStop        string = "stop"
+)
+
+// isRunningState returns true if Supervisor considers a process in the given state to be running.
+func isRunningState(state string) bool {
+	return state == Running || state == Starting || state == Backoff
+}
+
+// qualifyName returns a process name in group:name form. Names without a group are assumed to be
+// in a group of the same name.
+func qualifyName(name string) string {
+	if strings.Contains(name, ":") {
+		return name
+	}
+	return name + ":" + name
+}
+
+// Action is a single step needed to converge Supervisor to a desired state.
+type Action struct {
+	Op        string
+	Name      string
+	FromState string
+	ToState   string
+}
+
+func (action Action) String() string {
+	switch action.Op {
+	case ActionStart, ActionStop:
+		from := action.FromState
+		if from == "" {
+			from = Unknown
+		}
+		return fmt.Sprintf("%s %s (%s => %s)", action.Op, action.Name, from, action.ToState)
+	}
+	return fmt.Sprintf("%s %s", action.Op, action.Name)
+}
+
+// Plan is an ordered list of actions.
+type Plan []Action
+
+func (plan Plan) String() string {
+	lines := make([]string, len(plan))
+	for i, action := range plan {
+		lines[i] = action.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ActionResult is the outcome of applying an action.
+type ActionResult struct {
+	Action Action
+	Error  error
+}
+
+// ProcessSpec declares the desired state of a single process.
+type ProcessSpec struct {
+	Name     string   // group:name, or name when the group has the same name
+	State    string   // Running or Stopped
+	Requires []string // processes started before and stopped after this one
+}
+
+// Spec declares the desired state of a Supervisor instance.
+type Spec struct {
+	Groups    map[string]bool // groups which must be present (true) or absent (false)
+	Processes []ProcessSpec
+}
+
+// orderSpecs sorts process specs so that every process follows the processes it requires. The
+// original order is kept where possible. An error is returned if the requirements contain a cycle or
+// name a process which is not in the list.
+func orderSpecs(specs []ProcessSpec) (ordered []ProcessSpec, err error) {
+	index := make(map[string]int, len(specs))
+	for i, spec := range specs {
+		name := qualifyName(spec.Name)
+		if _, ok := index[name]; ok {
+			err = errors.New(fmt.Sprintf("process %s declared more than once", name))
+			return
+		}
+		index[name] = i
+	}
+
+	graph := NewDependencyGraph()
+	for _, spec := range specs {
+		for _, require := range spec.Requires {
+			if _, ok := index[qualifyName(require)]; !ok {
+				err = errors.New(fmt.Sprintf("process %s requires unknown process %s", spec.Name, require))
+				return
+			}
+		}
+		graph.Add(spec.Name, spec.Requires...)
+	}
+
+	order, err := graph.Order()
+	if err != nil {
+		return
+	}
+	ordered = make([]ProcessSpec, len(order))
+	for i, name := range order {
+		ordered[i] = specs[index[name]]
+	}
+	return
+}
+
+// Reconciler converges a Supervisor instance to a desired state.
+type Reconciler struct {
+	Client   Client
+	Interval time.Duration // minimum time between applied actions
+}
+
+// NewReconciler creates a reconciler which waits at least interval between actions.
+func NewReconciler(client Client, interval time.Duration) Reconciler {
+	return Reconciler{client, interval}
+}
+
+// Plan compares the spec against the current state of Supervisor and returns the actions needed to
+// converge it. Groups are removed and added first. Processes are then stopped in reverse dependency
+// order and started in dependency order.
+func (r Reconciler) Plan(spec Spec) (plan Plan, err error) {
+	ordered, err := orderSpecs(spec.Processes)
+	if err != nil {
+		return
+	}
+
+	allInfo, err := r.Client.GetAllProcessInfo()
+	if err != nil {
+		return
+	}
+
+	current := make(map[string]ProcessInfo, len(allInfo))
+	groups := make(map[string]bool)
+	for _, info := range allInfo {
+		current[info.FullName()] = info
+		groups[info.Group] = true
+	}
+
+	groupNames := make([]string, 0, len(spec.Groups))
+	for name := range spec.Groups {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+
+	for _, proc := range ordered {
+		if proc.State != Running && proc.State != Stopped {
+			err = errors.New(fmt.Sprintf("process %s has invalid desired state %s", proc.Name, proc.State))
+			return
+		}
+		group := strings.SplitN(qualifyName(proc.Name), ":", 2)[0]
+		if present, ok := spec.Groups[group]; ok && !present {
+			err = errors.New(fmt.Sprintf("process %s is in removed group %s", proc.Name, group))
+			return
+		}
+	}
+
+	// remove groups, stopping their processes first
+	for _, group := range groupNames {
+		if spec.Groups[group] || !groups[group] {
+			continue
+		}
+		for _, info := range allInfo {
+			if info.Group == group && isRunningState(info.StateName) {
+				plan = append(plan, Action{ActionStop, info.FullName(), info.StateName, Stopped})
+			}
+		}
+		plan = append(plan, Action{ActionRemoveGroup, group, "", ""})
+	}
+
+	// add groups
+	added := make(map[string]bool)
+	for _, group := range groupNames {
+		if spec.Groups[group] && !groups[group] {
+			plan = append(plan, Action{ActionAddGroup, group, "", ""})
+			added[group] = true
+		}
+	}
+
+	// stop processes in reverse dependency order
+	for i := len(ordered) - 1; i >= 0; i-- {
+		if ordered[i].State != Stopped {
+			continue
+		}
+		name := qualifyName(ordered[i].Name)
+		if info, ok := current[name]; ok {
+			if isRunningState(info.StateName) {
+				plan = append(plan, Action{ActionStop, name, info.StateName, Stopped})
+			}
+		} else if added[strings.SplitN(name, ":", 2)[0]] {
+			plan = append(plan, Action{ActionStop, name, "", Stopped})
+		} else {
+			err = errors.New(fmt.Sprintf("process %s not found", name))
+			return
+		}
+	}
+
+	// start processes in dependency order
+	for _, proc := range ordered {
+		if proc.State != Running {
+			continue
+		}
+		name := qualifyName(proc.Name)
+		if info, ok := current[name]; ok {
+			if !isRunningState(info.StateName) {
+				plan = append(plan, Action{ActionStart, name, info.StateName, Running})
+			}
+		} else if added[strings.SplitN(name, ":", 2)[0]] {
+			plan = append(plan, Action{ActionStart, name, "", Running})
+		} else {
+			err = errors.New(fmt.Sprintf("process %s not found", name))
+			return
+		}
+	}
+	return
+}
+
+// apply a single action
+func (r Reconciler) apply(action Action) (err error) {
+	var ok bool
+	switch action.Op {
+	case ActionAddGroup:
+		if ok, err = r.Client.AddProcessGroup(action.Name); IsFault(err, FaultAlreadyAdded) {
+			ok, err = true, nil
+		}
+	case ActionRemoveGroup:
+		ok, err = r.Client.RemoveProcessGroup(action.Name)
+	case ActionStart:
+		if ok, err = r.Client.StartProcess(action.Name, true); IsFault(err, FaultAlreadyStarted) {
+			ok, err = true, nil
+		}
+	case ActionStop:
+		if ok, err = r.Client.StopProcess(action.Name, true); IsFault(err, FaultNotRunning) {
+			ok, err = true, nil
+		}
+	default:
+		return errors.New(fmt.Sprintf("invalid action %s", action.Op))
+	}
+	if err == nil && !ok {
+		err = errors.New(fmt.Sprintf("%s failed", action))
+	}
+	return
+}
+
+// Apply executes the actions of a plan in order. Applying stops at the first failed action. The
+// results of all attempted actions are returned along with the error of the failed action.
+func (r Reconciler) Apply(plan Plan) (results []ActionResult, err error) {
+	results = make([]ActionResult, 0, len(plan))
+	for i, action := range plan {
+		if i > 0 && r.Interval > 0 {
+			time.Sleep(r.Interval)
+		}
+		err = r.apply(action)
+		results = append(results, ActionResult{action, err})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Reconcile plans and applies the actions needed to converge Supervisor to the spec. When dryRun is
+// true the plan is returned without being applied.
+func (r Reconciler) Reconcile(spec Spec, dryRun bool) (plan Plan, results []ActionResult, err error) {
+	if plan, err = r.Plan(spec); err != nil || dryRun {
+		return
+	}
+	results, err = r.Apply(plan)
+	return
+}
@@ -0,0 +1,131 @@
+package supervisor
+
+import (
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"strings"
+	"testing"
+)
+
+// Compare two string slices.
+func cmpStrings(s1 []string, s2 []string) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for i := range s1 {
+		if s1[i] != s2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Test ordering of process specs by their requirements.
+func TestOrderSpecs(t *testing.T) {
+	specs := []ProcessSpec{
+		{"api", Running, []string{"db:proxy", "cache"}},
+		{"db:proxy", Running, nil},
+		{"cache", Running, []string{"db:proxy"}},
+	}
+	ordered, err := orderSpecs(specs)
+	if err != nil {
+		t.Fatalf(`orderSpecs() => error{"%v"}, want nil`, err)
+	}
+	names := make([]string, len(ordered))
+	for i, spec := range ordered {
+		names[i] = spec.Name
+	}
+	if want := []string{"db:proxy", "cache", "api"}; !cmpStrings(names, want) {
+		t.Errorf(`orderSpecs() => %v, want %v`, names, want)
+	}
+
+	specs[1].Requires = []string{"api"}
+	if _, err := orderSpecs(specs); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf(`orderSpecs() => error{"%v"}, want cycle error`, err)
+	}
+
+	specs[1].Requires = []string{"missing"}
+	if _, err := orderSpecs(specs); err == nil {
+		t.Errorf(`orderSpecs() => nil, want unknown process error`)
+	}
+}
+
+// Test planning and applying a spec.
+func TestReconcile(t *testing.T) {
+	programs := supervisortest.Programs("web:api", "web:worker", "db:proxy", "old:job")
+	server := newTestServer(t, programs...)
+	server.SetState("web:worker", Running)
+	server.SetState("old:job", Running)
+	server.Configure(append(programs, supervisortest.NewProgram("batch:cron"))...)
+
+	reconciler := NewReconciler(testClient(t, server), 0)
+	spec := Spec{
+		Groups: map[string]bool{"old": false, "batch": true},
+		Processes: []ProcessSpec{
+			{"web:api", Running, []string{"db:proxy"}},
+			{"web:worker", Stopped, nil},
+			{"db:proxy", Running, nil},
+		},
+	}
+
+	plan, results, err := reconciler.Reconcile(spec, true)
+	if err != nil {
+		t.Fatalf(`Reconciler.Reconcile(dryRun=true) => error{"%v"}, want nil`, err)
+	}
+	if len(results) != 0 {
+		t.Errorf(`Reconciler.Reconcile(dryRun=true) => %d results, want 0`, len(results))
+	}
+	want := []string{
+		"stop old:job (RUNNING => STOPPED)",
+		"remove old",
+		"add batch",
+		"stop web:worker (RUNNING => STOPPED)",
+		"start db:proxy (STOPPED => RUNNING)",
+		"start web:api (STOPPED => RUNNING)",
+	}
+	if got := strings.Split(plan.String(), "\n"); !cmpStrings(got, want) {
+		t.Errorf("Reconciler.Plan() =>\n%s\nwant\n%s", plan, strings.Join(want, "\n"))
+	}
+	if actions := actions(server); len(actions) != 0 {
+		t.Errorf(`dry run applied actions %v, want none`, actions)
+	}
+
+	if _, results, err = reconciler.Reconcile(spec, false); err != nil {
+		t.Fatalf(`Reconciler.Reconcile() => error{"%v"}, want nil`, err)
+	}
+	if len(results) != len(want) {
+		t.Errorf(`Reconciler.Reconcile() => %d results, want %d`, len(results), len(want))
+	}
+	for name, state := range map[string]string{"web:api": Running, "web:worker": Stopped, "db:proxy": Running, "batch:cron": Stopped, "old:job": ""} {
+		if got := server.State(name); got != state {
+			t.Errorf(`state of %s => "%s", want "%s"`, name, got, state)
+		}
+	}
+
+	if plan, err = reconciler.Plan(spec); err != nil || len(plan) != 0 {
+		t.Errorf(`Reconciler.Plan() after apply => %v, error{"%v"}, want empty plan`, plan, err)
+	}
+}
+
+// Test that applying stops at the first failed action.
+func TestReconcileFailure(t *testing.T) {
+	programs := supervisortest.Programs("db:proxy", "web:api")
+	programs[0].SpawnError = "can't find command '/bin/proxy'"
+	server := newTestServer(t, programs...)
+
+	reconciler := NewReconciler(testClient(t, server), 0)
+	spec := Spec{Processes: []ProcessSpec{
+		{"web:api", Running, []string{"db:proxy"}},
+		{"db:proxy", Running, nil},
+	}}
+
+	_, results, err := reconciler.Reconcile(spec, false)
+	if !IsFault(err, FaultSpawnError) {
+		t.Errorf(`Reconciler.Reconcile() => error{"%v"}, want SPAWN_ERROR`, err)
+	}
+	if len(results) != 1 || results[0].Action.Name != "db:proxy" {
+		t.Errorf(`Reconciler.Reconcile() => %v, want one failed result for db:proxy`, results)
+	}
+	if state := server.State("web:api"); state != Stopped {
+		t.Errorf(`state of web:api => "%s", want "STOPPED"`, state)
+	}
+}
@@ -0,0 +1,134 @@
+package supervisor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is an event and the time it was received.
+type Record struct {
+	Time  time.Time
+	Event Event
+}
+
+// ReadRecord reads a record written by WriteRecord. The reader should be reused for every record in
+// the stream. The error will be io.EOF at the end of the stream.
+func ReadRecord(reader *bufio.Reader) (record Record, err error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	if record.Time, err = time.Parse(time.RFC3339Nano, strings.TrimSpace(line)); err != nil {
+		err = errors.New(fmt.Sprintf("record time invalid: %s", err))
+		return
+	}
+	if record.Event, err = ReadEvent(reader); err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// WriteRecord writes a record to the stream. The time is written in RFC 3339 format on its own line
+// and is followed by the event as Supervisor sends it. Payloads are written unchanged.
+func WriteRecord(writer io.Writer, record Record) error {
+	data := []byte(record.Time.Format(time.RFC3339Nano) + "\n")
+	data = append(data, record.Event.ToBytes()...)
+	_, err := writer.Write(data)
+	return err
+}
+
+// Recorder writes the events received by a listener to a stream.
+type Recorder struct {
+	out  io.Writer
+	lock *sync.Mutex
+	err  *error
+}
+
+// NewRecorder creates a recorder which writes records to the given stream.
+func NewRecorder(out io.Writer) Recorder {
+	return Recorder{out, &sync.Mutex{}, new(error)}
+}
+
+// Record writes an event with the current time.
+func (recorder Recorder) Record(event Event) error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	err := WriteRecord(recorder.out, Record{time.Now(), event})
+	if err != nil && *recorder.err == nil {
+		*recorder.err = err
+	}
+	return err
+}
+
+// Err returns the first error encountered while recording. A listener keeps running when its
+// recorder fails so this should be checked once the listener exits.
+func (recorder Recorder) Err() error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return *recorder.err
+}
+
+// Replayer sends recorded events to a listener over its stdin and stdout in place of Supervisor.
+type Replayer struct {
+	Speed float64
+	in    io.Writer
+	out   *bufio.Reader
+}
+
+// NewReplayer creates a replayer which writes events to the listener's stdin and reads its replies
+// from the listener's stdout. Events are replayed at their original speed.
+func NewReplayer(in io.Writer, out io.Reader) Replayer {
+	return Replayer{1, in, bufio.NewReader(out)}
+}
+
+// Replay reads records from the stream and sends each event to the listener once it is READY. The
+// time between events is the recorded time divided by Speed, or no time at all if Speed is zero.
+// The result returned by the listener for each event is returned in order. An error is returned if
+// a record cannot be read or the listener does not follow the protocol.
+func (replayer Replayer) Replay(records io.Reader) (results []string, err error) {
+	reader := bufio.NewReader(records)
+	var first time.Time
+	start := time.Now()
+	for {
+		var record Record
+		if record, err = ReadRecord(reader); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+
+		var line string
+		if line, err = replayer.out.ReadString('\n'); err != nil {
+			return
+		} else if line != "READY\n" {
+			err = errors.New(fmt.Sprintf("listener sent %q, want READY", line))
+			return
+		}
+
+		if first.IsZero() {
+			first = record.Time
+		}
+		if replayer.Speed > 0 {
+			offset := time.Duration(float64(record.Time.Sub(first)) / replayer.Speed)
+			time.Sleep(time.Until(start.Add(offset)))
+		}
+		if _, err = replayer.in.Write(record.Event.ToBytes()); err != nil {
+			return
+		}
+
+		var result []byte
+		if result, err = ReadResult(replayer.out); err != nil {
+			return
+		}
+		results = append(results, string(result))
+	}
+}
@@ -0,0 +1,100 @@
+package supervisor
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test recording the events read by a listener.
+func TestRecorder(t *testing.T) {
+	pool := supervisortest.NewEventPool("listener")
+	buf := &bytes.Buffer{}
+	recorder := NewRecorder(buf)
+	listener := NewListener(pool.Stdin(), pool.Stdout()).WithRecorder(recorder)
+
+	events := make(chan Event, 2)
+	done := make(chan error)
+	go func() {
+		done <- listener.Run(events)
+	}()
+
+	start := time.Now()
+	pool.Emit(supervisortest.SupervisorStateEvent(Running), supervisortest.LogEvent("web:api", 7, false, "\x00binary\xff\n"))
+	if _, err := pool.Drain(0); err != nil {
+		t.Fatalf(`EventPool.Drain() => error{"%v"}, want nil`, err)
+	}
+	pool.Close()
+	if err := <-done; err != nil || recorder.Err() != nil {
+		t.Fatalf(`Listener.Run() => error{"%v"}, recorder error{"%v"}, want nil`, err, recorder.Err())
+	}
+
+	reader := bufio.NewReader(buf)
+	for i, want := range []string{"SUPERVISOR_STATE_CHANGE_RUNNING", "PROCESS_LOG_STDOUT"} {
+		record, err := ReadRecord(reader)
+		if err != nil {
+			t.Fatalf(`ReadRecord() => error{"%v"}, want record %d`, err, i)
+		}
+		if record.Event.Name() != want || record.Event.Serial() != i || record.Time.Before(start) {
+			t.Errorf(`ReadRecord() => %s at %s, want %s with serial %d`, record.Event, record.Time, want, i)
+		}
+		if i == 1 && (string(record.Event.Payload) != "\x00binary\xff\n" || record.Event.Meta["groupname"] != "web") {
+			t.Errorf(`ReadRecord() => meta %v payload %q, want the log event`, record.Event.Meta, record.Event.Payload)
+		}
+	}
+	if _, err := ReadRecord(reader); err != io.EOF {
+		t.Errorf(`ReadRecord() at end => error{"%v"}, want EOF`, err)
+	}
+	if _, err := ReadRecord(bufio.NewReader(strings.NewReader("yesterday\n"))); err == nil {
+		t.Errorf(`ReadRecord() with an invalid time => nil, want error`)
+	}
+}
+
+// Test replaying a recording to a listener at an accelerated speed.
+func TestReplayer(t *testing.T) {
+	recording := &bytes.Buffer{}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"TICK_5", "PROCESS_STATE_FATAL", "TICK_5"} {
+		event := createEvent(i, name, "web", []byte{})
+		if err := WriteRecord(recording, Record{start.Add(time.Duration(i) * 200 * time.Millisecond), event}); err != nil {
+			t.Fatalf(`WriteRecord() => error{"%v"}, want nil`, err)
+		}
+	}
+
+	stdin, stdinWriter := io.Pipe()
+	stdoutReader, stdout := io.Pipe()
+	listener := NewListener(stdin, stdout)
+	go func() {
+		listener.Ready()
+		for {
+			event, err := listener.Read()
+			if err != nil {
+				return
+			}
+			if event.State() == Fatal {
+				listener.Fail()
+			} else {
+				listener.Ok()
+			}
+			listener.Ready()
+		}
+	}()
+
+	replayer := NewReplayer(stdinWriter, stdoutReader)
+	replayer.Speed = 10
+	begin := time.Now()
+	results, err := replayer.Replay(recording)
+	elapsed := time.Since(begin)
+	stdinWriter.Close()
+
+	if want := []string{"OK", "FAIL", "OK"}; err != nil || !cmpStrings(results, want) {
+		t.Errorf(`Replayer.Replay() => %v, error{"%v"}, want %v`, results, err, want)
+	}
+	if elapsed < 40*time.Millisecond || elapsed > 300*time.Millisecond {
+		t.Errorf(`Replayer.Replay() at 10x took %s, want about 40ms`, elapsed)
+	}
+}
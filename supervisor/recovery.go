@@ -0,0 +1,353 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRecoveryBackoff is the wait before the first attempt to start a FATAL process.
+	DefaultRecoveryBackoff time.Duration = 10 * time.Second
+
+	// DefaultRecoveryMaxBackoff is the longest wait between attempts to start a FATAL process.
+	DefaultRecoveryMaxBackoff time.Duration = 10 * time.Minute
+
+	// DefaultRecoveryLimit is the number of attempts to start a FATAL process before giving up.
+	DefaultRecoveryLimit int = 5
+
+	// DefaultRecoveryReset is how long a process must run after a recovery for its attempts to be
+	// forgotten when it becomes FATAL again.
+	DefaultRecoveryReset time.Duration = 10 * time.Minute
+)
+
+// RecoveryRecord is the recovery state of the process Group:Name. Attempts is the number of times the process
+// was started since it first became FATAL. Next is when it will be started again and is zero when
+// no start is pending. Running is when the process last reached RUNNING after being recovered.
+type RecoveryRecord struct {
+	Group    string    `json:"group"`
+	Name     string    `json:"name"`
+	Attempts int       `json:"attempts"`
+	Next     time.Time `json:"next,omitempty"`
+	Running  time.Time `json:"running,omitempty"`
+	GaveUp   bool      `json:"gave_up,omitempty"`
+}
+
+// recoveryState is the mutable state shared by copies of FatalRecovery.
+type recoveryState struct {
+	loaded  bool
+	records map[string]RecoveryRecord
+}
+
+// FatalRecovery is an event listener which starts processes again after they become FATAL. It waits
+// Backoff before the first attempt and doubles the wait after each attempt up to MaxBackoff. After
+// Limit attempts it gives up and sends a notification to Notifier if it is not nil. Attempts are
+// forgotten when a recovered process becomes FATAL again after running for at least ResetAfter,
+// and when a process is stopped, which is taken as a human stepping in.
+//
+// The records of processes being recovered are kept in a JSON file at Path, if it is not empty, so
+// that pending attempts and counts survive listener restarts. Errors starting processes, saving the
+// records or sending notifications are passed to OnError. The listener must be subscribed to
+// PROCESS_STATE events.
+type FatalRecovery struct {
+	Client     Client
+	Path       string
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Limit      int
+	ResetAfter time.Duration
+	Processes  []string
+	Notifier   Notifier
+	OnError    func(err error)
+	host       string
+	now        func() time.Time
+	lock       *sync.Mutex
+	state      *recoveryState
+}
+
+// NewFatalRecovery creates a listener which starts processes with the client and keeps its records
+// in the file at the given path.
+func NewFatalRecovery(client Client, path string) FatalRecovery {
+	host, _ := os.Hostname()
+	return FatalRecovery{
+		Client:     client,
+		Path:       path,
+		Backoff:    DefaultRecoveryBackoff,
+		MaxBackoff: DefaultRecoveryMaxBackoff,
+		Limit:      DefaultRecoveryLimit,
+		ResetAfter: DefaultRecoveryReset,
+		host:       host,
+		now:        time.Now,
+		lock:       &sync.Mutex{},
+		state:      &recoveryState{records: make(map[string]RecoveryRecord)},
+	}
+}
+
+// error passes an error to OnError.
+func (recovery FatalRecovery) error(err error) {
+	if recovery.OnError != nil {
+		recovery.OnError(err)
+	}
+}
+
+// load reads the records from the file the first time it is called. The lock must be held.
+func (recovery FatalRecovery) load() {
+	if recovery.state.loaded || recovery.Path == "" {
+		return
+	}
+	recovery.state.loaded = true
+	data, err := ioutil.ReadFile(recovery.Path)
+	if os.IsNotExist(err) {
+		return
+	} else if err == nil {
+		err = json.Unmarshal(data, &recovery.state.records)
+	}
+	if err != nil {
+		recovery.error(err)
+	}
+
+	// records are keyed by group:name
+	for key, record := range recovery.state.records {
+		if record.Group == "" || record.Name == "" || key != record.Group+":"+record.Name {
+			delete(recovery.state.records, key)
+			recovery.error(errors.New(fmt.Sprintf("%s: invalid record for process %s", recovery.Path, key)))
+		}
+	}
+}
+
+// save writes the records to a temporary file which replaces the file at Path. The lock must be
+// held.
+func (recovery FatalRecovery) save() {
+	if recovery.Path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(recovery.state.records, "", "  ")
+	if err != nil {
+		recovery.error(err)
+		return
+	}
+	temp := recovery.Path + ".tmp"
+	if err = ioutil.WriteFile(temp, data, 0644); err == nil {
+		err = os.Rename(temp, recovery.Path)
+	}
+	if err != nil {
+		recovery.error(err)
+	}
+}
+
+// Records returns a copy of the records of the processes being recovered.
+func (recovery FatalRecovery) Records() map[string]RecoveryRecord {
+	recovery.lock.Lock()
+	defer recovery.lock.Unlock()
+	recovery.load()
+	records := make(map[string]RecoveryRecord, len(recovery.state.records))
+	for name, record := range recovery.state.records {
+		records[name] = record
+	}
+	return records
+}
+
+// delay returns the wait before the attempt following the given number of attempts.
+func (recovery FatalRecovery) delay(attempts int) time.Duration {
+	delay := recovery.Backoff
+	for i := 0; i < attempts && (recovery.MaxBackoff <= 0 || delay < recovery.MaxBackoff); i++ {
+		delay *= 2
+	}
+	if recovery.MaxBackoff > 0 && delay > recovery.MaxBackoff {
+		delay = recovery.MaxBackoff
+	}
+	return delay
+}
+
+// schedule plans the next attempt for a process or gives up on it. The lock must be held.
+func (recovery FatalRecovery) schedule(name string, record RecoveryRecord, now time.Time) RecoveryRecord {
+	if recovery.Limit > 0 && record.Attempts >= recovery.Limit {
+		record.Next = time.Time{}
+		if !record.GaveUp {
+			record.GaveUp = true
+			recovery.notify(name, record, now)
+		}
+		return record
+	}
+	record.Next = now.Add(recovery.delay(record.Attempts))
+	return record
+}
+
+// notify sends a notification that the recovery of a process was given up.
+func (recovery FatalRecovery) notify(name string, record RecoveryRecord, now time.Time) {
+	if recovery.Notifier == nil {
+		return
+	}
+	err := recovery.Notifier.Notify(Notification{
+		Time:    now,
+		Kind:    "recovery",
+		Host:    recovery.host,
+		Process: name,
+		Group:   record.Group,
+		Name:    record.Name,
+		State:   Fatal,
+		Subject: fmt.Sprintf("%s is FATAL on %s", name, recovery.host),
+		Body:    fmt.Sprintf("Process %s on %s is still FATAL after %d attempts to start it. It will not be started again.\n", name, recovery.host, record.Attempts),
+	})
+	if err != nil {
+		recovery.error(err)
+	}
+}
+
+// Handle updates the records from a process state event. A FATAL process has an attempt to start
+// it scheduled. The records are saved if they change.
+func (recovery FatalRecovery) Handle(event Event) {
+	if event.Parent() != "PROCESS_STATE" {
+		return
+	}
+	group, process := event.Meta["groupname"], event.Meta["processname"]
+	if !matchProcess(recovery.Processes, group, process) {
+		return
+	}
+	name := group + ":" + process
+	now := recovery.now()
+
+	recovery.lock.Lock()
+	defer recovery.lock.Unlock()
+	recovery.load()
+	record, ok := recovery.state.records[name]
+	record.Group, record.Name = group, process
+	switch event.State() {
+	case Fatal:
+		if !record.Running.IsZero() && now.Sub(record.Running) >= recovery.ResetAfter {
+			record = RecoveryRecord{Group: group, Name: process}
+		}
+		record.Running = time.Time{}
+		if record.GaveUp {
+			return
+		}
+		recovery.state.records[name] = recovery.schedule(name, record, now)
+	case Running:
+		if !ok {
+			return
+		}
+		record.Running = now
+		recovery.state.records[name] = record
+	case Stopped:
+		if !ok {
+			return
+		}
+		delete(recovery.state.records, name)
+	default:
+		return
+	}
+	recovery.save()
+}
+
+// Scan schedules attempts to start the processes which are FATAL but have no record, as those which
+// became FATAL while the listener was not running.
+func (recovery FatalRecovery) Scan() error {
+	infos, err := recovery.Client.GetAllProcessInfo()
+	if err != nil {
+		return err
+	}
+	now := recovery.now()
+	recovery.lock.Lock()
+	defer recovery.lock.Unlock()
+	recovery.load()
+	changed := false
+	for _, info := range infos {
+		name := info.FullName()
+		if _, ok := recovery.state.records[name]; ok || info.StateName != Fatal || !matchProcess(recovery.Processes, info.Group, info.Name) {
+			continue
+		}
+		recovery.state.records[name] = recovery.schedule(name, RecoveryRecord{Group: info.Group, Name: info.Name}, now)
+		changed = true
+	}
+	if changed {
+		recovery.save()
+	}
+	return nil
+}
+
+// Retry starts the processes whose attempts are due in order of group:name and returns the time
+// until the next pending attempt, or zero if there is none. A process which fails to start has
+// another attempt scheduled and one which is already started counts as started.
+func (recovery FatalRecovery) Retry() time.Duration {
+	now := recovery.now()
+	recovery.lock.Lock()
+	recovery.load()
+	var due []string
+	for name, record := range recovery.state.records {
+		if !record.Next.IsZero() && !record.Next.After(now) {
+			due = append(due, name)
+		}
+	}
+	recovery.lock.Unlock()
+	sort.Strings(due)
+
+	for _, name := range due {
+		_, err := recovery.Client.StartProcess(name, false)
+		if FaultName(err) == FaultAlreadyStarted {
+			// the process was started by someone else
+			err = nil
+		}
+		recovery.lock.Lock()
+		record := recovery.state.records[name]
+		record.Attempts++
+		record.Next = time.Time{}
+		if err != nil {
+			recovery.error(err)
+			record = recovery.schedule(name, record, now)
+		}
+		recovery.state.records[name] = record
+		recovery.lock.Unlock()
+	}
+
+	recovery.lock.Lock()
+	defer recovery.lock.Unlock()
+	if len(due) > 0 {
+		recovery.save()
+	}
+	var wait time.Duration
+	pending := false
+	for _, record := range recovery.state.records {
+		if record.Next.IsZero() {
+			continue
+		}
+		if until := record.Next.Sub(now); !pending || until < wait {
+			wait, pending = until, true
+		}
+	}
+	if pending && wait <= 0 {
+		wait = time.Nanosecond
+	}
+	return wait
+}
+
+// Run scans for FATAL processes, starts the listener and handles its events until EOF, starting
+// processes as their attempts come due.
+func (recovery FatalRecovery) Run(listener Listener) error {
+	if err := recovery.Scan(); err != nil {
+		recovery.error(err)
+	}
+	events := make(chan Event)
+	done := make(chan error, 1)
+	go func() {
+		done <- listener.Run(events)
+	}()
+
+	for {
+		var due <-chan time.Time
+		if wait := recovery.Retry(); wait > 0 {
+			due = time.After(wait)
+		}
+		select {
+		case event := <-events:
+			recovery.Handle(event)
+		case <-due:
+		case err := <-done:
+			return err
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package supervisor
+
+import (
+	"fmt"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test that FATAL processes are started again with backoff until the limit.
+func TestFatalRecovery(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "cron")...)
+	server.SetState("cron", Fatal)
+	client := testClient(t, server)
+	hook := newWebhookServer(t)
+	path := filepath.Join(t.TempDir(), "recovery.json")
+
+	start := time.Unix(1000, 0)
+	now := start
+	create := func() FatalRecovery {
+		recovery := NewFatalRecovery(client, path)
+		recovery.Backoff = 10 * time.Second
+		recovery.MaxBackoff = 30 * time.Second
+		recovery.Limit = 3
+		recovery.ResetAfter = time.Minute
+		recovery.Notifier = NewWebhookNotifier(hook.URL)
+		recovery.OnError = func(err error) {
+			t.Errorf(`FatalRecovery.OnError(error{"%v"}), want no errors`, err)
+		}
+		recovery.now = func() time.Time { return now }
+		return recovery
+	}
+	recovery := create()
+	fatal := createEvent(1, "PROCESS_STATE_FATAL", "api", nil)
+	fatal.Meta["groupname"] = "web"
+
+	if err := recovery.Scan(); err != nil {
+		t.Fatalf(`FatalRecovery.Scan() => error{"%v"}, want nil`, err)
+	}
+	recovery.Handle(fatal)
+	steps := []struct {
+		at      time.Duration
+		fatal   bool
+		wait    time.Duration
+		actions string
+	}{
+		{5 * time.Second, false, 5 * time.Second, "[]"},
+		{10 * time.Second, true, 20 * time.Second, "[start cron:cron start web:api]"},
+		{30 * time.Second, true, 30 * time.Second, "[start web:api]"},
+		{60 * time.Second, true, 0, "[start web:api]"},
+		{120 * time.Second, false, 0, "[]"},
+	}
+	for i, step := range steps {
+		now = start.Add(step.at)
+		server.ResetCalls()
+		wait := recovery.Retry()
+		if step.fatal {
+			server.SetState("web:api", Fatal)
+			recovery.Handle(fatal)
+			wait = recovery.Retry()
+		}
+		if got := fmt.Sprint(actions(server)); got != step.actions || wait != step.wait {
+			t.Errorf(`%d: FatalRecovery.Retry() => %s, %v, want %s, %v`, i, got, wait, step.actions, step.wait)
+		}
+		// the records are read back when the listener restarts
+		recovery = create()
+	}
+
+	record := recovery.Records()["web:api"]
+	if record.Attempts != 3 || !record.GaveUp || !record.Next.IsZero() {
+		t.Errorf(`FatalRecovery.Records()["web:api"] => %+v, want given up after 3 attempts`, record)
+	}
+	if notifications := hook.received(); len(notifications) != 1 || notifications[0].Kind != "recovery" || notifications[0].Process != "web:api" {
+		t.Errorf(`FatalRecovery sent %+v, want one recovery notification for web:api`, notifications)
+	}
+
+	// a process which runs long enough is recovered again when it becomes FATAL
+	running := createEvent(2, "PROCESS_STATE_RUNNING", "api", nil)
+	running.Meta["groupname"] = "web"
+	recovery.Handle(running)
+	now = now.Add(time.Minute)
+	recovery.Handle(fatal)
+	if record := recovery.Records()["web:api"]; record.Attempts != 0 || record.GaveUp || !record.Next.Equal(now.Add(10*time.Second)) {
+		t.Errorf(`FatalRecovery.Records()["web:api"] => %+v, want a new attempt after running`, record)
+	}
+
+	// a stopped process is forgotten
+	stopped := createEvent(3, "PROCESS_STATE_STOPPED", "cron", nil)
+	stopped.Meta["groupname"] = "cron"
+	recovery.Handle(stopped)
+	if _, ok := recovery.Records()["cron:cron"]; ok {
+		t.Errorf(`FatalRecovery.Records() has cron:cron after it stopped`)
+	}
+}
+
+// Test that records which do not name a process are dropped when loaded.
+func TestFatalRecoveryLoad(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api")...)
+	hook := newWebhookServer(t)
+	path := filepath.Join(t.TempDir(), "recovery.json")
+	data := `{
+  "web:api": {"group": "web", "name": "api", "attempts": 3},
+  "cron": {"group": "cron", "name": "", "attempts": 1},
+  "cron:cron": {"attempts": 1},
+  "web:worker": {"group": "web", "name": "other", "attempts": 1}
+}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recovery := NewFatalRecovery(testClient(t, server), path)
+	recovery.Limit = 3
+	recovery.Notifier = NewWebhookNotifier(hook.URL)
+	var errs []error
+	recovery.OnError = func(err error) {
+		errs = append(errs, err)
+	}
+
+	records := recovery.Records()
+	if len(records) != 1 || records["web:api"].Group != "web" || records["web:api"].Name != "api" {
+		t.Errorf(`FatalRecovery.Records() => %+v, want only web:api`, records)
+	}
+	if len(errs) != 3 {
+		t.Errorf(`FatalRecovery.OnError() called with %v, want 3 errors`, errs)
+	}
+
+	// the group and name of the record are used to give up on the process
+	fatal := createEvent(1, "PROCESS_STATE_FATAL", "api", nil)
+	fatal.Meta["groupname"] = "web"
+	recovery.Handle(fatal)
+	if notifications := hook.received(); len(notifications) != 1 || notifications[0].Group != "web" || notifications[0].Name != "api" {
+		t.Errorf(`FatalRecovery sent %+v, want one notification for group web and name api`, notifications)
+	}
+}
+
+// Test running the recovery listener.
+func TestFatalRecoveryRun(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api")...)
+	recovery := NewFatalRecovery(testClient(t, server), "")
+	recovery.Backoff = time.Millisecond
+
+	pool := supervisortest.NewEventPool("recovery")
+	done := make(chan error)
+	go func() {
+		done <- recovery.Run(NewListener(pool.Stdin(), pool.Stdout()))
+	}()
+	transition := supervisortest.Transition{Group: "web", Name: "api", From: Backoff, To: Fatal}
+	if delivery, err := pool.Send(supervisortest.TransitionEvent(transition)); err != nil || !delivery.Ok() {
+		t.Fatalf(`EventPool.Send() => %+v, error{"%v"}, want OK`, delivery, err)
+	}
+	if !server.WaitState("web:api", Running, time.Second) {
+		t.Errorf(`FatalRecovery.Run() did not start web:api`)
+	}
+	pool.Close()
+	if err := <-done; err != nil {
+		t.Errorf(`FatalRecovery.Run() => error{"%v"}, want nil`, err)
+	}
+}
@@ -29,7 +29,7 @@ func ReadResult(reader io.Reader) (payload []byte, err error) {
 	}
 
 	payload = make([]byte, length)
-	_, err = buf.Read(payload)
+	_, err = io.ReadFull(buf, payload)
 	return
 }
 
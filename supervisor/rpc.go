@@ -1,9 +1,16 @@
 package supervisor
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/kolo/xmlrpc"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
 )
 
 const (
@@ -70,6 +77,11 @@ func (info ProcessInfo) String() string {
 	return fmt.Sprintf(`ProcessInfo{"%s", %d, "%s"}`, info.Name, info.PID, info.StateName)
 }
 
+// FullName returns the name of the process in the group:name form accepted by the RPC interface.
+func (info ProcessInfo) FullName() string {
+	return info.Group + ":" + info.Name
+}
+
 type ProcessStatus struct {
 	Name        string
 	Description string
@@ -108,15 +120,57 @@ func (tail ProcessTail) String() string {
 	return tail.Log
 }
 
+type ConfigInfo struct {
+	Name        string
+	Group       string
+	InUse       bool
+	Autostart   bool
+	ProcessPrio int64
+	GroupPrio   int64
+}
+
+func newConfigInfo(result xmlrpc.Struct) ConfigInfo {
+	return ConfigInfo{
+		Name:        result["name"].(string),
+		Group:       result["group"].(string),
+		InUse:       result["inuse"].(bool),
+		Autostart:   result["autostart"].(bool),
+		ProcessPrio: result["process_prio"].(int64),
+		GroupPrio:   result["group_prio"].(int64),
+	}
+}
+
+func (info ConfigInfo) String() string {
+	return fmt.Sprintf(`ConfigInfo{"%s:%s", %v}`, info.Group, info.Name, info.InUse)
+}
+
+// RpcObserver is called after every RPC call made by a Client with the method name, the time the
+// call took and its error.
+type RpcObserver func(method string, duration time.Duration, err error)
+
 type Client struct {
 	RpcClient  *xmlrpc.Client
 	ApiVersion string
+	url        string
+	transport  *http.Transport
+	observer   RpcObserver
 }
 
 // NewClient creates a new supervisor RPC client.
 func NewClient(url string) (client Client, err error) {
+	return NewClientTransport(url, nil)
+}
+
+// NewClientTransport creates a new supervisor RPC client which makes requests with the given HTTP
+// transport. The default transport is used if it is nil.
+func NewClientTransport(url string, transport *http.Transport) (client Client, err error) {
 	var rpc *xmlrpc.Client
-	if rpc, err = xmlrpc.NewClient(url, nil); err != nil {
+	if transport == nil {
+		rpc, err = xmlrpc.NewClient(url, nil)
+	} else {
+		rpc, err = xmlrpc.NewClient(url, transport)
+	}
+	if err != nil {
 		return
 	}
 
@@ -128,31 +182,106 @@ func NewClient(url string) (client Client, err error) {
 		err = errors.New(fmt.Sprintf("want Supervisor API version %s, got %s instead", apiVersion, version))
 		return
 	}
-	client = Client{rpc, version}
+	client = Client{rpc, version, url, transport, nil}
+	return
+}
+
+// DialClient connects to Supervisor using a serverurl as found in the supervisorctl section of
+// supervisord.conf. Both http:// and unix:// URLs are supported. The username and password are
+// used for basic authentication if not empty.
+func DialClient(serverURL string, username string, password string) (client Client, err error) {
+	url, err := neturl.Parse(serverURL)
+	if err != nil {
+		return
+	}
+
+	var transport *http.Transport
+	switch url.Scheme {
+	case "unix":
+		path := url.Path
+		if url.Host != "" {
+			path = url.Host + path
+		}
+		transport = &http.Transport{
+			DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		}
+		url = &neturl.URL{Scheme: "http", Host: "localhost", Path: "/RPC2"}
+	case "http", "https":
+		if url.Path == "" || url.Path == "/" {
+			url.Path = "/RPC2"
+		}
+	default:
+		err = errors.New(fmt.Sprintf("unsupported server URL %s", serverURL))
+		return
+	}
+	if username != "" {
+		url.User = neturl.UserPassword(username, password)
+	}
+	return NewClientTransport(url.String(), transport)
+}
+
+// httpGet requests a path from the Supervisor web server.
+func (client Client) httpGet(path string) (resp *http.Response, err error) {
+	url, err := neturl.Parse(client.url)
+	if err != nil {
+		return
+	}
+	url.Path = strings.TrimSuffix(url.Path, "/RPC2") + path
+
+	httpClient := &http.Client{}
+	if client.transport != nil {
+		httpClient.Transport = client.transport
+	}
+	if resp, err = httpClient.Get(url.String()); err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = errors.New(fmt.Sprintf("GET %s: %s", path, resp.Status))
+	}
 	return
 }
 
+// WithObserver returns a copy of the client which reports every RPC call to the observer.
+func (client Client) WithObserver(observer RpcObserver) Client {
+	client.observer = observer
+	return client
+}
+
+// call makes an RPC call and reports it to the observer.
+func (client Client) call(method string, args interface{}, reply interface{}) error {
+	start := time.Now()
+	err := client.RpcClient.Call(method, args, reply)
+	if client.observer != nil {
+		client.observer(method, time.Since(start), err)
+	}
+	return err
+}
+
 // Close the client.
 func (client Client) Close() error {
+	if client.transport != nil {
+		client.transport.CloseIdleConnections()
+	}
 	return client.RpcClient.Close()
 }
 
 // GetSupervisorVersion returns the Supervisor version we connect to.
 func (client Client) GetSupervisorVersion() (version string, err error) {
-	err = client.RpcClient.Call("supervisor.getSupervisorVersion", nil, &version)
+	err = client.call("supervisor.getSupervisorVersion", nil, &version)
 	return
 }
 
 // GetIdentification returns the Supervisor ID string.
 func (client Client) GetIdentification() (id string, err error) {
-	err = client.RpcClient.Call("supervisor.getIdentification", nil, &id)
+	err = client.call("supervisor.getIdentification", nil, &id)
 	return
 }
 
 // GetState returns the Supervisor process state.
 func (client Client) GetState() (state *SupervisorState, err error) {
 	result := xmlrpc.Struct{}
-	if err = client.RpcClient.Call("supervisor.getState", nil, &result); err == nil {
+	if err = client.call("supervisor.getState", nil, &result); err == nil {
 		state = newSupervisorState(result)
 	}
 	return
@@ -160,32 +289,32 @@ func (client Client) GetState() (state *SupervisorState, err error) {
 
 // GetPID returns the Supervisor process PID.
 func (client Client) GetPID() (pid int64, err error) {
-	err = client.RpcClient.Call("supervisor.getPID", nil, &pid)
+	err = client.call("supervisor.getPID", nil, &pid)
 	return
 }
 
 // ClearLog clears the Supervisor process log.
 func (client Client) ClearLog() (result bool, err error) {
-	err = client.RpcClient.Call("supervisor.clearLog", nil, &result)
+	err = client.call("supervisor.clearLog", nil, &result)
 	return
 }
 
 // Shutdown shuts down the Supervisor process.
 func (client Client) Shutdown() (result bool, err error) {
-	err = client.RpcClient.Call("supervisor.shutdown", nil, &result)
+	err = client.call("supervisor.shutdown", nil, &result)
 	return
 }
 
 // Restart restarts the Supervisor process.
 func (client Client) Restart() (result bool, err error) {
-	err = client.RpcClient.Call("supervisor.restart", nil, &result)
+	err = client.call("supervisor.restart", nil, &result)
 	return
 }
 
 // GetProcessInfo retrieves information for a particular Supervisor process.
 func (client Client) GetProcessInfo(name string) (info ProcessInfo, err error) {
 	result := xmlrpc.Struct{}
-	if err = client.RpcClient.Call("supervisor.getProcessInfo", name, &result); err == nil {
+	if err = client.call("supervisor.getProcessInfo", name, &result); err == nil {
 		info = newProcessInfo(result)
 	}
 	return
@@ -194,7 +323,7 @@ func (client Client) GetProcessInfo(name string) (info ProcessInfo, err error) {
 // GetAllProcessInfo retrieves information for all Supervisor processes.
 func (client Client) GetAllProcessInfo() (info []ProcessInfo, err error) {
 	var results []interface{}
-	if err = client.RpcClient.Call("supervisor.getAllProcessInfo", nil, &results); err == nil {
+	if err = client.call("supervisor.getAllProcessInfo", nil, &results); err == nil {
 		info = make([]ProcessInfo, len(results))
 		for i, result := range results {
 			info[i] = newProcessInfo(result.(xmlrpc.Struct))
@@ -206,21 +335,21 @@ func (client Client) GetAllProcessInfo() (info []ProcessInfo, err error) {
 // StartProcess tells Supervisor to start the named process.
 func (client Client) StartProcess(name string, wait bool) (result bool, err error) {
 	params := makeParams(name, wait)
-	err = client.RpcClient.Call("supervisor.startProcess", params, &result)
+	err = client.call("supervisor.startProcess", params, &result)
 	return
 }
 
 // StopProcess tells Supervisor to stop the named process.
 func (client Client) StopProcess(name string, wait bool) (result bool, err error) {
 	params := makeParams(name, wait)
-	err = client.RpcClient.Call("supervisor.stopProcess", params, &result)
+	err = client.call("supervisor.stopProcess", params, &result)
 	return
 }
 
 // StartAllProcesses tells Supervisor to start all stopped processes.
 func (client Client) StartAllProcesses(wait bool) (info []ProcessStatus, err error) {
 	var results []interface{}
-	if err = client.RpcClient.Call("supervisor.startAllProcesses", wait, &results); err == nil {
+	if err = client.call("supervisor.startAllProcesses", wait, &results); err == nil {
 		info = make([]ProcessStatus, len(results))
 		for i, result := range results {
 			info[i] = newProcessStatus(result.(xmlrpc.Struct))
@@ -232,7 +361,7 @@ func (client Client) StartAllProcesses(wait bool) (info []ProcessStatus, err err
 // StopAllProcesses teslls Supervisor to stop all running processes.
 func (client Client) StopAllProcesses(wait bool) (info []ProcessStatus, err error) {
 	var results []interface{}
-	if err = client.RpcClient.Call("supervisor.stopAllProcesses", wait, &results); err == nil {
+	if err = client.call("supervisor.stopAllProcesses", wait, &results); err == nil {
 		info = make([]ProcessStatus, len(results))
 		for i, result := range results {
 			info[i] = newProcessStatus(result.(xmlrpc.Struct))
@@ -242,63 +371,114 @@ func (client Client) StopAllProcesses(wait bool) (info []ProcessStatus, err erro
 }
 
 // StartProcessGroup tells Supervisor to start all stopped processes in the named group.
-func (client Client) StartProcessGroup(name string, wait bool) (result bool, err error) {
+func (client Client) StartProcessGroup(name string, wait bool) (info []ProcessStatus, err error) {
+	var results []interface{}
 	params := makeParams(name, wait)
-	err = client.RpcClient.Call("supervisor.startProcessGroup", params, &result)
+	if err = client.call("supervisor.startProcessGroup", params, &results); err == nil {
+		info = make([]ProcessStatus, len(results))
+		for i, result := range results {
+			info[i] = newProcessStatus(result.(xmlrpc.Struct))
+		}
+	}
 	return
 }
 
-// StopProcessGroup tells Supervisor to start all stopped processes in the named group.
-func (client Client) StopProcessGroup(name string, wait bool) (result bool, err error) {
+// StopProcessGroup tells Supervisor to stop all running processes in the named group.
+func (client Client) StopProcessGroup(name string, wait bool) (info []ProcessStatus, err error) {
+	var results []interface{}
 	params := makeParams(name, wait)
-	err = client.RpcClient.Call("supervisor.stopProcessGroup", params, &result)
+	if err = client.call("supervisor.stopProcessGroup", params, &results); err == nil {
+		info = make([]ProcessStatus, len(results))
+		for i, result := range results {
+			info[i] = newProcessStatus(result.(xmlrpc.Struct))
+		}
+	}
 	return
 }
 
 // SendProcessStdin send data to the stdin of a running process.
 func (client Client) SendProcessStdin(name string, chars string) (result bool, err error) {
 	params := makeParams(name, chars)
-	err = client.RpcClient.Call("supervisor.sendProcessStdin", params, &result)
+	err = client.call("supervisor.sendProcessStdin", params, &result)
 	return
 }
 
 // SendRemoteCommEvent sends an event to Supervisor processes listening to RemoveCommunicationEvents..
 func (client Client) SendRemoteCommEvent(typeKey string, data string) (result bool, err error) {
 	params := makeParams(typeKey, data)
-	err = client.RpcClient.Call("supervisor.sendRemoteCommEvent", params, &result)
+	err = client.call("supervisor.sendRemoteCommEvent", params, &result)
 	return
 }
 
 // AddProcessGroup adds a configured process group to Supervisor.
 func (client Client) AddProcessGroup(name string) (result bool, err error) {
-	err = client.RpcClient.Call("supervisor.addProcessGroup", name, &result)
+	err = client.call("supervisor.addProcessGroup", name, &result)
 	return
 }
 
 // RemoveProcessGroup removes a configured process group from Supervisor.
 func (client Client) RemoveProcessGroup(name string) (result bool, err error) {
-	err = client.RpcClient.Call("supervisor.removeProcessGroup", name, &result)
+	err = client.call("supervisor.removeProcessGroup", name, &result)
+	return
+}
+
+// ConfigChanges lists the process groups which differ between the running configuration and the
+// configuration on disk.
+type ConfigChanges struct {
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+func newConfigChanges(result []interface{}) ConfigChanges {
+	strs := func(data interface{}) []string {
+		items, _ := data.([]interface{})
+		names := make([]string, len(items))
+		for i, item := range items {
+			names[i] = item.(string)
+		}
+		return names
+	}
+
+	changes := ConfigChanges{}
+	if len(result) > 0 {
+		if lists, ok := result[0].([]interface{}); ok && len(lists) == 3 {
+			changes.Added = strs(lists[0])
+			changes.Changed = strs(lists[1])
+			changes.Removed = strs(lists[2])
+		}
+	}
+	return changes
+}
+
+// ReloadConfig tells Supervisor to reread its configuration and returns the process groups which
+// were added, changed, or removed. The changes are not applied.
+func (client Client) ReloadConfig() (changes ConfigChanges, err error) {
+	var result []interface{}
+	if err = client.call("supervisor.reloadConfig", nil, &result); err == nil {
+		changes = newConfigChanges(result)
+	}
 	return
 }
 
 // ReadLog reads the Supervisor process log.
 func (client Client) ReadLog(offset int64, length int64) (log string, err error) {
 	params := makeParams(offset, length)
-	err = client.RpcClient.Call("supervisor.readLog", params, &log)
+	err = client.call("supervisor.readLog", params, &log)
 	return
 }
 
 // ReadProcessStdoutLog reads the stdout log for the named process.
 func (client Client) ReadProcessStdoutLog(name string, offset int64, length int64) (log string, err error) {
 	params := makeParams(name, offset, length)
-	err = client.RpcClient.Call("supervisor.readProcessStdoutLog", params, &log)
+	err = client.call("supervisor.readProcessStdoutLog", params, &log)
 	return
 }
 
 // ReadProcessStderrLog reads the stderr log for the named process.
 func (client Client) ReadProcessStderrLog(name string, offset int64, length int64) (log string, err error) {
 	params := makeParams(name, offset, length)
-	err = client.RpcClient.Call("supervisor.readProcessStderrLog", params, &log)
+	err = client.call("supervisor.readProcessStderrLog", params, &log)
 	return
 }
 
@@ -306,7 +486,7 @@ func (client Client) ReadProcessStderrLog(name string, offset int64, length int6
 func (client Client) TailProcessStdoutLog(name string, offset int64, length int64) (tail *ProcessTail, err error) {
 	params := makeParams(name, offset, length)
 	result := make([]interface{}, 0, 3)
-	if err = client.RpcClient.Call("supervisor.tailProcessStdoutLog", params, &result); err == nil {
+	if err = client.call("supervisor.tailProcessStdoutLog", params, &result); err == nil {
 		tail = newProcessTail(result)
 	}
 	return
@@ -316,7 +496,7 @@ func (client Client) TailProcessStdoutLog(name string, offset int64, length int6
 func (client Client) TailProcessStderrLog(name string, offset int64, length int64) (tail *ProcessTail, err error) {
 	params := makeParams(name, offset, length)
 	result := make([]interface{}, 0, 3)
-	if err = client.RpcClient.Call("supervisor.tailProcessStderrLog", params, &result); err == nil {
+	if err = client.call("supervisor.tailProcessStderrLog", params, &result); err == nil {
 		tail = newProcessTail(result)
 	}
 	return
@@ -324,12 +504,88 @@ func (client Client) TailProcessStderrLog(name string, offset int64, length int6
 
 // ClearProcessLogs clears all logs for the named process.
 func (client Client) ClearProcessLogs(name string) (result bool, err error) {
-	err = client.RpcClient.Call("supervisor.clearProcessLogs", name, &result)
+	err = client.call("supervisor.clearProcessLogs", name, &result)
+	return
+}
+
+// ClearAllProcessLogs clears all logs of all processes.
+func (client Client) ClearAllProcessLogs() (info []ProcessStatus, err error) {
+	var results []interface{}
+	if err = client.call("supervisor.clearAllProcessLogs", nil, &results); err == nil {
+		info = make([]ProcessStatus, len(results))
+		for i, result := range results {
+			info[i] = newProcessStatus(result.(xmlrpc.Struct))
+		}
+	}
+	return
+}
+
+// SignalProcess sends a signal to the named process. The signal may be a name such as HUP or a
+// number.
+func (client Client) SignalProcess(name string, signal string) (result bool, err error) {
+	params := makeParams(name, signal)
+	err = client.call("supervisor.signalProcess", params, &result)
+	return
+}
+
+// SignalProcessGroup sends a signal to all processes in the named group.
+func (client Client) SignalProcessGroup(name string, signal string) (info []ProcessStatus, err error) {
+	var results []interface{}
+	params := makeParams(name, signal)
+	if err = client.call("supervisor.signalProcessGroup", params, &results); err == nil {
+		info = make([]ProcessStatus, len(results))
+		for i, result := range results {
+			info[i] = newProcessStatus(result.(xmlrpc.Struct))
+		}
+	}
 	return
 }
 
-// ClearAllProcessLogs clears all logs all processes.
-func (client Client) ClearAllProcessLogs(name string) (result bool, err error) {
-	err = client.RpcClient.Call("supervisor.clearAllProcessLogs", name, &result)
+// SignalAllProcesses sends a signal to all processes.
+func (client Client) SignalAllProcesses(signal string) (info []ProcessStatus, err error) {
+	var results []interface{}
+	if err = client.call("supervisor.signalAllProcesses", signal, &results); err == nil {
+		info = make([]ProcessStatus, len(results))
+		for i, result := range results {
+			info[i] = newProcessStatus(result.(xmlrpc.Struct))
+		}
+	}
 	return
 }
+
+// GetAllConfigInfo retrieves the configuration of all process groups known to Supervisor whether or
+// not they are in use.
+func (client Client) GetAllConfigInfo() (info []ConfigInfo, err error) {
+	var results []interface{}
+	if err = client.call("supervisor.getAllConfigInfo", nil, &results); err == nil {
+		info = make([]ConfigInfo, len(results))
+		for i, result := range results {
+			info[i] = newConfigInfo(result.(xmlrpc.Struct))
+		}
+	}
+	return
+}
+
+// TailLog streams the Supervisor process log from its web server. Data is read from the stream as it
+// is written to the log. The stream must be closed by the caller.
+func (client Client) TailLog() (io.ReadCloser, error) {
+	resp, err := client.httpGet("/mainlogtail")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// TailProcessLog streams the stdout or stderr log of the named process from the Supervisor web
+// server. The stream must be closed by the caller.
+func (client Client) TailProcessLog(name string, stderr bool) (io.ReadCloser, error) {
+	path := "/logtail/" + name
+	if stderr {
+		path += "/stderr"
+	}
+	resp, err := client.httpGet(path)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,347 @@
+package supervisor
+
+import (
+	"bufio"
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Start a fake Supervisor which is closed when the test ends.
+func newTestServer(t *testing.T, programs ...supervisortest.Program) *supervisortest.Server {
+	server := supervisortest.NewServer(programs...)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Connect a client to a fake Supervisor.
+func testClient(t *testing.T, server *supervisortest.Server) Client {
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatalf(`NewClient() => error{"%v"}, want nil`, err)
+	}
+	return client
+}
+
+// Return the calls which change processes or groups as "action name" strings.
+func actions(server *supervisortest.Server) []string {
+	verbs := map[string]string{
+		"supervisor.startProcess":       "start",
+		"supervisor.stopProcess":        "stop",
+		"supervisor.startProcessGroup":  "startgroup",
+		"supervisor.stopProcessGroup":   "stopgroup",
+		"supervisor.addProcessGroup":    "add",
+		"supervisor.removeProcessGroup": "remove",
+	}
+	var actions []string
+	for _, call := range server.Calls() {
+		verb, ok := verbs[call.Method]
+		if !ok {
+			continue
+		}
+		name := call.Args[0].(string)
+		if verb == "start" || verb == "stop" {
+			name = qualifyName(name)
+		}
+		actions = append(actions, verb+" "+name)
+	}
+	return actions
+}
+
+// Test the process control methods.
+func TestClientProcesses(t *testing.T) {
+	programs := supervisortest.Programs("web:api", "web:worker", "cron")
+	programs[1].StartSecs = 20 * time.Millisecond
+	server := newTestServer(t, programs...)
+	server.SetIdentification("test")
+	client := testClient(t, server)
+
+	if client.ApiVersion != "3.0" {
+		t.Errorf(`Client.ApiVersion => "%s", want "3.0"`, client.ApiVersion)
+	}
+	if version, err := client.GetSupervisorVersion(); err != nil || version == "" {
+		t.Errorf(`Client.GetSupervisorVersion() => "%s", error{"%v"}, want version`, version, err)
+	}
+	if id, err := client.GetIdentification(); err != nil || id != "test" {
+		t.Errorf(`Client.GetIdentification() => "%s", error{"%v"}, want "test"`, id, err)
+	}
+	if state, err := client.GetState(); err != nil || state.StateCode != 1 || state.StateName != "RUNNING" {
+		t.Errorf(`Client.GetState() => %v, error{"%v"}, want RUNNING`, state, err)
+	}
+	if pid, err := client.GetPID(); err != nil || pid != int64(os.Getpid()) {
+		t.Errorf(`Client.GetPID() => %d, error{"%v"}, want %d`, pid, err, os.Getpid())
+	}
+
+	if ok, err := client.StartProcess("web:worker", true); !ok || err != nil {
+		t.Errorf(`Client.StartProcess("web:worker", true) => %v, error{"%v"}, want true`, ok, err)
+	}
+	if _, err := client.StartProcess("web:worker", true); !IsFault(err, FaultAlreadyStarted) {
+		t.Errorf(`Client.StartProcess("web:worker", true) => error{"%v"}, want ALREADY_STARTED`, err)
+	}
+	info, err := client.GetProcessInfo("web:worker")
+	if err != nil || info.StateName != Running || info.PID == 0 || info.Start == 0 || !strings.HasPrefix(info.Description, "pid ") {
+		t.Errorf(`Client.GetProcessInfo("web:worker") => %+v, error{"%v"}, want RUNNING`, info, err)
+	}
+	if _, err := client.GetProcessInfo("web:missing"); !IsFault(err, FaultBadName) {
+		t.Errorf(`Client.GetProcessInfo("web:missing") => error{"%v"}, want BAD_NAME`, err)
+	}
+
+	if ok, err := client.StopProcess("web:worker", true); !ok || err != nil {
+		t.Errorf(`Client.StopProcess("web:worker", true) => %v, error{"%v"}, want true`, ok, err)
+	}
+	if _, err := client.StopProcess("web:worker", true); !IsFault(err, FaultNotRunning) {
+		t.Errorf(`Client.StopProcess("web:worker", true) => error{"%v"}, want NOT_RUNNING`, err)
+	}
+
+	statuses, err := client.StartProcessGroup("web", true)
+	if err != nil || len(statuses) != 2 || statuses[0].Name != "api" || statuses[1].Status != 80 {
+		t.Errorf(`Client.StartProcessGroup("web", true) => %v, error{"%v"}, want api and worker`, statuses, err)
+	}
+	if statuses, err = client.StopProcessGroup("web", true); err != nil || len(statuses) != 2 || statuses[0].Name != "worker" {
+		t.Errorf(`Client.StopProcessGroup("web", true) => %v, error{"%v"}, want worker and api`, statuses, err)
+	}
+	if _, err := client.StartProcessGroup("missing", true); !IsFault(err, FaultBadName) {
+		t.Errorf(`Client.StartProcessGroup("missing", true) => error{"%v"}, want BAD_NAME`, err)
+	}
+	if statuses, err = client.StartAllProcesses(false); err != nil || len(statuses) != 3 {
+		t.Errorf(`Client.StartAllProcesses(false) => %v, error{"%v"}, want 3 statuses`, statuses, err)
+	}
+	if !server.WaitState("web:worker", supervisortest.Running, time.Second) {
+		t.Errorf(`state of web:worker => %s, want RUNNING`, server.State("web:worker"))
+	}
+
+	if ok, err := client.SignalProcess("cron", "HUP"); !ok || err != nil {
+		t.Errorf(`Client.SignalProcess("cron", "HUP") => %v, error{"%v"}, want true`, ok, err)
+	}
+	if _, err := client.SignalProcess("cron", "NOPE"); !IsFault(err, FaultBadSignal) {
+		t.Errorf(`Client.SignalProcess("cron", "NOPE") => error{"%v"}, want BAD_SIGNAL`, err)
+	}
+	if statuses, err = client.SignalProcessGroup("web", "USR1"); err != nil || len(statuses) != 2 {
+		t.Errorf(`Client.SignalProcessGroup("web", "USR1") => %v, error{"%v"}, want 2 statuses`, statuses, err)
+	}
+	if statuses, err = client.SignalAllProcesses("TERM"); err != nil || len(statuses) != 3 {
+		t.Errorf(`Client.SignalAllProcesses("TERM") => %v, error{"%v"}, want 3 statuses`, statuses, err)
+	}
+	if ok, err := client.SendProcessStdin("cron", "hello\n"); !ok || err != nil {
+		t.Errorf(`Client.SendProcessStdin("cron") => %v, error{"%v"}, want true`, ok, err)
+	}
+	if ok, err := client.SendRemoteCommEvent("type", "data"); !ok || err != nil {
+		t.Errorf(`Client.SendRemoteCommEvent() => %v, error{"%v"}, want true`, ok, err)
+	}
+
+	if statuses, err = client.StopAllProcesses(true); err != nil || len(statuses) != 3 {
+		t.Errorf(`Client.StopAllProcesses(true) => %v, error{"%v"}, want 3 statuses`, statuses, err)
+	}
+	infos, err := client.GetAllProcessInfo()
+	if err != nil || len(infos) != 3 {
+		t.Fatalf(`Client.GetAllProcessInfo() => %v, error{"%v"}, want 3 processes`, infos, err)
+	}
+	for _, info := range infos {
+		if info.StateName != Stopped || info.PID != 0 {
+			t.Errorf(`Client.GetAllProcessInfo() => %v, want STOPPED`, info)
+		}
+	}
+}
+
+// Test the configuration methods.
+func TestClientConfig(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "old:job")...)
+	client := testClient(t, server)
+
+	batch := supervisortest.NewProgram("batch:runner")
+	batch.AutoStart = true
+	server.Configure(append(supervisortest.Programs("web:api", "web:worker"), batch)...)
+	changes, err := client.ReloadConfig()
+	if err != nil || !cmpStrings(changes.Added, []string{"batch"}) || !cmpStrings(changes.Changed, []string{"web"}) || !cmpStrings(changes.Removed, []string{"old"}) {
+		t.Errorf(`Client.ReloadConfig() => %+v, error{"%v"}, want batch added, web changed, old removed`, changes, err)
+	}
+
+	if ok, err := client.AddProcessGroup("batch"); !ok || err != nil {
+		t.Errorf(`Client.AddProcessGroup("batch") => %v, error{"%v"}, want true`, ok, err)
+	}
+	if state := server.State("batch:runner"); state != Running {
+		t.Errorf(`state of batch:runner => "%s", want auto started`, state)
+	}
+	if _, err := client.AddProcessGroup("batch"); !IsFault(err, FaultAlreadyAdded) {
+		t.Errorf(`Client.AddProcessGroup("batch") => error{"%v"}, want ALREADY_ADDED`, err)
+	}
+	if _, err := client.RemoveProcessGroup("batch"); !IsFault(err, FaultStillRunning) {
+		t.Errorf(`Client.RemoveProcessGroup("batch") => error{"%v"}, want STILL_RUNNING`, err)
+	}
+	if ok, err := client.RemoveProcessGroup("old"); !ok || err != nil {
+		t.Errorf(`Client.RemoveProcessGroup("old") => %v, error{"%v"}, want true`, ok, err)
+	}
+	if _, err := client.RemoveProcessGroup("old"); !IsFault(err, FaultBadName) {
+		t.Errorf(`Client.RemoveProcessGroup("old") => error{"%v"}, want BAD_NAME`, err)
+	}
+
+	infos, err := client.GetAllConfigInfo()
+	if err != nil || len(infos) != 3 {
+		t.Fatalf(`Client.GetAllConfigInfo() => %v, error{"%v"}, want 3 programs`, infos, err)
+	}
+	want := []string{`ConfigInfo{"batch:runner", true}`, `ConfigInfo{"web:api", true}`, `ConfigInfo{"web:worker", false}`}
+	for i, info := range infos {
+		if info.String() != want[i] || info.ProcessPrio != 999 {
+			t.Errorf(`Client.GetAllConfigInfo()[%d] => %v, want %s`, i, info, want[i])
+		}
+	}
+	if !infos[0].Autostart || infos[1].Autostart {
+		t.Errorf(`Client.GetAllConfigInfo() => %+v, want only batch:runner to auto start`, infos)
+	}
+}
+
+// Test the log methods.
+func TestClientLogs(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api")...)
+	client := testClient(t, server)
+	server.WriteLog("web:api", false, "one\ntwo\nthree\n")
+	server.WriteLog("web:api", true, "oops\n")
+
+	if log, err := client.ReadProcessStdoutLog("web:api", 4, 4); err != nil || log != "two\n" {
+		t.Errorf(`Client.ReadProcessStdoutLog("web:api", 4, 4) => "%s", error{"%v"}, want "two\n"`, log, err)
+	}
+	if log, err := client.ReadProcessStdoutLog("web:api", -6, 0); err != nil || log != "three\n" {
+		t.Errorf(`Client.ReadProcessStdoutLog("web:api", -6, 0) => "%s", error{"%v"}, want "three\n"`, log, err)
+	}
+	if _, err := client.ReadProcessStdoutLog("web:api", -6, 2); !IsFault(err, FaultBadArguments) {
+		t.Errorf(`Client.ReadProcessStdoutLog("web:api", -6, 2) => error{"%v"}, want BAD_ARGUMENTS`, err)
+	}
+	if log, err := client.ReadProcessStderrLog("web:api", 0, 0); err != nil || log != "oops\n" {
+		t.Errorf(`Client.ReadProcessStderrLog("web:api", 0, 0) => "%s", error{"%v"}, want "oops\n"`, log, err)
+	}
+
+	tail, err := client.TailProcessStdoutLog("web:api", 0, 6)
+	if err != nil || tail.Log != "three\n" || tail.Offset != 14 || !tail.Overflow {
+		t.Errorf(`Client.TailProcessStdoutLog("web:api", 0, 6) => %+v, error{"%v"}, want "three\n" at 14 with overflow`, tail, err)
+	}
+	server.WriteLog("web:api", false, "four\n")
+	if tail, err = client.TailProcessStdoutLog("web:api", tail.Offset, 100); err != nil || tail.Log != "four\n" || tail.Offset != 19 || tail.Overflow {
+		t.Errorf(`Client.TailProcessStdoutLog("web:api", 14, 100) => %+v, error{"%v"}, want "four\n" at 19`, tail, err)
+	}
+	if tail, err = client.TailProcessStderrLog("web:api", 0, 100); err != nil || tail.Log != "oops\n" {
+		t.Errorf(`Client.TailProcessStderrLog("web:api", 0, 100) => %+v, error{"%v"}, want "oops\n"`, tail, err)
+	}
+
+	stream, err := client.TailProcessLog("web:api", false)
+	if err != nil {
+		t.Fatalf(`Client.TailProcessLog("web:api") => error{"%v"}, want nil`, err)
+	}
+	reader := bufio.NewReader(stream)
+	server.WriteLog("web:api", false, "five\n")
+	for _, want := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		if line, err := reader.ReadString('\n'); err != nil || line != want {
+			t.Errorf(`TailProcessLog read "%s", error{"%v"}, want "%s"`, line, err, want)
+		}
+	}
+	stream.Close()
+
+	if ok, err := client.ClearProcessLogs("web:api"); !ok || err != nil {
+		t.Errorf(`Client.ClearProcessLogs("web:api") => %v, error{"%v"}, want true`, ok, err)
+	}
+	if log, _ := client.ReadProcessStdoutLog("web:api", 0, 0); log != "" {
+		t.Errorf(`Client.ReadProcessStdoutLog() after clear => "%s", want ""`, log)
+	}
+	if statuses, err := client.ClearAllProcessLogs(); err != nil || len(statuses) != 1 {
+		t.Errorf(`Client.ClearAllProcessLogs() => %v, error{"%v"}, want 1 status`, statuses, err)
+	}
+
+	client.StartProcess("web:api", true)
+	if log, err := client.ReadLog(0, 0); err != nil || !strings.Contains(log, "spawned: 'api' with pid") {
+		t.Errorf(`Client.ReadLog(0, 0) => "%s", error{"%v"}, want spawned message`, log, err)
+	}
+	mainLog, err := client.TailLog()
+	if err != nil {
+		t.Fatalf(`Client.TailLog() => error{"%v"}, want nil`, err)
+	}
+	if line, err := bufio.NewReader(mainLog).ReadString('\n'); err != nil || !strings.Contains(line, "spawned") {
+		t.Errorf(`TailLog read "%s", error{"%v"}, want spawned message`, line, err)
+	}
+	mainLog.Close()
+	if ok, err := client.ClearLog(); !ok || err != nil {
+		t.Errorf(`Client.ClearLog() => %v, error{"%v"}, want true`, ok, err)
+	}
+	if log, _ := client.ReadLog(0, 0); log != "" {
+		t.Errorf(`Client.ReadLog(0, 0) after clear => "%s", want ""`, log)
+	}
+}
+
+// Test shutting down and restarting Supervisor.
+func TestClientShutdown(t *testing.T) {
+	program := supervisortest.NewProgram("web:api")
+	program.AutoStart = true
+	server := newTestServer(t, program)
+	client := testClient(t, server)
+
+	if ok, err := client.Restart(); !ok || err != nil {
+		t.Errorf(`Client.Restart() => %v, error{"%v"}, want true`, ok, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if state, err := client.GetState(); err == nil && state.StateName == "RUNNING" {
+			break
+		} else if err != nil && !IsFault(err, FaultShutdownState) {
+			t.Fatalf(`Client.GetState() => error{"%v"}, want SHUTDOWN_STATE while restarting`, err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf(`Client.GetState() did not return to RUNNING after restart`)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if state := server.State("web:api"); state != Running {
+		t.Errorf(`state of web:api after restart => "%s", want RUNNING`, state)
+	}
+
+	if ok, err := client.Shutdown(); !ok || err != nil {
+		t.Errorf(`Client.Shutdown() => %v, error{"%v"}, want true`, ok, err)
+	}
+	if _, err := client.GetAllProcessInfo(); !IsFault(err, FaultShutdownState) {
+		t.Errorf(`Client.GetAllProcessInfo() after shutdown => error{"%v"}, want SHUTDOWN_STATE`, err)
+	}
+	if state := server.State("web:api"); state != Stopped {
+		t.Errorf(`state of web:api after shutdown => "%s", want STOPPED`, state)
+	}
+}
+
+// Test connecting over a unix socket with authentication and observing calls.
+func TestDialClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "supervisor.sock")
+	server, err := supervisortest.NewUnixServer(path, supervisortest.Programs("cron")...)
+	if err != nil {
+		t.Fatalf(`supervisortest.NewUnixServer() => error{"%v"}, want nil`, err)
+	}
+	defer server.Close()
+	server.SetAuth("user", "secret")
+
+	if _, err := DialClient(server.URL, "user", "wrong"); err == nil {
+		t.Errorf(`DialClient() with a bad password => nil, want error`)
+	}
+	client, err := DialClient(server.URL, "user", "secret")
+	if err != nil {
+		t.Fatalf(`DialClient() => error{"%v"}, want nil`, err)
+	}
+
+	var observed []string
+	client = client.WithObserver(func(method string, duration time.Duration, err error) {
+		observed = append(observed, method+" "+FaultName(err))
+	})
+	server.SetLatency("supervisor.getProcessInfo", 20*time.Millisecond)
+	server.SetFault("supervisor.startProcess", FaultFailed, 1)
+
+	start := time.Now()
+	if _, err := client.GetProcessInfo("cron"); err != nil || time.Since(start) < 20*time.Millisecond {
+		t.Errorf(`Client.GetProcessInfo("cron") => error{"%v"} after %s, want nil after 20ms`, err, time.Since(start))
+	}
+	if _, err := client.StartProcess("cron", true); !IsFault(err, FaultFailed) {
+		t.Errorf(`Client.StartProcess("cron", true) => error{"%v"}, want injected FAILED`, err)
+	}
+	if _, err := client.StartProcess("cron", true); err != nil {
+		t.Errorf(`Client.StartProcess("cron", true) => error{"%v"}, want nil`, err)
+	}
+	want := []string{"supervisor.getProcessInfo ", "supervisor.startProcess FAILED", "supervisor.startProcess "}
+	if !cmpStrings(observed, want) {
+		t.Errorf(`observed calls %q, want %q`, observed, want)
+	}
+}
@@ -0,0 +1,125 @@
+package supervisor
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Gap is a range of missing serials from First to Last inclusive.
+type Gap struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// Count returns the number of serials in the gap.
+func (gap Gap) Count() int {
+	return gap.Last - gap.First + 1
+}
+
+func (gap Gap) String() string {
+	if gap.First == gap.Last {
+		return fmt.Sprintf("%d", gap.First)
+	}
+	return fmt.Sprintf("%d-%d", gap.First, gap.Last)
+}
+
+// SerialState is the serials seen from an event pool. Next is one more than the highest serial
+// seen, Seen holds the recent serials and Pending the missing serials which may still arrive out of
+// order. Values is free for listeners to store their own state in.
+type SerialState struct {
+	Next    int               `json:"next"`
+	Seen    []int             `json:"seen,omitempty"`
+	Pending []Gap             `json:"pending,omitempty"`
+	Values  map[string]string `json:"values,omitempty"`
+}
+
+// clone returns a deep copy of the state.
+func (state SerialState) clone() SerialState {
+	state.Seen = append([]int(nil), state.Seen...)
+	state.Pending = append([]Gap(nil), state.Pending...)
+	if state.Values != nil {
+		values := make(map[string]string, len(state.Values))
+		for key, value := range state.Values {
+			values[key] = value
+		}
+		state.Values = values
+	}
+	return state
+}
+
+// pending returns the index of the pending gap containing the serial or -1.
+func (state *SerialState) pending(serial int) int {
+	for i, gap := range state.Pending {
+		if serial >= gap.First && serial <= gap.Last {
+			return i
+		}
+	}
+	return -1
+}
+
+// Observe records a serial. It returns true if the serial has already been seen and returns the
+// serials which are now considered lost. A missing serial is lost once more than reorder serials
+// after it have been seen, so a reorder of zero reports gaps as soon as they appear. Supervisor
+// resends a failed event before any event after it has been dispatched, so serials are remembered
+// only as far back as reorder. A serial older than that which was not missing starts the tracking
+// over, as happens when Supervisor restarts and its pool serials begin again at zero.
+func (state *SerialState) Observe(serial int, reorder int) (duplicate bool, lost []Gap) {
+	if reorder < 0 {
+		reorder = 0
+	}
+	i := sort.SearchInts(state.Seen, serial)
+	if i < len(state.Seen) && state.Seen[i] == serial {
+		return true, nil
+	}
+
+	switch {
+	case len(state.Seen) == 0 || (serial < state.Next-1-reorder && state.pending(serial) < 0):
+		state.Next, state.Seen, state.Pending = serial+1, nil, nil
+		i = 0
+	case serial >= state.Next:
+		if serial > state.Next {
+			state.Pending = append(state.Pending, Gap{state.Next, serial - 1})
+		}
+		state.Next = serial + 1
+	default:
+		if j := state.pending(serial); j >= 0 {
+			gap := state.Pending[j]
+			var split []Gap
+			if gap.First < serial {
+				split = append(split, Gap{gap.First, serial - 1})
+			}
+			if serial < gap.Last {
+				split = append(split, Gap{serial + 1, gap.Last})
+			}
+			state.Pending = append(state.Pending[:j], append(split, state.Pending[j+1:]...)...)
+		}
+	}
+
+	state.Seen = append(state.Seen, 0)
+	copy(state.Seen[i+1:], state.Seen[i:])
+	state.Seen[i] = serial
+
+	cutoff := state.Next - 1 - reorder
+	state.Seen = state.Seen[sort.SearchInts(state.Seen, cutoff):]
+	pending := state.Pending[:0]
+	for _, gap := range state.Pending {
+		if gap.First < cutoff {
+			if gap.Last < cutoff {
+				lost = append(lost, gap)
+				continue
+			}
+			lost = append(lost, Gap{gap.First, cutoff - 1})
+			gap.First = cutoff
+		}
+		pending = append(pending, gap)
+	}
+	state.Pending = pending
+	return
+}
+
+// Forget removes a serial from the seen serials so it is not a duplicate when it is seen again.
+func (state *SerialState) Forget(serial int) {
+	if i := sort.SearchInts(state.Seen, serial); i < len(state.Seen) && state.Seen[i] == serial {
+		state.Seen = append(state.Seen[:i], state.Seen[i+1:]...)
+	}
+}
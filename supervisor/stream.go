@@ -0,0 +1,369 @@
+package supervisor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stream event types.
+const (
+	StreamSupervisorState string = "supervisor_state"
+	StreamProcessAdd      string = "process_add"
+	StreamProcessRemove   string = "process_remove"
+	StreamProcessState    string = "process_state"
+)
+
+const (
+	// DefaultStreamHistory is the number of events an EventStream keeps for resuming subscribers.
+	DefaultStreamHistory int = 1000
+
+	// DefaultStreamKeepalive is the time between keepalives sent to idle subscribers.
+	DefaultStreamKeepalive time.Duration = 15 * time.Second
+
+	// events buffered for each subscriber before it is dropped as too slow
+	streamBuffer int = 64
+)
+
+// StreamEvent is the JSON representation of a Monitor event sent by EventStream. The ID is made of
+// the serial of the last Supervisor event received and the position of the event among those
+// derived from it.
+type StreamEvent struct {
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	Supervisor      string `json:"supervisor"`
+	SupervisorState string `json:"supervisor_state"`
+	Process         string `json:"process,omitempty"`
+	Name            string `json:"name,omitempty"`
+	Group           string `json:"group,omitempty"`
+	State           string `json:"state,omitempty"`
+	PID             int    `json:"pid,omitempty"`
+	FromState       string `json:"from_state,omitempty"`
+	FromName        string `json:"from_name,omitempty"`
+	Tries           int    `json:"tries,omitempty"`
+}
+
+// newStreamEvent converts a Monitor event. False is returned for events which are not streamed.
+func newStreamEvent(event interface{}) (stream StreamEvent, ok bool) {
+	var proc Process
+	var super Supervisor
+	switch event := event.(type) {
+	case SupervisorStateEvent:
+		super = event.Supervisor
+		stream = StreamEvent{Type: StreamSupervisorState, FromState: event.FromState, FromName: event.FromName}
+	case ProcessAddEvent:
+		super, proc = event.Supervisor, event.Process
+		stream = StreamEvent{Type: StreamProcessAdd}
+	case ProcessRemoveEvent:
+		super, proc = event.Supervisor, event.Process
+		stream = StreamEvent{Type: StreamProcessRemove}
+	case ProcessStateEvent:
+		super, proc = event.Supervisor, event.Process
+		stream = StreamEvent{Type: StreamProcessState, FromState: event.FromState, Tries: event.Tries}
+	default:
+		return
+	}
+	stream.Supervisor = super.Name
+	stream.SupervisorState = super.State
+	if stream.Type != StreamSupervisorState {
+		stream.Process = processKey(proc)
+		stream.Name = proc.Name
+		stream.Group = proc.Group
+		stream.State = proc.State
+		stream.PID = proc.PID
+	}
+	return stream, true
+}
+
+// streamFilter selects the events sent to a subscriber.
+type streamFilter struct {
+	groups    map[string]bool
+	processes map[string]bool
+}
+
+// newStreamFilter reads the group and process query parameters. Each may be repeated or contain a
+// comma separated list. Processes are given as group:name or name.
+func newStreamFilter(query url.Values) streamFilter {
+	filter := streamFilter{make(map[string]bool), make(map[string]bool)}
+	for key, set := range map[string]map[string]bool{"group": filter.groups, "process": filter.processes} {
+		for _, value := range query[key] {
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					set[name] = true
+				}
+			}
+		}
+	}
+	return filter
+}
+
+// match returns true if the event should be sent. Supervisor state events are always sent.
+func (filter streamFilter) match(event StreamEvent) bool {
+	if event.Process == "" || (len(filter.groups) == 0 && len(filter.processes) == 0) {
+		return true
+	}
+	return filter.groups[event.Group] || filter.processes[event.Process] || filter.processes[event.Name]
+}
+
+// streamState is the mutable state shared by copies of EventStream.
+type streamState struct {
+	serial      int
+	count       int
+	history     []StreamEvent
+	subscribers map[chan StreamEvent]streamFilter
+}
+
+// EventStream is an http.Handler which streams Monitor events to subscribers as Server-Sent Events
+// or, when the request asks to be upgraded, as WebSocket text messages containing a StreamEvent.
+// The group and process query parameters limit the processes which are streamed.
+//
+// Recent events are kept so that a subscriber may resume where it left off with the Last-Event-ID
+// header or the last_event_id query parameter. Events after the given ID are replayed. If the ID is
+// no longer kept all retained events are replayed. Event IDs follow the Supervisor event serial
+// when the Monitor runs as an event listener with ForwardEvents set.
+type EventStream struct {
+	History   int
+	Keepalive time.Duration
+	lock      *sync.Mutex
+	state     *streamState
+}
+
+// NewEventStream creates an event stream without subscribers.
+func NewEventStream() EventStream {
+	return EventStream{
+		History:   DefaultStreamHistory,
+		Keepalive: DefaultStreamKeepalive,
+		lock:      &sync.Mutex{},
+		state:     &streamState{subscribers: make(map[chan StreamEvent]streamFilter)},
+	}
+}
+
+// Publish sends a Monitor event to the subscribers. A ListenerEvent advances the serial used for
+// event IDs. Other events are ignored. Subscribers which fall behind are disconnected so that they
+// may resume from their last event.
+func (stream EventStream) Publish(event interface{}) {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	state := stream.state
+
+	if event, ok := event.(ListenerEvent); ok {
+		if serial := event.Event.Serial(); serial != state.serial {
+			state.serial = serial
+			state.count = 0
+		}
+		return
+	}
+	streamEvent, ok := newStreamEvent(event)
+	if !ok {
+		return
+	}
+	state.count++
+	streamEvent.ID = fmt.Sprintf("%d-%d", state.serial, state.count)
+
+	state.history = append(state.history, streamEvent)
+	if extra := len(state.history) - stream.History; extra > 0 {
+		state.history = append(state.history[:0], state.history[extra:]...)
+	}
+	for events, filter := range state.subscribers {
+		if !filter.match(streamEvent) {
+			continue
+		}
+		select {
+		case events <- streamEvent:
+		default:
+			delete(state.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// Run publishes events from the channel until it is closed.
+func (stream EventStream) Run(events chan interface{}) {
+	for event := range events {
+		stream.Publish(event)
+	}
+}
+
+// subscribe registers a subscriber and returns the retained events it should be sent first. The
+// channel is closed if the subscriber falls behind.
+func (stream EventStream) subscribe(filter streamFilter, lastID string) (events chan StreamEvent, replay []StreamEvent) {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+
+	if lastID != "" {
+		start := 0
+		for i, event := range stream.state.history {
+			if event.ID == lastID {
+				start = i + 1
+			}
+		}
+		for _, event := range stream.state.history[start:] {
+			if filter.match(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+	events = make(chan StreamEvent, streamBuffer)
+	stream.state.subscribers[events] = filter
+	return
+}
+
+// unsubscribe removes a subscriber.
+func (stream EventStream) unsubscribe(events chan StreamEvent) {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	if _, ok := stream.state.subscribers[events]; ok {
+		delete(stream.state.subscribers, events)
+		close(events)
+	}
+}
+
+// Subscribers returns the number of connected subscribers.
+func (stream EventStream) Subscribers() int {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+	return len(stream.state.subscribers)
+}
+
+// keepalive returns a channel which receives on every keepalive interval and a function to stop it.
+func (stream EventStream) keepalive() (<-chan time.Time, func()) {
+	if stream.Keepalive <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(stream.Keepalive)
+	return ticker.C, ticker.Stop
+}
+
+func (stream EventStream) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	filter := newStreamFilter(request.URL.Query())
+	lastID := request.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = request.URL.Query().Get("last_event_id")
+	}
+	if isWebSocket(request) {
+		stream.serveWebSocket(writer, request, filter, lastID)
+	} else {
+		stream.serveEvents(writer, request, filter, lastID)
+	}
+}
+
+// serveEvents streams events as Server-Sent Events.
+func (stream EventStream) serveEvents(writer http.ResponseWriter, request *http.Request, filter streamFilter, lastID string) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	events, replay := stream.subscribe(filter, lastID)
+	defer stream.unsubscribe(events)
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+
+	send := func(event StreamEvent) error {
+		data, _ := json.Marshal(event)
+		_, err := fmt.Fprintf(writer, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		return err
+	}
+	for _, event := range replay {
+		if send(event) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticks, stop := stream.keepalive()
+	defer stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok || send(event) != nil {
+				return
+			}
+		case <-ticks:
+			if _, err := fmt.Fprint(writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// serveWebSocket streams events as WebSocket text messages.
+func (stream EventStream) serveWebSocket(writer http.ResponseWriter, request *http.Request, filter streamFilter, lastID string) {
+	conn, rw, err := upgradeWebSocket(writer, request)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	events, replay := stream.subscribe(filter, lastID)
+	defer stream.unsubscribe(events)
+
+	lock := &sync.Mutex{}
+	send := func(opcode byte, payload []byte) error {
+		lock.Lock()
+		defer lock.Unlock()
+		return writeWebSocketFrame(conn, opcode, payload)
+	}
+	closeFrame := func(code uint16, reason string) []byte {
+		payload := make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, code)
+		return append(payload, reason...)
+	}
+
+	// answer control frames until the client closes the connection
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for {
+			opcode, payload, err := readWebSocketFrame(rw.Reader)
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case wsClose:
+				send(wsClose, payload)
+				return
+			case wsPing:
+				send(wsPong, payload)
+			}
+		}
+	}()
+
+	for _, event := range replay {
+		data, _ := json.Marshal(event)
+		if send(wsText, data) != nil {
+			return
+		}
+	}
+	ticks, stop := stream.keepalive()
+	defer stop()
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-events:
+			if !ok {
+				send(wsClose, closeFrame(1013, "subscriber fell behind"))
+				return
+			}
+			data, _ := json.Marshal(event)
+			if send(wsText, data) != nil {
+				return
+			}
+		case <-ticks:
+			if send(wsPing, nil) != nil {
+				return
+			}
+		}
+	}
+}
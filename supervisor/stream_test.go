@@ -0,0 +1,208 @@
+package supervisor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Publish a Supervisor event serial followed by a process state change.
+func publishState(stream EventStream, serial int, name string, state string) {
+	stream.Publish(ListenerEvent{Event: Event{Header: map[string]string{"serial": fmt.Sprint(serial)}}})
+	parts := strings.SplitN(name, ":", 2)
+	stream.Publish(ProcessStateEvent{Supervisor{"test", "RUNNING"}, Process{parts[1], parts[0], state, 0}, Stopped, 0})
+}
+
+// Wait for the stream to have the given number of subscribers.
+func waitSubscribers(t *testing.T, stream EventStream, count int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for stream.Subscribers() != count {
+		if time.Now().After(deadline) {
+			t.Fatalf(`EventStream.Subscribers() => %d, want %d`, stream.Subscribers(), count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Read the id and data of the next Server-Sent Event.
+func readSSE(t *testing.T, reader *bufio.Reader) (id string, event StreamEvent) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf(`read event => error{"%v"}, want nil`, err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			return
+		case strings.HasPrefix(line, "id: "):
+			id = line[4:]
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(line[6:]), &event); err != nil {
+				t.Fatalf(`json.Unmarshal(%q) => error{"%v"}, want nil`, line, err)
+			}
+		}
+	}
+}
+
+// Test converting Monitor events.
+func TestNewStreamEvent(t *testing.T) {
+	super := Supervisor{"test", "RUNNING"}
+	proc := Process{"api", "web", Running, 42}
+	tests := []struct {
+		event interface{}
+		want  StreamEvent
+	}{
+		{SupervisorStateEvent{super, "test", "UNKNOWN"}, StreamEvent{"", StreamSupervisorState, "test", "RUNNING", "", "", "", "", 0, "UNKNOWN", "test", 0}},
+		{ProcessAddEvent{super, proc}, StreamEvent{"", StreamProcessAdd, "test", "RUNNING", "web:api", "api", "web", Running, 42, "", "", 0}},
+		{ProcessRemoveEvent{super, proc}, StreamEvent{"", StreamProcessRemove, "test", "RUNNING", "web:api", "api", "web", Running, 42, "", "", 0}},
+		{ProcessStateEvent{super, proc, Starting, 1}, StreamEvent{"", StreamProcessState, "test", "RUNNING", "web:api", "api", "web", Running, 42, Starting, "", 1}},
+	}
+	for _, test := range tests {
+		if have, ok := newStreamEvent(test.event); !ok || have != test.want {
+			t.Errorf(`newStreamEvent(%+v) => %+v, want %+v`, test.event, have, test.want)
+		}
+	}
+	if _, ok := newStreamEvent(RefreshErrorEvent{}); ok {
+		t.Errorf(`newStreamEvent(RefreshErrorEvent) => true, want false`)
+	}
+}
+
+// Test streaming Server-Sent Events with a filter and resuming from an event ID.
+func TestEventStreamSSE(t *testing.T) {
+	stream := NewEventStream()
+	stream.History = 3
+	server := httptest.NewServer(stream)
+	defer server.Close()
+
+	publishState(stream, 1, "web:api", Starting)
+	publishState(stream, 2, "cron:cron", Running)
+	publishState(stream, 3, "web:api", Running)
+	stream.Publish(ProcessAddEvent{Supervisor{"test", "RUNNING"}, Process{"db", "db", Stopped, 0}})
+
+	request, _ := http.NewRequest("GET", server.URL+"?group=web&process=db", nil)
+	request.Header.Set("Last-Event-ID", "1-1")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf(`GET stream => error{"%v"}, want nil`, err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf(`GET stream => Content-Type %q, want text/event-stream`, contentType)
+	}
+	reader := bufio.NewReader(response.Body)
+
+	// 1-1 has fallen out of the history so all retained matching events are replayed
+	want := []string{"3-1 web:api RUNNING", "3-2 db:db STOPPED"}
+	for _, w := range want {
+		if id, event := readSSE(t, reader); fmt.Sprintf("%s %s %s", id, event.Process, event.State) != w || event.ID != id {
+			t.Errorf(`replayed event => %s %+v, want %s`, id, event, w)
+		}
+	}
+
+	waitSubscribers(t, stream, 1)
+	publishState(stream, 4, "cron:cron", Stopped)
+	publishState(stream, 5, "web:worker", Running)
+	stream.Publish(SupervisorStateEvent{Supervisor{"test", "SHUTDOWN"}, "test", "RUNNING"})
+	want = []string{"5-1 web:worker RUNNING", "5-2  "}
+	for _, w := range want {
+		if id, event := readSSE(t, reader); fmt.Sprintf("%s %s %s", id, event.Process, event.State) != w {
+			t.Errorf(`streamed event => %s %+v, want %s`, id, event, w)
+		}
+	}
+
+	// resuming from a retained ID replays only the later events
+	_, replay := stream.subscribe(newStreamFilter(nil), "5-1")
+	if len(replay) != 1 || replay[0].ID != "5-2" || replay[0].Type != StreamSupervisorState {
+		t.Errorf(`EventStream.subscribe("5-1") => %+v, want 5-2 supervisor_state`, replay)
+	}
+}
+
+// Test that slow subscribers are dropped.
+func TestEventStreamSlow(t *testing.T) {
+	stream := NewEventStream()
+	events, _ := stream.subscribe(newStreamFilter(nil), "")
+	for i := 0; i <= streamBuffer; i++ {
+		publishState(stream, i, "web:api", Running)
+	}
+	count := 0
+	for range events {
+		count++
+	}
+	if count != streamBuffer || stream.Subscribers() != 0 {
+		t.Errorf(`slow subscriber received %d events with %d subscribers, want %d and 0`, count, stream.Subscribers(), streamBuffer)
+	}
+	stream.unsubscribe(events)
+}
+
+// Test streaming over a WebSocket.
+func TestEventStreamWebSocket(t *testing.T) {
+	stream := NewEventStream()
+	server := httptest.NewServer(stream)
+	defer server.Close()
+
+	publishState(stream, 7, "web:api", Running)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf(`net.Dial() => error{"%v"}, want nil`, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET /?process=api&last_event_id=0-0 HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: %s\r\n\r\n", key)
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf(`websocket handshake => error{"%v"}, want nil`, err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf(`websocket handshake => %s %v, want 101 with accept key`, response.Status, response.Header)
+	}
+
+	readEvent := func() StreamEvent {
+		opcode, payload, err := readWebSocketFrame(reader)
+		if err != nil || opcode != wsText {
+			t.Fatalf(`readWebSocketFrame() => %d %q error{"%v"}, want text frame`, opcode, payload, err)
+		}
+		var event StreamEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			t.Fatalf(`json.Unmarshal(%q) => error{"%v"}, want nil`, payload, err)
+		}
+		return event
+	}
+	if event := readEvent(); event.ID != "7-1" || event.Process != "web:api" {
+		t.Errorf(`replayed event => %+v, want 7-1 web:api`, event)
+	}
+
+	waitSubscribers(t, stream, 1)
+	publishState(stream, 8, "cron:cron", Running)
+	publishState(stream, 9, "web:api", Stopped)
+	if event := readEvent(); event.ID != "9-1" || event.State != Stopped {
+		t.Errorf(`streamed event => %+v, want 9-1 STOPPED`, event)
+	}
+
+	// a masked close frame is echoed and the subscriber removed
+	conn.Write([]byte{0x80 | wsClose, 0x82, 1, 2, 3, 4, 0x03 ^ 1, 0xe8 ^ 2})
+	if opcode, payload, err := readWebSocketFrame(reader); err != nil || opcode != wsClose || string(payload) != "\x03\xe8" {
+		t.Errorf(`readWebSocketFrame() => %d %q error{"%v"}, want close 1000`, opcode, payload, err)
+	}
+	waitSubscribers(t, stream, 0)
+
+	// plain requests with a bad handshake are rejected
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Connection", "upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	recorder := httptest.NewRecorder()
+	stream.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf(`websocket without key => %d, want 400`, recorder.Code)
+	}
+}
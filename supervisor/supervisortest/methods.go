@@ -0,0 +1,732 @@
+package supervisortest
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// signal numbers by name as accepted by signalProcess
+	signals map[string]int = map[string]int{
+		"HUP": 1, "INT": 2, "QUIT": 3, "ILL": 4, "TRAP": 5, "ABRT": 6, "BUS": 7, "FPE": 8, "KILL": 9,
+		"USR1": 10, "SEGV": 11, "USR2": 12, "PIPE": 13, "ALRM": 14, "TERM": 15, "CHLD": 17, "CONT": 18,
+		"STOP": 19, "TSTP": 20, "TTIN": 21, "TTOU": 22, "URG": 23, "XCPU": 24, "XFSZ": 25,
+		"VTALRM": 26, "PROF": 27, "WINCH": 28, "IO": 29, "PWR": 30, "SYS": 31,
+	}
+
+	methods map[string]rpcMethod
+)
+
+// rpcMethod describes an XML-RPC method. The signature lists the return type followed by the types
+// of the parameters. Trailing parameters may be omitted when they have defaults. Unlocked methods are
+// called without the server lock.
+type rpcMethod struct {
+	signature []string
+	defaults  []interface{}
+	help      string
+	unlocked  bool
+	call      func(server *Server, args []interface{}) (interface{}, error)
+}
+
+// typeName returns the XML-RPC type name of a decoded value.
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case int64:
+		return "int"
+	case bool:
+		return "boolean"
+	case float64:
+		return "double"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "struct"
+	case []byte:
+		return "base64"
+	}
+	return "nil"
+}
+
+// check verifies the arguments against the signature and fills in defaults.
+func (method rpcMethod) check(args []interface{}) ([]interface{}, error) {
+	params := method.signature[1:]
+	required := len(params) - len(method.defaults)
+	if len(args) < required || len(args) > len(params) {
+		return nil, newFault("INCORRECT_PARAMETERS", fmt.Sprintf("takes %d arguments, got %d", len(params), len(args)))
+	}
+	for i, arg := range args {
+		if params[i] != "any" && typeName(arg) != params[i] {
+			return nil, newFault("INCORRECT_PARAMETERS", fmt.Sprintf("argument %d must be %s, got %s", i+1, params[i], typeName(arg)))
+		}
+	}
+	return append(append([]interface{}{}, args...), method.defaults[len(args)-required:]...), nil
+}
+
+// status returns a process status struct as returned by the group methods.
+func status(proc *process, err error) map[string]interface{} {
+	result := map[string]interface{}{
+		"name":        proc.program.Name,
+		"group":       proc.program.Group,
+		"status":      faultCodes["SUCCESS"],
+		"description": "OK",
+	}
+	if fault, ok := err.(Fault); ok {
+		result["status"] = fault.Code
+		result["description"] = fault.Error()
+	}
+	return result
+}
+
+// statuses converts a list of process statuses to an XML-RPC array.
+func statuses(results []map[string]interface{}) []interface{} {
+	items := make([]interface{}, len(results))
+	for i, result := range results {
+		items[i] = result
+	}
+	return items
+}
+
+// readBytes reads a log as supervisord reads log files. A negative offset with a zero length reads
+// that many bytes from the end, a zero length reads to the end.
+func readBytes(data []byte, offset int64, length int64) (string, error) {
+	size := int64(len(data))
+	if offset < 0 {
+		if length != 0 {
+			return "", newFault("BAD_ARGUMENTS", "")
+		}
+		if offset += size; offset < 0 {
+			offset = 0
+		}
+		return string(data[offset:]), nil
+	}
+	if length < 0 {
+		return "", newFault("BAD_ARGUMENTS", "")
+	}
+	if offset > size {
+		return "", nil
+	}
+	if length == 0 || offset+length > size {
+		length = size - offset
+	}
+	return string(data[offset : offset+length]), nil
+}
+
+// tailLog tails a log as supervisord tails log files. It returns the data, the offset to read from
+// next and whether data was skipped.
+func tailLog(data []byte, offset int64, length int64) (interface{}, error) {
+	if offset < 0 || length < 0 {
+		return nil, newFault("BAD_ARGUMENTS", "")
+	}
+	size := int64(len(data))
+	overflow := false
+	if size > offset+length {
+		overflow = true
+		offset = size - length
+	}
+	if offset > size {
+		return []interface{}{"", offset, false}, nil
+	}
+	end := offset + length
+	if end > size {
+		end = size
+	}
+	return []interface{}{string(data[offset:end]), end, overflow}, nil
+}
+
+// processLog returns the stdout or stderr log of a named process.
+func (server *Server) processLog(name string, stderr bool) (*process, []byte, error) {
+	proc, err := server.lookup(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stderr {
+		if proc.program.StderrLogfile == "" {
+			return nil, nil, newFault("NO_FILE", "no stderr log file")
+		}
+		return proc, proc.stderr, nil
+	}
+	if proc.program.StdoutLogfile == "" {
+		return nil, nil, newFault("NO_FILE", "no stdout log file")
+	}
+	return proc, proc.stdout, nil
+}
+
+// startProcess starts a single process and optionally waits for it to be RUNNING.
+func (server *Server) startProcess(proc *process, name string, wait bool) error {
+	if isRunningState(proc.state) {
+		return newFault("ALREADY_STARTED", name)
+	}
+	if proc.state == Stopping {
+		return newFault("ABNORMAL_TERMINATION", name)
+	}
+	server.spawn(proc)
+	if proc.state == Backoff || proc.state == Fatal {
+		return newFault("SPAWN_ERROR", name)
+	}
+	if wait && proc.state != Running {
+		return server.waitStarted(proc, name)
+	}
+	return nil
+}
+
+// startGroup starts the processes of a group which are not running.
+func (server *Server) startGroup(group string, wait bool) (interface{}, error) {
+	procs := server.sorted(group)
+	if len(procs) == 0 {
+		return nil, newFault("BAD_NAME", group)
+	}
+	var results []map[string]interface{}
+	for _, proc := range procs {
+		if isRunningState(proc.state) {
+			continue
+		}
+		err := server.startProcess(proc, proc.program.key(), wait)
+		results = append(results, status(proc, err))
+	}
+	return statuses(results), nil
+}
+
+// stopProcess stops a single process and optionally waits for it to stop.
+func (server *Server) stopProcess(proc *process, name string, wait bool) error {
+	if !isRunningState(proc.state) {
+		return newFault("NOT_RUNNING", name)
+	}
+	server.halt(proc)
+	if wait {
+		server.waitStopped(proc)
+	}
+	return nil
+}
+
+// stopGroup stops the running processes of a group in reverse priority order.
+func (server *Server) stopGroup(group string, wait bool) (interface{}, error) {
+	procs := server.sorted(group)
+	if len(procs) == 0 {
+		return nil, newFault("BAD_NAME", group)
+	}
+	var results []map[string]interface{}
+	for i := len(procs) - 1; i >= 0; i-- {
+		proc := procs[i]
+		if !isRunningState(proc.state) {
+			continue
+		}
+		err := server.stopProcess(proc, proc.program.key(), wait)
+		results = append(results, status(proc, err))
+	}
+	return statuses(results), nil
+}
+
+// signalProcess validates a signal and sends it to a process.
+func (server *Server) signalProcess(proc *process, name string, signal string) error {
+	upper := strings.TrimPrefix(strings.ToUpper(signal), "SIG")
+	if _, ok := signals[upper]; !ok {
+		if number, err := strconv.Atoi(signal); err != nil || number < 1 || number > 31 {
+			return newFault("BAD_SIGNAL", signal)
+		}
+	}
+	if !isRunningState(proc.state) {
+		return newFault("NOT_RUNNING", name)
+	}
+	if proc.pid == 0 {
+		return newFault("FAILED", fmt.Sprintf("attempted to send %s sig %s but it wasn't running", proc.program.Name, signal))
+	}
+	return nil
+}
+
+// signalGroup sends a signal to the running processes of a group, or all processes if the group is
+// empty.
+func (server *Server) signalGroup(group string, signal string) (interface{}, error) {
+	procs := server.sorted(group)
+	if group != "" && len(procs) == 0 {
+		return nil, newFault("BAD_NAME", group)
+	}
+	var results []map[string]interface{}
+	for _, proc := range procs {
+		if !isRunningState(proc.state) {
+			continue
+		}
+		err := server.signalProcess(proc, proc.program.key(), signal)
+		results = append(results, status(proc, err))
+	}
+	return statuses(results), nil
+}
+
+// str returns a string argument.
+func str(args []interface{}, i int) string {
+	return args[i].(string)
+}
+
+func init() {
+	// a method which takes a process name and reads a log
+	readLog := func(stderr bool) rpcMethod {
+		return rpcMethod{
+			signature: []string{"string", "string", "int", "int"},
+			help:      "Read length bytes from name's log starting at offset",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				_, data, err := server.processLog(str(args, 0), stderr)
+				if err != nil {
+					return nil, err
+				}
+				return readBytes(data, args[1].(int64), args[2].(int64))
+			},
+		}
+	}
+	tailLogMethod := func(stderr bool) rpcMethod {
+		return rpcMethod{
+			signature: []string{"array", "string", "int", "int"},
+			help:      "Provides a more efficient way to tail the log than readProcessLog()",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				_, data, err := server.processLog(str(args, 0), stderr)
+				if err != nil {
+					return nil, err
+				}
+				return tailLog(data, args[1].(int64), args[2].(int64))
+			},
+		}
+	}
+	version := rpcMethod{
+		signature: []string{"string"},
+		help:      "Return the version of the RPC API used by supervisord",
+		call: func(server *Server, args []interface{}) (interface{}, error) {
+			return apiVersion, nil
+		},
+	}
+	clearProcessLogs := rpcMethod{
+		signature: []string{"boolean", "string"},
+		help:      "Clear the stdout and stderr logs for the named process and reopen them.",
+		call: func(server *Server, args []interface{}) (interface{}, error) {
+			proc, err := server.lookup(str(args, 0))
+			if err != nil {
+				return nil, err
+			}
+			proc.stdout, proc.stderr = nil, nil
+			return true, nil
+		},
+	}
+
+	methods = map[string]rpcMethod{
+		"supervisor.getAPIVersion": version,
+		"supervisor.getVersion":    version,
+		"supervisor.getSupervisorVersion": {
+			signature: []string{"string"},
+			help:      "Return the version of the supervisor package in use by supervisord",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				return supervisorVersion, nil
+			},
+		},
+		"supervisor.getIdentification": {
+			signature: []string{"string"},
+			help:      "Return identifying string of supervisord",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				return server.identification, nil
+			},
+		},
+		"supervisor.getState": {
+			signature: []string{"struct"},
+			help:      "Return current state of supervisord as a struct",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				return map[string]interface{}{"statecode": moodCodes[server.mood], "statename": server.mood}, nil
+			},
+		},
+		"supervisor.getPID": {
+			signature: []string{"int"},
+			help:      "Return the PID of supervisord",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				return os.Getpid(), nil
+			},
+		},
+		"supervisor.readLog": {
+			signature: []string{"string", "int", "int"},
+			help:      "Read length bytes from the main log starting at offset",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				return readBytes(server.mainLog, args[0].(int64), args[1].(int64))
+			},
+		},
+		"supervisor.clearLog": {
+			signature: []string{"boolean"},
+			help:      "Clear the main log.",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				server.mainLog = nil
+				return true, nil
+			},
+		},
+		"supervisor.shutdown": {
+			signature: []string{"boolean"},
+			help:      "Shut down the supervisor process",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				server.mood = moodShutdown
+				for _, proc := range server.sorted("") {
+					if isRunningState(proc.state) {
+						server.halt(proc)
+					}
+				}
+				return true, nil
+			},
+		},
+		"supervisor.restart": {
+			signature: []string{"boolean"},
+			help:      "Restart the supervisor process",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				server.mood = moodRestarting
+				for _, proc := range server.sorted("") {
+					if isRunningState(proc.state) {
+						server.halt(proc)
+					}
+				}
+				time.AfterFunc(0, func() {
+					server.lock.Lock()
+					defer server.lock.Unlock()
+					if !server.closed {
+						server.load()
+						server.mood = moodRunning
+					}
+				})
+				return true, nil
+			},
+		},
+		"supervisor.reloadConfig": {
+			signature: []string{"array"},
+			help:      "Reload the configuration.",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				added, changed, removed := server.changes()
+				list := func(names []string) []interface{} {
+					items := make([]interface{}, len(names))
+					for i, name := range names {
+						items[i] = name
+					}
+					return items
+				}
+				return []interface{}{[]interface{}{list(added), list(changed), list(removed)}}, nil
+			},
+		},
+		"supervisor.addProcessGroup": {
+			signature: []string{"boolean", "string"},
+			help:      "Update the config for a running process from config file.",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				group := str(args, 0)
+				if len(server.sorted(group)) > 0 {
+					return nil, newFault("ALREADY_ADDED", group)
+				}
+				var added []*process
+				for _, program := range server.config {
+					if program.Group == group {
+						proc := newProcess(program)
+						server.processes[program.key()] = proc
+						added = append(added, proc)
+					}
+				}
+				if len(added) == 0 {
+					return nil, newFault("BAD_NAME", group)
+				}
+				for _, proc := range server.sorted(group) {
+					if proc.program.AutoStart {
+						server.spawn(proc)
+					}
+				}
+				return true, nil
+			},
+		},
+		"supervisor.removeProcessGroup": {
+			signature: []string{"boolean", "string"},
+			help:      "Remove a stopped process from the active configuration.",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				group := str(args, 0)
+				procs := server.sorted(group)
+				if len(procs) == 0 {
+					return nil, newFault("BAD_NAME", group)
+				}
+				for _, proc := range procs {
+					if isRunningState(proc.state) || proc.state == Stopping {
+						return nil, newFault("STILL_RUNNING", group)
+					}
+				}
+				for _, proc := range procs {
+					delete(server.processes, proc.program.key())
+				}
+				return true, nil
+			},
+		},
+		"supervisor.startProcess": {
+			signature: []string{"boolean", "string", "boolean"},
+			defaults:  []interface{}{true},
+			help:      "Start a process",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				name, wait := str(args, 0), args[1].(bool)
+				if group, short := splitName(name); short == "*" {
+					return server.startGroup(group, wait)
+				}
+				proc, err := server.lookup(name)
+				if err != nil {
+					return nil, err
+				}
+				if err := server.startProcess(proc, name, wait); err != nil {
+					return nil, err
+				}
+				return true, nil
+			},
+		},
+		"supervisor.startProcessGroup": {
+			signature: []string{"array", "string", "boolean"},
+			defaults:  []interface{}{true},
+			help:      "Start all processes in the group named 'name'",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				return server.startGroup(str(args, 0), args[1].(bool))
+			},
+		},
+		"supervisor.startAllProcesses": {
+			signature: []string{"array", "boolean"},
+			defaults:  []interface{}{true},
+			help:      "Start all processes listed in the configuration file",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				var results []map[string]interface{}
+				for _, proc := range server.sorted("") {
+					if !isRunningState(proc.state) {
+						err := server.startProcess(proc, proc.program.key(), args[0].(bool))
+						results = append(results, status(proc, err))
+					}
+				}
+				return statuses(results), nil
+			},
+		},
+		"supervisor.stopProcess": {
+			signature: []string{"boolean", "string", "boolean"},
+			defaults:  []interface{}{true},
+			help:      "Stop a process named by name",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				name, wait := str(args, 0), args[1].(bool)
+				if group, short := splitName(name); short == "*" {
+					return server.stopGroup(group, wait)
+				}
+				proc, err := server.lookup(name)
+				if err != nil {
+					return nil, err
+				}
+				if err := server.stopProcess(proc, name, wait); err != nil {
+					return nil, err
+				}
+				return true, nil
+			},
+		},
+		"supervisor.stopProcessGroup": {
+			signature: []string{"array", "string", "boolean"},
+			defaults:  []interface{}{true},
+			help:      "Stop all processes in the process group named 'name'",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				return server.stopGroup(str(args, 0), args[1].(bool))
+			},
+		},
+		"supervisor.stopAllProcesses": {
+			signature: []string{"array", "boolean"},
+			defaults:  []interface{}{true},
+			help:      "Stop all processes in the process list",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				var results []map[string]interface{}
+				procs := server.sorted("")
+				for i := len(procs) - 1; i >= 0; i-- {
+					if isRunningState(procs[i].state) {
+						err := server.stopProcess(procs[i], procs[i].program.key(), args[0].(bool))
+						results = append(results, status(procs[i], err))
+					}
+				}
+				return statuses(results), nil
+			},
+		},
+		"supervisor.signalProcess": {
+			signature: []string{"boolean", "string", "string"},
+			help:      "Send an arbitrary UNIX signal to the process named by name",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				proc, err := server.lookup(str(args, 0))
+				if err != nil {
+					return nil, err
+				}
+				if err := server.signalProcess(proc, str(args, 0), str(args, 1)); err != nil {
+					return nil, err
+				}
+				return true, nil
+			},
+		},
+		"supervisor.signalProcessGroup": {
+			signature: []string{"array", "string", "string"},
+			help:      "Send a signal to all processes in the group named 'name'",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				return server.signalGroup(str(args, 0), str(args, 1))
+			},
+		},
+		"supervisor.signalAllProcesses": {
+			signature: []string{"array", "string"},
+			help:      "Send a signal to all processes in the process list",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				return server.signalGroup("", str(args, 0))
+			},
+		},
+		"supervisor.getAllConfigInfo": {
+			signature: []string{"array"},
+			help:      "Get info about all available process configurations.",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				programs := append([]Program{}, server.config...)
+				sort.Slice(programs, func(i, j int) bool { return programs[i].key() < programs[j].key() })
+				infos := make([]interface{}, len(programs))
+				for i, program := range programs {
+					exitCodes := make([]interface{}, len(program.ExitCodes))
+					for j, code := range program.ExitCodes {
+						exitCodes[j] = code
+					}
+					proc, ok := server.processes[program.key()]
+					infos[i] = map[string]interface{}{
+						"name":           program.Name,
+						"group":          program.Group,
+						"inuse":          ok && reflect.DeepEqual(proc.program, program),
+						"autostart":      program.AutoStart,
+						"autorestart":    program.AutoRestart,
+						"command":        program.Command,
+						"exitcodes":      exitCodes,
+						"group_prio":     program.Priority,
+						"process_prio":   program.Priority,
+						"startretries":   program.StartRetries,
+						"startsecs":      int(program.StartSecs / time.Second),
+						"stdout_logfile": program.StdoutLogfile,
+						"stderr_logfile": program.StderrLogfile,
+					}
+				}
+				return infos, nil
+			},
+		},
+		"supervisor.getProcessInfo": {
+			signature: []string{"struct", "string"},
+			help:      "Get info about a process named name",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				proc, err := server.lookup(str(args, 0))
+				if err != nil {
+					return nil, err
+				}
+				return proc.info(server.now()), nil
+			},
+		},
+		"supervisor.getAllProcessInfo": {
+			signature: []string{"array"},
+			help:      "Get info about all processes",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				procs := server.sorted("")
+				sort.Slice(procs, func(i, j int) bool { return procs[i].program.key() < procs[j].program.key() })
+				infos := make([]interface{}, len(procs))
+				for i, proc := range procs {
+					infos[i] = proc.info(server.now())
+				}
+				return infos, nil
+			},
+		},
+		"supervisor.readProcessStdoutLog": readLog(false),
+		"supervisor.readProcessLog":       readLog(false),
+		"supervisor.readProcessStderrLog": readLog(true),
+		"supervisor.tailProcessStdoutLog": tailLogMethod(false),
+		"supervisor.tailProcessLog":       tailLogMethod(false),
+		"supervisor.tailProcessStderrLog": tailLogMethod(true),
+		"supervisor.clearProcessLogs":     clearProcessLogs,
+		"supervisor.clearProcessLog":      clearProcessLogs,
+		"supervisor.clearAllProcessLogs": {
+			signature: []string{"array"},
+			help:      "Clear all process log files",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				var results []map[string]interface{}
+				for _, proc := range server.sorted("") {
+					proc.stdout, proc.stderr = nil, nil
+					results = append(results, status(proc, nil))
+				}
+				return statuses(results), nil
+			},
+		},
+		"supervisor.sendProcessStdin": {
+			signature: []string{"boolean", "string", "string"},
+			help:      "Send a string of chars to the stdin of the process name.",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				proc, err := server.lookup(str(args, 0))
+				if err != nil {
+					return nil, err
+				}
+				if proc.pid == 0 || proc.state == Stopping {
+					return nil, newFault("NOT_RUNNING", str(args, 0))
+				}
+				return true, nil
+			},
+		},
+		"supervisor.sendRemoteCommEvent": {
+			signature: []string{"boolean", "string", "string"},
+			help:      "Send an event that will be received by event listener subprocesses subscribing to the RemoteCommunicationEvent.",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				return true, nil
+			},
+		},
+		"system.listMethods": {
+			signature: []string{"array"},
+			help:      "Return an array listing the available method names",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				names := make([]string, 0, len(methods))
+				for name := range methods {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				return names, nil
+			},
+		},
+		"system.methodHelp": {
+			signature: []string{"string", "string"},
+			help:      "Return a string showing the method's documentation",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				method, ok := methods[str(args, 0)]
+				if !ok {
+					return nil, newFault("SIGNATURE_UNSUPPORTED", "")
+				}
+				return method.help, nil
+			},
+		},
+		"system.methodSignature": {
+			signature: []string{"array", "string"},
+			help:      "Return an array describing the method signature in the form [rtype, ptype, ptype...] where rtype is the return data type of the method, and ptypes are the parameter data types that the method accepts in method argument order.",
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				method, ok := methods[str(args, 0)]
+				if !ok {
+					return nil, newFault("SIGNATURE_UNSUPPORTED", "")
+				}
+				return []interface{}{method.signature}, nil
+			},
+		},
+		"system.multicall": {
+			signature: []string{"array", "array"},
+			help:      "Process an array of calls, and return an array of results. Calls should be structs of the form {'methodName': string, 'params': array}. Each result will either be a single-item array containing the result value, or a struct of the form {'faultCode': int, 'faultString': string}. This is useful when you need to make lots of small calls without lots of round trips.",
+			unlocked:  true,
+			call: func(server *Server, args []interface{}) (interface{}, error) {
+				calls := args[0].([]interface{})
+				results := make([]interface{}, len(calls))
+				for i, item := range calls {
+					call, _ := item.(map[string]interface{})
+					name, _ := call["methodName"].(string)
+					params, _ := call["params"].([]interface{})
+					var result interface{}
+					var err error
+					if name == "system.multicall" {
+						err = newFault("INCORRECT_PARAMETERS", "recursive system.multicall forbidden")
+					} else {
+						result, err = server.dispatch(name, params)
+					}
+					if err != nil {
+						fault, ok := err.(Fault)
+						if !ok {
+							fault = newFault("FAILED", err.Error())
+						}
+						results[i] = map[string]interface{}{"faultCode": fault.Code, "faultString": fault.Error()}
+					} else {
+						results[i] = []interface{}{result}
+					}
+				}
+				return results, nil
+			},
+		},
+	}
+}
@@ -0,0 +1,413 @@
+package supervisortest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Event listener states.
+	ListenerAcknowledged string = "ACKNOWLEDGED"
+	ListenerReady        string = "READY"
+	ListenerBusy         string = "BUSY"
+	ListenerUnknown      string = "UNKNOWN"
+
+	// DefaultBufferSize is the default buffer_size of an event listener pool.
+	DefaultBufferSize int = 10
+
+	// DefaultPoolTimeout is how long an EventPool waits on the listener by default.
+	DefaultPoolTimeout time.Duration = 5 * time.Second
+)
+
+// PoolEvent is an event sent to a listener. Body is everything after the header: the event's
+// metadata tokens, optionally followed by a newline and the event data. The serials are assigned
+// when the event is emitted to a pool.
+type PoolEvent struct {
+	Name       string
+	Body       string
+	Serial     int
+	PoolSerial int
+}
+
+func (event PoolEvent) String() string {
+	return fmt.Sprintf("%s(serial:%d poolserial:%d)", event.Name, event.Serial, event.PoolSerial)
+}
+
+// TransitionEvent returns the PROCESS_STATE event supervisord emits for a transition.
+func TransitionEvent(transition Transition) PoolEvent {
+	body := fmt.Sprintf("processname:%s groupname:%s from_state:%s", transition.Name, transition.Group, transition.From)
+	switch transition.To {
+	case Starting, Backoff:
+		body += fmt.Sprintf(" tries:%d", transition.Tries)
+	case Exited:
+		expected := 0
+		if transition.Expected {
+			expected = 1
+		}
+		body += fmt.Sprintf(" expected:%d pid:%d", expected, transition.PID)
+	case Running, Stopping, Stopped:
+		body += fmt.Sprintf(" pid:%d", transition.PID)
+	}
+	return PoolEvent{Name: "PROCESS_STATE_" + transition.To, Body: body}
+}
+
+// LogEvent returns the PROCESS_LOG event supervisord emits for process output. The name is given
+// as group:name or name.
+func LogEvent(name string, pid int, stderr bool, data string) PoolEvent {
+	group, name := splitName(name)
+	channel := "stdout"
+	if stderr {
+		channel = "stderr"
+	}
+	return PoolEvent{
+		Name: "PROCESS_LOG_" + strings.ToUpper(channel),
+		Body: fmt.Sprintf("processname:%s groupname:%s pid:%d channel:%s\n%s", name, group, pid, channel, data),
+	}
+}
+
+// TickEvent returns the TICK event supervisord emits for a period of 5, 60 or 3600 seconds.
+func TickEvent(period int, now time.Time) PoolEvent {
+	when := now.Unix()
+	return PoolEvent{
+		Name: fmt.Sprintf("TICK_%d", period),
+		Body: fmt.Sprintf("when:%d", when-when%int64(period)),
+	}
+}
+
+// SupervisorStateEvent returns the SUPERVISOR_STATE_CHANGE event for a Supervisor state.
+func SupervisorStateEvent(state string) PoolEvent {
+	return PoolEvent{Name: "SUPERVISOR_STATE_CHANGE_" + state}
+}
+
+// Delivery is the result of sending an event to the listener.
+type Delivery struct {
+	Event   PoolEvent
+	Result  string
+	Attempt int
+}
+
+// Ok returns true if the listener accepted the event.
+func (delivery Delivery) Ok() bool {
+	return delivery.Result == "OK"
+}
+
+// ProtocolError is returned when the listener writes something supervisord does not expect in its
+// current state. Supervisord moves such a listener to the UNKNOWN state and sends it no more events.
+type ProtocolError struct {
+	State string
+	Data  string
+}
+
+func (err ProtocolError) Error() string {
+	return fmt.Sprintf("listener sent unexpected data in %s state: %q", err.State, err.Data)
+}
+
+// token is a line written by the listener, along with the payload when it is a RESULT line.
+type token struct {
+	line    string
+	payload string
+	result  bool
+}
+
+// EventPool plays supervisord's side of the event listener protocol for a single listener process.
+// The listener reads events from Stdin and writes to Stdout. Events are emitted into a buffer and
+// dispatched to the listener one at a time once it is READY. Events the listener rejects are put
+// back at the head of the buffer and sent again with the same serials, as supervisord does.
+type EventPool struct {
+	Name       string
+	Identifier string
+	BufferSize int
+	Timeout    time.Duration
+
+	stdin        *io.PipeReader
+	stdinWriter  *io.PipeWriter
+	stdout       *io.PipeWriter
+	stdoutReader *io.PipeReader
+	tokens       chan token
+
+	lock       *sync.Mutex
+	state      string
+	serial     int
+	poolSerial int
+	buffer     []PoolEvent
+	attempts   map[int]int
+	deliveries []Delivery
+	discarded  []PoolEvent
+	violations []error
+}
+
+// NewEventPool creates a pool with the given name and supervisord's defaults. The listener starts
+// in the ACKNOWLEDGED state and must write READY before it is sent an event.
+func NewEventPool(name string) *EventPool {
+	pool := &EventPool{
+		Name:       name,
+		Identifier: "supervisor",
+		BufferSize: DefaultBufferSize,
+		Timeout:    DefaultPoolTimeout,
+		tokens:     make(chan token, 16),
+		lock:       &sync.Mutex{},
+		state:      ListenerAcknowledged,
+		serial:     -1,
+		poolSerial: -1,
+		attempts:   make(map[int]int),
+	}
+	pool.stdin, pool.stdinWriter = io.Pipe()
+	pool.stdoutReader, pool.stdout = io.Pipe()
+	go pool.read()
+	return pool
+}
+
+// Stdin returns the stream the listener reads events from.
+func (pool *EventPool) Stdin() io.Reader {
+	return pool.stdin
+}
+
+// Stdout returns the stream the listener writes its state and results to.
+func (pool *EventPool) Stdout() io.Writer {
+	return pool.stdout
+}
+
+// Close closes the listener's streams. The listener reads EOF from Stdin.
+func (pool *EventPool) Close() {
+	pool.stdinWriter.Close()
+	pool.stdoutReader.Close()
+}
+
+// read splits the listener's output into tokens until it is closed.
+func (pool *EventPool) read() {
+	defer close(pool.tokens)
+	reader := bufio.NewReader(pool.stdoutReader)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			tok := token{line: line}
+			if strings.HasPrefix(line, "RESULT ") && err == nil {
+				if length, convErr := strconv.Atoi(strings.TrimSpace(line[7:])); convErr == nil && length >= 0 {
+					payload := make([]byte, length)
+					_, err = io.ReadFull(reader, payload)
+					tok.payload = string(payload)
+					tok.result = true
+				}
+			}
+			pool.tokens <- tok
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// next waits for the next token from the listener.
+func (pool *EventPool) next() (token, error) {
+	select {
+	case tok, ok := <-pool.tokens:
+		if !ok {
+			return tok, io.EOF
+		}
+		return tok, nil
+	case <-time.After(pool.Timeout):
+		return token{}, errors.New(fmt.Sprintf("listener did not respond within %s", pool.Timeout))
+	}
+}
+
+// write sends data to the listener.
+func (pool *EventPool) write(data string) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.WriteString(pool.stdinWriter, data)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(pool.Timeout):
+		return errors.New(fmt.Sprintf("listener did not read the event within %s", pool.Timeout))
+	}
+}
+
+// violation moves the listener to the UNKNOWN state and records the error. The lock must be held.
+func (pool *EventPool) violation(state string, data string) error {
+	err := ProtocolError{state, data}
+	pool.state = ListenerUnknown
+	pool.violations = append(pool.violations, err)
+	return err
+}
+
+// accept adds an event to the buffer, discarding the oldest event if the buffer is full. The lock
+// must be held.
+func (pool *EventPool) accept(event PoolEvent, head bool) {
+	if len(pool.buffer) >= pool.BufferSize && len(pool.buffer) > 0 {
+		pool.discarded = append(pool.discarded, pool.buffer[0])
+		pool.buffer = pool.buffer[1:]
+	}
+	if head {
+		pool.buffer = append([]PoolEvent{event}, pool.buffer...)
+	} else {
+		pool.buffer = append(pool.buffer, event)
+	}
+}
+
+// Emit assigns serials to events and adds them to the buffer. The events are returned with their
+// serials. The oldest buffered events are discarded when the buffer overflows.
+func (pool *EventPool) Emit(events ...PoolEvent) []PoolEvent {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	emitted := make([]PoolEvent, len(events))
+	for i, event := range events {
+		pool.serial++
+		pool.poolSerial++
+		event.Serial = pool.serial
+		event.PoolSerial = pool.poolSerial
+		pool.accept(event, false)
+		emitted[i] = event
+	}
+	return emitted
+}
+
+// Skip advances the global serial as if n events had been emitted to other pools. Supervisord
+// shares the global serial between pools, so a listener sees gaps in the serial but not in the
+// pool serial.
+func (pool *EventPool) Skip(n int) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	pool.serial += n
+}
+
+// Dispatch waits for the listener to be READY, sends it the event at the head of the buffer and
+// reads the result. An event which is not accepted with OK is rebuffered. An error is returned if
+// the buffer is empty, the listener violates the protocol, times out or closes its stdout.
+func (pool *EventPool) Dispatch() (delivery Delivery, err error) {
+	pool.lock.Lock()
+	if pool.state == ListenerUnknown {
+		pool.lock.Unlock()
+		return delivery, errors.New("listener is in the UNKNOWN state")
+	}
+	if len(pool.buffer) == 0 {
+		pool.lock.Unlock()
+		return delivery, errors.New("no events buffered")
+	}
+	event := pool.buffer[0]
+	pool.buffer = pool.buffer[1:]
+	state := pool.state
+	pool.lock.Unlock()
+
+	rebuffer := func() {
+		pool.lock.Lock()
+		pool.accept(event, true)
+		pool.lock.Unlock()
+	}
+
+	if state == ListenerAcknowledged {
+		tok, err := pool.next()
+		if err != nil {
+			rebuffer()
+			return delivery, err
+		}
+		pool.lock.Lock()
+		if tok.line != "READY\n" {
+			err = pool.violation(state, tok.line+tok.payload)
+			pool.accept(event, true)
+			pool.lock.Unlock()
+			return delivery, err
+		}
+		pool.state = ListenerReady
+		pool.lock.Unlock()
+	}
+
+	header := fmt.Sprintf("ver:%s server:%s serial:%d pool:%s poolserial:%d eventname:%s len:%d\n",
+		apiVersion, pool.Identifier, event.Serial, pool.Name, event.PoolSerial, event.Name, len(event.Body))
+	if err = pool.write(header + event.Body); err != nil {
+		rebuffer()
+		return
+	}
+	pool.lock.Lock()
+	pool.state = ListenerBusy
+	pool.lock.Unlock()
+
+	tok, err := pool.next()
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	switch {
+	case err != nil:
+		pool.accept(event, true)
+		return
+	case !tok.result:
+		err = pool.violation(ListenerBusy, tok.line)
+		pool.accept(event, true)
+		return
+	}
+
+	pool.attempts[event.Serial]++
+	delivery = Delivery{event, tok.payload, pool.attempts[event.Serial]}
+	pool.deliveries = append(pool.deliveries, delivery)
+	pool.state = ListenerAcknowledged
+	if !delivery.Ok() {
+		pool.accept(event, true)
+	}
+	return
+}
+
+// Send emits an event and dispatches the event at the head of the buffer, which is the emitted
+// event when nothing else is buffered.
+func (pool *EventPool) Send(event PoolEvent) (Delivery, error) {
+	pool.Emit(event)
+	return pool.Dispatch()
+}
+
+// Drain dispatches buffered events until the buffer is empty or limit events have been dispatched.
+// A limit of zero or less dispatches until the buffer is empty, which never happens if the listener
+// keeps rejecting an event.
+func (pool *EventPool) Drain(limit int) (deliveries []Delivery, err error) {
+	for limit <= 0 || len(deliveries) < limit {
+		if pool.Buffered() == 0 {
+			return
+		}
+		var delivery Delivery
+		if delivery, err = pool.Dispatch(); err != nil {
+			return
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return
+}
+
+// State returns the state of the listener as tracked by the pool.
+func (pool *EventPool) State() string {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	return pool.state
+}
+
+// Buffered returns the number of events waiting to be dispatched.
+func (pool *EventPool) Buffered() int {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	return len(pool.buffer)
+}
+
+// Deliveries returns every delivery made to the listener in order.
+func (pool *EventPool) Deliveries() []Delivery {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	return append([]Delivery{}, pool.deliveries...)
+}
+
+// Discarded returns the events discarded because the buffer overflowed.
+func (pool *EventPool) Discarded() []PoolEvent {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	return append([]PoolEvent{}, pool.discarded...)
+}
+
+// Violations returns the protocol violations committed by the listener.
+func (pool *EventPool) Violations() []error {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	return append([]error{}, pool.violations...)
+}
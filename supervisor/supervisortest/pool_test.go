@@ -0,0 +1,154 @@
+package supervisortest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Read an event from the pool as a listener and return the raw header and body.
+func readEvent(reader *bufio.Reader) (string, string, error) {
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return "", "", err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(header[strings.LastIndex(header, "len:")+4:]))
+	if err != nil {
+		return "", "", err
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(reader, body)
+	return header, string(body), err
+}
+
+// Test the events written to the listener.
+func TestEventPoolDispatch(t *testing.T) {
+	pool := NewEventPool("memmon")
+	defer pool.Close()
+	reader := bufio.NewReader(pool.Stdin())
+
+	results := []string{"OK", "FAIL", "OK"}
+	received := make(chan string, 3)
+	go func() {
+		io.WriteString(pool.Stdout(), "READY\n")
+		for _, result := range results {
+			header, body, err := readEvent(reader)
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- header + body
+			fmt.Fprintf(pool.Stdout(), "RESULT %d\n%sREADY\n", len(result), result)
+		}
+	}()
+
+	pool.Skip(2)
+	transition := Transition{Group: "web", Name: "api", From: Running, To: Exited, PID: 7, Expected: false}
+	pool.Emit(TransitionEvent(transition), TickEvent(60, time.Unix(130, 0)))
+	deliveries, err := pool.Drain(3)
+	if err != nil || len(deliveries) != 3 {
+		t.Fatalf(`EventPool.Drain(3) => %v, error{"%v"}, want 3 deliveries`, deliveries, err)
+	}
+
+	want := []string{
+		"ver:3.0 server:supervisor serial:2 pool:memmon poolserial:0 eventname:PROCESS_STATE_EXITED len:65\n" +
+			"processname:api groupname:web from_state:RUNNING expected:0 pid:7",
+		"ver:3.0 server:supervisor serial:3 pool:memmon poolserial:1 eventname:TICK_60 len:8\nwhen:120",
+		"ver:3.0 server:supervisor serial:3 pool:memmon poolserial:1 eventname:TICK_60 len:8\nwhen:120",
+	}
+	for i := range want {
+		if got := <-received; got != want[i] {
+			t.Errorf("event %d =>\n%q\nwant\n%q", i, got, want[i])
+		}
+	}
+	var got []string
+	for _, delivery := range deliveries {
+		got = append(got, fmt.Sprintf("%d:%s:%d", delivery.Event.Serial, delivery.Result, delivery.Attempt))
+	}
+	if want := []string{"2:OK:1", "3:FAIL:1", "3:OK:2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`EventPool.Drain(3) => %v, want %v`, got, want)
+	}
+	if state := pool.State(); state != ListenerAcknowledged {
+		t.Errorf(`EventPool.State() => %s, want ACKNOWLEDGED`, state)
+	}
+	if _, err := pool.Dispatch(); err == nil {
+		t.Errorf(`EventPool.Dispatch() with an empty buffer => nil, want error`)
+	}
+}
+
+// Test that protocol violations move the listener to the UNKNOWN state.
+func TestEventPoolViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		listen func(pool *EventPool, reader *bufio.Reader)
+		want   ProtocolError
+	}{
+		{
+			"output before READY",
+			func(pool *EventPool, reader *bufio.Reader) {
+				io.WriteString(pool.Stdout(), "starting up\n")
+			},
+			ProtocolError{ListenerAcknowledged, "starting up\n"},
+		},
+		{
+			"READY instead of RESULT",
+			func(pool *EventPool, reader *bufio.Reader) {
+				io.WriteString(pool.Stdout(), "READY\n")
+				readEvent(reader)
+				io.WriteString(pool.Stdout(), "READY\n")
+			},
+			ProtocolError{ListenerBusy, "READY\n"},
+		},
+		{
+			"bad result length",
+			func(pool *EventPool, reader *bufio.Reader) {
+				io.WriteString(pool.Stdout(), "READY\n")
+				readEvent(reader)
+				io.WriteString(pool.Stdout(), "RESULT two\nOK")
+			},
+			ProtocolError{ListenerBusy, "RESULT two\n"},
+		},
+	}
+	for _, test := range tests {
+		pool := NewEventPool("listener")
+		go test.listen(pool, bufio.NewReader(pool.Stdin()))
+		_, err := pool.Send(SupervisorStateEvent("RUNNING"))
+		if err != test.want {
+			t.Errorf(`%s: EventPool.Send() => error{"%v"}, want error{"%v"}`, test.name, err, test.want)
+		}
+		if state := pool.State(); state != ListenerUnknown || pool.Buffered() != 1 {
+			t.Errorf(`%s: EventPool.State() => %s with %d buffered, want UNKNOWN with 1 buffered`, test.name, state, pool.Buffered())
+		}
+		if _, err := pool.Dispatch(); err == nil {
+			t.Errorf(`%s: EventPool.Dispatch() in UNKNOWN state => nil, want error`, test.name)
+		}
+		if violations := pool.Violations(); len(violations) != 1 {
+			t.Errorf(`%s: EventPool.Violations() => %v, want 1 violation`, test.name, violations)
+		}
+		pool.Close()
+	}
+}
+
+// Test buffer overflow and timeouts.
+func TestEventPoolOverflow(t *testing.T) {
+	pool := NewEventPool("listener")
+	defer pool.Close()
+	pool.BufferSize = 2
+	pool.Timeout = 10 * time.Millisecond
+
+	pool.Emit(SupervisorStateEvent("RUNNING"), TickEvent(5, time.Unix(5, 0)), TickEvent(5, time.Unix(10, 0)))
+	if discarded := pool.Discarded(); len(discarded) != 1 || discarded[0].Serial != 0 {
+		t.Errorf(`EventPool.Discarded() => %v, want serial 0`, discarded)
+	}
+	if _, err := pool.Dispatch(); err == nil {
+		t.Errorf(`EventPool.Dispatch() without READY => nil, want timeout`)
+	}
+	if pool.Buffered() != 2 || pool.State() != ListenerAcknowledged {
+		t.Errorf(`EventPool after timeout => %d buffered in %s, want 2 in ACKNOWLEDGED`, pool.Buffered(), pool.State())
+	}
+}
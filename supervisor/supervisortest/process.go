@@ -0,0 +1,354 @@
+package supervisortest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Process states.
+const (
+	Stopped  string = "STOPPED"
+	Starting string = "STARTING"
+	Running  string = "RUNNING"
+	Backoff  string = "BACKOFF"
+	Stopping string = "STOPPING"
+	Exited   string = "EXITED"
+	Fatal    string = "FATAL"
+	Unknown  string = "UNKNOWN"
+)
+
+var (
+	stateCodes map[string]int = map[string]int{
+		Stopped:  0,
+		Starting: 10,
+		Running:  20,
+		Backoff:  30,
+		Stopping: 40,
+		Exited:   100,
+		Fatal:    200,
+		Unknown:  1000,
+	}
+)
+
+// isRunningState returns true for the states in which Supervisor considers a process started.
+func isRunningState(state string) bool {
+	return state == Running || state == Starting || state == Backoff
+}
+
+// splitName returns the group and name of a process given as group:name or name.
+func splitName(name string) (string, string) {
+	if i := strings.Index(name, ":"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, name
+}
+
+// Program configures a simulated program. The first group of fields mirror the options of a
+// [program:x] section. The remaining fields control how the simulated process behaves.
+type Program struct {
+	Name          string
+	Group         string
+	Command       string
+	Priority      int
+	AutoStart     bool
+	AutoRestart   string // false, true or unexpected
+	StartSecs     time.Duration
+	StartRetries  int
+	ExitCodes     []int
+	StdoutLogfile string
+	StderrLogfile string
+
+	SpawnError string        // spawning fails with this error when not empty
+	ExitAfter  time.Duration // the process exits on its own this long after it is spawned
+	ExitCode   int           // the exit status used with ExitAfter
+	StopDelay  time.Duration // how long the process takes to exit once stopped
+	Backoff    time.Duration // the nth retry of a failed start waits n times this long
+}
+
+// NewProgram creates a program with Supervisor's defaults. The name is given as group:name or name,
+// in which case the group has the same name. Unlike Supervisor the program does not auto start and
+// is RUNNING as soon as it is spawned.
+func NewProgram(name string) Program {
+	group, name := splitName(name)
+	return Program{
+		Name:          name,
+		Group:         group,
+		Command:       "/bin/" + name,
+		Priority:      999,
+		AutoRestart:   "unexpected",
+		StartRetries:  3,
+		ExitCodes:     []int{0},
+		StdoutLogfile: fmt.Sprintf("/var/log/supervisor/%s-stdout.log", name),
+		StderrLogfile: fmt.Sprintf("/var/log/supervisor/%s-stderr.log", name),
+	}
+}
+
+// Programs creates programs with NewProgram for each name.
+func Programs(names ...string) []Program {
+	programs := make([]Program, len(names))
+	for i, name := range names {
+		programs[i] = NewProgram(name)
+	}
+	return programs
+}
+
+// key returns the group:name of the program.
+func (program Program) key() string {
+	return program.Group + ":" + program.Name
+}
+
+// expected returns true if the exit code is one of the program's expected exit codes.
+func (program Program) expected(code int) bool {
+	for _, exitCode := range program.ExitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition records a change in the state of a process.
+type Transition struct {
+	Time     time.Time
+	Group    string
+	Name     string
+	From     string
+	To       string
+	PID      int
+	Expected bool
+	Tries    int
+}
+
+func (transition Transition) String() string {
+	return fmt.Sprintf("%s:%s %s -> %s", transition.Group, transition.Name, transition.From, transition.To)
+}
+
+// process is the simulated state of a program.
+type process struct {
+	program    Program
+	state      string
+	pid        int
+	start      time.Time
+	stop       time.Time
+	exitStatus int
+	expected   bool
+	spawnErr   string
+	backoff    int
+	spawns     int
+	ran        int // the last spawn which reached RUNNING
+	stdout     []byte
+	stderr     []byte
+}
+
+func newProcess(program Program) *process {
+	return &process{program: program, state: Stopped}
+}
+
+// description returns the description shown by supervisorctl status.
+func (proc *process) description(now time.Time) string {
+	switch proc.state {
+	case Running:
+		seconds := int64(now.Sub(proc.start) / time.Second)
+		uptime := fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+		if days := seconds / 86400; days > 0 {
+			uptime = fmt.Sprintf("%d days, %d:%02d:%02d", days, seconds%86400/3600, seconds%3600/60, seconds%60)
+		}
+		return fmt.Sprintf("pid %d, uptime %s", proc.pid, uptime)
+	case Backoff, Fatal:
+		return proc.spawnErr
+	case Stopped, Exited:
+		if proc.stop.IsZero() {
+			return "Not started"
+		}
+		return proc.stop.Format("Jan 02 03:04 PM")
+	}
+	return ""
+}
+
+// info returns the process info struct returned by getProcessInfo.
+func (proc *process) info(now time.Time) map[string]interface{} {
+	unix := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.Unix()
+	}
+	return map[string]interface{}{
+		"name":           proc.program.Name,
+		"group":          proc.program.Group,
+		"description":    proc.description(now),
+		"start":          unix(proc.start),
+		"stop":           unix(proc.stop),
+		"now":            now.Unix(),
+		"state":          stateCodes[proc.state],
+		"statename":      proc.state,
+		"spawnerr":       proc.spawnErr,
+		"exitstatus":     proc.exitStatus,
+		"logfile":        proc.program.StdoutLogfile,
+		"stdout_logfile": proc.program.StdoutLogfile,
+		"stderr_logfile": proc.program.StderrLogfile,
+		"pid":            proc.pid,
+	}
+}
+
+// The methods below implement the process state machine. They must be called with the server lock
+// held. Timers check the spawn count so that they have no effect once the process has moved on.
+
+// change moves a process to a new state and records the transition.
+func (server *Server) change(proc *process, state string) {
+	from := proc.state
+	proc.state = state
+	server.transitions = append(server.transitions, Transition{
+		server.now(), proc.program.Group, proc.program.Name, from, state, proc.pid, proc.expected, proc.backoff,
+	})
+	server.cond.Broadcast()
+}
+
+// after runs a function with the lock held once the delay has passed, unless the process has been
+// spawned again, removed or the server closed in the meantime.
+func (server *Server) after(proc *process, delay time.Duration, run func()) {
+	spawns := proc.spawns
+	time.AfterFunc(delay, func() {
+		server.lock.Lock()
+		defer server.lock.Unlock()
+		if !server.closed && proc.spawns == spawns && server.processes[proc.program.key()] == proc {
+			run()
+		}
+	})
+}
+
+// spawn starts a process.
+func (server *Server) spawn(proc *process) {
+	program := proc.program
+	proc.spawns++
+	proc.expected = false
+	if program.SpawnError != "" {
+		server.change(proc, Starting)
+		proc.spawnErr = program.SpawnError
+		server.logf("spawnerr: %s", program.SpawnError)
+		proc.backoff++
+		server.change(proc, Backoff)
+		server.retry(proc)
+		return
+	}
+
+	proc.spawnErr = ""
+	proc.pid = server.nextPID
+	server.nextPID++
+	proc.start = server.now()
+	server.logf("spawned: '%s' with pid %d", program.Name, proc.pid)
+	server.change(proc, Starting)
+
+	if program.ExitAfter > 0 {
+		server.after(proc, program.ExitAfter, func() {
+			server.exit(proc, program.ExitCode)
+		})
+	}
+	if program.StartSecs <= 0 {
+		server.running(proc)
+	} else {
+		server.after(proc, program.StartSecs, func() {
+			if proc.state == Starting {
+				server.running(proc)
+			}
+		})
+	}
+}
+
+// running moves a process which has stayed up for StartSecs to RUNNING.
+func (server *Server) running(proc *process) {
+	proc.backoff = 0
+	proc.ran = proc.spawns
+	server.logf("success: %s entered RUNNING state, process has stayed up for > than %d seconds (startsecs)",
+		proc.program.Name, int(proc.program.StartSecs/time.Second))
+	server.change(proc, Running)
+}
+
+// retry schedules a process in BACKOFF to be spawned again or gives up.
+func (server *Server) retry(proc *process) {
+	if proc.backoff > proc.program.StartRetries {
+		server.logf("gave up: %s entered FATAL state, too many start retries too quickly", proc.program.Name)
+		server.change(proc, Fatal)
+		return
+	}
+	server.after(proc, time.Duration(proc.backoff)*proc.program.Backoff, func() {
+		if proc.state == Backoff {
+			server.spawn(proc)
+		}
+	})
+}
+
+// exit handles a process exiting with the given status.
+func (server *Server) exit(proc *process, code int) {
+	program := proc.program
+	proc.exitStatus = code
+	proc.stop = server.now()
+	switch proc.state {
+	case Starting:
+		proc.expected = false
+		proc.backoff++
+		proc.spawnErr = "Exited too quickly (process log may have details)"
+		server.logf("exited: %s (exit status %d; not expected)", program.Name, code)
+		proc.pid = 0
+		server.change(proc, Backoff)
+		server.retry(proc)
+	case Running:
+		proc.expected = program.expected(code)
+		if proc.expected {
+			server.logf("exited: %s (exit status %d; expected)", program.Name, code)
+		} else {
+			server.logf("exited: %s (exit status %d; not expected)", program.Name, code)
+		}
+		server.change(proc, Exited)
+		proc.pid = 0
+		if program.AutoRestart == "true" || (program.AutoRestart == "unexpected" && !proc.expected) {
+			server.spawn(proc)
+		}
+	case Stopping:
+		server.logf("stopped: %s (terminated by SIGTERM)", program.Name)
+		server.change(proc, Stopped)
+		proc.pid = 0
+	}
+}
+
+// halt stops a process in one of the running states.
+func (server *Server) halt(proc *process) {
+	if proc.state == Backoff {
+		server.change(proc, Stopped)
+		return
+	}
+	server.logf("waiting for %s to stop", proc.program.Name)
+	server.change(proc, Stopping)
+	if proc.program.StopDelay <= 0 {
+		server.exit(proc, -1)
+	} else {
+		server.after(proc, proc.program.StopDelay, func() {
+			server.exit(proc, -1)
+		})
+	}
+}
+
+// waitStarted waits for a spawned process to leave the STARTING state and returns the fault
+// startProcess should return.
+func (server *Server) waitStarted(proc *process, name string) error {
+	spawns := proc.spawns
+	for proc.state == Starting && proc.spawns == spawns && !server.closed {
+		server.cond.Wait()
+	}
+	switch {
+	case proc.ran >= spawns:
+		return nil
+	case proc.spawns != spawns || proc.state == Backoff || proc.state == Fatal:
+		// the process exited too quickly and was moved to BACKOFF
+		return newFault("SPAWN_ERROR", name)
+	}
+	return newFault("ABNORMAL_TERMINATION", name)
+}
+
+// waitStopped waits for a stopping process to stop.
+func (server *Server) waitStopped(proc *process) {
+	for proc.state == Stopping && !server.closed {
+		server.cond.Wait()
+	}
+}
@@ -0,0 +1,571 @@
+// Package supervisortest provides a fake supervisord for tests. Server answers the supervisor.* and
+// system.* XML-RPC methods and the log tail HTTP endpoints from a simulated process table. Processes
+// move through Supervisor's states as supervisord would move them: a spawned process is STARTING
+// until it has stayed up for StartSecs, moves to BACKOFF when it exits too quickly, and ends in FATAL
+// once its start retries are used up. Faults and latency may be injected per method.
+//
+// EventPool plays supervisord's side of the event listener protocol so listeners can be tested
+// without a running supervisord.
+package supervisortest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiVersion        string = "3.0"
+	supervisorVersion string = "4.2.5"
+
+	// Supervisor states.
+	moodRunning    string = "RUNNING"
+	moodRestarting string = "RESTARTING"
+	moodShutdown   string = "SHUTDOWN"
+
+	// bytes sent when a log tail is opened
+	tailBytes int = 1024
+)
+
+var (
+	moodCodes map[string]int = map[string]int{
+		"FATAL":        2,
+		moodRunning:    1,
+		moodRestarting: 0,
+		moodShutdown:   -1,
+	}
+
+	// interval at which followed logs are checked for new data
+	tailInterval time.Duration = 10 * time.Millisecond
+)
+
+// Call is an XML-RPC call received by a Server.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+func (call Call) String() string {
+	parts := []string{call.Method}
+	for _, arg := range call.Args {
+		parts = append(parts, fmt.Sprint(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// injection is a fault returned in place of calling a method.
+type injection struct {
+	fault string
+	count int
+}
+
+// Server is a fake supervisord listening on a local address.
+type Server struct {
+	URL            string
+	http           *httptest.Server
+	done           chan bool
+	lock           sync.Mutex
+	cond           *sync.Cond
+	closed         bool
+	mood           string
+	identification string
+	username       string
+	password       string
+	config         []Program
+	processes      map[string]*process
+	nextPID        int
+	mainLog        []byte
+	transitions    []Transition
+	calls          []Call
+	faults         map[string]*injection
+	latency        map[string]time.Duration
+	now            func() time.Time
+}
+
+// newServer creates a server which has not been started.
+func newServer(programs []Program) *Server {
+	server := &Server{
+		done:           make(chan bool),
+		mood:           moodRunning,
+		identification: "supervisor",
+		processes:      make(map[string]*process),
+		nextPID:        100,
+		faults:         make(map[string]*injection),
+		latency:        make(map[string]time.Duration),
+		now:            time.Now,
+	}
+	server.cond = sync.NewCond(&server.lock)
+	server.config = append([]Program{}, programs...)
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.load()
+	return server
+}
+
+// NewServer starts a fake supervisord on a loopback address with the given programs. URL is set to
+// its RPC URL. Programs with AutoStart set are spawned.
+func NewServer(programs ...Program) *Server {
+	server := newServer(programs)
+	server.http = httptest.NewServer(server)
+	server.URL = server.http.URL + "/RPC2"
+	return server
+}
+
+// NewUnixServer starts a fake supervisord on a unix socket at the given path. URL is set to a
+// unix:// URL as used in the supervisorctl section of supervisord.conf.
+func NewUnixServer(path string, programs ...Program) (*Server, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	server := newServer(programs)
+	server.http = httptest.NewUnstartedServer(server)
+	server.http.Listener.Close()
+	server.http.Listener = listener
+	server.http.Start()
+	server.URL = "unix://" + path
+	return server, nil
+}
+
+// Close shuts down the server. Calls waiting on a process and log tails are ended.
+func (server *Server) Close() {
+	server.lock.Lock()
+	if server.closed {
+		server.lock.Unlock()
+		return
+	}
+	server.closed = true
+	close(server.done)
+	server.cond.Broadcast()
+	server.lock.Unlock()
+	server.http.Close()
+}
+
+// load replaces the process table with the configured programs and spawns those which auto start.
+// The lock must be held.
+func (server *Server) load() {
+	server.processes = make(map[string]*process)
+	for _, program := range server.config {
+		server.processes[program.key()] = newProcess(program)
+	}
+	for _, proc := range server.sorted("") {
+		if proc.program.AutoStart {
+			server.spawn(proc)
+		}
+	}
+}
+
+// sorted returns the processes in a group, or all processes if group is empty, in priority order.
+// The lock must be held.
+func (server *Server) sorted(group string) []*process {
+	var procs []*process
+	for _, proc := range server.processes {
+		if group == "" || proc.program.Group == group {
+			procs = append(procs, proc)
+		}
+	}
+	sort.Slice(procs, func(i, j int) bool {
+		a, b := procs[i].program, procs[j].program
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.key() < b.key()
+	})
+	return procs
+}
+
+// lookup finds a process by group:name or name. The lock must be held.
+func (server *Server) lookup(name string) (*process, error) {
+	group, short := splitName(name)
+	if proc, ok := server.processes[group+":"+short]; ok {
+		return proc, nil
+	}
+	return nil, newFault("BAD_NAME", name)
+}
+
+// logf writes a line to the main log. The lock must be held.
+func (server *Server) logf(format string, args ...interface{}) {
+	now := server.now()
+	line := fmt.Sprintf("%s,%03d INFO %s\n", now.Format("2006-01-02 15:04:05"), now.Nanosecond()/int(time.Millisecond), fmt.Sprintf(format, args...))
+	server.mainLog = append(server.mainLog, line...)
+}
+
+// Configure replaces the configuration Supervisor would read from disk. The running processes are
+// not changed until the configuration is reloaded and process groups are added or removed.
+func (server *Server) Configure(programs ...Program) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.config = append([]Program{}, programs...)
+}
+
+// changes compares the configuration to the running process groups. The lock must be held.
+func (server *Server) changes() (added []string, changed []string, removed []string) {
+	configured := make(map[string][]Program)
+	for _, program := range server.config {
+		configured[program.Group] = append(configured[program.Group], program)
+	}
+	running := make(map[string][]Program)
+	for _, proc := range server.processes {
+		running[proc.program.Group] = append(running[proc.program.Group], proc.program)
+	}
+	byKey := func(programs []Program) []Program {
+		sort.Slice(programs, func(i, j int) bool { return programs[i].key() < programs[j].key() })
+		return programs
+	}
+
+	for group, programs := range configured {
+		if current, ok := running[group]; !ok {
+			added = append(added, group)
+		} else if !reflect.DeepEqual(byKey(programs), byKey(current)) {
+			changed = append(changed, group)
+		}
+	}
+	for group := range running {
+		if _, ok := configured[group]; !ok {
+			removed = append(removed, group)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return
+}
+
+// State returns the state of a process or an empty string if it does not exist.
+func (server *Server) State(name string) string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if proc, err := server.lookup(name); err == nil {
+		return proc.state
+	}
+	return ""
+}
+
+// WaitState waits for a process to reach a state. False is returned if it does not do so within the
+// timeout.
+func (server *Server) WaitState(name string, state string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for server.State(name) != state {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+// SetState forces a process into a state without going through the state machine. A pid is
+// assigned when the state has a running process.
+func (server *Server) SetState(name string, state string) error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	proc, err := server.lookup(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := stateCodes[state]; !ok {
+		return errors.New("unknown state " + state)
+	}
+
+	// cancel pending timers
+	proc.spawns++
+	switch state {
+	case Starting, Running, Stopping:
+		if proc.pid == 0 {
+			proc.pid = server.nextPID
+			server.nextPID++
+			proc.start = server.now()
+		}
+		if state == Running {
+			proc.ran = proc.spawns
+		}
+	default:
+		if proc.pid != 0 {
+			proc.stop = server.now()
+		}
+		proc.pid = 0
+	}
+	server.change(proc, state)
+	return nil
+}
+
+// Exit makes a process exit with the given status as if it had terminated on its own.
+func (server *Server) Exit(name string, status int) error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	proc, err := server.lookup(name)
+	if err != nil {
+		return err
+	}
+	if proc.pid == 0 {
+		return newFault("NOT_RUNNING", name)
+	}
+	server.exit(proc, status)
+	return nil
+}
+
+// WriteLog appends output to the stdout or stderr log of a process.
+func (server *Server) WriteLog(name string, stderr bool, data string) error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	proc, err := server.lookup(name)
+	if err != nil {
+		return err
+	}
+	if stderr {
+		proc.stderr = append(proc.stderr, data...)
+	} else {
+		proc.stdout = append(proc.stdout, data...)
+	}
+	return nil
+}
+
+// Calls returns the XML-RPC calls received by the server in order. The calls made by a multicall
+// follow the multicall itself.
+func (server *Server) Calls() []Call {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return append([]Call{}, server.calls...)
+}
+
+// ResetCalls forgets the calls received so far.
+func (server *Server) ResetCalls() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.calls = nil
+}
+
+// Transitions returns the process state changes made so far in order.
+func (server *Server) Transitions() []Transition {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return append([]Transition{}, server.transitions...)
+}
+
+// SetFault makes a method return the named fault, such as FAILED, instead of being called. The fault
+// is returned for the next count calls or until it is cleared when count is zero or less. An empty
+// method applies to every method and an empty fault clears the method's fault.
+func (server *Server) SetFault(method string, fault string, count int) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if fault == "" {
+		delete(server.faults, method)
+		return
+	}
+	server.faults[method] = &injection{fault, count}
+}
+
+// SetLatency delays every call of a method by the given duration. An empty method applies to methods
+// which do not have their own latency.
+func (server *Server) SetLatency(method string, latency time.Duration) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.latency[method] = latency
+}
+
+// SetAuth requires requests to use basic authentication with the given credentials.
+func (server *Server) SetAuth(username string, password string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.username = username
+	server.password = password
+}
+
+// SetIdentification sets the identification returned by getIdentification.
+func (server *Server) SetIdentification(identification string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.identification = identification
+}
+
+// Call calls a method directly as if it had been received over XML-RPC. Faults are returned as a
+// Fault error.
+func (server *Server) Call(method string, args ...interface{}) (interface{}, error) {
+	return server.dispatch(method, args)
+}
+
+// injected returns the latency and injected fault of a method call and records the call.
+func (server *Server) injected(method string, args []interface{}) (time.Duration, error) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.calls = append(server.calls, Call{method, args})
+
+	latency, ok := server.latency[method]
+	if !ok {
+		latency = server.latency[""]
+	}
+	key := method
+	injected, ok := server.faults[key]
+	if !ok {
+		key = ""
+		injected, ok = server.faults[key]
+	}
+	if !ok {
+		return latency, nil
+	}
+	if injected.count > 0 {
+		if injected.count--; injected.count == 0 {
+			delete(server.faults, key)
+		}
+	}
+	return latency, newFault(injected.fault, method)
+}
+
+// dispatch calls a method after applying injected latency and faults.
+func (server *Server) dispatch(name string, args []interface{}) (interface{}, error) {
+	latency, err := server.injected(name, args)
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-server.done:
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	method, ok := methods[name]
+	if !ok {
+		return nil, newFault("UNKNOWN_METHOD", name)
+	}
+	if args, err = method.check(args); err != nil {
+		return nil, err
+	}
+	if method.unlocked {
+		return method.call(server, args)
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if strings.HasPrefix(name, "supervisor.") && server.mood != moodRunning {
+		return nil, newFault("SHUTDOWN_STATE", "")
+	}
+	return method.call(server, args)
+}
+
+func (server *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.lock.Lock()
+	username, password := server.username, server.password
+	server.lock.Unlock()
+	if username != "" || password != "" {
+		if user, pass, ok := request.BasicAuth(); !ok || user != username || pass != password {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="default"`)
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	path := request.URL.Path
+	switch {
+	case path == "/RPC2":
+		if request.Method != http.MethodPost {
+			http.Error(writer, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		server.serveRPC(writer, request)
+	case path == "/mainlogtail":
+		server.serveTail(writer, request, func() ([]byte, bool) {
+			return server.mainLog, true
+		})
+	case strings.HasPrefix(path, "/logtail/"):
+		name := strings.TrimPrefix(path, "/logtail/")
+		stderr := false
+		if strings.HasSuffix(name, "/stderr") {
+			name, stderr = strings.TrimSuffix(name, "/stderr"), true
+		} else {
+			name = strings.TrimSuffix(name, "/stdout")
+		}
+		server.lock.Lock()
+		proc, err := server.lookup(name)
+		server.lock.Unlock()
+		if err != nil {
+			http.Error(writer, "Not Found", http.StatusNotFound)
+			return
+		}
+		server.serveTail(writer, request, func() ([]byte, bool) {
+			if server.processes[proc.program.key()] != proc {
+				return nil, false
+			}
+			if stderr {
+				return proc.stderr, true
+			}
+			return proc.stdout, true
+		})
+	default:
+		http.Error(writer, "Not Found", http.StatusNotFound)
+	}
+}
+
+// serveRPC answers an XML-RPC request.
+func (server *Server) serveRPC(writer http.ResponseWriter, request *http.Request) {
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var result interface{}
+	method, args, err := decodeCall(body)
+	if err != nil {
+		err = newFault("INCORRECT_PARAMETERS", err.Error())
+	} else {
+		result, err = server.dispatch(method, args)
+	}
+	writer.Header().Set("Content-Type", "text/xml")
+	writer.Write(encodeResponse(result, err))
+}
+
+// serveTail streams a log as it grows. The read function is called with the lock held and returns
+// false when the log no longer exists.
+func (server *Server) serveTail(writer http.ResponseWriter, request *http.Request, read func() ([]byte, bool)) {
+	flusher, _ := writer.(http.Flusher)
+	writer.Header().Set("Content-Type", "text/plain;charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+
+	offset := -1
+	for {
+		server.lock.Lock()
+		data, ok := read()
+		var chunk []byte
+		if ok {
+			if offset < 0 {
+				if offset = len(data) - tailBytes; offset < 0 {
+					offset = 0
+				}
+			}
+			if len(data) < offset {
+				// the log was cleared
+				offset = 0
+			}
+			chunk = append(chunk, data[offset:]...)
+			offset = len(data)
+		}
+		server.lock.Unlock()
+		if !ok {
+			return
+		}
+		if len(chunk) > 0 {
+			if _, err := writer.Write(chunk); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		select {
+		case <-request.Context().Done():
+			return
+		case <-server.done:
+			return
+		case <-time.After(tailInterval):
+		}
+	}
+}
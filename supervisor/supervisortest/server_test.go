@@ -0,0 +1,123 @@
+package supervisortest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Return the transitions of a process as strings.
+func transitions(server *Server, name string) []string {
+	group, name := splitName(name)
+	var changes []string
+	for _, transition := range server.Transitions() {
+		if transition.Group == group && transition.Name == name {
+			changes = append(changes, transition.From+" -> "+transition.To)
+		}
+	}
+	return changes
+}
+
+// Test that a process which exits while starting backs off and then gives up.
+func TestBackoffFatal(t *testing.T) {
+	program := NewProgram("web:api")
+	program.StartSecs = time.Second
+	program.StartRetries = 2
+	program.ExitAfter = 5 * time.Millisecond
+	program.ExitCode = 1
+	server := NewServer(program)
+	defer server.Close()
+
+	if _, err := server.Call("supervisor.startProcess", "web:api", true); err == nil || err.(Fault).Name != "SPAWN_ERROR" {
+		t.Errorf(`supervisor.startProcess => error{"%v"}, want SPAWN_ERROR`, err)
+	}
+	if !server.WaitState("web:api", Fatal, time.Second) {
+		t.Fatalf(`state of web:api => %s, want FATAL`, server.State("web:api"))
+	}
+	want := []string{
+		"STOPPED -> STARTING",
+		"STARTING -> BACKOFF",
+		"BACKOFF -> STARTING",
+		"STARTING -> BACKOFF",
+		"BACKOFF -> STARTING",
+		"STARTING -> BACKOFF",
+		"BACKOFF -> FATAL",
+	}
+	if got := transitions(server, "web:api"); !reflect.DeepEqual(got, want) {
+		t.Errorf(`transitions => %q, want %q`, got, want)
+	}
+
+	info, err := server.Call("supervisor.getProcessInfo", "web:api")
+	if err != nil {
+		t.Fatalf(`supervisor.getProcessInfo => error{"%v"}, want nil`, err)
+	}
+	if info := info.(map[string]interface{}); info["pid"] != 0 || info["spawnerr"] == "" || info["state"] != 200 {
+		t.Errorf(`supervisor.getProcessInfo => %v, want FATAL with a spawn error`, info)
+	}
+}
+
+// Test restarting processes which exit according to autorestart and exitcodes.
+func TestAutoRestart(t *testing.T) {
+	server := NewServer(Programs("cron", "web:api")...)
+	defer server.Close()
+	server.SetState("cron", Running)
+	server.SetState("web:api", Running)
+
+	server.Exit("cron", 1)
+	if state := server.State("cron"); state != Running {
+		t.Errorf(`state of cron after unexpected exit => %s, want RUNNING`, state)
+	}
+	server.Exit("web:api", 0)
+	if state := server.State("web:api"); state != Exited {
+		t.Errorf(`state of web:api after expected exit => %s, want EXITED`, state)
+	}
+	want := []string{"RUNNING -> EXITED", "EXITED -> STARTING", "STARTING -> RUNNING"}
+	if got := transitions(server, "cron"); !reflect.DeepEqual(got[1:], want) {
+		t.Errorf(`transitions of cron => %q, want %q after RUNNING`, got, want)
+	}
+	if err := server.Exit("web:api", 0); err == nil {
+		t.Errorf(`Server.Exit() of an exited process => nil, want error`)
+	}
+}
+
+// Test injected faults, argument checking and multicall.
+func TestCalls(t *testing.T) {
+	server := NewServer(Programs("cron")...)
+	defer server.Close()
+
+	server.SetFault("supervisor.getState", "FAILED", 1)
+	if _, err := server.Call("supervisor.getState"); err == nil || err.(Fault).Code != 30 {
+		t.Errorf(`supervisor.getState => error{"%v"}, want injected FAILED`, err)
+	}
+	if _, err := server.Call("supervisor.getState"); err != nil {
+		t.Errorf(`supervisor.getState => error{"%v"}, want nil`, err)
+	}
+	if _, err := server.Call("supervisor.startProcess"); err == nil || err.(Fault).Name != "INCORRECT_PARAMETERS" {
+		t.Errorf(`supervisor.startProcess() => error{"%v"}, want INCORRECT_PARAMETERS`, err)
+	}
+	if _, err := server.Call("supervisor.explode"); err == nil || err.(Fault).Name != "UNKNOWN_METHOD" {
+		t.Errorf(`supervisor.explode() => error{"%v"}, want UNKNOWN_METHOD`, err)
+	}
+
+	result, err := server.Call("system.multicall", []interface{}{
+		map[string]interface{}{"methodName": "supervisor.startProcess", "params": []interface{}{"cron"}},
+		map[string]interface{}{"methodName": "supervisor.startProcess", "params": []interface{}{"cron"}},
+		map[string]interface{}{"methodName": "system.multicall", "params": []interface{}{}},
+	})
+	want := []interface{}{
+		[]interface{}{true},
+		map[string]interface{}{"faultCode": 60, "faultString": "ALREADY_STARTED: cron"},
+		map[string]interface{}{"faultCode": 2, "faultString": "INCORRECT_PARAMETERS: recursive system.multicall forbidden"},
+	}
+	if err != nil || !reflect.DeepEqual(result, want) {
+		t.Errorf(`system.multicall => %v, error{"%v"}, want %v`, result, err, want)
+	}
+
+	server.Call("supervisor.shutdown")
+	if _, err := server.Call("supervisor.getAllProcessInfo"); err == nil || err.(Fault).Name != "SHUTDOWN_STATE" {
+		t.Errorf(`supervisor.getAllProcessInfo after shutdown => error{"%v"}, want SHUTDOWN_STATE`, err)
+	}
+	if _, err := server.Call("system.listMethods"); err != nil {
+		t.Errorf(`system.listMethods after shutdown => error{"%v"}, want nil`, err)
+	}
+}
@@ -0,0 +1,248 @@
+package supervisortest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supervisor fault codes by name.
+var faultCodes map[string]int = map[string]int{
+	"UNKNOWN_METHOD":        1,
+	"INCORRECT_PARAMETERS":  2,
+	"BAD_ARGUMENTS":         3,
+	"SIGNATURE_UNSUPPORTED": 4,
+	"SHUTDOWN_STATE":        6,
+	"BAD_NAME":              10,
+	"BAD_SIGNAL":            11,
+	"NO_FILE":               20,
+	"NOT_EXECUTABLE":        21,
+	"FAILED":                30,
+	"ABNORMAL_TERMINATION":  40,
+	"SPAWN_ERROR":           50,
+	"ALREADY_STARTED":       60,
+	"NOT_RUNNING":           70,
+	"SUCCESS":               80,
+	"ALREADY_ADDED":         90,
+	"STILL_RUNNING":         91,
+	"CANT_REREAD":           92,
+}
+
+// Fault is an XML-RPC fault returned by the server. It is formatted as Supervisor formats its
+// faults, with the fault name followed by the detail.
+type Fault struct {
+	Code   int
+	Name   string
+	Detail string
+}
+
+// newFault creates a fault by name. Unknown names are given the FAILED code.
+func newFault(name string, detail string) Fault {
+	code, ok := faultCodes[name]
+	if !ok {
+		code = faultCodes["FAILED"]
+	}
+	return Fault{code, name, detail}
+}
+
+func (fault Fault) Error() string {
+	if fault.Detail == "" {
+		return fault.Name
+	}
+	return fault.Name + ": " + fault.Detail
+}
+
+// xmlValue is an XML-RPC value as it appears on the wire.
+type xmlValue struct {
+	String   *string     `xml:"string"`
+	Int      *string     `xml:"int"`
+	I4       *string     `xml:"i4"`
+	I8       *string     `xml:"i8"`
+	Boolean  *string     `xml:"boolean"`
+	Double   *string     `xml:"double"`
+	Base64   *string     `xml:"base64"`
+	DateTime *string     `xml:"dateTime.iso8601"`
+	Nil      *struct{}   `xml:"nil"`
+	Array    *xmlArray   `xml:"array"`
+	Struct   *xmlStruct  `xml:"struct"`
+	Text     string      `xml:",chardata"`
+	Other    []xmlAnyTag `xml:",any"`
+}
+
+type xmlAnyTag struct {
+	XMLName xml.Name
+}
+
+type xmlArray struct {
+	Values []xmlValue `xml:"data>value"`
+}
+
+type xmlStruct struct {
+	Members []xmlMember `xml:"member"`
+}
+
+type xmlMember struct {
+	Name  string   `xml:"name"`
+	Value xmlValue `xml:"value"`
+}
+
+type xmlCall struct {
+	Method string     `xml:"methodName"`
+	Params []xmlValue `xml:"params>param>value"`
+}
+
+// decode converts a wire value to a Go value. Integers are int64, arrays []interface{} and structs
+// map[string]interface{}.
+func (value xmlValue) decode() (interface{}, error) {
+	parseInt := func(text string) (interface{}, error) {
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	}
+	switch {
+	case value.String != nil:
+		return *value.String, nil
+	case value.Int != nil:
+		return parseInt(*value.Int)
+	case value.I4 != nil:
+		return parseInt(*value.I4)
+	case value.I8 != nil:
+		return parseInt(*value.I8)
+	case value.Boolean != nil:
+		switch strings.TrimSpace(*value.Boolean) {
+		case "1":
+			return true, nil
+		case "0":
+			return false, nil
+		}
+		return nil, errors.New("invalid boolean " + *value.Boolean)
+	case value.Double != nil:
+		return strconv.ParseFloat(strings.TrimSpace(*value.Double), 64)
+	case value.Base64 != nil:
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(*value.Base64))
+	case value.DateTime != nil:
+		return strings.TrimSpace(*value.DateTime), nil
+	case value.Nil != nil:
+		return nil, nil
+	case value.Array != nil:
+		items := make([]interface{}, len(value.Array.Values))
+		for i, item := range value.Array.Values {
+			var err error
+			if items[i], err = item.decode(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case value.Struct != nil:
+		members := make(map[string]interface{}, len(value.Struct.Members))
+		for _, member := range value.Struct.Members {
+			item, err := member.Value.decode()
+			if err != nil {
+				return nil, err
+			}
+			members[member.Name] = item
+		}
+		return members, nil
+	case len(value.Other) > 0:
+		return nil, errors.New("unsupported value type " + value.Other[0].XMLName.Local)
+	}
+	return value.Text, nil
+}
+
+// decodeCall parses an XML-RPC method call.
+func decodeCall(body []byte) (method string, args []interface{}, err error) {
+	call := xmlCall{}
+	if err = xml.Unmarshal(body, &call); err != nil {
+		return
+	}
+	if call.Method == "" {
+		err = errors.New("missing methodName")
+		return
+	}
+	args = make([]interface{}, len(call.Params))
+	for i, param := range call.Params {
+		if args[i], err = param.decode(); err != nil {
+			return
+		}
+	}
+	return call.Method, args, nil
+}
+
+// encodeValue writes a Go value as an XML-RPC value. Struct members are written in sorted order.
+func encodeValue(buf *bytes.Buffer, value interface{}) {
+	buf.WriteString("<value>")
+	switch value := value.(type) {
+	case string:
+		buf.WriteString("<string>")
+		xml.EscapeText(buf, []byte(value))
+		buf.WriteString("</string>")
+	case bool:
+		if value {
+			buf.WriteString("<boolean>1</boolean>")
+		} else {
+			buf.WriteString("<boolean>0</boolean>")
+		}
+	case int:
+		fmt.Fprintf(buf, "<int>%d</int>", value)
+	case int64:
+		fmt.Fprintf(buf, "<int>%d</int>", value)
+	case float64:
+		fmt.Fprintf(buf, "<double>%s</double>", strconv.FormatFloat(value, 'f', -1, 64))
+	case []byte:
+		fmt.Fprintf(buf, "<base64>%s</base64>", base64.StdEncoding.EncodeToString(value))
+	case []string:
+		buf.WriteString("<array><data>")
+		for _, item := range value {
+			encodeValue(buf, item)
+		}
+		buf.WriteString("</data></array>")
+	case []interface{}:
+		buf.WriteString("<array><data>")
+		for _, item := range value {
+			encodeValue(buf, item)
+		}
+		buf.WriteString("</data></array>")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteString("<struct>")
+		for _, key := range keys {
+			buf.WriteString("<member><name>")
+			xml.EscapeText(buf, []byte(key))
+			buf.WriteString("</name>")
+			encodeValue(buf, value[key])
+			buf.WriteString("</member>")
+		}
+		buf.WriteString("</struct>")
+	default:
+		buf.WriteString("<nil/>")
+	}
+	buf.WriteString("</value>")
+}
+
+// encodeResponse writes an XML-RPC method response for a result or fault.
+func encodeResponse(result interface{}, err error) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`<?xml version="1.0"?>` + "\n<methodResponse>")
+	if err != nil {
+		fault, ok := err.(Fault)
+		if !ok {
+			fault = newFault("FAILED", err.Error())
+		}
+		buf.WriteString("<fault>")
+		encodeValue(buf, map[string]interface{}{"faultCode": fault.Code, "faultString": fault.Error()})
+		buf.WriteString("</fault>")
+	} else {
+		buf.WriteString("<params><param>")
+		encodeValue(buf, result)
+		buf.WriteString("</param></params>")
+	}
+	buf.WriteString("</methodResponse>\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,166 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kinds of configuration change applied by Update.
+const (
+	ChangeAdded   string = "added"
+	ChangeChanged string = "changed"
+	ChangeRemoved string = "removed"
+)
+
+// GroupUpdate is the outcome of applying a configuration change to a process group. Steps lists the
+// actions which were taken, or would be taken in a dry run, in order.
+type GroupUpdate struct {
+	Name   string
+	Change string
+	Steps  []string
+	Error  error
+}
+
+func (update GroupUpdate) String() string {
+	if update.Error != nil {
+		return fmt.Sprintf("%s: ERROR (%s)", update.Name, update.Error)
+	}
+	lines := make([]string, 0, len(update.Steps))
+	for _, step := range update.Steps {
+		switch step {
+		case ActionStop:
+			lines = append(lines, update.Name+": stopped")
+		case ActionRemoveGroup:
+			if update.Change == ChangeRemoved {
+				lines = append(lines, update.Name+": removed process group")
+			}
+		case ActionAddGroup:
+			if update.Change == ChangeChanged {
+				lines = append(lines, update.Name+": updated process group")
+			} else {
+				lines = append(lines, update.Name+": added process group")
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// UpdateReport describes the configuration changes found and applied by Update.
+type UpdateReport struct {
+	ConfigChanges
+	DryRun bool
+	Groups []GroupUpdate
+}
+
+// Failed returns the group updates which failed.
+func (report UpdateReport) Failed() []GroupUpdate {
+	var failed []GroupUpdate
+	for _, update := range report.Groups {
+		if update.Error != nil {
+			failed = append(failed, update)
+		}
+	}
+	return failed
+}
+
+func (report UpdateReport) String() string {
+	lines := make([]string, 0, len(report.Groups))
+	for _, update := range report.Groups {
+		if line := update.String(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// run a single step of a group update
+func (client Client) updateStep(name string, step string) error {
+	switch step {
+	case ActionStop:
+		statuses, err := client.StopProcessGroup(name, true)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if code := FaultCodeName(status.Status); code != FaultSuccess && code != FaultNotRunning {
+				return errors.New(fmt.Sprintf("failed to stop %s:%s: %s", status.Group, status.Name, status.Description))
+			}
+		}
+	case ActionRemoveGroup:
+		if ok, err := client.RemoveProcessGroup(name); err != nil {
+			return err
+		} else if !ok {
+			return errors.New(fmt.Sprintf("failed to remove process group %s", name))
+		}
+	case ActionAddGroup:
+		if ok, err := client.AddProcessGroup(name); err != nil {
+			return err
+		} else if !ok {
+			return errors.New(fmt.Sprintf("failed to add process group %s", name))
+		}
+	}
+	return nil
+}
+
+// Update rereads the Supervisor configuration and applies the changes the same way as
+// `supervisorctl update`. Removed groups are stopped and removed, changed groups are stopped,
+// removed, and added again, and new groups are added. If groups are named then only changes to
+// those groups are applied. When dryRun is true the steps are reported but not taken. An error is
+// returned only if Supervisor could not be queried; per group failures are recorded in the report.
+func (client Client) Update(dryRun bool, groups ...string) (report UpdateReport, err error) {
+	report.DryRun = dryRun
+	if report.ConfigChanges, err = client.ReloadConfig(); err != nil {
+		return
+	}
+
+	selected := func(name string) bool {
+		return len(groups) == 0 || contains(groups, name)
+	}
+	changes := []struct {
+		change string
+		names  []string
+		steps  []string
+	}{
+		{ChangeRemoved, report.Removed, []string{ActionStop, ActionRemoveGroup}},
+		{ChangeChanged, report.Changed, []string{ActionStop, ActionRemoveGroup, ActionAddGroup}},
+		{ChangeAdded, report.Added, []string{ActionAddGroup}},
+	}
+
+	found := make(map[string]bool)
+	for _, change := range changes {
+		for _, name := range change.names {
+			found[name] = true
+			if !selected(name) {
+				continue
+			}
+			update := GroupUpdate{Name: name, Change: change.change}
+			for _, step := range change.steps {
+				if !dryRun {
+					if update.Error = client.updateStep(name, step); update.Error != nil {
+						break
+					}
+				}
+				update.Steps = append(update.Steps, step)
+			}
+			report.Groups = append(report.Groups, update)
+		}
+	}
+
+	// named groups without changes must at least exist
+	if len(groups) > 0 {
+		var allInfo []ProcessInfo
+		if allInfo, err = client.GetAllProcessInfo(); err != nil {
+			return
+		}
+		for _, info := range allInfo {
+			found[info.Group] = true
+		}
+	}
+	for _, name := range groups {
+		if !found[name] {
+			report.Groups = append(report.Groups, GroupUpdate{Name: name, Error: errors.New("no such group")})
+		}
+	}
+	return
+}
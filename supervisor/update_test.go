@@ -0,0 +1,64 @@
+package supervisor
+
+import (
+	"github.com/rynbrd/go-supervisor/supervisor/supervisortest"
+	"testing"
+)
+
+// Test applying configuration changes with Update.
+func TestUpdate(t *testing.T) {
+	server := newTestServer(t, supervisortest.Programs("web:api", "old:job", "cron")...)
+	server.SetState("web:api", Running)
+	server.SetState("old:job", Running)
+	server.Configure(supervisortest.Programs("cron", "web:api", "web:worker", "batch:runner")...)
+	client := testClient(t, server)
+
+	report, err := client.Update(true)
+	if err != nil {
+		t.Fatalf(`Client.Update(dryRun=true) => error{"%v"}, want nil`, err)
+	}
+	if actions := actions(server); len(actions) != 0 {
+		t.Errorf(`Client.Update(dryRun=true) called %v, want nothing`, actions)
+	}
+	want := "old: stopped\nold: removed process group\nweb: stopped\nweb: updated process group\nbatch: added process group"
+	if out := report.String(); out != want {
+		t.Errorf("UpdateReport.String() =>\n%s\nwant\n%s", out, want)
+	}
+
+	report, err = client.Update(false, "web", "old", "cron", "missing")
+	if err != nil {
+		t.Fatalf(`Client.Update() => error{"%v"}, want nil`, err)
+	}
+	wantActions := []string{"stopgroup old", "remove old", "stopgroup web", "remove web", "add web"}
+	if actions := actions(server); !cmpStrings(actions, wantActions) {
+		t.Errorf(`Client.Update() called %v, want %v`, actions, wantActions)
+	}
+	if failed := report.Failed(); len(failed) != 1 || failed[0].Name != "missing" {
+		t.Errorf(`UpdateReport.Failed() => %v, want failure for missing`, failed)
+	}
+	if state := server.State("web:worker"); state != Stopped {
+		t.Errorf(`state of web:worker => "%s", want "STOPPED"`, state)
+	}
+	if state := server.State("old:job"); state != "" {
+		t.Errorf(`state of old:job => "%s", want removed`, state)
+	}
+	if state := server.State("batch:runner"); state != "" {
+		t.Errorf(`state of batch:runner => "%s", want not added`, state)
+	}
+}
+
+// Test that a failed step is recorded for the group.
+func TestUpdateFailure(t *testing.T) {
+	server := newTestServer(t)
+	server.Configure(supervisortest.Programs("batch:runner")...)
+	server.SetFault("supervisor.addProcessGroup", "BAD_NAME", 0)
+	client := testClient(t, server)
+
+	report, err := client.Update(false)
+	if err != nil {
+		t.Fatalf(`Client.Update() => error{"%v"}, want nil`, err)
+	}
+	if failed := report.Failed(); len(failed) != 1 || !IsFault(failed[0].Error, FaultBadName) {
+		t.Errorf(`UpdateReport.Failed() => %v, want BAD_NAME for batch`, failed)
+	}
+}
@@ -0,0 +1,147 @@
+package supervisor
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// WebSocket opcodes.
+const (
+	wsText  byte = 0x1
+	wsClose byte = 0x8
+	wsPing  byte = 0x9
+	wsPong  byte = 0xa
+)
+
+const (
+	wsGUID string = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// largest frame accepted from a client, clients are only expected to send control frames
+	wsMaxPayload int64 = 4096
+)
+
+// headerContains returns true if a comma separated header contains the token.
+func headerContains(header http.Header, key string, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(key)] {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isWebSocket returns true if the request asks to be upgraded to a WebSocket.
+func isWebSocket(request *http.Request) bool {
+	return headerContains(request.Header, "Connection", "upgrade") &&
+		headerContains(request.Header, "Upgrade", "websocket")
+}
+
+// wsAccept returns the Sec-WebSocket-Accept value for a key.
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// upgradeWebSocket completes the WebSocket handshake and takes over the connection. An error
+// response has been written when an error is returned.
+func upgradeWebSocket(writer http.ResponseWriter, request *http.Request) (conn net.Conn, rw *bufio.ReadWriter, err error) {
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if request.Method != http.MethodGet || key == "" || request.Header.Get("Sec-WebSocket-Version") != "13" {
+		writer.Header().Set("Sec-WebSocket-Version", "13")
+		err = errors.New("invalid websocket handshake")
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := writer.(http.Hijacker)
+	if !ok {
+		err = errors.New("websocket not supported")
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if conn, rw, err = hijacker.Hijack(); err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", wsAccept(key))
+	if err = rw.Flush(); err != nil {
+		conn.Close()
+	}
+	return
+}
+
+// writeWebSocketFrame writes a single unmasked frame as a server does.
+func writeWebSocketFrame(writer io.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xffff:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	if _, err := writer.Write(header); err != nil {
+		return err
+	}
+	_, err := writer.Write(payload)
+	return err
+}
+
+// readWebSocketFrame reads a single frame and unmasks its payload.
+func readWebSocketFrame(reader *bufio.Reader) (opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		return
+	}
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err = io.ReadFull(reader, extended); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err = io.ReadFull(reader, extended); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(extended))
+	}
+	if length < 0 || length > wsMaxPayload {
+		err = errors.New(fmt.Sprintf("websocket frame of %d bytes is too large", length))
+		return
+	}
+
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err = io.ReadFull(reader, mask); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(reader, payload); err != nil {
+		return
+	}
+	for i := range mask {
+		for j := i; j < len(payload); j += 4 {
+			payload[j] ^= mask[i]
+		}
+	}
+	return
+}